@@ -318,8 +318,9 @@ func (m *Manager) getWatchHistory(mediaId int) (ret *WatchHistoryItem, exists bo
 
 	if exists && ret != nil && ret.Duration > 0 {
 		// If the item completion ratio is equal or above IgnoreRatioThreshold, don't return anything
+		// The same goes for an episode stopped during its credits
 		ratio := ret.CurrentTime / ret.Duration
-		if ratio >= IgnoreRatioThreshold {
+		if ratio >= IgnoreRatioThreshold || m.IsInCredits(ret.Filepath, ret.CurrentTime) {
 			// Delete the item
 			go func() {
 				defer util.HandlePanicInModuleThen("continuity/getWatchHistory", func() {})
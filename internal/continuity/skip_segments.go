@@ -0,0 +1,36 @@
+package continuity
+
+import (
+	"seanime/internal/database/models"
+)
+
+// GetSkipSegments returns the intro and credits of a file, ordered by start time.
+// The segments are detected by the skipdetector module.
+func (m *Manager) GetSkipSegments(filepath string) []*models.SkipSegment {
+	if m == nil || m.db == nil || filepath == "" {
+		return nil
+	}
+
+	segments, err := m.db.GetSkipSegmentsByPath(filepath)
+	if err != nil {
+		return nil
+	}
+	return segments
+}
+
+// GetCreditsStartTime returns the time in seconds at which the credits of a file start.
+func (m *Manager) GetCreditsStartTime(filepath string) (float64, bool) {
+	for _, s := range m.GetSkipSegments(filepath) {
+		if s.Type == models.SkipSegmentTypeCredits {
+			return s.StartTime, true
+		}
+	}
+	return 0, false
+}
+
+// IsInCredits returns true if the playback of the file has reached its credits.
+// The episode can be considered watched, even if the completion threshold hasn't been reached.
+func (m *Manager) IsInCredits(filepath string, currentTime float64) bool {
+	start, found := m.GetCreditsStartTime(filepath)
+	return found && currentTime >= start
+}
@@ -0,0 +1,50 @@
+package continuity
+
+import (
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"seanime/internal/util"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchHistoryItem_InCredits(t *testing.T) {
+	database, err := db.NewDatabase(t.TempDir(), "seanime-test", util.NewLogger())
+	require.NoError(t, err)
+	manager := GetMockManager(t, database)
+
+	path := "/Anime/Show/Show - 01.mkv"
+	require.NoError(t, database.ReplaceSkipSegments(1, path, []*models.SkipSegment{
+		{Type: models.SkipSegmentTypeIntro, StartTime: 60, EndTime: 150},
+		{Type: models.SkipSegmentTypeCredits, StartTime: 1290, EndTime: 1380},
+	}))
+
+	// The stored path is normalized
+	assert.True(t, manager.IsInCredits("/anime/show/Show - 01.mkv", 1300))
+	assert.False(t, manager.IsInCredits(path, 1200))
+
+	err = manager.UpdateWatchHistoryItem(&UpdateWatchHistoryItemOptions{
+		MediaId:       1,
+		EpisodeNumber: 1,
+		Filepath:      path,
+		CurrentTime:   1200,
+		Duration:      1420,
+		Kind:          MediastreamKind,
+	})
+	require.NoError(t, err)
+	assert.True(t, manager.GetWatchHistoryItem(1).Found)
+
+	// Stopped during the credits, the episode is considered watched
+	err = manager.UpdateWatchHistoryItem(&UpdateWatchHistoryItemOptions{
+		MediaId:       1,
+		EpisodeNumber: 1,
+		Filepath:      path,
+		CurrentTime:   1300,
+		Duration:      1420,
+		Kind:          MediastreamKind,
+	})
+	require.NoError(t, err)
+	assert.False(t, manager.GetWatchHistoryItem(1).Found)
+}
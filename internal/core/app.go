@@ -21,6 +21,8 @@ import (
 	"seanime/internal/library/fillermanager"
 	"seanime/internal/library/playbackmanager"
 	"seanime/internal/library/scanner"
+	"seanime/internal/library/skipdetector"
+	"seanime/internal/library/torrentwatcher"
 	"seanime/internal/manga"
 	"seanime/internal/mediaplayers/mediaplayer"
 	"seanime/internal/mediaplayers/mpchc"
@@ -58,6 +60,7 @@ type (
 		LocalPlatform                 platform.Platform
 		SyncManager                   sync2.Manager
 		FillerManager                 *fillermanager.FillerManager
+		SkipDetector                  *skipdetector.SkipDetector
 		WSEventManager                *events.WSEventManager
 		AutoDownloader                *autodownloader.AutoDownloader
 		ExtensionRepository           *extension_repo.Repository
@@ -72,6 +75,7 @@ type (
 		Updater                 *updater.Updater
 		Settings                *models.Settings
 		AutoScanner             *autoscanner.AutoScanner
+		TorrentWatcher          *torrentwatcher.Watcher
 		PlaybackManager         *playbackmanager.PlaybackManager
 		FileCacher              *filecache.Cacher
 		OnlinestreamRepository  *onlinestream.Repository
@@ -271,10 +275,12 @@ func NewApp(configOpts *ConfigOptions, selfupdater *updater.SelfUpdater) *App {
 		ReportRepository:              report.NewRepository(logger),
 		TorrentRepository:             nil, // Initialized in App.initModulesOnce
 		FillerManager:                 nil, // Initialized in App.initModulesOnce
+		SkipDetector:                  nil, // Initialized in App.initModulesOnce
 		MangaDownloader:               nil, // Initialized in App.initModulesOnce
 		PlaybackManager:               nil, // Initialized in App.initModulesOnce
 		AutoDownloader:                nil, // Initialized in App.initModulesOnce
 		AutoScanner:                   nil, // Initialized in App.initModulesOnce
+		TorrentWatcher:                nil, // Initialized in App.initModulesOnce
 		MediastreamRepository:         nil, // Initialized in App.initModulesOnce
 		TorrentstreamRepository:       nil, // Initialized in App.initModulesOnce
 		ContinuityManager:             nil, // Initialized in App.initModulesOnce
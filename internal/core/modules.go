@@ -12,6 +12,8 @@ import (
 	"seanime/internal/library/autoscanner"
 	"seanime/internal/library/fillermanager"
 	"seanime/internal/library/playbackmanager"
+	"seanime/internal/library/skipdetector"
+	"seanime/internal/library/torrentwatcher"
 	"seanime/internal/manga"
 	"seanime/internal/mediaplayers/mediaplayer"
 	"seanime/internal/mediaplayers/mpchc"
@@ -19,7 +21,10 @@ import (
 	"seanime/internal/mediaplayers/vlc"
 	"seanime/internal/mediastream"
 	"seanime/internal/notifier"
+	"seanime/internal/torrent_clients/aria2"
+	"seanime/internal/torrent_clients/deluge"
 	"seanime/internal/torrent_clients/qbittorrent"
+	"seanime/internal/torrent_clients/rtorrent"
 	"seanime/internal/torrent_clients/torrent_client"
 	"seanime/internal/torrent_clients/transmission"
 	"seanime/internal/torrents/torrent"
@@ -56,6 +61,16 @@ func (a *App) initModulesOnce() {
 		Logger: a.Logger,
 	})
 
+	// +---------------------+
+	// |    Skip segments    |
+	// +---------------------+
+
+	a.SkipDetector = skipdetector.New(&skipdetector.NewSkipDetectorOptions{
+		DB:             a.Database,
+		Logger:         a.Logger,
+		WSEventManager: a.WSEventManager,
+	})
+
 	// +---------------------+
 	// |     Continuity      |
 	// +---------------------+
@@ -107,6 +122,21 @@ func (a *App) initModulesOnce() {
 		TorrentRepository: a.TorrentRepository,
 	})
 
+	// +---------------------+
+	// |   Torrent Watcher   |
+	// +---------------------+
+
+	a.TorrentWatcher = torrentwatcher.New(&torrentwatcher.NewWatcherOptions{
+		Logger:           a.Logger,
+		Database:         a.Database,
+		WSEventManager:   a.WSEventManager,
+		Platform:         a.AnilistPlatform,
+		MetadataProvider: a.MetadataProvider,
+	})
+
+	// This is run in a goroutine
+	a.TorrentWatcher.Start()
+
 	// +---------------------+
 	// |   Auto Downloader   |
 	// +---------------------+
@@ -119,6 +149,8 @@ func (a *App) initModulesOnce() {
 		WSEventManager:          a.WSEventManager,
 		MetadataProvider:        a.MetadataProvider,
 		DebridClientRepository:  a.DebridClientRepository,
+		Platform:                a.AnilistPlatform,
+		TorrentWatcher:          a.TorrentWatcher,
 	})
 
 	if !a.IsOffline() {
@@ -169,6 +201,7 @@ func (a *App) initModulesOnce() {
 		Logger:         a.Logger,
 		WSEventManager: a.WSEventManager,
 		FileCacher:     a.FileCacher,
+		Database:       a.Database,
 	})
 
 	a.AddCleanupFunction(func() {
@@ -322,6 +355,29 @@ func (a *App) InitOrRefreshModules() {
 		if err != nil && settings.Torrent.TransmissionUsername != "" && settings.Torrent.TransmissionPassword != "" { // Only log error if username and password are set
 			a.Logger.Error().Err(err).Msg("app: Failed to initialize transmission client")
 		}
+		// Init Deluge
+		del := deluge.New(&deluge.NewDelugeOptions{
+			Logger:   a.Logger,
+			Password: settings.Torrent.DelugePassword,
+			Host:     settings.Torrent.DelugeHost,
+			Port:     settings.Torrent.DelugePort,
+		})
+		// Init rTorrent
+		rtor := rtorrent.New(&rtorrent.NewRTorrentOptions{
+			Logger:   a.Logger,
+			Host:     settings.Torrent.RTorrentHost,
+			Port:     settings.Torrent.RTorrentPort,
+			Username: settings.Torrent.RTorrentUsername,
+			Password: settings.Torrent.RTorrentPassword,
+			RPCPath:  settings.Torrent.RTorrentRPCPath,
+		})
+		// Init aria2
+		ar := aria2.New(&aria2.NewAria2Options{
+			Logger: a.Logger,
+			Host:   settings.Torrent.Aria2Host,
+			Port:   settings.Torrent.Aria2Port,
+			Secret: settings.Torrent.Aria2Secret,
+		})
 
 		if a.TorrentClientRepository != nil {
 			a.TorrentClientRepository.Shutdown()
@@ -332,6 +388,9 @@ func (a *App) InitOrRefreshModules() {
 			Logger:            a.Logger,
 			QbittorrentClient: qbit,
 			Transmission:      trans,
+			Deluge:            del,
+			RTorrent:          rtor,
+			Aria2:             ar,
 			TorrentRepository: a.TorrentRepository,
 			Provider:          settings.Torrent.Default,
 			MetadataProvider:  a.MetadataProvider,
@@ -341,6 +400,12 @@ func (a *App) InitOrRefreshModules() {
 
 		// Set AutoDownloader qBittorrent client
 		a.AutoDownloader.SetTorrentClientRepository(a.TorrentClientRepository)
+
+		// Set the torrent client used to watch the completion of tracked torrents
+		a.TorrentWatcher.SetTorrentClientRepository(a.TorrentClientRepository)
+
+		// Set the aria2 client used for debrid downloads
+		a.DebridClientRepository.SetAria2Client(ar)
 	} else {
 		a.Logger.Warn().Msg("app: Did not initialize torrent client module, no settings found")
 	}
@@ -416,6 +481,12 @@ func (a *App) InitOrRefreshMediastreamSettings() {
 
 	a.MediastreamRepository.InitializeModules(settings, a.Config.Cache.Dir, a.Config.Cache.TranscodeDir)
 
+	// The skip detector decodes the audio with the same FFmpeg installation
+	a.SkipDetector.SetSettings(&skipdetector.Settings{
+		FfmpegPath:  settings.FfmpegPath,
+		FfprobePath: settings.FfprobePath,
+	})
+
 	// Cleanup cache
 	go func() {
 		if settings.TranscodeEnabled {
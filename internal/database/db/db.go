@@ -77,6 +77,7 @@ func migrateTables(db *gorm.DB) error {
 		&models.ScanSummary{},
 		&models.AutoDownloaderRule{},
 		&models.AutoDownloaderItem{},
+		&models.AutoDownloaderRuleTemplate{},
 		&models.SilencedMediaEntry{},
 		&models.Theme{},
 		&models.PlaylistEntry{},
@@ -89,6 +90,12 @@ func migrateTables(db *gorm.DB) error {
 		&models.OnlinestreamMapping{},
 		&models.DebridSettings{},
 		&models.DebridTorrentItem{},
+		&models.DebridDownload{},
+		&models.TorrentstreamCacheEntry{},
+		&models.TrackedTorrent{},
+		&models.SkipSegment{},
+		&models.MediastreamOptimizationTask{},
+		&models.MediastreamMediaInfoEntry{},
 		//&models.MangaChapterContainer{},
 	)
 	if err != nil {
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+)
+
+// GetDebridDownloads returns the downloads in queue order.
+func (db *Database) GetDebridDownloads() ([]*models.DebridDownload, error) {
+	var res []*models.DebridDownload
+	err := db.gormdb.Order("position asc, id asc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (db *Database) GetDebridDownload(id uint) (*models.DebridDownload, error) {
+	var res models.DebridDownload
+	err := db.gormdb.First(&res, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (db *Database) GetDebridDownloadsByTorrentItemId(tId string) ([]*models.DebridDownload, error) {
+	var res []*models.DebridDownload
+	err := db.gormdb.Where("torrent_item_id = ?", tId).Order("position asc, id asc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (db *Database) InsertDebridDownloads(items []*models.DebridDownload) error {
+	if len(items) == 0 {
+		return nil
+	}
+	return db.gormdb.Create(items).Error
+}
+
+func (db *Database) SaveDebridDownload(item *models.DebridDownload) error {
+	return db.gormdb.Save(item).Error
+}
+
+// UpdateDebridDownloadProgress only updates the progress columns, it does nothing if the download was deleted.
+func (db *Database) UpdateDebridDownloadProgress(id uint, downloadedBytes int64, totalSize int64) error {
+	return db.gormdb.Model(&models.DebridDownload{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"downloaded_bytes": downloadedBytes,
+		"total_size":       totalSize,
+	}).Error
+}
+
+func (db *Database) UpdateDebridDownloadPosition(id uint, position int) error {
+	return db.gormdb.Model(&models.DebridDownload{}).Where("id = ?", id).Update("position", position).Error
+}
+
+func (db *Database) DeleteDebridDownload(id uint) error {
+	return db.gormdb.Delete(&models.DebridDownload{}, id).Error
+}
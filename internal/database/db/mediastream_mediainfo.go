@@ -0,0 +1,78 @@
+package db
+
+import (
+	"errors"
+	"seanime/internal/database/models"
+	"seanime/internal/util"
+
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+)
+
+// GetMediastreamMediaInfoEntries returns the media information of the indexed files.
+func (db *Database) GetMediastreamMediaInfoEntries() ([]*models.MediastreamMediaInfoEntry, error) {
+	var res []*models.MediastreamMediaInfoEntry
+	err := db.gormdb.Order("path asc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetMediastreamMediaInfoEntryByPath returns the indexed media information of a file, or nil if it hasn't been indexed.
+func (db *Database) GetMediastreamMediaInfoEntryByPath(path string) (*models.MediastreamMediaInfoEntry, error) {
+	var res models.MediastreamMediaInfoEntry
+	err := db.gormdb.Where("path = ?", util.NormalizePath(path)).First(&res).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// UpsertMediastreamMediaInfoEntry inserts the media information of a file, or replaces the existing one.
+// The path is stored normalized.
+func (db *Database) UpsertMediastreamMediaInfoEntry(entry *models.MediastreamMediaInfoEntry) error {
+	entry.Path = util.NormalizePath(entry.Path)
+	existing, err := db.GetMediastreamMediaInfoEntryByPath(entry.Path)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		entry.ID = existing.ID
+		entry.CreatedAt = existing.CreatedAt
+	}
+	return db.gormdb.Save(entry).Error
+}
+
+// DeleteMediastreamMediaInfoEntriesExcept removes the files that are no longer in the library from the index.
+func (db *Database) DeleteMediastreamMediaInfoEntriesExcept(paths []string) error {
+	if len(paths) == 0 {
+		return db.gormdb.Where("1 = 1").Delete(&models.MediastreamMediaInfoEntry{}).Error
+	}
+	// Done in Go since SQLite limits the number of query parameters
+	entries, err := db.GetMediastreamMediaInfoEntries()
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		keep[util.NormalizePath(p)] = struct{}{}
+	}
+	ids := make([]uint, 0)
+	for _, entry := range entries {
+		if _, found := keep[entry.Path]; !found {
+			ids = append(ids, entry.ID)
+		}
+	}
+	for _, chunk := range lo.Chunk(ids, 500) {
+		if err := db.gormdb.Delete(&models.MediastreamMediaInfoEntry{}, chunk).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"errors"
+	"seanime/internal/database/models"
+
+	"gorm.io/gorm"
+)
+
+// GetMediastreamOptimizationTasks returns the tasks of the optimization queue, from the oldest.
+func (db *Database) GetMediastreamOptimizationTasks() ([]*models.MediastreamOptimizationTask, error) {
+	var res []*models.MediastreamOptimizationTask
+	err := db.gormdb.Order("id asc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetNextMediastreamOptimizationTask returns the oldest pending task, or nil if there is none.
+func (db *Database) GetNextMediastreamOptimizationTask() (*models.MediastreamOptimizationTask, error) {
+	var res models.MediastreamOptimizationTask
+	err := db.gormdb.Where("status = ?", models.MediastreamOptimizationStatusPending).Order("id asc").First(&res).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (db *Database) GetMediastreamOptimizationTask(id uint) (*models.MediastreamOptimizationTask, error) {
+	var res models.MediastreamOptimizationTask
+	err := db.gormdb.First(&res, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// GetMediastreamOptimizationTaskByPath returns the latest task of a file.
+func (db *Database) GetMediastreamOptimizationTaskByPath(path string) (*models.MediastreamOptimizationTask, error) {
+	var res models.MediastreamOptimizationTask
+	err := db.gormdb.Where("path = ?", path).Order("id desc").First(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (db *Database) InsertMediastreamOptimizationTask(task *models.MediastreamOptimizationTask) error {
+	return db.gormdb.Create(task).Error
+}
+
+func (db *Database) UpdateMediastreamOptimizationTask(task *models.MediastreamOptimizationTask) error {
+	return db.gormdb.Save(task).Error
+}
+
+func (db *Database) DeleteMediastreamOptimizationTask(id uint) error {
+	return db.gormdb.Delete(&models.MediastreamOptimizationTask{}, id).Error
+}
+
+// ResetRunningMediastreamOptimizationTasks marks the tasks that were interrupted as pending.
+func (db *Database) ResetRunningMediastreamOptimizationTasks() error {
+	return db.gormdb.Model(&models.MediastreamOptimizationTask{}).
+		Where("status = ?", models.MediastreamOptimizationStatusRunning).
+		Update("status", models.MediastreamOptimizationStatusPending).Error
+}
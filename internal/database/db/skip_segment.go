@@ -0,0 +1,52 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+	"seanime/internal/util"
+
+	"gorm.io/gorm"
+)
+
+// GetSkipSegmentsByPath returns the skip segments of a file, ordered by start time.
+func (db *Database) GetSkipSegmentsByPath(path string) ([]*models.SkipSegment, error) {
+	var res []*models.SkipSegment
+	err := db.gormdb.Where("path = ?", util.NormalizePath(path)).Order("start_time asc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (db *Database) GetSkipSegmentsByMediaId(mediaId int) ([]*models.SkipSegment, error) {
+	var res []*models.SkipSegment
+	err := db.gormdb.Where("media_id = ?", mediaId).Order("path asc, start_time asc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ReplaceSkipSegments replaces the skip segments of a file.
+// The path is stored normalized.
+func (db *Database) ReplaceSkipSegments(mediaId int, path string, segments []*models.SkipSegment) error {
+	path = util.NormalizePath(path)
+	return db.gormdb.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("path = ?", path).Delete(&models.SkipSegment{}).Error; err != nil {
+			return err
+		}
+		for _, s := range segments {
+			s.MediaId = mediaId
+			s.Path = path
+			if err := tx.Create(s).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *Database) DeleteSkipSegmentsByMediaId(mediaId int) error {
+	return db.gormdb.Where("media_id = ?", mediaId).Delete(&models.SkipSegment{}).Error
+}
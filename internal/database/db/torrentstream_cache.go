@@ -0,0 +1,50 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+	"time"
+)
+
+// GetTorrentstreamCacheEntries returns the cache entries from the least recently accessed.
+func (db *Database) GetTorrentstreamCacheEntries() ([]*models.TorrentstreamCacheEntry, error) {
+	var res []*models.TorrentstreamCacheEntry
+	err := db.gormdb.Order("last_accessed_at asc, id asc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (db *Database) GetTorrentstreamCacheEntry(id uint) (*models.TorrentstreamCacheEntry, error) {
+	var res models.TorrentstreamCacheEntry
+	err := db.gormdb.First(&res, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (db *Database) GetTorrentstreamCacheEntryByEpisode(mediaId int, episodeNumber int) (*models.TorrentstreamCacheEntry, error) {
+	var res models.TorrentstreamCacheEntry
+	err := db.gormdb.Where("media_id = ? AND episode_number = ?", mediaId, episodeNumber).First(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (db *Database) InsertTorrentstreamCacheEntry(entry *models.TorrentstreamCacheEntry) error {
+	return db.gormdb.Create(entry).Error
+}
+
+// TouchTorrentstreamCacheEntry marks the entry as recently accessed.
+func (db *Database) TouchTorrentstreamCacheEntry(id uint) error {
+	return db.gormdb.Model(&models.TorrentstreamCacheEntry{}).Where("id = ?", id).Update("last_accessed_at", time.Now()).Error
+}
+
+func (db *Database) DeleteTorrentstreamCacheEntry(id uint) error {
+	return db.gormdb.Delete(&models.TorrentstreamCacheEntry{}, id).Error
+}
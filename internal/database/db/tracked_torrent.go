@@ -0,0 +1,40 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+)
+
+func (db *Database) GetTrackedTorrents() ([]*models.TrackedTorrent, error) {
+	var res []*models.TrackedTorrent
+	err := db.gormdb.Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// UpsertTrackedTorrent inserts the tracked torrent, replacing the one with the same hash.
+func (db *Database) UpsertTrackedTorrent(item *models.TrackedTorrent) error {
+	err := db.gormdb.Where("hash = ?", item.Hash).Delete(&models.TrackedTorrent{}).Error
+	if err != nil {
+		return err
+	}
+	return db.gormdb.Create(item).Error
+}
+
+func (db *Database) MarkTrackedTorrentImported(hash string) error {
+	return db.gormdb.Model(&models.TrackedTorrent{}).Where("hash = ?", hash).Update("imported", true).Error
+}
+
+// UpdateTrackedTorrentImportError records a failed import, the import is retried on the next poll.
+func (db *Database) UpdateTrackedTorrentImportError(hash string, importError string, attempts int) error {
+	return db.gormdb.Model(&models.TrackedTorrent{}).Where("hash = ?", hash).Updates(map[string]interface{}{
+		"import_error":    importError,
+		"import_attempts": attempts,
+	}).Error
+}
+
+func (db *Database) DeleteTrackedTorrentByHash(hash string) error {
+	return db.gormdb.Where("hash = ?", hash).Delete(&models.TrackedTorrent{}).Error
+}
@@ -6,11 +6,15 @@ import (
 	"seanime/internal/database/db"
 	"seanime/internal/database/models"
 	"seanime/internal/library/anime"
+	"sync"
 )
 
 var CurrLocalFilesDbId uint
 var CurrLocalFiles mo.Option[[]*anime.LocalFile]
 
+// localFilesMu serializes the writes of the local files, see UpdateLocalFiles.
+var localFilesMu sync.Mutex
+
 // GetLocalFiles will return the latest local files and the id of the entry.
 func GetLocalFiles(db *db.Database) ([]*anime.LocalFile, uint, error) {
 
@@ -40,8 +44,30 @@ func GetLocalFiles(db *db.Database) ([]*anime.LocalFile, uint, error) {
 	return lfs, res.ID, nil
 }
 
+// UpdateLocalFiles applies the changes to the latest local files and saves them.
+// The local files are read and saved under the same lock as the other saves, so that a concurrent save (e.g. a scan) is not overwritten.
+// Slow work should be done before calling this function.
+func UpdateLocalFiles(db *db.Database, update func(lfs []*anime.LocalFile) []*anime.LocalFile) ([]*anime.LocalFile, error) {
+	localFilesMu.Lock()
+	defer localFilesMu.Unlock()
+
+	lfs, lfsId, err := GetLocalFiles(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return saveLocalFiles(db, lfsId, update(lfs))
+}
+
 // SaveLocalFiles will save the local files in the database at the given id.
 func SaveLocalFiles(db *db.Database, lfsId uint, lfs []*anime.LocalFile) ([]*anime.LocalFile, error) {
+	localFilesMu.Lock()
+	defer localFilesMu.Unlock()
+
+	return saveLocalFiles(db, lfsId, lfs)
+}
+
+func saveLocalFiles(db *db.Database, lfsId uint, lfs []*anime.LocalFile) ([]*anime.LocalFile, error) {
 	// Marshal the local files
 	marshaledLfs, err := json.Marshal(lfs)
 	if err != nil {
@@ -73,6 +99,8 @@ func SaveLocalFiles(db *db.Database, lfsId uint, lfs []*anime.LocalFile) ([]*ani
 
 // InsertLocalFiles will insert the local files in the database at a new entry.
 func InsertLocalFiles(db *db.Database, lfs []*anime.LocalFile) ([]*anime.LocalFile, error) {
+	localFilesMu.Lock()
+	defer localFilesMu.Unlock()
 
 	// Marshal the local files
 	bytes, err := json.Marshal(lfs)
@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"strings"
 	"time"
@@ -92,17 +93,30 @@ func (o *LibrarySettings) GetLibraryPaths() (ret []string) {
 	return
 }
 
-type LibraryPaths []string
+type LibraryPaths = StringList
 
-func (o *LibraryPaths) Scan(src interface{}) error {
-	str, ok := src.(string)
-	if !ok {
+// StringList is a list of strings stored as comma-separated text.
+type StringList []string
+
+func (o *StringList) Scan(src interface{}) error {
+	var str string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
 		return errors.New("src value cannot cast to string")
 	}
+	if str == "" {
+		*o = nil
+		return nil
+	}
 	*o = strings.Split(str, ",")
 	return nil
 }
-func (o LibraryPaths) Value() (driver.Value, error) {
+func (o StringList) Value() (driver.Value, error) {
 	if len(o) == 0 {
 		return nil, nil
 	}
@@ -143,6 +157,23 @@ type TorrentSettings struct {
 	ShowActiveTorrentCount bool `gorm:"column:show_active_torrent_count" json:"showActiveTorrentCount"`
 	// v2.2+
 	HideTorrentList bool `gorm:"column:hide_torrent_list" json:"hideTorrentList"`
+	// v2.8+
+	DelugeHost       string `gorm:"column:deluge_host" json:"delugeHost"`
+	DelugePort       int    `gorm:"column:deluge_port" json:"delugePort"`
+	DelugePassword   string `gorm:"column:deluge_password" json:"delugePassword"`
+	RTorrentHost     string `gorm:"column:rtorrent_host" json:"rtorrentHost"` // Prefix with "scgi://" to connect over SCGI
+	RTorrentPort     int    `gorm:"column:rtorrent_port" json:"rtorrentPort"`
+	RTorrentUsername string `gorm:"column:rtorrent_username" json:"rtorrentUsername"`
+	RTorrentPassword string `gorm:"column:rtorrent_password" json:"rtorrentPassword"`
+	RTorrentRPCPath  string `gorm:"column:rtorrent_rpc_path" json:"rtorrentRpcPath"`
+	Aria2Host        string `gorm:"column:aria2_host" json:"aria2Host"`
+	Aria2Port        int    `gorm:"column:aria2_port" json:"aria2Port"`
+	Aria2Secret      string `gorm:"column:aria2_secret" json:"aria2Secret"`
+	// Seeding policy for torrents added by Seanime, can be overridden by AutoDownloader rules
+	SeedingPolicyAction     string  `gorm:"column:seeding_policy_action" json:"seedingPolicyAction"` // "", "stop" or "remove"
+	SeedingPolicyRatio      float64 `gorm:"column:seeding_policy_ratio" json:"seedingPolicyRatio"`   // 0 = no limit
+	SeedingPolicyTime       int     `gorm:"column:seeding_policy_time" json:"seedingPolicyTime"`     // Minutes, 0 = no limit
+	SeedingPolicyDeleteData bool    `gorm:"column:seeding_policy_delete_data" json:"seedingPolicyDeleteData"`
 }
 
 type ListSyncSettings struct {
@@ -195,6 +226,11 @@ type AutoDownloaderRule struct {
 	Value []byte `gorm:"column:value" json:"value"`
 }
 
+type AutoDownloaderRuleTemplate struct {
+	BaseModel
+	Value []byte `gorm:"column:value" json:"value"`
+}
+
 type AutoDownloaderItem struct {
 	BaseModel
 	RuleID      uint   `gorm:"column:rule_id" json:"ruleId"`
@@ -316,10 +352,105 @@ type MediastreamSettings struct {
 	FfprobePath                   string `gorm:"column:ffprobe_path" json:"ffprobePath"`
 	// v2.2+
 	TranscodeHwAccelCustomSettings string `gorm:"column:transcode_hw_accel_custom_settings" json:"transcodeHwAccelCustomSettings"`
+	// v2.8+
+	GenerateThumbnails    bool                         `gorm:"column:generate_thumbnails" json:"generateThumbnails"` // Generate the seek previews of a file on first play
+	PreTranscodeRules     MediastreamOptimizationRules `gorm:"column:pre_transcode_rules;type:text" json:"preTranscodeRules"`
+	PreTranscodeThreads   int                          `gorm:"column:pre_transcode_threads" json:"preTranscodeThreads"`      // CPU budget of the optimizer, 0 for half of the CPUs
+	PreTranscodeStartTime string                       `gorm:"column:pre_transcode_start_time" json:"preTranscodeStartTime"` // HH:MM, files are only optimized during the time window
+	PreTranscodeEndTime   string                       `gorm:"column:pre_transcode_end_time" json:"preTranscodeEndTime"`     // HH:MM, can be earlier than the start time to span midnight
+	TranscodeCacheMaxSize int                          `gorm:"column:transcode_cache_max_size" json:"transcodeCacheMaxSize"` // MB, transcoded segments are kept across sessions. 0 for the default size
+	DisableTranscodeCache bool                         `gorm:"column:disable_transcode_cache" json:"disableTranscodeCache"`  // Don't keep the transcoded segments across sessions
+	DisableQualityWarming bool                         `gorm:"column:disable_quality_warming" json:"disableQualityWarming"`  // Don't encode the neighboring qualities ahead of an ABR switch
 
 	//TranscodeTempDir              string `gorm:"column:transcode_temp_dir" json:"transcodeTempDir"` // DEPRECATED
 }
 
+// MediastreamOptimizationRule selects the local files that are pre-transcoded by the optimizer.
+// e.g. Every HEVC 10-bit file in currently watching shows -> H.264 1080p
+type MediastreamOptimizationRule struct {
+	Name         string   `json:"name"`
+	Enabled      bool     `json:"enabled"`
+	VideoCodecs  []string `json:"videoCodecs"`  // e.g. "hevc", empty for every codec
+	MinBitDepth  int      `json:"minBitDepth"`  // e.g. 10, 0 for every bit depth
+	WatchingOnly bool     `json:"watchingOnly"` // Only the files of the shows in the "Currently watching" list
+	Quality      string   `json:"quality"`      // "low", "medium", "high" or "max"
+	MaxHeight    int      `json:"maxHeight"`    // e.g. 1080, taller videos are downscaled. 0 to keep the original height
+}
+
+type MediastreamOptimizationRules []*MediastreamOptimizationRule
+
+func (o *MediastreamOptimizationRules) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return errors.New("src value cannot cast to string")
+	}
+	if len(data) == 0 {
+		*o = nil
+		return nil
+	}
+	return json.Unmarshal(data, o)
+}
+func (o MediastreamOptimizationRules) Value() (driver.Value, error) {
+	if len(o) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+const (
+	MediastreamOptimizationStatusPending = "pending"
+	MediastreamOptimizationStatusRunning = "running"
+	MediastreamOptimizationStatusDone    = "done"
+	MediastreamOptimizationStatusFailed  = "failed"
+)
+
+// MediastreamOptimizationTask is a file in the optimization queue.
+// Running tasks are interrupted outside the time window and on shutdown, they're resumed afterward.
+type MediastreamOptimizationTask struct {
+	BaseModel
+	Path       string `gorm:"column:path;index" json:"path"`
+	Hash       string `gorm:"column:hash" json:"hash"` // Hash of the file when it was queued, a modified file is queued again
+	MediaId    int    `gorm:"column:media_id" json:"mediaId"`
+	Rule       string `gorm:"column:rule" json:"rule"` // Name of the rule that queued the file, empty if it was queued manually
+	Quality    string `gorm:"column:quality" json:"quality"`
+	MaxHeight  int    `gorm:"column:max_height" json:"maxHeight"`
+	Status     string `gorm:"column:status;index" json:"status"`
+	OutputPath string `gorm:"column:output_path" json:"outputPath"`
+	Error      string `gorm:"column:error" json:"error"`
+}
+
+// MediastreamMediaInfoEntry is the media information of a local file in the library index.
+// Files are probed once, they're probed again when they're modified.
+type MediastreamMediaInfoEntry struct {
+	BaseModel
+	Path              string     `gorm:"column:path;uniqueIndex" json:"path"` // Normalized
+	Hash              string     `gorm:"column:hash" json:"hash"`             // Changes when the file is modified
+	MediaId           int        `gorm:"column:media_id;index" json:"mediaId"`
+	Size              int64      `gorm:"column:size" json:"size"`         // Bytes
+	Duration          float64    `gorm:"column:duration" json:"duration"` // Seconds
+	VideoCodec        string     `gorm:"column:video_codec" json:"videoCodec"`
+	Quality           string     `gorm:"column:quality" json:"quality"` // e.g. "1080p"
+	Width             uint32     `gorm:"column:width" json:"width"`
+	Height            uint32     `gorm:"column:height" json:"height"`
+	BitDepth          uint32     `gorm:"column:bit_depth" json:"bitDepth"`
+	AudioCodecs       StringList `gorm:"column:audio_codecs;type:text" json:"audioCodecs"`
+	AudioLanguages    StringList `gorm:"column:audio_languages;type:text" json:"audioLanguages"`
+	SubtitleLanguages StringList `gorm:"column:subtitle_languages;type:text" json:"subtitleLanguages"` // Embedded and external subtitles
+	Error             string     `gorm:"column:error" json:"error"`                                    // Probe error, empty if the file was probed
+}
+
 // +---------------------+
 // |    TorrentStream    |
 // +---------------------+
@@ -342,6 +473,68 @@ type TorrentstreamSettings struct {
 	StreamUrlAddress string `gorm:"column:stream_url_address" json:"streamUrlAddress"`
 	// v2.7+
 	SlowSeeding bool `gorm:"column:slow_seeding" json:"slowSeeding"`
+	// v2.8+
+	MaxConnections     int                        `gorm:"column:max_connections" json:"maxConnections"`          // Peer connections shared by all concurrent streams, 0 for the default
+	DownloadSpeedLimit int                        `gorm:"column:download_speed_limit" json:"downloadSpeedLimit"` // KB/s, shared by all concurrent streams, 0 for no limit
+	UploadSpeedLimit   int                        `gorm:"column:upload_speed_limit" json:"uploadSpeedLimit"`     // KB/s, shared by all concurrent streams, 0 for no limit
+	CacheDir           string                     `gorm:"column:cache_dir" json:"cacheDir"`
+	CacheMaxSize       int                        `gorm:"column:cache_max_size" json:"cacheMaxSize"`            // MB, 0 disables the cache
+	SpeedProfiles      TorrentstreamSpeedProfiles `gorm:"column:speed_profiles;type:text" json:"speedProfiles"` // Override the speed limits during their time window
+}
+
+// TorrentstreamSpeedProfile overrides the speed limits of the torrent client during a time window.
+// e.g. Throttle the downloads during work hours.
+type TorrentstreamSpeedProfile struct {
+	Name               string `json:"name"`
+	Days               []int  `json:"days"`               // Days of the week, 0 is Sunday. Empty for every day
+	StartTime          string `json:"startTime"`          // HH:MM
+	EndTime            string `json:"endTime"`            // HH:MM, can be earlier than StartTime to span midnight
+	DownloadSpeedLimit int    `json:"downloadSpeedLimit"` // KB/s, 0 for no limit
+	UploadSpeedLimit   int    `json:"uploadSpeedLimit"`   // KB/s, 0 for no limit
+}
+
+type TorrentstreamSpeedProfiles []*TorrentstreamSpeedProfile
+
+func (o *TorrentstreamSpeedProfiles) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return errors.New("src value cannot cast to string")
+	}
+	if len(data) == 0 {
+		*o = nil
+		return nil
+	}
+	return json.Unmarshal(data, o)
+}
+func (o TorrentstreamSpeedProfiles) Value() (driver.Value, error) {
+	if len(o) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// TorrentstreamCacheEntry is a completed stream file kept in the torrentstream cache.
+// Entries are evicted from the least recently watched when the cache exceeds its size.
+type TorrentstreamCacheEntry struct {
+	BaseModel
+	MediaId        int       `gorm:"column:media_id;index" json:"mediaId"`
+	EpisodeNumber  int       `gorm:"column:episode_number" json:"episodeNumber"`
+	InfoHash       string    `gorm:"column:info_hash" json:"infoHash"`
+	Path           string    `gorm:"column:path" json:"path"`
+	Size           int64     `gorm:"column:size" json:"size"`
+	LastAccessedAt time.Time `gorm:"column:last_accessed_at" json:"lastAccessedAt"`
 }
 
 type TorrentstreamHistory struct {
@@ -350,6 +543,26 @@ type TorrentstreamHistory struct {
 	Torrent []byte `gorm:"column:torrent" json:"torrent"`
 }
 
+// +---------------------+
+// |    Skip segments    |
+// +---------------------+
+
+const (
+	SkipSegmentTypeIntro   = "intro"
+	SkipSegmentTypeCredits = "credits"
+)
+
+// SkipSegment is an intro or credits segment of a local file.
+// Segments are detected from the audio shared by the episodes of a series.
+type SkipSegment struct {
+	BaseModel
+	MediaId   int     `gorm:"column:media_id;index" json:"mediaId"`
+	Path      string  `gorm:"column:path;index" json:"path"`
+	Type      string  `gorm:"column:type" json:"type"`            // "intro" or "credits"
+	StartTime float64 `gorm:"column:start_time" json:"startTime"` // In seconds
+	EndTime   float64 `gorm:"column:end_time" json:"endTime"`     // In seconds
+}
+
 // +---------------------+
 // |        Filler       |
 // +---------------------+
@@ -406,6 +619,44 @@ type DebridSettings struct {
 	IncludeDebridStreamInLibrary bool   `gorm:"column:include_debrid_stream_in_library" json:"includeDebridStreamInLibrary"`
 	StreamAutoSelect             bool   `gorm:"column:stream_auto_select" json:"streamAutoSelect"`
 	StreamPreferredResolution    string `gorm:"column:stream_preferred_resolution" json:"streamPreferredResolution"`
+	// v2.8+
+	DownloadWithAria2   bool `gorm:"column:download_with_aria2" json:"downloadWithAria2"`    // Hand downloads to the aria2 instance from the torrent client settings
+	DownloadConcurrency int  `gorm:"column:download_concurrency" json:"downloadConcurrency"` // Maximum number of files downloaded at the same time, 0 for no limit
+	DownloadSpeedLimit  int  `gorm:"column:download_speed_limit" json:"downloadSpeedLimit"`  // KB/s, shared by all downloads, 0 for no limit
+}
+
+// TrackedTorrent is a torrent added by Seanime whose completion is watched.
+// It is kept after the torrent is imported so that seeding policies can be applied to it.
+type TrackedTorrent struct {
+	BaseModel
+	Hash        string `gorm:"column:hash;index" json:"hash"`
+	Name        string `gorm:"column:name" json:"name"`
+	MediaId     int    `gorm:"column:media_id" json:"mediaId"`
+	Destination string `gorm:"column:destination" json:"destination"`
+	RuleId      uint   `gorm:"column:rule_id" json:"ruleId"` // AutoDownloader rule that added the torrent, 0 if added manually
+	Imported    bool   `gorm:"column:imported" json:"imported"`
+	// The import is retried on the next polls if it fails
+	ImportAttempts int    `gorm:"column:import_attempts" json:"importAttempts"`
+	ImportError    string `gorm:"column:import_error" json:"importError"`
+}
+
+// DebridDownload is a file of a debrid torrent being downloaded locally.
+// It is persisted so that the download can be resumed after a restart.
+type DebridDownload struct {
+	BaseModel
+	TorrentItemID   string `gorm:"column:torrent_item_id;index" json:"torrentItemId"`
+	TorrentName     string `gorm:"column:torrent_name" json:"torrentName"`
+	Provider        string `gorm:"column:provider" json:"provider"`
+	Url             string `gorm:"column:url" json:"url"`
+	UrlIndex        int    `gorm:"column:url_index" json:"urlIndex"` // Index of the URL in the torrent's download URLs, used to refresh expired URLs
+	Destination     string `gorm:"column:destination" json:"destination"`
+	Filename        string `gorm:"column:filename" json:"filename"` // Empty until the download starts
+	TotalSize       int64  `gorm:"column:total_size" json:"totalSize"`
+	DownloadedBytes int64  `gorm:"column:downloaded_bytes" json:"downloadedBytes"`
+	Status          string `gorm:"column:status" json:"status"` // "queued", "downloading", "paused", "completed", "failed"
+	Position        int    `gorm:"column:position" json:"position"`
+	Error           string `gorm:"column:error" json:"error"`
+	Aria2Gid        string `gorm:"column:aria2_gid" json:"aria2Gid"` // Set while the file is downloaded by aria2, used to re-attach to the download after a restart
 }
 
 type DebridTorrentItem struct {
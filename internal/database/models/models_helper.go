@@ -5,6 +5,9 @@ func (s *Settings) GetSensitiveValues() []string {
 		s.MediaPlayer.VlcPassword,
 		s.Torrent.QBittorrentPassword,
 		s.Torrent.TransmissionPassword,
+		s.Torrent.DelugePassword,
+		s.Torrent.RTorrentPassword,
+		s.Torrent.Aria2Secret,
 	}
 }
 
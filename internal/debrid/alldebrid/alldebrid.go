@@ -0,0 +1,632 @@
+package alldebrid
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog"
+	"github.com/samber/mo"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"seanime/internal/debrid/debrid"
+	"seanime/internal/util"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// agent is the name of the application, AllDebrid requires it on every request.
+const agent = "seanime"
+
+type (
+	AllDebrid struct {
+		baseUrl string
+		apiKey  mo.Option[string]
+		client  *http.Client
+		logger  *zerolog.Logger
+	}
+
+	Response struct {
+		Status string          `json:"status"` // "success" or "error"
+		Data   json.RawMessage `json:"data"`
+		Error  *ErrorResponse  `json:"error"`
+	}
+
+	ErrorResponse struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+
+	Magnet struct {
+		ID             int     `json:"id"`
+		Filename       string  `json:"filename"`
+		Size           int64   `json:"size"`
+		Hash           string  `json:"hash"`
+		Status         string  `json:"status"`
+		StatusCode     int     `json:"statusCode"`
+		Downloaded     int64   `json:"downloaded"`
+		Uploaded       int64   `json:"uploaded"`
+		Seeders        int     `json:"seeders"`
+		DownloadSpeed  int64   `json:"downloadSpeed"`
+		UploadSpeed    int64   `json:"uploadSpeed"`
+		UploadDate     int64   `json:"uploadDate"`
+		CompletionDate int64   `json:"completionDate"`
+		Links          []*Link `json:"links"`
+	}
+
+	// Link is a downloadable file of a ready magnet, it must be unlocked to get the download URL.
+	Link struct {
+		Link     string  `json:"link"`
+		Filename string  `json:"filename"`
+		Size     int64   `json:"size"`
+		Files    []*Node `json:"files"`
+	}
+
+	// Node is an entry of a file tree, "e" is set for folders and "s" for files.
+	Node struct {
+		N string  `json:"n"`
+		S int64   `json:"s"`
+		E []*Node `json:"e"`
+	}
+
+	InstantAvailabilityItem struct {
+		Magnet  string  `json:"magnet"`
+		Hash    string  `json:"hash"`
+		Instant bool    `json:"instant"`
+		Files   []*Node `json:"files"`
+	}
+
+	uploadedMagnet struct {
+		Magnet string         `json:"magnet"`
+		Hash   string         `json:"hash"`
+		Name   string         `json:"name"`
+		Size   int64          `json:"size"`
+		Ready  bool           `json:"ready"`
+		ID     int            `json:"id"`
+		Error  *ErrorResponse `json:"error"`
+	}
+
+	unlockedLink struct {
+		Link     string `json:"link"`
+		Filename string `json:"filename"`
+		Filesize int64  `json:"filesize"`
+	}
+)
+
+// Magnet status codes
+const (
+	statusCodeQueued      = 0
+	statusCodeDownloading = 1
+	statusCodeCompressing = 2
+	statusCodeUploading   = 3
+	statusCodeReady       = 4
+)
+
+func NewAllDebrid(logger *zerolog.Logger) debrid.Provider {
+	return &AllDebrid{
+		baseUrl: "https://api.alldebrid.com/v4",
+		apiKey:  mo.None[string](),
+		client: &http.Client{
+			Timeout: time.Second * 30,
+		},
+		logger: logger,
+	}
+}
+
+func (t *AllDebrid) GetSettings() debrid.Settings {
+	return debrid.Settings{
+		ID:   "alldebrid",
+		Name: "AllDebrid",
+	}
+}
+
+// doQuery sends the request and decodes the "data" field of the response into ret.
+func (t *AllDebrid) doQuery(method, uri string, form url.Values, ret interface{}) error {
+	apiKey, found := t.apiKey.Get()
+	if !found {
+		return debrid.ErrNotAuthenticated
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("agent", agent)
+	u.RawQuery = q.Encode()
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Add("Authorization", "Bearer "+apiKey)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res Response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.logger.Error().Err(err).Msg("alldebrid: Failed to decode response")
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if res.Status != "success" {
+		if res.Error != nil {
+			return fmt.Errorf("request failed: %s (%s)", res.Error.Message, res.Error.Code)
+		}
+		return fmt.Errorf("request failed: %s", resp.Status)
+	}
+
+	if ret == nil {
+		return nil
+	}
+
+	return json.Unmarshal(res.Data, ret)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (t *AllDebrid) Authenticate(apiKey string) error {
+	t.apiKey = mo.Some(apiKey)
+	return nil
+}
+
+func (t *AllDebrid) GetInstantAvailability(hashes []string) map[string]debrid.TorrentItemInstantAvailability {
+
+	t.logger.Trace().Strs("hashes", hashes).Msg("alldebrid: Checking instant availability")
+
+	availability := make(map[string]debrid.TorrentItemInstantAvailability)
+
+	if len(hashes) == 0 {
+		return availability
+	}
+
+	for i := 0; i < len(hashes); i += 100 {
+		end := min(i+100, len(hashes))
+
+		form := url.Values{}
+		for _, hash := range hashes[i:end] {
+			form.Add("magnets[]", hash)
+		}
+
+		var data struct {
+			Magnets []*InstantAvailabilityItem `json:"magnets"`
+		}
+		err := t.doQuery("POST", t.baseUrl+"/magnet/instant", form, &data)
+		if err != nil {
+			t.logger.Error().Err(err).Msg("alldebrid: Failed to get instant availability")
+			return availability
+		}
+
+		for _, item := range data.Magnets {
+			if !item.Instant {
+				continue
+			}
+
+			// Use the hash that was passed, the case can differ
+			hash := item.Hash
+			for _, h := range hashes[i:end] {
+				if strings.EqualFold(h, item.Hash) || strings.EqualFold(h, item.Magnet) {
+					hash = h
+					break
+				}
+			}
+
+			avail := debrid.TorrentItemInstantAvailability{
+				CachedFiles: make(map[string]*debrid.CachedFile),
+			}
+			for _, f := range flattenNodes(item.Files, "") {
+				avail.CachedFiles[f.Path] = &debrid.CachedFile{
+					Name: path.Base(f.Path),
+					Size: f.Size,
+				}
+			}
+			availability[hash] = avail
+		}
+	}
+
+	return availability
+}
+
+func (t *AllDebrid) AddTorrent(opts debrid.AddTorrentOptions) (string, error) {
+
+	// Check if the torrent is already added
+	if opts.InfoHash != "" {
+		magnets, err := t.getMagnets()
+		if err == nil {
+			for _, m := range magnets {
+				if strings.EqualFold(m.Hash, opts.InfoHash) {
+					t.logger.Debug().Int("torrentId", m.ID).Msg("alldebrid: Torrent already added")
+					return strconv.Itoa(m.ID), nil
+				}
+			}
+		}
+	}
+
+	m, err := t.uploadMagnet(opts.MagnetLink)
+	if err != nil {
+		return "", err
+	}
+
+	t.logger.Debug().Int("torrentId", m.ID).Str("torrentName", m.Name).Bool("ready", m.Ready).Msg("alldebrid: Torrent added")
+
+	// AllDebrid downloads all files of the torrent, opts.SelectFileId is ignored
+	return strconv.Itoa(m.ID), nil
+}
+
+// GetTorrentStreamUrl blocks until the torrent is downloaded and returns the stream URL for the torrent file by calling GetTorrentDownloadUrl.
+func (t *AllDebrid) GetTorrentStreamUrl(ctx context.Context, opts debrid.StreamTorrentOptions, itemCh chan debrid.TorrentItem) (streamUrl string, err error) {
+
+	t.logger.Trace().Str("torrentId", opts.ID).Str("fileId", opts.FileId).Msg("alldebrid: Retrieving stream link")
+
+	doneCh := make(chan struct{})
+
+	go func(ctx context.Context) {
+		defer func() {
+			close(doneCh)
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			case <-time.After(4 * time.Second):
+				torrent, _err := t.GetTorrent(opts.ID)
+				if _err != nil {
+					t.logger.Error().Err(_err).Msg("alldebrid: Failed to get torrent")
+					err = fmt.Errorf("alldebrid: Failed to get torrent: %w", _err)
+					return
+				}
+
+				itemCh <- *torrent
+
+				if torrent.Status == debrid.TorrentItemStatusError {
+					err = fmt.Errorf("alldebrid: Torrent failed to download")
+					return
+				}
+
+				// Check if the torrent is ready
+				if torrent.IsReady {
+					downloadUrl, _err := t.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{
+						ID:     opts.ID,
+						FileId: opts.FileId,
+					})
+					if _err != nil {
+						t.logger.Error().Err(_err).Msg("alldebrid: Failed to get download URL")
+						err = _err
+						return
+					}
+
+					streamUrl = downloadUrl
+					return
+				}
+			}
+		}
+	}(ctx)
+
+	<-doneCh
+
+	return
+}
+
+// GetTorrentDownloadUrl returns the download URL for the torrent file.
+// If no opts.FileId is provided, it will return a comma-separated list of download URLs for all files in the torrent.
+func (t *AllDebrid) GetTorrentDownloadUrl(opts debrid.DownloadTorrentOptions) (downloadUrl string, err error) {
+
+	t.logger.Trace().Str("torrentId", opts.ID).Msg("alldebrid: Retrieving download link")
+
+	magnet, err := t.getMagnet(opts.ID)
+	if err != nil {
+		return "", fmt.Errorf("alldebrid: Failed to get download URL: %w", err)
+	}
+
+	if magnet.StatusCode != statusCodeReady || len(magnet.Links) == 0 {
+		return "", fmt.Errorf("alldebrid: Failed to get download URL, torrent is not ready")
+	}
+
+	links := make([]*Link, 0, len(magnet.Links))
+	for _, l := range magnet.Links {
+		if opts.FileId == "" || getLinkPath(l) == opts.FileId {
+			links = append(links, l)
+		}
+	}
+	if len(links) == 0 {
+		return "", fmt.Errorf("alldebrid: Failed to get download URL, file not found")
+	}
+
+	urls := make([]string, 0, len(links))
+	for _, l := range links {
+		unlocked, err := t.unlockLink(l.Link)
+		if err != nil {
+			return "", fmt.Errorf("alldebrid: Failed to get download URL: %w", err)
+		}
+		urls = append(urls, unlocked.Link)
+	}
+
+	downloadUrl = strings.Join(urls, ",")
+
+	t.logger.Debug().Str("downloadUrl", downloadUrl).Msg("alldebrid: Download link retrieved")
+
+	return downloadUrl, nil
+}
+
+func (t *AllDebrid) GetTorrent(id string) (ret *debrid.TorrentItem, err error) {
+	magnet, err := t.getMagnet(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toDebridTorrent(magnet), nil
+}
+
+// GetTorrentInfo returns the torrent's files.
+// The files are known without adding the torrent if it is cached, otherwise the torrent is added and its files are read once it is ready.
+func (t *AllDebrid) GetTorrentInfo(opts debrid.GetTorrentInfoOptions) (ret *debrid.TorrentInfo, err error) {
+
+	if opts.InfoHash != "" {
+		avail := t.GetInstantAvailability([]string{opts.InfoHash})
+		if a, ok := avail[opts.InfoHash]; ok && len(a.CachedFiles) > 0 {
+			files := make([]*debrid.TorrentItemFile, 0, len(a.CachedFiles))
+			var size int64
+			for p, f := range a.CachedFiles {
+				files = append(files, &debrid.TorrentItemFile{ID: p, Name: f.Name, Path: "/" + p, Size: f.Size})
+				size += f.Size
+			}
+			slices.SortFunc(files, func(i, j *debrid.TorrentItemFile) int {
+				return cmp.Compare(i.Path, j.Path)
+			})
+			for idx, f := range files {
+				f.Index = idx
+			}
+
+			name := opts.InfoHash
+			if len(files) > 0 {
+				name = strings.Split(strings.TrimPrefix(files[0].Path, "/"), "/")[0]
+			}
+
+			return &debrid.TorrentInfo{
+				Name:  name,
+				Hash:  opts.InfoHash,
+				Size:  size,
+				Files: files,
+			}, nil
+		}
+	}
+
+	if opts.MagnetLink == "" {
+		return nil, fmt.Errorf("alldebrid: Magnet link is required")
+	}
+
+	m, err := t.uploadMagnet(opts.MagnetLink)
+	if err != nil {
+		return nil, fmt.Errorf("alldebrid: Failed to get info: %w", err)
+	}
+
+	// The magnet is removed if its files can't be listed, it was only added to get the info
+	id := strconv.Itoa(m.ID)
+	magnet, err := t.getMagnet(id)
+	if err != nil {
+		_ = t.DeleteTorrent(id)
+		return nil, fmt.Errorf("alldebrid: Failed to get info: %w", err)
+	}
+
+	if len(magnet.Links) == 0 {
+		_ = t.DeleteTorrent(id)
+		return nil, fmt.Errorf("alldebrid: Torrent is not cached, its files are not available yet")
+	}
+
+	return toDebridTorrentInfo(magnet), nil
+}
+
+func (t *AllDebrid) GetTorrents() (ret []*debrid.TorrentItem, err error) {
+
+	magnets, err := t.getMagnets()
+	if err != nil {
+		return nil, fmt.Errorf("alldebrid: Failed to get torrents: %w", err)
+	}
+
+	for _, m := range magnets {
+		ret = append(ret, toDebridTorrent(m))
+	}
+
+	slices.SortFunc(ret, func(i, j *debrid.TorrentItem) int {
+		return cmp.Compare(j.AddedAt, i.AddedAt)
+	})
+
+	return ret, nil
+}
+
+func (t *AllDebrid) DeleteTorrent(id string) error {
+
+	err := t.doQuery("POST", t.baseUrl+"/magnet/delete", url.Values{"id": {id}}, nil)
+	if err != nil {
+		t.logger.Error().Err(err).Msg("alldebrid: Failed to delete torrent")
+		return fmt.Errorf("alldebrid: Failed to delete torrent: %w", err)
+	}
+
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (t *AllDebrid) uploadMagnet(magnet string) (*uploadedMagnet, error) {
+
+	t.logger.Trace().Str("magnetLink", magnet).Msg("alldebrid: Adding torrent")
+
+	var data struct {
+		Magnets []*uploadedMagnet `json:"magnets"`
+	}
+	err := t.doQuery("POST", t.baseUrl+"/magnet/upload", url.Values{"magnets[]": {magnet}}, &data)
+	if err != nil {
+		t.logger.Error().Err(err).Msg("alldebrid: Failed to add torrent")
+		return nil, fmt.Errorf("alldebrid: Failed to add torrent: %w", err)
+	}
+
+	if len(data.Magnets) == 0 {
+		return nil, fmt.Errorf("alldebrid: Failed to add torrent, empty response")
+	}
+	if data.Magnets[0].Error != nil {
+		return nil, fmt.Errorf("alldebrid: Failed to add torrent: %s", data.Magnets[0].Error.Message)
+	}
+
+	return data.Magnets[0], nil
+}
+
+func (t *AllDebrid) unlockLink(link string) (*unlockedLink, error) {
+	var ret unlockedLink
+	err := t.doQuery("POST", t.baseUrl+"/link/unlock", url.Values{"link": {link}}, &ret)
+	if err != nil {
+		t.logger.Error().Err(err).Msg("alldebrid: Failed to unlock link")
+		return nil, fmt.Errorf("alldebrid: Failed to unlock link: %w", err)
+	}
+	return &ret, nil
+}
+
+func (t *AllDebrid) getMagnets() ([]*Magnet, error) {
+	var data struct {
+		Magnets []*Magnet `json:"magnets"`
+	}
+	err := t.doQuery("GET", t.baseUrl+"/magnet/status", nil, &data)
+	if err != nil {
+		t.logger.Error().Err(err).Msg("alldebrid: Failed to get torrents")
+		return nil, fmt.Errorf("alldebrid: Failed to get torrents: %w", err)
+	}
+	return data.Magnets, nil
+}
+
+func (t *AllDebrid) getMagnet(id string) (*Magnet, error) {
+	var data struct {
+		Magnets *Magnet `json:"magnets"` // Single object when an ID is passed
+	}
+	err := t.doQuery("GET", t.baseUrl+"/magnet/status?id="+url.QueryEscape(id), nil, &data)
+	if err != nil {
+		t.logger.Error().Err(err).Msg("alldebrid: Failed to get torrent")
+		return nil, fmt.Errorf("alldebrid: Failed to get torrent: %w", err)
+	}
+	if data.Magnets == nil {
+		return nil, fmt.Errorf("alldebrid: Torrent not found")
+	}
+	return data.Magnets, nil
+}
+
+type flatFile struct {
+	Path string
+	Size int64
+}
+
+// flattenNodes returns the files of the tree with their paths, e.g. "Big Buck Bunny/Big Buck Bunny.mp4".
+func flattenNodes(nodes []*Node, prefix string) []*flatFile {
+	ret := make([]*flatFile, 0)
+	for _, n := range nodes {
+		p := n.N
+		if prefix != "" {
+			p = prefix + "/" + n.N
+		}
+		if n.E != nil {
+			ret = append(ret, flattenNodes(n.E, p)...)
+			continue
+		}
+		ret = append(ret, &flatFile{Path: p, Size: n.S})
+	}
+	return ret
+}
+
+// getLinkPath returns the path of the link's file in the torrent, it is used as the file ID.
+func getLinkPath(l *Link) string {
+	if files := flattenNodes(l.Files, ""); len(files) == 1 {
+		return files[0].Path
+	}
+	return l.Filename
+}
+
+func toDebridTorrent(m *Magnet) (ret *debrid.TorrentItem) {
+
+	completionPercentage := 0
+	if m.Size > 0 {
+		completionPercentage = int(float64(m.Downloaded) / float64(m.Size) * 100)
+	}
+	if m.StatusCode >= statusCodeReady {
+		completionPercentage = 100
+	}
+
+	eta := ""
+	if m.DownloadSpeed > 0 && m.Size > m.Downloaded {
+		eta = util.FormatETA(int((m.Size - m.Downloaded) / m.DownloadSpeed))
+	}
+
+	status := toDebridTorrentStatus(m)
+
+	ret = &debrid.TorrentItem{
+		ID:                   strconv.Itoa(m.ID),
+		Name:                 m.Filename,
+		Hash:                 m.Hash,
+		Size:                 m.Size,
+		FormattedSize:        humanize.Bytes(uint64(m.Size)),
+		CompletionPercentage: completionPercentage,
+		ETA:                  eta,
+		Status:               status,
+		AddedAt:              time.Unix(m.UploadDate, 0).Format(time.RFC3339),
+		Speed:                util.ToHumanReadableSpeed(int(m.DownloadSpeed)),
+		Seeders:              m.Seeders,
+		IsReady:              status == debrid.TorrentItemStatusCompleted,
+	}
+
+	return
+}
+
+func toDebridTorrentInfo(m *Magnet) (ret *debrid.TorrentInfo) {
+
+	files := make([]*debrid.TorrentItemFile, 0, len(m.Links))
+	for idx, l := range m.Links {
+		p := getLinkPath(l)
+		files = append(files, &debrid.TorrentItemFile{
+			ID:    p, // The path is used to find the link in GetTorrentDownloadUrl
+			Index: idx,
+			Name:  path.Base(p),
+			Path:  "/" + p,
+			Size:  l.Size,
+		})
+	}
+
+	id := strconv.Itoa(m.ID)
+
+	ret = &debrid.TorrentInfo{
+		ID:    &id,
+		Name:  m.Filename,
+		Hash:  m.Hash,
+		Size:  m.Size,
+		Files: files,
+	}
+
+	return
+}
+
+func toDebridTorrentStatus(m *Magnet) debrid.TorrentItemStatus {
+	switch m.StatusCode {
+	case statusCodeQueued:
+		return debrid.TorrentItemStatusStalled
+	case statusCodeDownloading, statusCodeCompressing, statusCodeUploading:
+		return debrid.TorrentItemStatusDownloading
+	case statusCodeReady:
+		return debrid.TorrentItemStatusCompleted
+	default:
+		// 5 and above are errors (e.g. upload fail, not downloaded in 20 min, file too big)
+		return debrid.TorrentItemStatusError
+	}
+}
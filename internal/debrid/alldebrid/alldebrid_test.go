@@ -0,0 +1,195 @@
+package alldebrid
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"seanime/internal/debrid/debrid"
+	"seanime/internal/test_utils"
+	"seanime/internal/util"
+	"testing"
+	"time"
+)
+
+const testApiKey = "test-api-key"
+
+func newTestAllDebrid(t *testing.T) (*AllDebrid, *test_utils.FixtureServer) {
+	s := test_utils.NewFixtureServer(t, &test_utils.NewFixtureServerOptions{
+		MissingFixture: "error_invalid_id.json",
+		Route: func(r *http.Request) string {
+			if r.Header.Get("Authorization") != "Bearer "+testApiKey || r.URL.Query().Get("agent") != agent {
+				return "error_auth.json"
+			}
+
+			switch r.URL.Path {
+			case "/magnet/instant":
+				return "magnet_instant.json"
+			case "/magnet/upload":
+				return "magnet_upload.json"
+			case "/magnet/status":
+				if id := r.URL.Query().Get("id"); id != "" {
+					return "magnet_status_" + id + ".json"
+				}
+				return "magnet_status.json"
+			case "/link/unlock":
+				return "link_unlock.json"
+			case "/magnet/delete":
+				return "magnet_delete.json"
+			}
+			return ""
+		},
+	})
+
+	ad := NewAllDebrid(util.NewLogger()).(*AllDebrid)
+	ad.baseUrl = s.URL
+
+	err := ad.Authenticate(testApiKey)
+	require.NoError(t, err)
+
+	return ad, s
+}
+
+func TestAllDebrid_Authenticate(t *testing.T) {
+	ad, _ := newTestAllDebrid(t)
+
+	err := ad.Authenticate("wrong")
+	require.NoError(t, err)
+
+	_, err = ad.GetTorrents()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AUTH_BAD_APIKEY")
+}
+
+func TestAllDebrid_GetTorrents(t *testing.T) {
+	ad, _ := newTestAllDebrid(t)
+
+	torrents, err := ad.GetTorrents()
+	require.NoError(t, err)
+	require.Len(t, torrents, 2)
+
+	// Most recent first
+	assert.Equal(t, "2002", torrents[0].ID)
+	assert.Equal(t, debrid.TorrentItemStatusDownloading, torrents[0].Status)
+	assert.Equal(t, 50, torrents[0].CompletionPercentage)
+	assert.False(t, torrents[0].IsReady)
+
+	assert.Equal(t, "1001", torrents[1].ID)
+	assert.Equal(t, debrid.TorrentItemStatusCompleted, torrents[1].Status)
+	assert.True(t, torrents[1].IsReady)
+}
+
+func TestAllDebrid_InstantAvailability(t *testing.T) {
+	ad, s := newTestAllDebrid(t)
+
+	avail := ad.GetInstantAvailability([]string{"80431b4f9a12f4e06616062d3d3973b9ef99b5e6", "9f4961a9c71eeb53abce2ef2afc587b452dee5eb"})
+	require.Len(t, avail, 1)
+
+	cached, ok := avail["80431b4f9a12f4e06616062d3d3973b9ef99b5e6"]
+	require.True(t, ok)
+	require.Len(t, cached.CachedFiles, 2)
+
+	file, ok := cached.CachedFiles["[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/[SubsPlease] Bocchi the Rock! - 01 (1080p) [E04F4EFB].mkv"]
+	require.True(t, ok)
+	assert.Equal(t, "[SubsPlease] Bocchi the Rock! - 01 (1080p) [E04F4EFB].mkv", file.Name)
+	assert.Equal(t, int64(1442048000), file.Size)
+
+	assert.Len(t, s.Form("/magnet/instant")["magnets[]"], 2)
+}
+
+func TestAllDebrid_GetTorrentInfo(t *testing.T) {
+	ad, s := newTestAllDebrid(t)
+
+	// Cached, the files are read from the instant availability
+	info, err := ad.GetTorrentInfo(debrid.GetTorrentInfoOptions{
+		MagnetLink: "magnet:?xt=urn:btih:80431b4f9a12f4e06616062d3d3973b9ef99b5e6",
+		InfoHash:   "80431b4f9a12f4e06616062d3d3973b9ef99b5e6",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]", info.Name)
+	require.Len(t, info.Files, 2)
+	assert.Equal(t, 1, info.Files[1].Index)
+	assert.Equal(t, "/[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/[SubsPlease] Bocchi the Rock! - 02 (1080p) [7C4A3E11].mkv", info.Files[1].Path)
+
+	// Not cached, the files are not known until the torrent is downloaded
+	_, err = ad.GetTorrentInfo(debrid.GetTorrentInfoOptions{
+		MagnetLink: "magnet:?xt=urn:btih:9f4961a9c71eeb53abce2ef2afc587b452dee5eb",
+		InfoHash:   "9f4961a9c71eeb53abce2ef2afc587b452dee5eb",
+	})
+	require.Error(t, err)
+	// The uploaded magnet is removed
+	assert.Equal(t, []string{"2002"}, s.Form("/magnet/delete")["id"])
+}
+
+func TestAllDebrid_AddTorrent(t *testing.T) {
+	ad, s := newTestAllDebrid(t)
+
+	// Already added
+	id, err := ad.AddTorrent(debrid.AddTorrentOptions{
+		MagnetLink: "magnet:?xt=urn:btih:80431b4f9a12f4e06616062d3d3973b9ef99b5e6",
+		InfoHash:   "80431B4F9A12F4E06616062D3D3973B9EF99B5E6",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1001", id)
+	assert.Nil(t, s.Form("/magnet/upload"))
+
+	id, err = ad.AddTorrent(debrid.AddTorrentOptions{
+		MagnetLink: "magnet:?xt=urn:btih:9f4961a9c71eeb53abce2ef2afc587b452dee5ec",
+		InfoHash:   "9f4961a9c71eeb53abce2ef2afc587b452dee5ec",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "2002", id)
+	assert.Equal(t, []string{"magnet:?xt=urn:btih:9f4961a9c71eeb53abce2ef2afc587b452dee5ec"}, s.Form("/magnet/upload")["magnets[]"])
+}
+
+func TestAllDebrid_GetDownloadUrl(t *testing.T) {
+	ad, s := newTestAllDebrid(t)
+
+	// Select the second file
+	url, err := ad.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{
+		ID:     "1001",
+		FileId: "[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/[SubsPlease] Bocchi the Rock! - 02 (1080p) [7C4A3E11].mkv",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.alldebrid.com/dl/AAAA02/Bocchi%20the%20Rock%20-%2002.mkv", url)
+	assert.Equal(t, []string{"https://alldebrid.com/f/AAAA02"}, s.Form("/link/unlock")["link"])
+
+	// Unknown file
+	_, err = ad.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{ID: "1001", FileId: "unknown.mkv"})
+	require.Error(t, err)
+
+	// Not ready
+	_, err = ad.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{ID: "2002"})
+	require.Error(t, err)
+}
+
+func TestAllDebrid_GetTorrentStreamUrl(t *testing.T) {
+	ad, _ := newTestAllDebrid(t)
+
+	itemCh := make(chan debrid.TorrentItem, 10)
+
+	streamUrl, err := ad.GetTorrentStreamUrl(context.Background(), debrid.StreamTorrentOptions{
+		ID:     "1001",
+		FileId: "[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/[SubsPlease] Bocchi the Rock! - 02 (1080p) [7C4A3E11].mkv",
+	}, itemCh)
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.alldebrid.com/dl/AAAA02/Bocchi%20the%20Rock%20-%2002.mkv", streamUrl)
+
+	require.Len(t, itemCh, 1)
+	item := <-itemCh
+	assert.Equal(t, 100, item.CompletionPercentage)
+
+	// Cancelled while the torrent is downloading
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = ad.GetTorrentStreamUrl(ctx, debrid.StreamTorrentOptions{ID: "2002"}, itemCh)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestAllDebrid_DeleteTorrent(t *testing.T) {
+	ad, s := newTestAllDebrid(t)
+
+	err := ad.DeleteTorrent("1001")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1001"}, s.Form("/magnet/delete")["id"])
+}
@@ -0,0 +1,135 @@
+package debrid_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"seanime/internal/database/models"
+	"seanime/internal/torrent_clients/aria2"
+	"seanime/internal/util"
+	"time"
+)
+
+// downloadFileWithAria2 hands the queued file to aria2 and follows its progress.
+// The GID of the aria2 download is stored in the queue so that the download can be re-attached after a restart.
+// Like downloadFile, the file is downloaded to a temporary folder in the destination, then moved or extracted to the destination.
+func (r *Repository) downloadFileWithAria2(ctx context.Context, client *aria2.Aria2, d *models.DebridDownload) (err error) {
+	defer util.HandlePanicInModuleWithError("debrid/client/downloadFileWithAria2", &err)
+
+	tmpDirPath := getDownloadTmpDirPath(d)
+	if err := os.MkdirAll(tmpDirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create temp folder: %w", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		util.HideFile(tmpDirPath)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	gid, err := r.attachAria2Download(client, d, tmpDirPath)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	var status *aria2.Download
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(context.Cause(ctx), errDownloadPaused) {
+				// Keep the download in aria2 so that it's resumed where it stopped
+				r.logger.Debug().Str("gid", gid).Msg("debrid: Pausing aria2 download")
+				_ = client.Pause(gid)
+			} else {
+				r.logger.Debug().Str("gid", gid).Msg("debrid: Download cancelled, removing from aria2")
+				_ = client.Remove(gid)
+				d.Aria2Gid = ""
+			}
+			return context.Cause(ctx)
+		case <-ticker.C:
+		}
+
+		status, err = client.TellStatus(gid)
+		if err != nil {
+			return fmt.Errorf("lost track of aria2 download: %w", err)
+		}
+
+		r.downloadQueue.setProgress(d.ID, status.GetCompletedLength(), status.GetTotalLength(), int(status.GetDownloadSpeed()/1024))
+		_ = r.db.UpdateDebridDownloadProgress(d.ID, status.GetCompletedLength(), status.GetTotalLength())
+		r.sendTorrentItemDownloadProgress(d.TorrentItemID)
+
+		if status.Status == aria2.StatusError || status.Status == aria2.StatusRemoved {
+			_ = client.Remove(gid)
+			d.Aria2Gid = ""
+			return fmt.Errorf("aria2 download failed: %s", status.ErrorMessage)
+		}
+		if status.Status == aria2.StatusComplete {
+			break
+		}
+	}
+
+	_ = client.Remove(gid) // Clear the download result
+
+	r.logger.Debug().Str("gid", gid).Msg("debrid: aria2 download completed")
+
+	d.Aria2Gid = ""
+	d.TotalSize = status.GetTotalLength()
+	d.DownloadedBytes = status.GetCompletedLength()
+	if len(status.Files) > 0 {
+		d.Filename = filepath.Base(status.Files[0].Path)
+	}
+	_ = r.db.SaveDebridDownload(d)
+
+	if d.Filename == "" {
+		return fmt.Errorf("aria2 did not report the downloaded file")
+	}
+
+	return r.finalizeDownload(d, tmpDirPath)
+}
+
+// attachAria2Download returns the GID of the aria2 download of the file.
+// The download stored in the queue is resumed if aria2 still knows it, otherwise the file is added again and aria2 continues the partial download.
+func (r *Repository) attachAria2Download(client *aria2.Aria2, d *models.DebridDownload, tmpDirPath string) (string, error) {
+	if d.Aria2Gid != "" {
+		status, err := client.TellStatus(d.Aria2Gid)
+		if err == nil {
+			switch status.Status {
+			case aria2.StatusPaused:
+				if err := client.Unpause(d.Aria2Gid); err != nil {
+					return "", err
+				}
+				fallthrough
+			case aria2.StatusActive, aria2.StatusWaiting, aria2.StatusComplete:
+				r.logger.Debug().Str("gid", d.Aria2Gid).Msg("debrid: Re-attached to aria2 download")
+				return d.Aria2Gid, nil
+			}
+			_ = client.Remove(d.Aria2Gid)
+		}
+		// The link may have expired since the download was added
+		if newUrl, err := r.refreshDownloadUrl(d); err == nil {
+			d.Url = newUrl
+		}
+	}
+
+	gid, err := client.AddUri([]string{d.Url}, map[string]string{
+		"dir":                       tmpDirPath,
+		"continue":                  "true",
+		"split":                     "4",
+		"max-connection-per-server": "4",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to add download to aria2: %w", err)
+	}
+
+	r.logger.Debug().Str("gid", gid).Str("destination", d.Destination).Msg("debrid: Download added to aria2")
+
+	d.Aria2Gid = gid
+	_ = r.db.SaveDebridDownload(d)
+
+	return gid, nil
+}
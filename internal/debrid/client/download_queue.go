@@ -0,0 +1,792 @@
+package debrid_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"seanime/internal/database/models"
+	"seanime/internal/debrid/debrid"
+	"seanime/internal/events"
+	"seanime/internal/notifier"
+	"seanime/internal/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/time/rate"
+)
+
+const (
+	DownloadStatusQueued      = "queued"
+	DownloadStatusDownloading = "downloading"
+	DownloadStatusPaused      = "paused"
+	DownloadStatusCompleted   = "completed"
+	DownloadStatusFailed      = "failed"
+
+	downloadBufferSize = 32 * 1024
+)
+
+var (
+	errDownloadPaused  = errors.New("download paused")
+	errDownloadRemoved = errors.New("download removed")
+)
+
+type (
+	// downloadQueue holds the state of the running downloads.
+	// The queue itself is persisted in the database, so that downloads can be resumed after a restart.
+	downloadQueue struct {
+		mu         sync.Mutex
+		running    map[uint]*runningDownload
+		limiter    *rate.Limiter // Shared by all downloads
+		resumeOnce sync.Once
+	}
+
+	runningDownload struct {
+		torrentItemId   string
+		cancel          context.CancelCauseFunc
+		downloadedBytes int64
+		totalSize       int64
+		speed           int // KB/s
+	}
+
+	// DownloadQueueItem is a file in the download queue.
+	DownloadQueueItem struct {
+		*models.DebridDownload
+		Speed int `json:"speed"` // KB/s
+	}
+)
+
+func newDownloadQueue() *downloadQueue {
+	return &downloadQueue{
+		running: make(map[uint]*runningDownload),
+		limiter: rate.NewLimiter(rate.Inf, 0),
+	}
+}
+
+// setSpeedLimit sets the bandwidth shared by all downloads, in KB/s.
+func (q *downloadQueue) setSpeedLimit(kbps int) {
+	if kbps <= 0 {
+		q.limiter.SetLimit(rate.Inf)
+		return
+	}
+	bps := kbps * 1024
+	// The burst must fit a whole buffer
+	q.limiter.SetBurst(max(bps, downloadBufferSize))
+	q.limiter.SetLimit(rate.Limit(bps))
+}
+
+func (q *downloadQueue) setProgress(id uint, downloadedBytes int64, totalSize int64, speed int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if rd, found := q.running[id]; found {
+		rd.downloadedBytes = downloadedBytes
+		rd.totalSize = totalSize
+		rd.speed = speed
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// GetDownloads returns the download queue in order.
+func (r *Repository) GetDownloads() ([]*DownloadQueueItem, error) {
+	downloads, err := r.db.GetDebridDownloads()
+	if err != nil {
+		return nil, err
+	}
+
+	r.downloadQueue.mu.Lock()
+	defer r.downloadQueue.mu.Unlock()
+
+	ret := make([]*DownloadQueueItem, 0, len(downloads))
+	for _, d := range downloads {
+		item := &DownloadQueueItem{DebridDownload: d}
+		if rd, found := r.downloadQueue.running[d.ID]; found {
+			item.DownloadedBytes = rd.downloadedBytes
+			item.TotalSize = rd.totalSize
+			item.Speed = rd.speed
+		}
+		ret = append(ret, item)
+	}
+
+	return ret, nil
+}
+
+// PauseDownloads stops the downloads, the downloaded data is kept so that they can be resumed.
+func (r *Repository) PauseDownloads(ids []uint) error {
+	r.downloadQueue.mu.Lock()
+	defer r.downloadQueue.mu.Unlock()
+
+	for _, id := range ids {
+		if rd, found := r.downloadQueue.running[id]; found {
+			rd.cancel(errDownloadPaused)
+			continue
+		}
+		d, err := r.db.GetDebridDownload(id)
+		if err != nil {
+			return err
+		}
+		if d.Status != DownloadStatusQueued {
+			continue
+		}
+		d.Status = DownloadStatusPaused
+		if err := r.db.SaveDebridDownload(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResumeDownloads queues the paused and failed downloads again.
+func (r *Repository) ResumeDownloads(ids []uint) error {
+	for _, id := range ids {
+		d, err := r.db.GetDebridDownload(id)
+		if err != nil {
+			return err
+		}
+		if d.Status != DownloadStatusPaused && d.Status != DownloadStatusFailed {
+			continue
+		}
+		d.Status = DownloadStatusQueued
+		d.Error = ""
+		if err := r.db.SaveDebridDownload(d); err != nil {
+			return err
+		}
+	}
+
+	r.processDownloadQueue()
+
+	return nil
+}
+
+// ReorderDownloads moves the downloads to the front of the queue, in the given order.
+// Running downloads are not stopped.
+func (r *Repository) ReorderDownloads(ids []uint) error {
+	downloads, err := r.db.GetDebridDownloads()
+	if err != nil {
+		return err
+	}
+
+	byId := make(map[uint]*models.DebridDownload, len(downloads))
+	for _, d := range downloads {
+		byId[d.ID] = d
+	}
+
+	ordered := make([]*models.DebridDownload, 0, len(downloads))
+	seen := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		if d, found := byId[id]; found {
+			if _, ok := seen[id]; !ok {
+				ordered = append(ordered, d)
+				seen[id] = struct{}{}
+			}
+		}
+	}
+	for _, d := range downloads {
+		if _, found := seen[d.ID]; !found {
+			ordered = append(ordered, d)
+		}
+	}
+
+	for idx, d := range ordered {
+		if d.Position == idx {
+			continue
+		}
+		d.Position = idx
+		if err := r.db.UpdateDebridDownloadPosition(d.ID, idx); err != nil {
+			return err
+		}
+	}
+
+	r.processDownloadQueue()
+
+	return nil
+}
+
+// RemoveDownloads cancels the downloads and deletes their downloaded data.
+func (r *Repository) RemoveDownloads(ids []uint) error {
+	r.downloadQueue.mu.Lock()
+
+	torrentItemIds := make(map[string]struct{})
+	for _, id := range ids {
+		// Running downloads are removed once they stop
+		if rd, found := r.downloadQueue.running[id]; found {
+			rd.cancel(errDownloadRemoved)
+			continue
+		}
+		d, err := r.db.GetDebridDownload(id)
+		if err != nil {
+			continue
+		}
+		if client, ok := r.getAria2Client(); ok && d.Aria2Gid != "" {
+			_ = client.Remove(d.Aria2Gid)
+		}
+		_ = os.RemoveAll(getDownloadTmpDirPath(d))
+		if err := r.db.DeleteDebridDownload(id); err != nil {
+			r.downloadQueue.mu.Unlock()
+			return err
+		}
+		torrentItemIds[d.TorrentItemID] = struct{}{}
+	}
+
+	r.downloadQueue.mu.Unlock()
+
+	for tId := range torrentItemIds {
+		r.sendTorrentItemDownloadStatus(tId)
+	}
+
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// queueTorrentItemDownload adds the files of the torrent item to the end of the download queue.
+func (r *Repository) queueTorrentItemDownload(tId string, torrentName string, provider string, downloadUrls []string, destination string) error {
+	downloads, err := r.db.GetDebridDownloads()
+	if err != nil {
+		return err
+	}
+
+	position := 0
+	for _, d := range downloads {
+		if d.TorrentItemID == tId {
+			return fmt.Errorf("debrid: Torrent is already in the download queue")
+		}
+		position = max(position, d.Position+1)
+	}
+
+	items := make([]*models.DebridDownload, 0, len(downloadUrls))
+	for idx, u := range downloadUrls {
+		items = append(items, &models.DebridDownload{
+			TorrentItemID: tId,
+			TorrentName:   torrentName,
+			Provider:      provider,
+			Url:           u,
+			UrlIndex:      idx,
+			Destination:   destination,
+			Status:        DownloadStatusQueued,
+			Position:      position + idx,
+		})
+	}
+
+	if err := r.db.InsertDebridDownloads(items); err != nil {
+		return err
+	}
+
+	r.processDownloadQueue()
+
+	return nil
+}
+
+// resumeDownloads queues the downloads that were interrupted by a restart.
+func (r *Repository) resumeDownloads() {
+	r.downloadQueue.resumeOnce.Do(func() {
+		downloads, err := r.db.GetDebridDownloads()
+		if err != nil {
+			return
+		}
+		for _, d := range downloads {
+			if d.Status != DownloadStatusDownloading {
+				continue
+			}
+			d.Status = DownloadStatusQueued
+			_ = r.db.SaveDebridDownload(d)
+		}
+		if len(downloads) > 0 {
+			r.logger.Debug().Int("count", len(downloads)).Msg("debrid: Resuming download queue")
+		}
+		r.processDownloadQueue()
+	})
+}
+
+// processDownloadQueue starts the queued downloads, up to the concurrency limit.
+func (r *Repository) processDownloadQueue() {
+	q := r.downloadQueue
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	downloads, err := r.db.GetDebridDownloads()
+	if err != nil {
+		r.logger.Err(err).Msg("debrid: Failed to get download queue")
+		return
+	}
+
+	limit := r.settings.DownloadConcurrency
+	for _, d := range downloads {
+		if limit > 0 && len(q.running) >= limit {
+			break
+		}
+		if d.Status != DownloadStatusQueued {
+			continue
+		}
+		if _, found := q.running[d.ID]; found {
+			continue
+		}
+
+		d.Status = DownloadStatusDownloading
+		d.Error = ""
+		if err := r.db.SaveDebridDownload(d); err != nil {
+			r.logger.Err(err).Msg("debrid: Failed to update download")
+			continue
+		}
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+		q.running[d.ID] = &runningDownload{
+			torrentItemId:   d.TorrentItemID,
+			cancel:          cancel,
+			downloadedBytes: d.DownloadedBytes,
+			totalSize:       d.TotalSize,
+		}
+
+		go r.runDownload(ctx, d)
+	}
+}
+
+func (r *Repository) runDownload(ctx context.Context, d *models.DebridDownload) {
+	defer r.processDownloadQueue()
+
+	var err error
+	if client, ok := r.getAria2Client(); ok && r.settings.DownloadWithAria2 {
+		err = r.downloadFileWithAria2(ctx, client, d)
+	} else {
+		err = r.downloadFile(ctx, d)
+	}
+
+	q := r.downloadQueue
+	q.mu.Lock()
+	cause := context.Cause(ctx)
+	if rd, found := q.running[d.ID]; found {
+		rd.cancel(nil)
+		delete(q.running, d.ID)
+	}
+
+	switch {
+	case errors.Is(cause, errDownloadRemoved):
+		r.logger.Debug().Uint("id", d.ID).Msg("debrid: Download removed")
+		_ = os.RemoveAll(getDownloadTmpDirPath(d))
+		_ = r.db.DeleteDebridDownload(d.ID)
+	case err == nil:
+		d.Status = DownloadStatusCompleted
+		d.DownloadedBytes = d.TotalSize
+		_ = r.db.SaveDebridDownload(d)
+	case errors.Is(cause, errDownloadPaused):
+		r.logger.Debug().Uint("id", d.ID).Msg("debrid: Download paused")
+		d.Status = DownloadStatusPaused
+		_ = r.db.SaveDebridDownload(d)
+	default:
+		r.logger.Err(err).Str("url", d.Url).Msg("debrid: Download failed")
+		r.wsEventManager.SendEvent(events.ErrorToast, fmt.Sprintf("debrid: Download failed: %v", err))
+		d.Status = DownloadStatusFailed
+		d.Error = err.Error()
+		_ = r.db.SaveDebridDownload(d)
+	}
+	q.mu.Unlock()
+
+	r.sendTorrentItemDownloadStatus(d.TorrentItemID)
+}
+
+// sendTorrentItemDownloadStatus notifies the client once all the files of the torrent item have stopped downloading.
+// The files are removed from the queue once they have all been downloaded.
+func (r *Repository) sendTorrentItemDownloadStatus(tId string) {
+	downloads, err := r.db.GetDebridDownloadsByTorrentItemId(tId)
+	if err != nil {
+		return
+	}
+
+	if len(downloads) == 0 {
+		r.wsEventManager.SendEvent(events.DebridDownloadProgress, map[string]interface{}{
+			"status": "cancelled",
+			"itemID": tId,
+		})
+		return
+	}
+
+	completed, paused := 0, 0
+	for _, d := range downloads {
+		switch d.Status {
+		case DownloadStatusQueued, DownloadStatusDownloading:
+			return // Still downloading
+		case DownloadStatusCompleted:
+			completed++
+		case DownloadStatusPaused:
+			paused++
+		}
+	}
+
+	switch {
+	case completed == len(downloads):
+		for _, d := range downloads {
+			_ = r.db.DeleteDebridDownload(d.ID)
+		}
+		r.sendDownloadCompletedEvent(tId)
+		notifier.GlobalNotifier.Notify(notifier.Debrid, fmt.Sprintf("Downloaded %q", downloads[0].TorrentName))
+	case paused > 0:
+		r.wsEventManager.SendEvent(events.DebridDownloadProgress, map[string]interface{}{
+			"status": "paused",
+			"itemID": tId,
+		})
+	default:
+		r.wsEventManager.SendEvent(events.DebridDownloadProgress, map[string]interface{}{
+			"status": "cancelled",
+			"itemID": tId,
+		})
+	}
+}
+
+// sendTorrentItemDownloadProgress sends the progress of all the files of the torrent item.
+func (r *Repository) sendTorrentItemDownloadProgress(tId string) {
+	downloads, err := r.db.GetDebridDownloadsByTorrentItemId(tId)
+	if err != nil {
+		return
+	}
+
+	totalBytes := uint64(0)
+	totalSize := uint64(0)
+	speed := 0
+
+	r.downloadQueue.mu.Lock()
+	for _, d := range downloads {
+		if rd, found := r.downloadQueue.running[d.ID]; found {
+			totalBytes += uint64(rd.downloadedBytes)
+			totalSize += uint64(rd.totalSize)
+			speed += rd.speed
+			continue
+		}
+		totalBytes += uint64(d.DownloadedBytes)
+		totalSize += uint64(d.TotalSize)
+	}
+	r.downloadQueue.mu.Unlock()
+
+	r.wsEventManager.SendEvent(events.DebridDownloadProgress, map[string]interface{}{
+		"status":     "downloading",
+		"itemID":     tId,
+		"totalBytes": humanize.Bytes(totalBytes),
+		"totalSize":  humanize.Bytes(totalSize),
+		"speed":      speed,
+	})
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// downloadFile downloads the file to a temporary folder in the destination, then moves or extracts it to the destination.
+// If part of the file has already been downloaded, the download is resumed with a Range request.
+func (r *Repository) downloadFile(ctx context.Context, d *models.DebridDownload) (err error) {
+	defer util.HandlePanicInModuleWithError("debrid/client/downloadFile", &err)
+
+	tmpDirPath := getDownloadTmpDirPath(d)
+	if err := os.MkdirAll(tmpDirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create temp folder: %w", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		r.logger.Debug().Str("tmpDirPath", tmpDirPath).Msg("debrid: Hiding temp folder")
+		util.HideFile(tmpDirPath)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	// Resume from the partially downloaded file
+	var offset int64
+	if d.Filename != "" {
+		if info, err := os.Stat(filepath.Join(tmpDirPath, d.Filename)); err == nil {
+			offset = info.Size()
+		}
+	}
+
+	resp, err := r.requestDownload(ctx, d, offset)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		_ = resp.Body.Close()
+		if d.TotalSize > 0 && offset == d.TotalSize {
+			r.logger.Debug().Str("filename", d.Filename).Msg("debrid: File already downloaded")
+			return r.finalizeDownload(d, tmpDirPath)
+		}
+		// The partial file does not match, start over
+		_ = os.Remove(filepath.Join(tmpDirPath, d.Filename))
+		offset = 0
+		resp, err = r.requestDownload(ctx, d, offset)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		r.logger.Debug().Str("filename", d.Filename).Int64("offset", offset).Msg("debrid: Resuming download")
+		if total := parseContentRangeTotal(resp.Header.Get("Content-Range")); total > 0 {
+			d.TotalSize = total
+		} else if resp.ContentLength > 0 {
+			d.TotalSize = offset + resp.ContentLength
+		}
+	case http.StatusOK:
+		// The server does not support ranges, or nothing was downloaded yet
+		offset = 0
+		d.TotalSize = max(resp.ContentLength, 0)
+	default:
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	if d.Filename == "" {
+		d.Filename = r.getDownloadFilename(d.Url, resp)
+		r.logger.Debug().Str("filename", d.Filename).Msg("debrid: Starting download")
+	}
+	_ = r.db.SaveDebridDownload(d)
+
+	filePath := filepath.Join(tmpDirPath, d.Filename)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(filePath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	// Copy the response body to the temporary file
+	buffer := make([]byte, downloadBufferSize)
+	downloaded := offset
+	lastBytes := downloaded
+	lastSent := time.Now()
+	for {
+		n, readErr := resp.Body.Read(buffer)
+		if n > 0 {
+			if err := r.downloadQueue.limiter.WaitN(ctx, n); err != nil {
+				_ = file.Close()
+				return err
+			}
+			if _, err := file.Write(buffer[:n]); err != nil {
+				_ = file.Close()
+				return fmt.Errorf("failed to write to temp file: %w", err)
+			}
+			downloaded += int64(n)
+
+			if time.Since(lastSent) > time.Second*2 {
+				speed := int(float64(downloaded-lastBytes) / time.Since(lastSent).Seconds() / 1024) // KB/s
+				r.downloadQueue.setProgress(d.ID, downloaded, d.TotalSize, speed)
+				_ = r.db.UpdateDebridDownloadProgress(d.ID, downloaded, d.TotalSize)
+				r.sendTorrentItemDownloadProgress(d.TorrentItemID)
+				lastBytes = downloaded
+				lastSent = time.Now()
+			}
+		}
+		if readErr != nil {
+			if readErr == io.EOF {
+				break
+			}
+			_ = file.Close()
+			d.DownloadedBytes = downloaded
+			return fmt.Errorf("failed to read from response body: %w", readErr)
+		}
+	}
+	_ = file.Close()
+	d.DownloadedBytes = downloaded
+
+	// Verify the size of the downloaded file
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if d.TotalSize > 0 && info.Size() != d.TotalSize {
+		if info.Size() > d.TotalSize {
+			_ = os.Remove(filePath)
+			d.DownloadedBytes = 0
+		}
+		return fmt.Errorf("downloaded size (%d) does not match the expected size (%d)", info.Size(), d.TotalSize)
+	}
+
+	r.logger.Debug().Str("filename", d.Filename).Msg("debrid: Download completed")
+
+	return r.finalizeDownload(d, tmpDirPath)
+}
+
+// requestDownload requests the file from the offset.
+// If the download URL has expired, it is refreshed from the provider.
+func (r *Repository) requestDownload(ctx context.Context, d *models.DebridDownload, offset int64) (*http.Response, error) {
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.Url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		return http.DefaultClient.Do(req)
+	}
+
+	resp, err := do()
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		newUrl, refreshErr := r.refreshDownloadUrl(d)
+		if refreshErr != nil || newUrl == d.Url {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+		r.logger.Debug().Str("filename", d.Filename).Msg("debrid: Download URL refreshed")
+		d.Url = newUrl
+		_ = r.db.SaveDebridDownload(d)
+		return do()
+	}
+
+	return resp, nil
+}
+
+// refreshDownloadUrl gets a new download URL for the file from the provider.
+func (r *Repository) refreshDownloadUrl(d *models.DebridDownload) (string, error) {
+	provider, err := r.GetProvider()
+	if err != nil {
+		return "", err
+	}
+	if provider.GetSettings().ID != d.Provider {
+		return "", fmt.Errorf("debrid: Provider changed")
+	}
+
+	downloadUrl, err := provider.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{
+		ID: d.TorrentItemID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	urls := strings.Split(downloadUrl, ",")
+	if d.UrlIndex >= len(urls) {
+		return "", fmt.Errorf("debrid: Download URL not found")
+	}
+
+	return urls[d.UrlIndex], nil
+}
+
+// getDownloadFilename returns the name of the downloaded file from the headers, the content type or the URL.
+func (r *Repository) getDownloadFilename(downloadUrl string, resp *http.Response) string {
+	// e.g. "my-torrent.zip", "downloaded_torrent"
+	filename := "downloaded_torrent"
+	ext := ""
+
+	// Try to get the file name from the Content-Disposition header
+	hFilename, err := getFilenameFromHeaders(downloadUrl)
+	if err == nil {
+		r.logger.Warn().Str("newFilename", hFilename).Str("defaultFilename", filename).Msg("debrid: Filename found in headers, overriding default")
+		filename = hFilename
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err == nil {
+			switch mediaType {
+			case "application/zip":
+				ext = ".zip"
+			case "application/x-rar-compressed":
+				ext = ".rar"
+			default:
+			}
+			r.logger.Debug().Str("mediaType", mediaType).Str("ext", ext).Msg("debrid: Detected media type and extension")
+		}
+	}
+
+	if filename == "downloaded_torrent" && ext != "" {
+		filename = fmt.Sprintf("%s%s", filename, ext)
+	}
+
+	// Check if the download URL has the extension
+	urlExt := filepath.Ext(downloadUrl)
+	if filename == "downloaded_torrent" && urlExt != "" {
+		filename = filepath.Base(downloadUrl)
+		filename, _ = url.PathUnescape(filename)
+		r.logger.Warn().Str("urlExt", urlExt).Str("filename", filename).Str("downloadUrl", downloadUrl).Msg("debrid: Extension found in URL, using it as file extension and file name")
+	}
+
+	return filename
+}
+
+// finalizeDownload extracts or moves the downloaded file to the destination and deletes the temporary folder.
+func (r *Repository) finalizeDownload(d *models.DebridDownload, tmpDirPath string) (err error) {
+	filePath := filepath.Join(tmpDirPath, d.Filename)
+
+	switch runtime.GOOS {
+	case "windows":
+		time.Sleep(time.Second * 1)
+	}
+
+	var extractedDir string
+	switch strings.ToLower(filepath.Ext(d.Filename)) {
+	case ".zip":
+		r.sendExtractingEvent(d.TorrentItemID)
+		extractedDir, err = unzipFile(filePath, tmpDirPath)
+		r.logger.Debug().Str("extractedDir", extractedDir).Msg("debrid: Extracted zip file")
+	case ".rar":
+		r.sendExtractingEvent(d.TorrentItemID)
+		extractedDir, err = unrarFile(filePath, tmpDirPath)
+		r.logger.Debug().Str("extractedDir", extractedDir).Msg("debrid: Extracted rar file")
+	default:
+		r.logger.Debug().Str("filePath", filePath).Str("destination", d.Destination).Msg("debrid: No extraction needed, moving file directly")
+		// Move the file directly to the destination
+		if err = moveFolderOrFileTo(filePath, d.Destination); err != nil {
+			return fmt.Errorf("failed to move downloaded file: %w", err)
+		}
+		_ = os.RemoveAll(tmpDirPath)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract downloaded file: %w", err)
+	}
+
+	r.logger.Debug().Str("extractedDir", extractedDir).Str("destination", d.Destination).Msg("debrid: Moving extracted files to destination")
+
+	// Delete the archive before moving the extracted files
+	_ = os.Remove(filePath)
+
+	if err = moveContentsTo(extractedDir, d.Destination); err != nil {
+		return fmt.Errorf("failed to move downloaded files: %w", err)
+	}
+	_ = os.RemoveAll(tmpDirPath)
+
+	return nil
+}
+
+func (r *Repository) sendExtractingEvent(tId string) {
+	r.wsEventManager.SendEvent(events.DebridDownloadProgress, map[string]interface{}{
+		"status":     "downloading",
+		"itemID":     tId,
+		"totalBytes": "Extracting...",
+		"totalSize":  "-",
+		"speed":      "",
+	})
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// getDownloadTmpDirPath returns the temporary folder holding the partially downloaded file.
+func getDownloadTmpDirPath(d *models.DebridDownload) string {
+	return filepath.Join(d.Destination, fmt.Sprintf(".tmp-debrid-%d", d.ID))
+}
+
+// parseContentRangeTotal returns the complete length from a Content-Range header, e.g. "bytes 100-199/1000".
+// It returns -1 if the length is unknown.
+func parseContentRangeTotal(contentRange string) int64 {
+	_, total, found := strings.Cut(contentRange, "/")
+	if !found || total == "*" {
+		return -1
+	}
+	ret, err := strconv.ParseInt(strings.TrimSpace(total), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return ret
+}
@@ -0,0 +1,257 @@
+package debrid_client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"seanime/internal/events"
+	"seanime/internal/torrent_clients/aria2"
+	"seanime/internal/util"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDownloadQueueRepository(t *testing.T) *Repository {
+	logger := util.NewLogger()
+	database, err := db.NewDatabase(t.TempDir(), "seanime-test", logger)
+	require.NoError(t, err)
+
+	return NewRepository(&NewRepositoryOptions{
+		Logger:         logger,
+		WSEventManager: events.NewMockWSEventManager(logger),
+		Database:       database,
+	})
+}
+
+// waitForDownloads waits until the downloads of the torrent item have stopped.
+func waitForDownloads(t *testing.T, r *Repository, tId string) []*models.DebridDownload {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		downloads, err := r.db.GetDebridDownloadsByTorrentItemId(tId)
+		require.NoError(t, err)
+		active := false
+		for _, d := range downloads {
+			if d.Status == DownloadStatusQueued || d.Status == DownloadStatusDownloading {
+				active = true
+			}
+		}
+		if !active {
+			return downloads
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("downloads did not stop")
+	return nil
+}
+
+func TestDownloadQueue_Resume(t *testing.T) {
+	r := newTestDownloadQueueRepository(t)
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024) // 1 MiB
+
+	var mu sync.Mutex
+	var rangeHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		rangeHeader = req.Header.Get("Range")
+		mu.Unlock()
+		http.ServeContent(w, req, "episode.mkv", time.Now(), bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	destination := t.TempDir()
+
+	d := &models.DebridDownload{
+		TorrentItemID: "1",
+		TorrentName:   "Torrent",
+		Url:           srv.URL + "/episode.mkv",
+		Destination:   destination,
+		Filename:      "episode.mkv",
+		TotalSize:     int64(len(content)),
+		Status:        DownloadStatusDownloading, // Interrupted by a restart
+	}
+	require.NoError(t, r.db.InsertDebridDownloads([]*models.DebridDownload{d}))
+
+	// Half of the file was downloaded before the restart
+	tmpDirPath := getDownloadTmpDirPath(d)
+	require.NoError(t, os.MkdirAll(tmpDirPath, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDirPath, "episode.mkv"), content[:len(content)/2], 0644))
+
+	r.resumeDownloads()
+
+	downloads := waitForDownloads(t, r, "1")
+	assert.Empty(t, downloads, "completed downloads should be removed from the queue")
+
+	mu.Lock()
+	assert.Equal(t, "bytes=524288-", rangeHeader)
+	mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(destination, "episode.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	_, err = os.Stat(tmpDirPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadQueue_SizeMismatch(t *testing.T) {
+	r := newTestDownloadQueueRepository(t)
+
+	// The server announces more data than it sends
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-99/200")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(make([]byte, 100))
+	}))
+	defer srv.Close()
+
+	err := r.queueTorrentItemDownload("1", "Torrent", "", []string{srv.URL + "/episode.mkv"}, t.TempDir())
+	require.NoError(t, err)
+
+	downloads := waitForDownloads(t, r, "1")
+	require.Len(t, downloads, 1)
+	assert.Equal(t, DownloadStatusFailed, downloads[0].Status)
+	assert.Contains(t, downloads[0].Error, "does not match")
+
+	// The partial file is kept so that the download can be resumed
+	_, err = os.Stat(filepath.Join(getDownloadTmpDirPath(downloads[0]), "episode.mkv"))
+	assert.NoError(t, err)
+
+	// Removing the download deletes the partial file
+	require.NoError(t, r.RemoveDownloads([]uint{downloads[0].ID}))
+	_, err = os.Stat(getDownloadTmpDirPath(downloads[0]))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadQueue_ConcurrencyAndOrder(t *testing.T) {
+	r := newTestDownloadQueueRepository(t)
+	r.settings.DownloadConcurrency = 1
+
+	// Downloads are blocked until released
+	release := make(chan struct{})
+	var mu sync.Mutex
+	requested := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			mu.Lock()
+			requested = append(requested, req.URL.Path)
+			mu.Unlock()
+		}
+		<-release
+		http.ServeContent(w, req, filepath.Base(req.URL.Path), time.Now(), bytes.NewReader([]byte("data")))
+	}))
+	defer srv.Close()
+
+	destination := t.TempDir()
+	err := r.queueTorrentItemDownload("1", "Torrent", "", []string{srv.URL + "/a.mkv", srv.URL + "/b.mkv", srv.URL + "/c.mkv"}, destination)
+	require.NoError(t, err)
+
+	downloads, err := r.GetDownloads()
+	require.NoError(t, err)
+	require.Len(t, downloads, 3)
+	assert.Equal(t, DownloadStatusDownloading, downloads[0].Status)
+	assert.Equal(t, DownloadStatusQueued, downloads[1].Status)
+	assert.Equal(t, DownloadStatusQueued, downloads[2].Status)
+
+	// c.mkv is moved before b.mkv, b.mkv is paused
+	require.NoError(t, r.ReorderDownloads([]uint{downloads[2].ID}))
+	require.NoError(t, r.PauseDownloads([]uint{downloads[1].ID}))
+
+	close(release)
+
+	remaining := waitForDownloads(t, r, "1")
+	require.Len(t, remaining, 3)
+	assert.Equal(t, DownloadStatusCompleted, remaining[0].Status) // c.mkv, first in the queue
+	assert.Equal(t, DownloadStatusCompleted, remaining[1].Status) // a.mkv
+	assert.Equal(t, DownloadStatusPaused, remaining[2].Status)    // b.mkv
+
+	mu.Lock()
+	assert.Equal(t, []string{"/a.mkv", "/c.mkv"}, requested)
+	mu.Unlock()
+
+	// Resuming the last file completes the torrent
+	require.NoError(t, r.ResumeDownloads([]uint{remaining[2].ID}))
+	remaining = waitForDownloads(t, r, "1")
+	assert.Empty(t, remaining)
+
+	for _, name := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+		_, err := os.Stat(filepath.Join(destination, name))
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestDownloadQueue_Aria2Reattach(t *testing.T) {
+	r := newTestDownloadQueueRepository(t)
+	r.settings.DownloadWithAria2 = true
+
+	destination := t.TempDir()
+	d := &models.DebridDownload{
+		TorrentItemID: "1",
+		TorrentName:   "Torrent",
+		Url:           "http://localhost/episode.mkv",
+		Destination:   destination,
+		Status:        DownloadStatusDownloading, // Interrupted by a restart
+		Aria2Gid:      "7",
+	}
+	require.NoError(t, r.db.InsertDebridDownloads([]*models.DebridDownload{d}))
+
+	// aria2 kept downloading while Seanime was stopped
+	tmpDirPath := getDownloadTmpDirPath(d)
+	require.NoError(t, os.MkdirAll(tmpDirPath, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDirPath, "episode.mkv"), []byte("data"), 0644))
+
+	var mu sync.Mutex
+	methods := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Method string `json:"method"`
+			ID     string `json:"id"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		mu.Lock()
+		methods = append(methods, body.Method)
+		mu.Unlock()
+
+		var result interface{} = "OK"
+		if body.Method == "aria2.tellStatus" {
+			result = &aria2.Download{Gid: "7", Status: aria2.StatusComplete, TotalLength: "4", CompletedLength: "4",
+				Files: []*aria2.File{{Index: "1", Path: filepath.Join(tmpDirPath, "episode.mkv")}}}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": body.ID, "result": result})
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	r.SetAria2Client(aria2.New(&aria2.NewAria2Options{Logger: util.NewLogger(), Host: u.Hostname(), Port: port}))
+
+	r.resumeDownloads()
+
+	downloads := waitForDownloads(t, r, "1")
+	assert.Empty(t, downloads, "completed downloads should be removed from the queue")
+
+	mu.Lock()
+	assert.NotContains(t, methods, "aria2.addUri", "the download should be re-attached, not added again")
+	mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(destination, "episode.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+}
+
+func TestParseContentRangeTotal(t *testing.T) {
+	assert.Equal(t, int64(1000), parseContentRangeTotal("bytes 100-199/1000"))
+	assert.Equal(t, int64(-1), parseContentRangeTotal("bytes 100-199/*"))
+	assert.Equal(t, int64(-1), parseContentRangeTotal(""))
+}
@@ -1,7 +1,6 @@
 package debrid_client
 
 import (
-	"context"
 	"fmt"
 	"github.com/stretchr/testify/require"
 	"os"
@@ -85,12 +84,9 @@ loop:
 	for {
 		select {
 		case <-time.After(time.Second * 1):
-			isEmpty := true
-			repo.ctxMap.Range(func(key string, value context.CancelFunc) bool {
-				isEmpty = false
-				return true
-			})
-			if isEmpty {
+			downloads, err := repo.GetDownloads()
+			require.NoError(t, err)
+			if len(downloads) == 0 {
 				break loop
 			}
 		}
@@ -10,14 +10,17 @@ import (
 	"seanime/internal/api/metadata"
 	"seanime/internal/database/db"
 	"seanime/internal/database/models"
+	"seanime/internal/debrid/alldebrid"
 	"seanime/internal/debrid/debrid"
+	"seanime/internal/debrid/premiumize"
 	"seanime/internal/debrid/realdebrid"
 	"seanime/internal/debrid/torbox"
 	"seanime/internal/events"
 	"seanime/internal/library/playbackmanager"
 	"seanime/internal/platforms/platform"
+	"seanime/internal/torrent_clients/aria2"
 	"seanime/internal/torrents/torrent"
-	"seanime/internal/util/result"
+	"sync"
 )
 
 var (
@@ -31,7 +34,7 @@ type (
 		db                     *db.Database
 		settings               *models.DebridSettings
 		wsEventManager         events.WSEventManagerInterface
-		ctxMap                 *result.Map[string, context.CancelFunc]
+		downloadQueue          *downloadQueue
 		downloadLoopCancelFunc context.CancelFunc
 		torrentRepository      *torrent.Repository
 
@@ -40,6 +43,8 @@ type (
 		completeAnimeCache *anilist.CompleteAnimeCache
 		metadataProvider   metadata.Provider
 		platform           platform.Platform
+		aria2              *aria2.Aria2
+		aria2Mu            sync.RWMutex
 	}
 
 	NewRepositoryOptions struct {
@@ -68,7 +73,7 @@ func NewRepository(opts *NewRepositoryOptions) (ret *Repository) {
 		playbackManager:    opts.PlaybackManager,
 		metadataProvider:   opts.MetadataProvider,
 		completeAnimeCache: anilist.NewCompleteAnimeCache(),
-		ctxMap:             result.NewResultMap[string, context.CancelFunc](),
+		downloadQueue:      newDownloadQueue(),
 	}
 
 	ret.streamManager = NewStreamManager(ret)
@@ -89,12 +94,15 @@ func (r *Repository) startOrStopDownloadLoop() {
 		ctx, cancel := context.WithCancel(context.Background())
 		r.downloadLoopCancelFunc = cancel
 		r.launchDownloadLoop(ctx)
+		// Resume the downloads interrupted by the last shutdown
+		r.resumeDownloads()
 	}
 }
 
 // InitializeProvider is called each time the settings change
 func (r *Repository) InitializeProvider(settings *models.DebridSettings) error {
 	r.settings = settings
+	r.downloadQueue.setSpeedLimit(settings.DownloadSpeedLimit)
 
 	if !settings.Enabled {
 		r.provider = mo.None[debrid.Provider]()
@@ -108,6 +116,10 @@ func (r *Repository) InitializeProvider(settings *models.DebridSettings) error {
 		r.provider = mo.Some(torbox.NewTorBox(r.logger))
 	case "realdebrid":
 		r.provider = mo.Some(realdebrid.NewRealDebrid(r.logger))
+	case "alldebrid":
+		r.provider = mo.Some(alldebrid.NewAllDebrid(r.logger))
+	case "premiumize":
+		r.provider = mo.Some(premiumize.NewPremiumize(r.logger))
 	default:
 		r.provider = mo.None[debrid.Provider]()
 	}
@@ -197,6 +209,20 @@ func (r *Repository) GetTorrentInfo(opts debrid.GetTorrentInfoOptions) (*debrid.
 	return torrentInfo, nil
 }
 
+// SetAria2Client sets the aria2 client used when DownloadWithAria2 is enabled.
+// The downloads that are running keep the client they started with.
+func (r *Repository) SetAria2Client(client *aria2.Aria2) {
+	r.aria2Mu.Lock()
+	defer r.aria2Mu.Unlock()
+	r.aria2 = client
+}
+
+func (r *Repository) getAria2Client() (*aria2.Aria2, bool) {
+	r.aria2Mu.RLock()
+	defer r.aria2Mu.RUnlock()
+	return r.aria2, r.aria2 != nil
+}
+
 func (r *Repository) HasProvider() bool {
 	return r.provider.IsPresent()
 }
@@ -207,25 +233,20 @@ func (r *Repository) GetSettings() *models.DebridSettings {
 
 // CancelDownload cancels the download for the given item ID
 func (r *Repository) CancelDownload(itemID string) error {
-	cancelFunc, found := r.ctxMap.Get(itemID)
-	if !found {
+	// Remove the files from the download queue
+	downloads, err := r.db.GetDebridDownloadsByTorrentItemId(itemID)
+	if err != nil {
+		return err
+	}
+	if len(downloads) == 0 {
 		return fmt.Errorf("no download found for item ID: %s", itemID)
 	}
 
-	// Call the cancel function to cancel the download
-	if cancelFunc != nil {
-		cancelFunc()
+	ids := make([]uint, 0, len(downloads))
+	for _, d := range downloads {
+		ids = append(ids, d.ID)
 	}
-
-	r.ctxMap.Delete(itemID)
-
-	// Notify that the download has been cancelled
-	r.wsEventManager.SendEvent(events.DebridDownloadProgress, map[string]interface{}{
-		"status": "cancelled",
-		"itemID": itemID,
-	})
-
-	return nil
+	return r.RemoveDownloads(ids)
 }
 
 func (r *Repository) StartStream(opts *StartStreamOptions) error {
@@ -0,0 +1,529 @@
+package premiumize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog"
+	"github.com/samber/mo"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"seanime/internal/debrid/debrid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	Premiumize struct {
+		baseUrl string
+		apiKey  mo.Option[string]
+		client  *http.Client
+		logger  *zerolog.Logger
+	}
+
+	Response struct {
+		Status  string `json:"status"` // "success" or "error"
+		Message string `json:"message"`
+	}
+
+	Transfer struct {
+		ID       string  `json:"id"`
+		Name     string  `json:"name"`
+		Message  string  `json:"message"`
+		Status   string  `json:"status"`
+		Progress float64 `json:"progress"` // 0 to 1
+		Src      string  `json:"src"`      // Magnet link
+		FolderID string  `json:"folder_id"`
+		FileID   string  `json:"file_id"`
+	}
+
+	// DirectDownload lists the files of a cached torrent.
+	DirectDownload struct {
+		Filename string                   `json:"filename"`
+		Filesize int64                    `json:"filesize"`
+		Content  []*DirectDownloadContent `json:"content"`
+	}
+
+	DirectDownloadContent struct {
+		Path       string `json:"path"` // e.g. "Big Buck Bunny/Big Buck Bunny.mp4"
+		Size       int64  `json:"size"`
+		Link       string `json:"link"`
+		StreamLink string `json:"stream_link"`
+	}
+
+	cacheCheckResponse struct {
+		Response []bool    `json:"response"`
+		Filename []*string `json:"filename"`
+		Filesize []*string `json:"filesize"`
+	}
+)
+
+func NewPremiumize(logger *zerolog.Logger) debrid.Provider {
+	return &Premiumize{
+		baseUrl: "https://www.premiumize.me/api",
+		apiKey:  mo.None[string](),
+		client: &http.Client{
+			Timeout: time.Second * 30,
+		},
+		logger: logger,
+	}
+}
+
+func (t *Premiumize) GetSettings() debrid.Settings {
+	return debrid.Settings{
+		ID:   "premiumize",
+		Name: "Premiumize",
+	}
+}
+
+// doQuery sends the request and decodes the response into ret.
+func (t *Premiumize) doQuery(method, uri string, form url.Values, ret interface{}) error {
+	apiKey, found := t.apiKey.Get()
+	if !found {
+		return debrid.ErrNotAuthenticated
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("apikey", apiKey)
+	u.RawQuery = q.Encode()
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var res Response
+	if err := json.Unmarshal(content, &res); err != nil {
+		t.logger.Error().Err(err).Msg("premiumize: Failed to decode response")
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if res.Status != "success" {
+		if res.Message != "" {
+			return fmt.Errorf("request failed: %s", res.Message)
+		}
+		return fmt.Errorf("request failed: %s", resp.Status)
+	}
+
+	if ret == nil {
+		return nil
+	}
+
+	return json.Unmarshal(content, ret)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (t *Premiumize) Authenticate(apiKey string) error {
+	t.apiKey = mo.Some(apiKey)
+	return nil
+}
+
+// GetInstantAvailability returns the cached torrents.
+// Premiumize only returns the name and size of each torrent, the cached file is keyed by the torrent's name.
+func (t *Premiumize) GetInstantAvailability(hashes []string) map[string]debrid.TorrentItemInstantAvailability {
+
+	t.logger.Trace().Strs("hashes", hashes).Msg("premiumize: Checking instant availability")
+
+	availability := make(map[string]debrid.TorrentItemInstantAvailability)
+
+	if len(hashes) == 0 {
+		return availability
+	}
+
+	for i := 0; i < len(hashes); i += 100 {
+		batch := hashes[i:min(i+100, len(hashes))]
+
+		form := url.Values{}
+		for _, hash := range batch {
+			form.Add("items[]", hash)
+		}
+
+		var res cacheCheckResponse
+		err := t.doQuery("POST", t.baseUrl+"/cache/check", form, &res)
+		if err != nil {
+			t.logger.Error().Err(err).Msg("premiumize: Failed to get instant availability")
+			return availability
+		}
+
+		// The results are in the same order as the items
+		for idx, cached := range res.Response {
+			if !cached || idx >= len(batch) {
+				continue
+			}
+
+			name := batch[idx]
+			if idx < len(res.Filename) && res.Filename[idx] != nil {
+				name = *res.Filename[idx]
+			}
+			var size int64
+			if idx < len(res.Filesize) && res.Filesize[idx] != nil {
+				size, _ = strconv.ParseInt(*res.Filesize[idx], 10, 64)
+			}
+
+			availability[batch[idx]] = debrid.TorrentItemInstantAvailability{
+				CachedFiles: t.getCachedFiles(batch[idx], name, size),
+			}
+		}
+	}
+
+	return availability
+}
+
+// getCachedFiles lists the files of a cached torrent, keyed by their path.
+// The cache check only returns the name of the torrent, so the files are listed with a direct download request.
+// If they can't be listed, the torrent is returned as a single file.
+func (t *Premiumize) getCachedFiles(hash string, name string, size int64) map[string]*debrid.CachedFile {
+	dd, err := t.directDownload("magnet:?xt=urn:btih:" + hash)
+	if err != nil || len(dd.Content) == 0 {
+		return map[string]*debrid.CachedFile{
+			name: {Name: name, Size: size},
+		}
+	}
+
+	ret := make(map[string]*debrid.CachedFile, len(dd.Content))
+	for _, c := range dd.Content {
+		ret[c.Path] = &debrid.CachedFile{Name: path.Base(c.Path), Size: c.Size}
+	}
+	return ret
+}
+
+func (t *Premiumize) AddTorrent(opts debrid.AddTorrentOptions) (string, error) {
+
+	// Check if the torrent is already added
+	if opts.InfoHash != "" {
+		transfers, err := t.getTransfers()
+		if err == nil {
+			for _, tr := range transfers {
+				if strings.EqualFold(getHashFromMagnet(tr.Src), opts.InfoHash) {
+					t.logger.Debug().Str("torrentId", tr.ID).Msg("premiumize: Torrent already added")
+					return tr.ID, nil
+				}
+			}
+		}
+	}
+
+	t.logger.Trace().Str("magnetLink", opts.MagnetLink).Msg("premiumize: Adding torrent")
+
+	var res struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	err := t.doQuery("POST", t.baseUrl+"/transfer/create", url.Values{"src": {opts.MagnetLink}}, &res)
+	if err != nil {
+		t.logger.Error().Err(err).Msg("premiumize: Failed to add torrent")
+		return "", fmt.Errorf("premiumize: Failed to add torrent: %w", err)
+	}
+
+	t.logger.Debug().Str("torrentId", res.ID).Str("torrentName", res.Name).Msg("premiumize: Torrent added")
+
+	// Premiumize downloads all files of the torrent, opts.SelectFileId is ignored
+	return res.ID, nil
+}
+
+// GetTorrentStreamUrl blocks until the torrent is downloaded and returns the stream URL for the torrent file by calling GetTorrentDownloadUrl.
+func (t *Premiumize) GetTorrentStreamUrl(ctx context.Context, opts debrid.StreamTorrentOptions, itemCh chan debrid.TorrentItem) (streamUrl string, err error) {
+
+	t.logger.Trace().Str("torrentId", opts.ID).Str("fileId", opts.FileId).Msg("premiumize: Retrieving stream link")
+
+	doneCh := make(chan struct{})
+
+	go func(ctx context.Context) {
+		defer func() {
+			close(doneCh)
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			case <-time.After(4 * time.Second):
+				torrent, _err := t.GetTorrent(opts.ID)
+				if _err != nil {
+					t.logger.Error().Err(_err).Msg("premiumize: Failed to get torrent")
+					err = fmt.Errorf("premiumize: Failed to get torrent: %w", _err)
+					return
+				}
+
+				itemCh <- *torrent
+
+				if torrent.Status == debrid.TorrentItemStatusError {
+					err = fmt.Errorf("premiumize: Torrent failed to download")
+					return
+				}
+
+				// Check if the torrent is ready
+				if torrent.IsReady {
+					downloadUrl, _err := t.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{
+						ID:     opts.ID,
+						FileId: opts.FileId,
+					})
+					if _err != nil {
+						t.logger.Error().Err(_err).Msg("premiumize: Failed to get download URL")
+						err = _err
+						return
+					}
+
+					streamUrl = downloadUrl
+					return
+				}
+			}
+		}
+	}(ctx)
+
+	<-doneCh
+
+	return
+}
+
+// GetTorrentDownloadUrl returns the download URL for the torrent file.
+// If no opts.FileId is provided, it will return a comma-separated list of download URLs for all files in the torrent.
+func (t *Premiumize) GetTorrentDownloadUrl(opts debrid.DownloadTorrentOptions) (downloadUrl string, err error) {
+
+	t.logger.Trace().Str("torrentId", opts.ID).Msg("premiumize: Retrieving download link")
+
+	transfer, err := t.getTransfer(opts.ID)
+	if err != nil {
+		return "", fmt.Errorf("premiumize: Failed to get download URL: %w", err)
+	}
+
+	if !toDebridTorrent(transfer).IsReady {
+		return "", fmt.Errorf("premiumize: Failed to get download URL, torrent is not ready")
+	}
+
+	// Finished transfers are cached, their files are listed by the direct download endpoint
+	dd, err := t.directDownload(transfer.Src)
+	if err != nil {
+		return "", fmt.Errorf("premiumize: Failed to get download URL: %w", err)
+	}
+
+	urls := make([]string, 0, len(dd.Content))
+	for _, c := range dd.Content {
+		if opts.FileId == "" || c.Path == opts.FileId {
+			urls = append(urls, c.Link)
+		}
+	}
+	if len(urls) == 0 {
+		return "", fmt.Errorf("premiumize: Failed to get download URL, file not found")
+	}
+
+	downloadUrl = strings.Join(urls, ",")
+
+	t.logger.Debug().Str("downloadUrl", downloadUrl).Msg("premiumize: Download link retrieved")
+
+	return downloadUrl, nil
+}
+
+func (t *Premiumize) GetTorrent(id string) (ret *debrid.TorrentItem, err error) {
+	transfer, err := t.getTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toDebridTorrent(transfer), nil
+}
+
+// GetTorrentInfo returns the files of a cached torrent without adding it.
+// Premiumize does not list the files of torrents that are not cached.
+func (t *Premiumize) GetTorrentInfo(opts debrid.GetTorrentInfoOptions) (ret *debrid.TorrentInfo, err error) {
+
+	src := opts.MagnetLink
+	if src == "" {
+		if opts.InfoHash == "" {
+			return nil, fmt.Errorf("premiumize: Magnet link or info hash is required")
+		}
+		src = "magnet:?xt=urn:btih:" + opts.InfoHash
+	}
+
+	dd, err := t.directDownload(src)
+	if err != nil {
+		return nil, fmt.Errorf("premiumize: Failed to get info: %w", err)
+	}
+
+	if len(dd.Content) == 0 {
+		return nil, fmt.Errorf("premiumize: Torrent is not cached, its files are not available yet")
+	}
+
+	hash := opts.InfoHash
+	if hash == "" {
+		hash = getHashFromMagnet(src)
+	}
+
+	return toDebridTorrentInfo(dd, hash), nil
+}
+
+func (t *Premiumize) GetTorrents() (ret []*debrid.TorrentItem, err error) {
+
+	transfers, err := t.getTransfers()
+	if err != nil {
+		return nil, fmt.Errorf("premiumize: Failed to get torrents: %w", err)
+	}
+
+	// Premiumize returns the most recent transfers first
+	for _, tr := range transfers {
+		ret = append(ret, toDebridTorrent(tr))
+	}
+
+	return ret, nil
+}
+
+func (t *Premiumize) DeleteTorrent(id string) error {
+
+	err := t.doQuery("POST", t.baseUrl+"/transfer/delete", url.Values{"id": {id}}, nil)
+	if err != nil {
+		t.logger.Error().Err(err).Msg("premiumize: Failed to delete torrent")
+		return fmt.Errorf("premiumize: Failed to delete torrent: %w", err)
+	}
+
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (t *Premiumize) getTransfers() ([]*Transfer, error) {
+	var res struct {
+		Transfers []*Transfer `json:"transfers"`
+	}
+	err := t.doQuery("GET", t.baseUrl+"/transfer/list", nil, &res)
+	if err != nil {
+		t.logger.Error().Err(err).Msg("premiumize: Failed to get torrents")
+		return nil, fmt.Errorf("premiumize: Failed to get torrents: %w", err)
+	}
+	return res.Transfers, nil
+}
+
+// getTransfer returns the transfer with the given ID, Premiumize has no endpoint for a single transfer.
+func (t *Premiumize) getTransfer(id string) (*Transfer, error) {
+	transfers, err := t.getTransfers()
+	if err != nil {
+		return nil, err
+	}
+	for _, tr := range transfers {
+		if tr.ID == id {
+			return tr, nil
+		}
+	}
+	return nil, fmt.Errorf("premiumize: Torrent not found")
+}
+
+func (t *Premiumize) directDownload(src string) (*DirectDownload, error) {
+	var ret DirectDownload
+	err := t.doQuery("POST", t.baseUrl+"/transfer/directdl", url.Values{"src": {src}}, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// getHashFromMagnet returns the lowercase info hash of the magnet link, or an empty string.
+func getHashFromMagnet(magnet string) string {
+	u, err := url.Parse(magnet)
+	if err != nil || u.Scheme != "magnet" {
+		return ""
+	}
+	for _, xt := range u.Query()["xt"] {
+		if strings.HasPrefix(strings.ToLower(xt), "urn:btih:") {
+			return strings.ToLower(xt[len("urn:btih:"):])
+		}
+	}
+	return ""
+}
+
+func toDebridTorrent(tr *Transfer) (ret *debrid.TorrentItem) {
+
+	status := toDebridTorrentStatus(tr)
+
+	completionPercentage := int(tr.Progress * 100)
+	if status == debrid.TorrentItemStatusCompleted || status == debrid.TorrentItemStatusSeeding {
+		completionPercentage = 100
+	}
+
+	ret = &debrid.TorrentItem{
+		ID:                   tr.ID,
+		Name:                 tr.Name,
+		Hash:                 getHashFromMagnet(tr.Src),
+		FormattedSize:        humanize.Bytes(0),
+		CompletionPercentage: completionPercentage,
+		ETA:                  "",
+		Status:               status,
+		Speed:                tr.Message, // e.g. "Downloading at 5.2 MB/s, 1 minute left"
+		IsReady:              status == debrid.TorrentItemStatusCompleted || status == debrid.TorrentItemStatusSeeding,
+	}
+
+	return
+}
+
+func toDebridTorrentInfo(dd *DirectDownload, hash string) (ret *debrid.TorrentInfo) {
+
+	files := make([]*debrid.TorrentItemFile, 0, len(dd.Content))
+	var size int64
+	for idx, c := range dd.Content {
+		files = append(files, &debrid.TorrentItemFile{
+			ID:    c.Path, // The path is used to find the link in GetTorrentDownloadUrl
+			Index: idx,
+			Name:  path.Base(c.Path),
+			Path:  "/" + c.Path,
+			Size:  c.Size,
+		})
+		size += c.Size
+	}
+
+	name := dd.Filename
+	if name == "" && len(dd.Content) > 0 {
+		name = strings.Split(dd.Content[0].Path, "/")[0]
+	}
+
+	ret = &debrid.TorrentInfo{
+		Name:  name,
+		Hash:  hash,
+		Size:  size,
+		Files: files,
+	}
+
+	return
+}
+
+func toDebridTorrentStatus(tr *Transfer) debrid.TorrentItemStatus {
+	switch tr.Status {
+	case "running":
+		return debrid.TorrentItemStatusDownloading
+	case "waiting", "queued":
+		return debrid.TorrentItemStatusStalled
+	case "finished":
+		return debrid.TorrentItemStatusCompleted
+	case "seeding":
+		return debrid.TorrentItemStatusSeeding
+	case "error", "banned", "timeout", "deleted":
+		return debrid.TorrentItemStatusError
+	default:
+		return debrid.TorrentItemStatusOther
+	}
+}
@@ -0,0 +1,197 @@
+package premiumize
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"seanime/internal/debrid/debrid"
+	"seanime/internal/test_utils"
+	"seanime/internal/util"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testApiKey = "test-api-key"
+
+func newTestPremiumize(t *testing.T) (*Premiumize, *test_utils.FixtureServer) {
+	s := test_utils.NewFixtureServer(t, &test_utils.NewFixtureServerOptions{
+		Route: func(r *http.Request) string {
+			if r.URL.Query().Get("apikey") != testApiKey {
+				return "error_auth.json"
+			}
+
+			switch r.URL.Path {
+			case "/cache/check":
+				return "cache_check.json"
+			case "/transfer/list":
+				return "transfer_list.json"
+			case "/transfer/create":
+				return "transfer_create.json"
+			case "/transfer/directdl":
+				if strings.Contains(r.PostForm.Get("src"), "80431b4f9a12f4e06616062d3d3973b9ef99b5e6") {
+					return "transfer_directdl.json"
+				}
+				return "transfer_directdl_uncached.json"
+			case "/transfer/delete":
+				return "transfer_delete.json"
+			}
+			return ""
+		},
+	})
+
+	pm := NewPremiumize(util.NewLogger()).(*Premiumize)
+	pm.baseUrl = s.URL
+
+	err := pm.Authenticate(testApiKey)
+	require.NoError(t, err)
+
+	return pm, s
+}
+
+func TestPremiumize_Authenticate(t *testing.T) {
+	pm, _ := newTestPremiumize(t)
+
+	err := pm.Authenticate("wrong")
+	require.NoError(t, err)
+
+	_, err = pm.GetTorrents()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Not logged in.")
+}
+
+func TestPremiumize_GetTorrents(t *testing.T) {
+	pm, _ := newTestPremiumize(t)
+
+	torrents, err := pm.GetTorrents()
+	require.NoError(t, err)
+	require.Len(t, torrents, 2)
+
+	assert.Equal(t, "tr-2002", torrents[0].ID)
+	assert.Equal(t, "9f4961a9c71eeb53abce2ef2afc587b452dee5eb", torrents[0].Hash)
+	assert.Equal(t, debrid.TorrentItemStatusDownloading, torrents[0].Status)
+	assert.Equal(t, 50, torrents[0].CompletionPercentage)
+	assert.False(t, torrents[0].IsReady)
+
+	assert.Equal(t, "tr-1001", torrents[1].ID)
+	assert.Equal(t, debrid.TorrentItemStatusCompleted, torrents[1].Status)
+	assert.True(t, torrents[1].IsReady)
+}
+
+func TestPremiumize_InstantAvailability(t *testing.T) {
+	pm, s := newTestPremiumize(t)
+
+	avail := pm.GetInstantAvailability([]string{"80431b4f9a12f4e06616062d3d3973b9ef99b5e6", "9f4961a9c71eeb53abce2ef2afc587b452dee5eb"})
+	require.Len(t, avail, 1)
+
+	cached, ok := avail["80431b4f9a12f4e06616062d3d3973b9ef99b5e6"]
+	require.True(t, ok)
+	require.Len(t, cached.CachedFiles, 2)
+
+	// One entry per file of the torrent
+	file, ok := cached.CachedFiles["[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/[SubsPlease] Bocchi the Rock! - 01 (1080p) [E04F4EFB].mkv"]
+	require.True(t, ok)
+	assert.Equal(t, "[SubsPlease] Bocchi the Rock! - 01 (1080p) [E04F4EFB].mkv", file.Name)
+	assert.Equal(t, int64(1442048000), file.Size)
+
+	assert.Len(t, s.Form("/cache/check")["items[]"], 2)
+}
+
+func TestPremiumize_GetTorrentInfo(t *testing.T) {
+	pm, _ := newTestPremiumize(t)
+
+	info, err := pm.GetTorrentInfo(debrid.GetTorrentInfoOptions{
+		MagnetLink: "magnet:?xt=urn:btih:80431b4f9a12f4e06616062d3d3973b9ef99b5e6",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]", info.Name)
+	assert.Equal(t, "80431b4f9a12f4e06616062d3d3973b9ef99b5e6", info.Hash)
+	assert.Equal(t, int64(2884096000), info.Size)
+	require.Len(t, info.Files, 2)
+	assert.Equal(t, "[SubsPlease] Bocchi the Rock! - 02 (1080p) [7C4A3E11].mkv", info.Files[1].Name)
+	assert.Equal(t, "/[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/[SubsPlease] Bocchi the Rock! - 02 (1080p) [7C4A3E11].mkv", info.Files[1].Path)
+
+	// Not cached
+	_, err = pm.GetTorrentInfo(debrid.GetTorrentInfoOptions{
+		InfoHash: "9f4961a9c71eeb53abce2ef2afc587b452dee5eb",
+	})
+	require.Error(t, err)
+}
+
+func TestPremiumize_AddTorrent(t *testing.T) {
+	pm, s := newTestPremiumize(t)
+
+	// Already added
+	id, err := pm.AddTorrent(debrid.AddTorrentOptions{
+		MagnetLink: "magnet:?xt=urn:btih:80431b4f9a12f4e06616062d3d3973b9ef99b5e6",
+		InfoHash:   "80431B4F9A12F4E06616062D3D3973B9EF99B5E6",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tr-1001", id)
+	assert.Nil(t, s.Form("/transfer/create"))
+
+	id, err = pm.AddTorrent(debrid.AddTorrentOptions{
+		MagnetLink: "magnet:?xt=urn:btih:0b3e8a9c1d2f4e5a6b7c8d9e0f1a2b3c4d5e6f70",
+		InfoHash:   "0b3e8a9c1d2f4e5a6b7c8d9e0f1a2b3c4d5e6f70",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tr-3003", id)
+	assert.Equal(t, []string{"magnet:?xt=urn:btih:0b3e8a9c1d2f4e5a6b7c8d9e0f1a2b3c4d5e6f70"}, s.Form("/transfer/create")["src"])
+}
+
+func TestPremiumize_GetDownloadUrl(t *testing.T) {
+	pm, _ := newTestPremiumize(t)
+
+	// Select the second file
+	url, err := pm.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{
+		ID:     "tr-1001",
+		FileId: "[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/[SubsPlease] Bocchi the Rock! - 02 (1080p) [7C4A3E11].mkv",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.premiumize.me/dl/AAAA02/Bocchi%20the%20Rock%20-%2002.mkv", url)
+
+	// All files
+	url, err = pm.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{ID: "tr-1001"})
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(url, ","), 2)
+
+	// Unknown file
+	_, err = pm.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{ID: "tr-1001", FileId: "unknown.mkv"})
+	require.Error(t, err)
+
+	// Not ready
+	_, err = pm.GetTorrentDownloadUrl(debrid.DownloadTorrentOptions{ID: "tr-2002"})
+	require.Error(t, err)
+}
+
+func TestPremiumize_GetTorrentStreamUrl(t *testing.T) {
+	pm, _ := newTestPremiumize(t)
+
+	itemCh := make(chan debrid.TorrentItem, 10)
+
+	streamUrl, err := pm.GetTorrentStreamUrl(context.Background(), debrid.StreamTorrentOptions{
+		ID:     "tr-1001",
+		FileId: "[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/[SubsPlease] Bocchi the Rock! - 01 (1080p) [E04F4EFB].mkv",
+	}, itemCh)
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.premiumize.me/dl/AAAA01/Bocchi%20the%20Rock%20-%2001.mkv", streamUrl)
+
+	require.Len(t, itemCh, 1)
+	item := <-itemCh
+	assert.Equal(t, 100, item.CompletionPercentage)
+
+	// Cancelled while the torrent is downloading
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = pm.GetTorrentStreamUrl(ctx, debrid.StreamTorrentOptions{ID: "tr-2002"}, itemCh)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPremiumize_DeleteTorrent(t *testing.T) {
+	pm, s := newTestPremiumize(t)
+
+	err := pm.DeleteTorrent("tr-1001")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tr-1001"}, s.Form("/transfer/delete")["id"])
+}
@@ -36,11 +36,14 @@ const (
 	ChapterDownloadQueueUpdated = "chapter-download-queue-updated"
 	OfflineSnapshotCreated      = "offline-snapshot-created"
 
-	MediastreamShutdownStream = "mediastream-shutdown-stream"
+	MediastreamShutdownStream  = "mediastream-shutdown-stream"
+	MediastreamThumbnailsReady = "mediastream-thumbnails-ready" // The thumbnail sprites of a file have been generated
+	MediastreamOptimization    = "mediastream-optimization"     // The status or progress of an optimization task has changed
 
 	ExtensionsReloaded = "extensions-reloaded"
 
 	ActiveTorrentCountUpdated = "active-torrent-count-updated"
+	TrackedTorrentImported    = "tracked-torrent-imported" // The files of a completed torrent have been added to the library
 
 	SyncLocalQueueState = "sync-local-queue-state"
 	SyncLocalFinished   = "sync-local-finished"
@@ -49,4 +52,6 @@ const (
 	DebridDownloadProgress = "debrid-download-progress"
 
 	DebridStreamState = "debrid-stream-state"
+
+	SkipSegmentsAnalyzed = "skip-segments-analyzed" // The intro and credits of the episodes of a media have been detected
 )
@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
 	"seanime/internal/database/db_bridge"
 	"seanime/internal/library/anime"
+	"seanime/internal/library/autodownloader"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -231,3 +235,277 @@ func (h *Handler) HandleDeleteAutoDownloaderItem(c echo.Context) error {
 
 	return h.RespondWithData(c, true)
 }
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// HandleGetAutoDownloaderRuleTemplates
+//
+//	@summary returns all rule templates.
+//	@desc It returns an empty slice if there are no templates.
+//	@route /api/v1/auto-downloader/templates [GET]
+//	@returns []anime.AutoDownloaderRuleTemplate
+func (h *Handler) HandleGetAutoDownloaderRuleTemplates(c echo.Context) error {
+	templates, err := db_bridge.GetAutoDownloaderRuleTemplates(h.App.Database)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, templates)
+}
+
+// HandleCreateAutoDownloaderRuleTemplate
+//
+//	@summary creates a new rule template.
+//	@desc The destination can contain placeholders (e.g. "{libraryPath}/{romaji}").
+//	@desc It returns the created template.
+//	@route /api/v1/auto-downloader/template [POST]
+//	@returns anime.AutoDownloaderRuleTemplate
+func (h *Handler) HandleCreateAutoDownloaderRuleTemplate(c echo.Context) error {
+
+	type body struct {
+		Template *anime.AutoDownloaderRuleTemplate `json:"template"`
+	}
+
+	var b body
+
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if b.Template == nil {
+		return h.RespondWithError(c, errors.New("invalid template"))
+	}
+
+	if b.Template.DestinationTemplate == "" {
+		return h.RespondWithError(c, autodownloader.ErrTemplateDestinationRequired)
+	}
+
+	b.Template.DbID = 0
+	if err := db_bridge.InsertAutoDownloaderRuleTemplate(h.App.Database, b.Template); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, b.Template)
+}
+
+// HandleUpdateAutoDownloaderRuleTemplate
+//
+//	@summary updates a rule template.
+//	@desc It returns the updated template.
+//	@route /api/v1/auto-downloader/template [PATCH]
+//	@returns anime.AutoDownloaderRuleTemplate
+func (h *Handler) HandleUpdateAutoDownloaderRuleTemplate(c echo.Context) error {
+
+	type body struct {
+		Template *anime.AutoDownloaderRuleTemplate `json:"template"`
+	}
+
+	var b body
+
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if b.Template == nil {
+		return h.RespondWithError(c, errors.New("invalid template"))
+	}
+
+	if b.Template.DbID == 0 {
+		return h.RespondWithError(c, errors.New("invalid id"))
+	}
+
+	if b.Template.DestinationTemplate == "" {
+		return h.RespondWithError(c, autodownloader.ErrTemplateDestinationRequired)
+	}
+
+	if err := db_bridge.UpdateAutoDownloaderRuleTemplate(h.App.Database, b.Template.DbID, b.Template); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, b.Template)
+}
+
+// HandleDeleteAutoDownloaderRuleTemplate
+//
+//	@summary deletes a rule template.
+//	@desc Rules created from the template are not deleted.
+//	@desc It returns 'true' if the template was deleted.
+//	@route /api/v1/auto-downloader/template/{id} [DELETE]
+//	@param id - int - true - "The DB id of the template"
+//	@returns bool
+func (h *Handler) HandleDeleteAutoDownloaderRuleTemplate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return h.RespondWithError(c, errors.New("invalid id"))
+	}
+
+	if err := db_bridge.DeleteAutoDownloaderRuleTemplate(h.App.Database, uint(id)); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleCreateAutoDownloaderRulesFromTemplate
+//
+//	@summary creates rules from a template for the current season.
+//	@desc A rule is created for every anime in the user's collection that is 'CURRENT' or 'PLANNING' and airing this season.
+//	@desc Anime that already have a rule are skipped.
+//	@desc It returns the created rules.
+//	@route /api/v1/auto-downloader/template/create-rules [POST]
+//	@returns []anime.AutoDownloaderRule
+func (h *Handler) HandleCreateAutoDownloaderRulesFromTemplate(c echo.Context) error {
+
+	type body struct {
+		TemplateID uint `json:"templateId"`
+	}
+
+	var b body
+
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	tmpl, err := db_bridge.GetAutoDownloaderRuleTemplate(h.App.Database, b.TemplateID)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	animeCollection, err := h.App.GetAnimeCollection(false)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	existingRules, err := db_bridge.GetAutoDownloaderRules(h.App.Database)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	libraryPath := ""
+	if h.App.Settings != nil && h.App.Settings.Library != nil {
+		libraryPath = h.App.Settings.Library.LibraryPath
+	}
+
+	rules, err := autodownloader.CreateRulesFromTemplate(tmpl, animeCollection, existingRules, libraryPath, time.Now())
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	for _, rule := range rules {
+		if err := db_bridge.InsertAutoDownloaderRule(h.App.Database, rule); err != nil {
+			return h.RespondWithError(c, err)
+		}
+	}
+
+	return h.RespondWithData(c, rules)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// HandleExportAutoDownloaderRules
+//
+//	@summary exports all rules to a file.
+//	@desc The file is versioned and can be imported on another instance using HandleImportAutoDownloaderRules.
+//	@route /api/v1/auto-downloader/rules/export [GET]
+//	@param format - string - false - "The format of the file, 'json' (default) or 'yaml'"
+func (h *Handler) HandleExportAutoDownloaderRules(c echo.Context) error {
+
+	format := autodownloader.RulesFileFormat(c.QueryParam("format"))
+	if format == "" {
+		format = autodownloader.RulesFileFormatJSON
+	}
+
+	rules, err := db_bridge.GetAutoDownloaderRules(h.App.Database)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	// The collection is only used to add titles and MAL IDs to the file
+	animeCollection, _ := h.App.GetAnimeCollection(false)
+
+	data, err := autodownloader.ExportRules(rules, animeCollection, format)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	contentType := "application/json"
+	if format == autodownloader.RulesFileFormatYAML {
+		contentType = "application/yaml"
+	}
+
+	filename := fmt.Sprintf("seanime-autodownloader-rules-%s.%s", time.Now().Format("2006-01-02_15-04-05"), format)
+
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	return c.Blob(200, contentType, data)
+}
+
+// HandleImportAutoDownloaderRules
+//
+//	@summary imports rules from a file.
+//	@desc The file can be a JSON or YAML file exported by HandleExportAutoDownloaderRules.
+//	@desc Media are resolved by AniList ID, falling back to the MAL ID. Rules for media that are not in the anime collection are skipped.
+//	@desc 'conflictStrategy' determines what happens when a rule already exists for a media: 'skip' (default), 'replace' or 'merge'.
+//	@desc Destinations must be in a library path. If 'remapDestinations' is true, other destinations are moved to the main library path.
+//	@route /api/v1/auto-downloader/rules/import [POST]
+//	@returns autodownloader.ImportRulesResult
+func (h *Handler) HandleImportAutoDownloaderRules(c echo.Context) error {
+
+	type body struct {
+		DataFilePath      string                                     `json:"dataFilePath"`
+		ConflictStrategy  autodownloader.RulesImportConflictStrategy `json:"conflictStrategy"`
+		RemapDestinations bool                                       `json:"remapDestinations"`
+	}
+
+	var b body
+
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	data, err := os.ReadFile(b.DataFilePath)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	animeCollection, err := h.App.GetAnimeCollection(false)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	existingRules, err := db_bridge.GetAutoDownloaderRules(h.App.Database)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	libraryPaths := make([]string, 0)
+	if h.App.Settings != nil && h.App.Settings.Library != nil {
+		libraryPaths = h.App.Settings.Library.GetLibraryPaths()
+	}
+
+	res, err := autodownloader.ImportRules(&autodownloader.ImportRulesOptions{
+		Data:              data,
+		ConflictStrategy:  b.ConflictStrategy,
+		RemapDestinations: b.RemapDestinations,
+		AnimeCollection:   animeCollection,
+		ExistingRules:     existingRules,
+		LibraryPaths:      libraryPaths,
+	})
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	for _, rule := range res.Created {
+		if err := db_bridge.InsertAutoDownloaderRule(h.App.Database, rule); err != nil {
+			return h.RespondWithError(c, err)
+		}
+	}
+
+	for _, rule := range res.Updated {
+		if err := db_bridge.UpdateAutoDownloaderRule(h.App.Database, rule.DbID, rule); err != nil {
+			return h.RespondWithError(c, err)
+		}
+	}
+
+	return h.RespondWithData(c, res)
+}
@@ -183,6 +183,121 @@ func (h *Handler) HandleDebridCancelDownload(c echo.Context) error {
 	return h.RespondWithData(c, true)
 }
 
+// HandleDebridGetDownloads
+//
+//	@summary get the debrid download queue.
+//	@desc This returns the files being downloaded locally from the debrid service, in queue order.
+//	@returns []debrid_client.DownloadQueueItem
+//	@route /api/v1/debrid/downloads [GET]
+func (h *Handler) HandleDebridGetDownloads(c echo.Context) error {
+	downloads, err := h.App.DebridClientRepository.GetDownloads()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, downloads)
+}
+
+// HandleDebridPauseDownloads
+//
+//	@summary pause debrid downloads.
+//	@desc The downloaded data is kept so that the downloads can be resumed.
+//	@returns bool
+//	@route /api/v1/debrid/downloads/pause [POST]
+func (h *Handler) HandleDebridPauseDownloads(c echo.Context) error {
+
+	type body struct {
+		IDs []uint `json:"ids"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.DebridClientRepository.PauseDownloads(b.IDs)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleDebridResumeDownloads
+//
+//	@summary resume debrid downloads.
+//	@desc This queues the paused and failed downloads again.
+//	@returns bool
+//	@route /api/v1/debrid/downloads/resume [POST]
+func (h *Handler) HandleDebridResumeDownloads(c echo.Context) error {
+
+	type body struct {
+		IDs []uint `json:"ids"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.DebridClientRepository.ResumeDownloads(b.IDs)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleDebridReorderDownloads
+//
+//	@summary reorder the debrid download queue.
+//	@desc The given downloads are moved to the front of the queue, in order.
+//	@returns bool
+//	@route /api/v1/debrid/downloads/reorder [POST]
+func (h *Handler) HandleDebridReorderDownloads(c echo.Context) error {
+
+	type body struct {
+		IDs []uint `json:"ids"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.DebridClientRepository.ReorderDownloads(b.IDs)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleDebridRemoveDownloads
+//
+//	@summary remove debrid downloads.
+//	@desc This cancels the downloads and deletes the downloaded data.
+//	@returns bool
+//	@route /api/v1/debrid/downloads [DELETE]
+func (h *Handler) HandleDebridRemoveDownloads(c echo.Context) error {
+
+	type body struct {
+		IDs []uint `json:"ids"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.DebridClientRepository.RemoveDownloads(b.IDs)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
 // HandleDebridDeleteTorrent
 //
 //	@summary remove torrent from debrid.
@@ -61,6 +61,7 @@ func (h *Handler) HandleRemoveFileCacheBucket(c echo.Context) error {
 //
 //	@summary returns the total size of cached video file data.
 //	@desc The total size of the cache video file data is returned in human-readable format.
+//	@desc It includes the transcoded segments kept across sessions.
 //	@route /api/v1/filecache/mediastream/videofiles/total-size [GET]
 //	@returns string
 func (h *Handler) HandleGetFileCacheMediastreamVideoFilesTotalSize(c echo.Context) error {
@@ -3,8 +3,12 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"seanime/internal/database/db_bridge"
 	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
 	"seanime/internal/mediastream"
+	"seanime/internal/mediastream/optimizer"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 )
@@ -40,6 +44,10 @@ func (h *Handler) HandleSaveMediastreamSettings(c echo.Context) error {
 		return h.RespondWithError(c, err)
 	}
 
+	if err := optimizer.ValidateSettings(&b.Settings); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
 	settings, err := h.App.Database.UpsertMediastreamSettings(&b.Settings)
 	if err != nil {
 		return h.RespondWithError(c, err)
@@ -54,6 +62,9 @@ func (h *Handler) HandleSaveMediastreamSettings(c echo.Context) error {
 //
 //	@summary request media stream.
 //	@desc This requests a media stream and returns the media container to start the playback.
+//	@desc The optimized version of the file is played instead of a transcode stream if it exists.
+//	@desc A transcode stream is remuxed instead if the client supports the video codec of the file.
+//	@desc Only H.264 video is remuxed, since the segments are MPEG-TS.
 //	@returns mediastream.MediaContainer
 //	@route /api/v1/mediastream/request [POST]
 func (h *Handler) HandleRequestMediastreamMediaContainer(c echo.Context) error {
@@ -63,6 +74,7 @@ func (h *Handler) HandleRequestMediastreamMediaContainer(c echo.Context) error {
 		StreamType       mediastream.StreamType `json:"streamType"`       // The type of stream to request.
 		AudioStreamIndex int                    `json:"audioStreamIndex"` // The audio stream index to use. (unused)
 		ClientId         string                 `json:"clientId"`         // The session id
+		SupportedCodecs  []string               `json:"supportedCodecs"`  // The MIME codecs supported by the client (e.g. "avc1", "mp4a.40").
 	}
 
 	var b body
@@ -73,14 +85,25 @@ func (h *Handler) HandleRequestMediastreamMediaContainer(c echo.Context) error {
 	var mediaContainer *mediastream.MediaContainer
 	var err error
 
+	// Prefer the pre-transcoded file over a transcode, direct play keeps the original file
+	if b.StreamType == mediastream.StreamTypeTranscode && h.App.MediastreamRepository.IsOptimized(b.Path) {
+		b.StreamType = mediastream.StreamTypeOptimized
+	}
+
+	// Only change the container when the client supports the codecs
+	if b.StreamType == mediastream.StreamTypeTranscode && h.App.MediastreamRepository.CanRemux(b.Path, b.SupportedCodecs) {
+		b.StreamType = mediastream.StreamTypeRemux
+	}
+
 	switch b.StreamType {
 	case mediastream.StreamTypeDirect:
 		mediaContainer, err = h.App.MediastreamRepository.RequestDirectPlay(b.Path, b.ClientId)
 	case mediastream.StreamTypeTranscode:
 		mediaContainer, err = h.App.MediastreamRepository.RequestTranscodeStream(b.Path, b.ClientId)
+	case mediastream.StreamTypeRemux:
+		mediaContainer, err = h.App.MediastreamRepository.RequestRemuxStream(b.Path, b.ClientId, b.SupportedCodecs)
 	case mediastream.StreamTypeOptimized:
-		err = fmt.Errorf("stream type %s not implemented", b.StreamType)
-		//mediaContainer, err = h.App.MediastreamRepository.RequestOptimizedStream(b.Path)
+		mediaContainer, err = h.App.MediastreamRepository.RequestOptimizedStream(b.Path)
 	default:
 		err = fmt.Errorf("stream type %s not implemented", b.StreamType)
 	}
@@ -103,6 +126,7 @@ func (h *Handler) HandlePreloadMediastreamMediaContainer(c echo.Context) error {
 		Path             string                 `json:"path"`             // The path of the file.
 		StreamType       mediastream.StreamType `json:"streamType"`       // The type of stream to request.
 		AudioStreamIndex int                    `json:"audioStreamIndex"` // The audio stream index to use.
+		SupportedCodecs  []string               `json:"supportedCodecs"`  // The MIME codecs supported by the client (e.g. "avc1", "mp4a.40").
 	}
 
 	var b body
@@ -112,11 +136,24 @@ func (h *Handler) HandlePreloadMediastreamMediaContainer(c echo.Context) error {
 
 	var err error
 
+	// Prefer the pre-transcoded file over a transcode, direct play keeps the original file
+	if b.StreamType == mediastream.StreamTypeTranscode && h.App.MediastreamRepository.IsOptimized(b.Path) {
+		b.StreamType = mediastream.StreamTypeOptimized
+	}
+
+	if b.StreamType == mediastream.StreamTypeTranscode && h.App.MediastreamRepository.CanRemux(b.Path, b.SupportedCodecs) {
+		b.StreamType = mediastream.StreamTypeRemux
+	}
+
 	switch b.StreamType {
 	case mediastream.StreamTypeTranscode:
 		err = h.App.MediastreamRepository.RequestPreloadTranscodeStream(b.Path)
+	case mediastream.StreamTypeRemux:
+		err = h.App.MediastreamRepository.RequestPreloadRemuxStream(b.Path)
 	case mediastream.StreamTypeDirect:
 		err = h.App.MediastreamRepository.RequestPreloadDirectPlay(b.Path)
+	case mediastream.StreamTypeOptimized:
+		err = h.App.MediastreamRepository.RequestPreloadOptimizedStream(b.Path)
 	default:
 		err = fmt.Errorf("stream type %s not implemented", b.StreamType)
 	}
@@ -135,6 +172,48 @@ func (h *Handler) HandleMediastreamGetAttachments(c echo.Context) error {
 	return h.App.MediastreamRepository.ServeEchoExtractedAttachments(c)
 }
 
+func (h *Handler) HandleMediastreamGetThumbnails(c echo.Context) error {
+	return h.App.MediastreamRepository.ServeEchoThumbnails(c)
+}
+
+// HandleMediastreamGenerateThumbnails
+//
+//	@summary generates the seek preview thumbnails of files ahead of time.
+//	@desc This queues the generation of the thumbnail sprites of the files in the background.
+//	@desc If no paths are provided, the thumbnails of all the local files are generated.
+//	@desc An events.MediastreamThumbnailsReady event is sent for each file.
+//	@returns bool
+//	@route /api/v1/mediastream/thumbnails/generate [POST]
+func (h *Handler) HandleMediastreamGenerateThumbnails(c echo.Context) error {
+
+	type body struct {
+		Paths []string `json:"paths"` // The paths of the files, empty for the whole library.
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	paths := b.Paths
+	if len(paths) == 0 {
+		lfs, _, err := db_bridge.GetLocalFiles(h.App.Database)
+		if err != nil {
+			return h.RespondWithError(c, err)
+		}
+		for _, lf := range lfs {
+			paths = append(paths, lf.Path)
+		}
+	}
+
+	err := h.App.MediastreamRepository.RequestThumbnails(paths, false)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
 //
 // Direct
 //
@@ -144,6 +223,178 @@ func (h *Handler) HandleMediastreamDirectPlay(c echo.Context) error {
 	return h.App.MediastreamRepository.ServeEchoDirectPlay(c, client)
 }
 
+// HandleMediastreamDirectPlayAudioRemux
+//
+//	@summary streams the current media with a processed audio track.
+//	@desc The video stream is copied, only the selected audio track is encoded (loudness normalization, downmix, codec).
+//	@desc The client should request the stream again with the "start" query parameter when seeking.
+//	@desc The response is the media stream, not JSON.
+//	@returns string
+//	@route /api/v1/mediastream/direct/audio [GET]
+func (h *Handler) HandleMediastreamDirectPlayAudioRemux(c echo.Context) error {
+	client := "1"
+	return h.App.MediastreamRepository.ServeEchoDirectPlayAudioRemux(c, client)
+}
+
+//
+// Optimized
+//
+
+func (h *Handler) HandleMediastreamOptimizedPlay(c echo.Context) error {
+	client := "1"
+	return h.App.MediastreamRepository.ServeEchoOptimizedPlay(c, client)
+}
+
+// HandleGetMediastreamOptimizationQueue
+//
+//	@summary returns the optimization queue.
+//	@desc The progress of the running task is sent through events.MediastreamOptimization events.
+//	@returns []models.MediastreamOptimizationTask
+//	@route /api/v1/mediastream/optimization/queue [GET]
+func (h *Handler) HandleGetMediastreamOptimizationQueue(c echo.Context) error {
+	tasks, err := h.App.MediastreamRepository.GetOptimizationQueue()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, tasks)
+}
+
+// HandleQueueMediastreamLibraryOptimizations
+//
+//	@summary queues the local files matching the optimization rules.
+//	@desc The local files are checked against the rules of the settings in the background.
+//	@desc Files are also checked after each library scan.
+//	@returns bool
+//	@route /api/v1/mediastream/optimization/queue [POST]
+func (h *Handler) HandleQueueMediastreamLibraryOptimizations(c echo.Context) error {
+	lfs, _, err := db_bridge.GetLocalFiles(h.App.Database)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	go h.queueMediastreamLibraryOptimizations(lfs)
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleStartMediastreamOptimization
+//
+//	@summary adds a file to the optimization queue.
+//	@desc The file is optimized regardless of the rules, failed files are retried.
+//	@returns bool
+//	@route /api/v1/mediastream/optimization/file [POST]
+func (h *Handler) HandleStartMediastreamOptimization(c echo.Context) error {
+
+	type body struct {
+		Path      string            `json:"path"`      // The path of the file.
+		MediaId   int               `json:"mediaId"`   // The media ID of the file, optional.
+		Quality   optimizer.Quality `json:"quality"`   // "low", "medium", "high" or "max".
+		MaxHeight int               `json:"maxHeight"` // Taller videos are downscaled, 0 to keep the original height.
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.MediastreamRepository.StartMediaOptimization(&mediastream.StartMediaOptimizationOptions{
+		Filepath:  b.Path,
+		MediaId:   b.MediaId,
+		Quality:   b.Quality,
+		MaxHeight: b.MaxHeight,
+	})
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleDeleteMediastreamOptimizationTask
+//
+//	@summary removes a task from the optimization queue.
+//	@desc The task is interrupted if it's running. The optimized file is kept.
+//	@returns bool
+//	@param id - int - true - "The ID of the task"
+//	@route /api/v1/mediastream/optimization/queue/{id} [DELETE]
+func (h *Handler) HandleDeleteMediastreamOptimizationTask(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return h.RespondWithError(c, errors.New("invalid id"))
+	}
+
+	if err := h.App.MediastreamRepository.DeleteOptimizationTask(uint(id)); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+//
+// Media info index
+//
+
+// HandleIndexMediastreamMediaInfo
+//
+//	@summary indexes the media information of the local files.
+//	@desc The files that haven't been indexed yet, or that were modified since, are probed in the background.
+//	@desc The library is also indexed after each scan.
+//	@returns bool
+//	@route /api/v1/mediastream/media-info/index [POST]
+func (h *Handler) HandleIndexMediastreamMediaInfo(c echo.Context) error {
+	lfs, _, err := db_bridge.GetLocalFiles(h.App.Database)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.MediastreamRepository.IndexLibraryMediaInfo(lfs); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleQueryMediastreamMediaInfoIndex
+//
+//	@summary returns the indexed files matching the filters, with their statistics.
+//	@desc The files that couldn't be probed have an error, they can be listed with "failedOnly".
+//	@returns mediastream.MediaInfoIndexResult
+//	@route /api/v1/mediastream/media-info/query [POST]
+func (h *Handler) HandleQueryMediastreamMediaInfoIndex(c echo.Context) error {
+
+	type body struct {
+		Filter mediastream.MediaInfoIndexFilter `json:"filter"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	ret, err := h.App.MediastreamRepository.QueryMediaInfoIndex(&b.Filter)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, ret)
+}
+
+// queueMediastreamLibraryOptimizations queues the local files matching the optimization rules.
+func (h *Handler) queueMediastreamLibraryOptimizations(lfs []*anime.LocalFile) {
+	settings := h.App.SecondarySettings.Mediastream
+	if settings == nil || !settings.PreTranscodeEnabled {
+		return
+	}
+
+	animeCollection, err := h.App.GetAnimeCollection(false)
+	if err != nil {
+		h.App.Logger.Warn().Err(err).Msg("mediastream: Failed to get anime collection for optimization rules")
+	}
+
+	_, _ = h.App.MediastreamRepository.QueueLibraryOptimizations(lfs, animeCollection)
+}
+
 //
 // Transcode
 //
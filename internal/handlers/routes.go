@@ -37,6 +37,7 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 		"/events",
 		"/api/v1/image-proxy",
 		"/api/v1/mediastream/transcode/",
+		"/api/v1/mediastream/thumbnails/",
 		"/api/v1/torrent-client/list",
 		"/api/v1/proxy",
 	}
@@ -136,10 +137,18 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1.GET("/auto-downloader/rule/:id", h.HandleGetAutoDownloaderRule)
 	v1.GET("/auto-downloader/rule/anime/:id", h.HandleGetAutoDownloaderRulesByAnime)
 	v1.GET("/auto-downloader/rules", h.HandleGetAutoDownloaderRules)
+	v1.GET("/auto-downloader/rules/export", h.HandleExportAutoDownloaderRules)
+	v1.POST("/auto-downloader/rules/import", h.HandleImportAutoDownloaderRules)
 	v1.POST("/auto-downloader/rule", h.HandleCreateAutoDownloaderRule)
 	v1.PATCH("/auto-downloader/rule", h.HandleUpdateAutoDownloaderRule)
 	v1.DELETE("/auto-downloader/rule/:id", h.HandleDeleteAutoDownloaderRule)
 
+	v1.GET("/auto-downloader/templates", h.HandleGetAutoDownloaderRuleTemplates)
+	v1.POST("/auto-downloader/template", h.HandleCreateAutoDownloaderRuleTemplate)
+	v1.PATCH("/auto-downloader/template", h.HandleUpdateAutoDownloaderRuleTemplate)
+	v1.DELETE("/auto-downloader/template/:id", h.HandleDeleteAutoDownloaderRuleTemplate)
+	v1.POST("/auto-downloader/template/create-rules", h.HandleCreateAutoDownloaderRulesFromTemplate)
+
 	v1.GET("/auto-downloader/items", h.HandleGetAutoDownloaderItems)
 	v1.DELETE("/auto-downloader/item", h.HandleDeleteAutoDownloaderItem)
 
@@ -370,8 +379,20 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1.GET("/mediastream/transcode/*", h.HandleMediastreamTranscode)
 	v1.GET("/mediastream/subs/*", h.HandleMediastreamGetSubtitles)
 	v1.GET("/mediastream/att/*", h.HandleMediastreamGetAttachments)
+	v1.GET("/mediastream/thumbnails/*", h.HandleMediastreamGetThumbnails)
+	v1.POST("/mediastream/thumbnails/generate", h.HandleMediastreamGenerateThumbnails)
 	v1.GET("/mediastream/direct", h.HandleMediastreamDirectPlay)
 	v1.HEAD("/mediastream/direct", h.HandleMediastreamDirectPlay)
+	v1.GET("/mediastream/direct/audio", h.HandleMediastreamDirectPlayAudioRemux)
+	// Optimized
+	v1.GET("/mediastream/optimized", h.HandleMediastreamOptimizedPlay)
+	v1.HEAD("/mediastream/optimized", h.HandleMediastreamOptimizedPlay)
+	v1.GET("/mediastream/optimization/queue", h.HandleGetMediastreamOptimizationQueue)
+	v1.POST("/mediastream/optimization/queue", h.HandleQueueMediastreamLibraryOptimizations)
+	v1.DELETE("/mediastream/optimization/queue/:id", h.HandleDeleteMediastreamOptimizationTask)
+	v1.POST("/mediastream/optimization/file", h.HandleStartMediastreamOptimization)
+	v1.POST("/mediastream/media-info/index", h.HandleIndexMediastreamMediaInfo)
+	v1.POST("/mediastream/media-info/query", h.HandleQueryMediastreamMediaInfoIndex)
 	v1.GET("/mediastream/file/*", h.HandleMediastreamFile)
 
 	//
@@ -381,11 +402,16 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1.GET("/torrentstream/settings", h.HandleGetTorrentstreamSettings)
 	v1.PATCH("/torrentstream/settings", h.HandleSaveTorrentstreamSettings)
 	v1.POST("/torrentstream/start", h.HandleTorrentstreamStartStream)
+	v1.GET("/torrentstream/streams", h.HandleGetTorrentstreamStreams)
 	v1.POST("/torrentstream/stop", h.HandleTorrentstreamStopStream)
 	v1.POST("/torrentstream/drop", h.HandleTorrentstreamDropTorrent)
 	v1.POST("/torrentstream/torrent-file-previews", h.HandleGetTorrentstreamTorrentFilePreviews)
 	v1.POST("/torrentstream/batch-history", h.HandleGetTorrentstreamBatchHistory)
 	v1.GET("/torrentstream/stream/*", echo.WrapHandler(h.HandleTorrentstreamServeStream()))
+	v1.GET("/torrentstream/cache", h.HandleGetTorrentstreamCache)
+	v1.DELETE("/torrentstream/cache", h.HandleRemoveTorrentstreamCacheEntries)
+	v1.POST("/torrentstream/cache/promote", h.HandlePromoteTorrentstreamCacheEntry)
+	v1.GET("/torrentstream/cache/stream/*", echo.WrapHandler(h.HandleTorrentstreamServeCachedStream()))
 
 	//
 	// Extensions
@@ -414,6 +440,12 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1Continuity.GET("/item/:id", h.HandleGetContinuityWatchHistoryItem)
 	v1Continuity.GET("/history", h.HandleGetContinuityWatchHistory)
 
+	//
+	// Skip segments
+	//
+	v1.POST("/library/skip-segments", h.HandleGetSkipSegments)
+	v1.POST("/library/skip-segments/analyze", h.HandleAnalyzeSkipSegments)
+
 	//
 	// Sync
 	//
@@ -438,6 +470,11 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1.POST("/debrid/torrents", h.HandleDebridAddTorrents)
 	v1.POST("/debrid/torrents/download", h.HandleDebridDownloadTorrent)
 	v1.POST("/debrid/torrents/cancel", h.HandleDebridCancelDownload)
+	v1.GET("/debrid/downloads", h.HandleDebridGetDownloads)
+	v1.POST("/debrid/downloads/pause", h.HandleDebridPauseDownloads)
+	v1.POST("/debrid/downloads/resume", h.HandleDebridResumeDownloads)
+	v1.POST("/debrid/downloads/reorder", h.HandleDebridReorderDownloads)
+	v1.DELETE("/debrid/downloads", h.HandleDebridRemoveDownloads)
 	v1.DELETE("/debrid/torrent", h.HandleDebridDeleteTorrent)
 	v1.GET("/debrid/torrents", h.HandleDebridGetTorrents)
 	v1.POST("/debrid/torrents/info", h.HandleDebridGetTorrentInfo)
@@ -98,6 +98,10 @@ func (h *Handler) HandleScanLocalFiles(c echo.Context) error {
 
 	go h.App.AutoDownloader.CleanUpDownloadedItems()
 
+	go h.queueMediastreamLibraryOptimizations(lfs)
+
+	go h.App.MediastreamRepository.IndexLibraryMediaInfo(lfs)
+
 	return h.RespondWithData(c, lfs)
 
 }
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/database/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetSkipSegments
+//
+//	@summary returns the intro and credits of a file or of the episodes of a media.
+//	@desc This is used by the web player to display the skip buttons.
+//	@desc If a path is provided, only the segments of that file are returned.
+//	@returns []models.SkipSegment
+//	@route /api/v1/library/skip-segments [POST]
+func (h *Handler) HandleGetSkipSegments(c echo.Context) error {
+	type body struct {
+		Path    string `json:"path"`
+		MediaId int    `json:"mediaId"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if b.Path != "" {
+		segments := h.App.ContinuityManager.GetSkipSegments(b.Path)
+		if segments == nil {
+			segments = make([]*models.SkipSegment, 0)
+		}
+		return h.RespondWithData(c, segments)
+	}
+
+	if b.MediaId == 0 {
+		return h.RespondWithError(c, errors.New("path or media ID is required"))
+	}
+
+	segments, err := h.App.SkipDetector.GetSkipSegments(b.MediaId)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, segments)
+}
+
+// HandleAnalyzeSkipSegments
+//
+//	@summary detects the intro and credits of the episodes of a media.
+//	@desc The audio of the local episodes is fingerprinted in the background.
+//	@desc A "skip-segments-analyzed" event is sent when the analysis is done.
+//	@returns bool
+//	@route /api/v1/library/skip-segments/analyze [POST]
+func (h *Handler) HandleAnalyzeSkipSegments(c echo.Context) error {
+	type body struct {
+		MediaId int `json:"mediaId"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if b.MediaId == 0 {
+		return h.RespondWithError(c, errors.New("media ID is required"))
+	}
+
+	if h.App.SkipDetector.IsAnalyzing(b.MediaId) {
+		return h.RespondWithError(c, errors.New("media is already being analyzed"))
+	}
+
+	lfs, _, err := db_bridge.GetLocalFiles(h.App.Database)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	go func() {
+		if err := h.App.SkipDetector.AnalyzeMedia(b.MediaId, lfs); err != nil {
+			h.App.Logger.Error().Err(err).Int("mediaId", b.MediaId).Msg("skipdetector: Failed to analyze media")
+		}
+	}()
+
+	return h.RespondWithData(c, true)
+}
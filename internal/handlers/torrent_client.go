@@ -158,6 +158,9 @@ func (h *Handler) HandleTorrentClientDownload(c echo.Context) error {
 		if err != nil {
 			return h.RespondWithError(c, err)
 		}
+
+		// Add the files to the library once the torrent is complete
+		h.App.TorrentWatcher.Track(b.Torrents[0].InfoHash, b.Torrents[0].Name, b.Media.ID, b.Destination, 0)
 	} else {
 
 		// Get magnets
@@ -182,6 +185,15 @@ func (h *Handler) HandleTorrentClientDownload(c echo.Context) error {
 		if err != nil {
 			return h.RespondWithError(c, err)
 		}
+
+		// Add the files to the library once the torrents are complete
+		for i, t := range b.Torrents {
+			if t.InfoHash != "" {
+				h.App.TorrentWatcher.Track(t.InfoHash, t.Name, b.Media.ID, b.Destination, 0)
+			} else {
+				h.App.TorrentWatcher.TrackMagnet(magnets[i], t.Name, b.Media.ID, b.Destination, 0)
+			}
+		}
 	}
 
 	// Add the media to the collection (if it wasn't already)
@@ -254,6 +266,9 @@ func (h *Handler) HandleTorrentClientAddMagnetFromRule(c echo.Context) error {
 		return h.RespondWithError(c, err)
 	}
 
+	// Add the files to the library once the torrent is complete
+	h.App.TorrentWatcher.TrackMagnet(b.MagnetUrl, "", rule.MediaId, rule.Destination, rule.DbID)
+
 	if b.QueuedItemId > 0 {
 		// the magnet was added successfully, remove the item from the queue
 		err = h.App.Database.DeleteAutoDownloaderItem(b.QueuedItemId)
@@ -59,6 +59,7 @@ func (h *Handler) HandleGetTorrentstreamSettings(c echo.Context) error {
 //	@summary save torrentstream settings.
 //	@desc This saves the torrentstream settings.
 //	@desc The client should refetch the server status.
+//	@desc Only the bandwidth settings can be changed while a stream is active.
 //	@returns models.TorrentstreamSettings
 //	@route /api/v1/torrentstream/settings [PATCH]
 func (h *Handler) HandleSaveTorrentstreamSettings(c echo.Context) error {
@@ -72,6 +73,14 @@ func (h *Handler) HandleSaveTorrentstreamSettings(c echo.Context) error {
 		return h.RespondWithError(c, err)
 	}
 
+	if err := torrentstream.ValidateSpeedProfiles(b.Settings.SpeedProfiles); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.TorrentstreamRepository.CheckSettingsUpdate(&b.Settings); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
 	settings, err := h.App.Database.UpsertTorrentstreamSettings(&b.Settings)
 	if err != nil {
 		return h.RespondWithError(c, err)
@@ -174,16 +183,36 @@ func (h *Handler) HandleTorrentstreamStartStream(c echo.Context) error {
 	return h.RespondWithData(c, true)
 }
 
+// HandleGetTorrentstreamStreams
+//
+//	@summary returns the running torrent streams.
+//	@desc This returns one stream per client, with the status of its torrent.
+//	@returns []torrentstream.StreamInfo
+//	@route /api/v1/torrentstream/streams [GET]
+func (h *Handler) HandleGetTorrentstreamStreams(c echo.Context) error {
+	return h.RespondWithData(c, h.App.TorrentstreamRepository.GetStreams())
+}
+
 // HandleTorrentstreamStopStream
 //
 //	@summary stop a torrent stream.
-//	@desc This stops the entire streaming process and drops the torrent if it's below a threshold.
+//	@desc This stops the streaming process of the client and drops the torrent if it's below a threshold.
+//	@desc If no client ID is provided, all streams are stopped.
 //	@desc This is made to be used while the stream is running.
 //	@returns bool
 //	@route /api/v1/torrentstream/stop [POST]
 func (h *Handler) HandleTorrentstreamStopStream(c echo.Context) error {
 
-	err := h.App.TorrentstreamRepository.StopStream()
+	type body struct {
+		ClientId string `json:"clientId"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.TorrentstreamRepository.StopStream(b.ClientId)
 	if err != nil {
 		return h.RespondWithError(c, err)
 	}
@@ -194,13 +223,23 @@ func (h *Handler) HandleTorrentstreamStopStream(c echo.Context) error {
 // HandleTorrentstreamDropTorrent
 //
 //	@summary drops a torrent stream.
-//	@desc This stops the entire streaming process and drops the torrent completely.
+//	@desc This stops the streaming process of the client and drops the torrent completely.
+//	@desc If no client ID is provided, all streams are stopped and all torrents are dropped.
 //	@desc This is made to be used to force drop a torrent.
 //	@returns bool
 //	@route /api/v1/torrentstream/drop [POST]
 func (h *Handler) HandleTorrentstreamDropTorrent(c echo.Context) error {
 
-	err := h.App.TorrentstreamRepository.DropTorrent()
+	type body struct {
+		ClientId string `json:"clientId"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.TorrentstreamRepository.DropTorrent(b.ClientId)
 	if err != nil {
 		return h.RespondWithError(c, err)
 	}
@@ -227,6 +266,81 @@ func (h *Handler) HandleGetTorrentstreamBatchHistory(c echo.Context) error {
 	return h.RespondWithData(c, ret)
 }
 
+// HandleGetTorrentstreamCache
+//
+//	@summary returns the cached episodes.
+//	@desc The files of completed streams are kept in the cache, from the most recently watched.
+//	@returns torrentstream.CacheSummary
+//	@route /api/v1/torrentstream/cache [GET]
+func (h *Handler) HandleGetTorrentstreamCache(c echo.Context) error {
+	ret, err := h.App.TorrentstreamRepository.GetCache()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, ret)
+}
+
+// HandleRemoveTorrentstreamCacheEntries
+//
+//	@summary deletes cached episodes.
+//	@returns bool
+//	@route /api/v1/torrentstream/cache [DELETE]
+func (h *Handler) HandleRemoveTorrentstreamCacheEntries(c echo.Context) error {
+
+	type body struct {
+		IDs []uint `json:"ids"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.TorrentstreamRepository.RemoveCacheEntries(b.IDs)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandlePromoteTorrentstreamCacheEntry
+//
+//	@summary moves a cached episode to the library.
+//	@desc The file is moved to a folder named after the media in the library path and added to the local files.
+//	@desc It is matched with the media and episode it was streamed for.
+//	@desc If no library path is provided, the main library path is used.
+//	@returns anime.LocalFile
+//	@route /api/v1/torrentstream/cache/promote [POST]
+func (h *Handler) HandlePromoteTorrentstreamCacheEntry(c echo.Context) error {
+
+	type body struct {
+		ID          uint   `json:"id"`
+		LibraryPath string `json:"libraryPath"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	lf, err := h.App.TorrentstreamRepository.PromoteCacheEntry(&torrentstream.PromoteCacheEntryOptions{
+		ID:          b.ID,
+		LibraryPath: b.LibraryPath,
+	})
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, lf)
+}
+
+// route /api/v1/torrentstream/cache/stream/*
+func (h *Handler) HandleTorrentstreamServeCachedStream() http.Handler {
+	return h.App.TorrentstreamRepository.HTTPCacheHandler()
+}
+
 // route /api/v1/torrentstream/stream/*
 func (h *Handler) HandleTorrentstreamServeStream() http.Handler {
 	return h.App.TorrentstreamRepository.HTTPStreamHandler()
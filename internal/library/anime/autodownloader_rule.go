@@ -11,11 +11,19 @@ const (
 const (
 	AutoDownloaderRuleEpisodeRecent   AutoDownloaderRuleEpisodeType = "recent"
 	AutoDownloaderRuleEpisodeSelected AutoDownloaderRuleEpisodeType = "selected"
+	AutoDownloaderRuleEpisodeComplete AutoDownloaderRuleEpisodeType = "complete" // Download the missing episodes of a finished show using a batch
+)
+
+const (
+	SeedingPolicyActionNone   SeedingPolicyAction = ""       // Keep seeding
+	SeedingPolicyActionStop   SeedingPolicyAction = "stop"   // Stop the torrent
+	SeedingPolicyActionRemove SeedingPolicyAction = "remove" // Remove the torrent from the client
 )
 
 type (
 	AutoDownloaderRuleTitleComparisonType string
 	AutoDownloaderRuleEpisodeType         string
+	SeedingPolicyAction                   string
 
 	// AutoDownloaderRule is a rule that is used to automatically download media.
 	// The structs are sent to the client, thus adding `dbId` to facilitate mutations.
@@ -31,5 +39,34 @@ type (
 		EpisodeNumbers      []int                                 `json:"episodeNumbers,omitempty"`
 		Destination         string                                `json:"destination"`
 		AdditionalTerms     []string                              `json:"additionalTerms"`
+		// SeedingPolicy overrides the seeding policy of the torrent settings for the torrents added by this rule.
+		SeedingPolicy *AutoDownloaderRuleSeedingPolicy `json:"seedingPolicy,omitempty"`
+		// DebridCachedOnly skips the releases that are not cached by the debrid service, when debrid is used.
+		DebridCachedOnly bool `json:"debridCachedOnly,omitempty"`
+	}
+
+	// AutoDownloaderRuleSeedingPolicy is applied to the completed torrents once one of the limits is reached.
+	AutoDownloaderRuleSeedingPolicy struct {
+		Action      SeedingPolicyAction `json:"action"`
+		Ratio       float64             `json:"ratio"`       // 0 = no limit
+		SeedingTime int                 `json:"seedingTime"` // Minutes, 0 = no limit
+		DeleteData  bool                `json:"deleteData"`
+	}
+
+	// AutoDownloaderRuleTemplate holds the options shared by rules that are created in bulk.
+	// DestinationTemplate and ComparisonTitleTemplate can contain placeholders (e.g. "{libraryPath}/{romaji}")
+	// that are replaced with the media's data when a rule is created from the template.
+	AutoDownloaderRuleTemplate struct {
+		DbID                    uint                                  `json:"dbId"` // Will be set when fetched from the database
+		Name                    string                                `json:"name"`
+		Enabled                 bool                                  `json:"enabled"`
+		ReleaseGroups           []string                              `json:"releaseGroups"`
+		Resolutions             []string                              `json:"resolutions"`
+		AdditionalTerms         []string                              `json:"additionalTerms"`
+		TitleComparisonType     AutoDownloaderRuleTitleComparisonType `json:"titleComparisonType"`
+		EpisodeType             AutoDownloaderRuleEpisodeType         `json:"episodeType"`
+		EpisodeNumbers          []int                                 `json:"episodeNumbers,omitempty"`
+		DestinationTemplate     string                                `json:"destinationTemplate"`
+		ComparisonTitleTemplate string                                `json:"comparisonTitleTemplate,omitempty"` // Defaults to "{romaji}"
 	}
 )
@@ -11,7 +11,9 @@ import (
 	"seanime/internal/debrid/debrid"
 	"seanime/internal/events"
 	"seanime/internal/library/anime"
+	"seanime/internal/library/torrentwatcher"
 	"seanime/internal/notifier"
+	"seanime/internal/platforms/platform"
 	"seanime/internal/torrent_clients/torrent_client"
 	"seanime/internal/torrents/torrent"
 	"seanime/internal/util"
@@ -45,11 +47,14 @@ type (
 		wsEventManager          events.WSEventManagerInterface
 		settings                *models.AutoDownloaderSettings
 		metadataProvider        metadata.Provider
+		platform                platform.Platform
+		torrentWatcher          *torrentwatcher.Watcher
 		settingsUpdatedCh       chan struct{}
 		stopCh                  chan struct{}
 		startCh                 chan struct{}
 		debugTrace              bool
 		mu                      sync.Mutex
+		ruleAiringTimes         map[uint]ruleAiringTimes // Only accessed by the check loop
 	}
 
 	NewAutoDownloaderOptions struct {
@@ -60,6 +65,8 @@ type (
 		Database                *db.Database
 		MetadataProvider        metadata.Provider
 		DebridClientRepository  *debrid_client.Repository
+		Platform                platform.Platform
+		TorrentWatcher          *torrentwatcher.Watcher
 	}
 
 	tmpTorrentToDownload struct {
@@ -78,6 +85,8 @@ func New(opts *NewAutoDownloaderOptions) *AutoDownloader {
 		animeCollection:         mo.None[*anilist.AnimeCollection](),
 		metadataProvider:        opts.MetadataProvider,
 		debridClientRepository:  opts.DebridClientRepository,
+		platform:                opts.Platform,
+		torrentWatcher:          opts.TorrentWatcher,
 		settings: &models.AutoDownloaderSettings{
 			Provider:              torrent.ProviderAnimeTosho, // Default provider, will be updated after the settings are fetched
 			Interval:              20,
@@ -90,6 +99,7 @@ func New(opts *NewAutoDownloaderOptions) *AutoDownloader {
 		startCh:           make(chan struct{}, 1),
 		debugTrace:        true,
 		mu:                sync.Mutex{},
+		ruleAiringTimes:   make(map[uint]ruleAiringTimes),
 	}
 }
 
@@ -199,7 +209,8 @@ func (ad *AutoDownloader) start() {
 		if ad.settings != nil && ad.settings.Interval > 0 && ad.settings.Interval >= 15 {
 			interval = ad.settings.Interval
 		}
-		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		// Check sooner if an episode is expected to be released before the next interval
+		timer := time.NewTimer(ad.getNextCheckDelay(time.Duration(interval) * time.Minute))
 		select {
 		case <-ad.settingsUpdatedCh:
 			break // Restart the loop
@@ -210,12 +221,12 @@ func (ad *AutoDownloader) start() {
 				ad.logger.Debug().Msg("autodownloader: Auto Downloader started")
 				ad.checkForNewEpisodes()
 			}
-		case <-ticker.C:
+		case <-timer.C:
 			if ad.settings.Enabled {
 				ad.checkForNewEpisodes()
 			}
 		}
-		ticker.Stop()
+		timer.Stop()
 	}
 
 }
@@ -284,6 +295,9 @@ func (ad *AutoDownloader) checkForNewEpisodes() {
 		return
 	}
 
+	// Check which torrents are cached by the debrid service, nil if debrid is not used
+	cachedHashes := ad.getDebridCachedHashes(torrents)
+
 	// Get existing torrents
 	existingTorrents := make([]*torrent_client.Torrent, 0)
 	if ad.torrentClientRepository != nil {
@@ -326,75 +340,22 @@ func (ad *AutoDownloader) checkForNewEpisodes() {
 				items = make([]*models.AutoDownloaderItem, 0)
 			}
 
-			// Get all torrents that follow the rule
-			torrentsToDownload := make([]*tmpTorrentToDownload, 0)
-		outer:
-			for _, t := range torrents {
-				// If the torrent is already added, skip it
-				for _, et := range existingTorrents {
-					if et.Hash == t.InfoHash {
-						continue outer // Skip the torrent
-					}
-				}
-
-				episode, ok := ad.torrentFollowsRule(t, rule, listEntry, localEntry, items)
-				if ok {
-					torrentsToDownload = append(torrentsToDownload, &tmpTorrentToDownload{
-						torrent: t,
-						episode: episode,
-					})
-				}
-			}
-
-			// Download the torrent if there's only one
-			if len(torrentsToDownload) == 1 {
-				t := torrentsToDownload[0]
-				ok := ad.downloadTorrent(t.torrent, rule, t.episode)
-				if ok {
+			// +---------------------+
+			// |   Complete series   |
+			// +---------------------+
+			// Batches are searched for separately, the latest torrents are single episodes
+			if rule.EpisodeType == anime.AutoDownloaderRuleEpisodeComplete {
+				if ok := ad.downloadCompleteSeries(rule, listEntry, localEntry, items, existingTorrents); ok {
+					mu.Lock()
 					downloaded++
+					mu.Unlock()
 				}
 				return
 			}
 
-			// If there's more than one, we will group them by episode and sort them
-			// Make a map [episode]torrents
-			epMap := make(map[int][]*tmpTorrentToDownload)
-			for _, t := range torrentsToDownload {
-				if _, ok := epMap[t.episode]; !ok {
-					epMap[t.episode] = make([]*tmpTorrentToDownload, 0)
-					epMap[t.episode] = append(epMap[t.episode], t)
-				} else {
-					epMap[t.episode] = append(epMap[t.episode], t)
-				}
-			}
-
-			// Go through each episode group and download the best torrent (by resolution and seeders)
-			for ep, torrents := range epMap {
-
-				// If there's only one torrent for the episode, download it
-				if len(torrents) == 1 {
-					ok := ad.downloadTorrent(torrents[0].torrent, rule, ep)
-					if ok {
-						mu.Lock()
-						downloaded++
-						mu.Unlock()
-					}
-					continue
-				}
-
-				// If there are more than one
-				// Sort by resolution
-				sort.Slice(torrents, func(i, j int) bool {
-					qI := comparison.ExtractResolutionInt(torrents[i].torrent.ParsedData.VideoResolution)
-					qJ := comparison.ExtractResolutionInt(torrents[j].torrent.ParsedData.VideoResolution)
-					return qI > qJ
-				})
-				// Sort by seeds
-				sort.Slice(torrents, func(i, j int) bool {
-					return torrents[i].torrent.Seeders > torrents[j].torrent.Seeders
-				})
-
-				ok := ad.downloadTorrent(torrents[0].torrent, rule, ep)
+			// Download the best torrent of each episode that follows the rule
+			for ep, t := range ad.selectRuleTorrents(torrents, rule, listEntry, localEntry, items, existingTorrents, cachedHashes) {
+				ok := ad.downloadTorrent(t, rule, ep)
 				if ok {
 					mu.Lock()
 					downloaded++
@@ -421,6 +382,63 @@ func (ad *AutoDownloader) checkForNewEpisodes() {
 
 }
 
+// selectRuleTorrents returns the torrent to download for each episode that follows the rule.
+// If there are several torrents for an episode, the releases cached by the debrid service are preferred, then the highest resolutions and seeders.
+func (ad *AutoDownloader) selectRuleTorrents(
+	torrents []*NormalizedTorrent,
+	rule *anime.AutoDownloaderRule,
+	listEntry *anilist.AnimeListEntry,
+	localEntry *anime.LocalFileWrapperEntry,
+	items []*models.AutoDownloaderItem,
+	existingTorrents []*torrent_client.Torrent,
+	cachedHashes map[string]struct{},
+) map[int]*NormalizedTorrent {
+	// Get all torrents that follow the rule
+	torrentsToDownload := make([]*tmpTorrentToDownload, 0)
+outer:
+	for _, t := range filterByDebridAvailability(torrents, cachedHashes, rule.DebridCachedOnly) {
+		// If the torrent is already added, skip it
+		for _, et := range existingTorrents {
+			if et.Hash == t.InfoHash {
+				continue outer // Skip the torrent
+			}
+		}
+
+		episode, ok := ad.torrentFollowsRule(t, rule, listEntry, localEntry, items)
+		if ok {
+			torrentsToDownload = append(torrentsToDownload, &tmpTorrentToDownload{
+				torrent: t,
+				episode: episode,
+			})
+		}
+	}
+
+	// Group them by episode
+	epMap := make(map[int][]*NormalizedTorrent)
+	for _, t := range torrentsToDownload {
+		epMap[t.episode] = append(epMap[t.episode], t.torrent)
+	}
+
+	ret := make(map[int]*NormalizedTorrent, len(epMap))
+	for ep, torrents := range epMap {
+		// If there are more than one
+		// Sort by resolution
+		sort.SliceStable(torrents, func(i, j int) bool {
+			qI := comparison.ExtractResolutionInt(torrents[i].ParsedData.VideoResolution)
+			qJ := comparison.ExtractResolutionInt(torrents[j].ParsedData.VideoResolution)
+			return qI > qJ
+		})
+		// Sort by seeds
+		sort.SliceStable(torrents, func(i, j int) bool {
+			return torrents[i].Seeders > torrents[j].Seeders
+		})
+		// Prefer the releases cached by the debrid service
+		ret[ep] = filterByDebridAvailability(torrents, cachedHashes, false)[0]
+	}
+
+	return ret
+}
+
 func (ad *AutoDownloader) torrentFollowsRule(
 	t *NormalizedTorrent,
 	rule *anime.AutoDownloaderRule,
@@ -564,6 +582,9 @@ func (ad *AutoDownloader) downloadTorrent(t *NormalizedTorrent, rule *anime.Auto
 				return false
 			}
 
+			// Add the files to the library once the torrent is complete
+			ad.torrentWatcher.Track(t.InfoHash, t.Name, rule.MediaId, rule.Destination, rule.DbID)
+
 			downloaded = true
 		}
 	}
@@ -0,0 +1,352 @@
+package autodownloader
+
+import (
+	"cmp"
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/models"
+	"seanime/internal/debrid/debrid"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/torrent_clients/torrent_client"
+	"seanime/internal/torrents/analyzer"
+	"seanime/internal/torrents/torrent"
+	"seanime/internal/util"
+	"seanime/internal/util/comparison"
+	"slices"
+	"time"
+
+	"github.com/5rahim/habari"
+	hibiketorrent "github.com/5rahim/hibike/pkg/extension/torrent"
+	"github.com/samber/lo"
+)
+
+const (
+	// BatchItemEpisode is the episode number of queued items that were added for a batch torrent.
+	BatchItemEpisode = -1
+	// seadexProviderID is the ID of the built-in SeaDex provider extension.
+	seadexProviderID = "seadex"
+)
+
+// downloadCompleteSeries downloads a batch torrent for a rule in "complete" mode.
+// It only runs for finished shows that have episodes missing from the library.
+func (ad *AutoDownloader) downloadCompleteSeries(
+	rule *anime.AutoDownloaderRule,
+	listEntry *anilist.AnimeListEntry,
+	localEntry *anime.LocalFileWrapperEntry,
+	items []*models.AutoDownloaderItem,
+	existingTorrents []*torrent_client.Torrent,
+) bool {
+	defer util.HandlePanicInModuleThen("autodownloader/downloadCompleteSeries", func() {})
+
+	media := listEntry.GetMedia()
+	if !media.IsFinished() {
+		return false
+	}
+
+	// Skip if a batch was already queued or downloaded
+	for _, item := range items {
+		if item.Episode == BatchItemEpisode {
+			return false
+		}
+	}
+
+	missingEpisodes := getMissingEpisodeNumbers(media, localEntry)
+	if len(missingEpisodes) == 0 {
+		return false
+	}
+
+	torrents := ad.findBatchTorrents(rule, media)
+	torrents = lo.Filter(torrents, func(t *NormalizedTorrent, _ int) bool {
+		return !lo.ContainsBy(existingTorrents, func(et *torrent_client.Torrent) bool {
+			return et.Hash == t.InfoHash
+		})
+	})
+	// Prefer the batches cached by the debrid service
+	torrents = filterByDebridAvailability(torrents, ad.getDebridCachedHashes(torrents), rule.DebridCachedOnly)
+	if len(torrents) == 0 {
+		ad.logger.Debug().Int("mediaId", media.GetID()).Msg("autodownloader: No batch torrent found")
+		return false
+	}
+
+	return ad.downloadBatchTorrent(torrents[0], rule, media, missingEpisodes)
+}
+
+// findBatchTorrents returns the batch torrents that follow the rule, SeaDex-recommended releases first.
+func (ad *AutoDownloader) findBatchTorrents(rule *anime.AutoDownloaderRule, media *anilist.BaseAnime) []*NormalizedTorrent {
+	search := func(providerId string) []*hibiketorrent.AnimeTorrent {
+		data, err := ad.torrentRepository.SearchAnime(torrent.AnimeSearchOptions{
+			Provider: providerId,
+			Type:     torrent.AnimeSearchTypeSmart,
+			Media:    media,
+			Batch:    true,
+		})
+		if err != nil {
+			ad.logger.Warn().Err(err).Str("provider", providerId).Msg("autodownloader: Failed to search for batch torrents")
+			return nil
+		}
+		return data.Torrents
+	}
+
+	var seadexTorrents, otherTorrents []*hibiketorrent.AnimeTorrent
+
+	// SeaDex releases are preferred
+	if _, found := ad.torrentRepository.GetAnimeProviderExtension(seadexProviderID); found {
+		seadexTorrents = search(seadexProviderID)
+	}
+
+	providerExt, found := ad.torrentRepository.GetDefaultAnimeProviderExtension()
+	if found && providerExt.GetID() != seadexProviderID && providerExt.GetProvider().GetSettings().CanSmartSearch {
+		otherTorrents = search(providerExt.GetID())
+	}
+
+	return ad.selectBatchTorrents(seadexTorrents, otherTorrents, rule)
+}
+
+// selectBatchTorrents returns the batch torrents that follow the rule.
+// SeaDex releases come first, the other releases are sorted by resolution, then by seeders.
+func (ad *AutoDownloader) selectBatchTorrents(seadexTorrents []*hibiketorrent.AnimeTorrent, otherTorrents []*hibiketorrent.AnimeTorrent, rule *anime.AutoDownloaderRule) []*NormalizedTorrent {
+	ret := make([]*NormalizedTorrent, 0)
+
+	for _, t := range seadexTorrents {
+		nt := &NormalizedTorrent{AnimeTorrent: *t, ParsedData: habari.Parse(t.Name)}
+		// SeaDex torrent names don't contain the resolution
+		if !ad.isReleaseGroupMatch(t.ReleaseGroup, rule) || !ad.isAdditionalTermsMatch(t.Name, rule) {
+			continue
+		}
+		ret = append(ret, nt)
+	}
+
+	others := make([]*NormalizedTorrent, 0)
+	for _, t := range otherTorrents {
+		nt := &NormalizedTorrent{AnimeTorrent: *t, ParsedData: habari.Parse(t.Name)}
+		// Smart searches can return single episodes, only batches are downloaded
+		if !isBatchTorrent(nt) {
+			continue
+		}
+		if !ad.isReleaseGroupMatch(nt.ParsedData.ReleaseGroup, rule) ||
+			!ad.isResolutionMatch(nt.ParsedData.VideoResolution, rule) ||
+			!ad.isAdditionalTermsMatch(t.Name, rule) {
+			continue
+		}
+		others = append(others, nt)
+	}
+
+	// Sort by resolution, then by seeders
+	slices.SortStableFunc(others, func(a, b *NormalizedTorrent) int {
+		qA := comparison.ExtractResolutionInt(a.ParsedData.VideoResolution)
+		qB := comparison.ExtractResolutionInt(b.ParsedData.VideoResolution)
+		if qA != qB {
+			return cmp.Compare(qB, qA)
+		}
+		return cmp.Compare(b.Seeders, a.Seeders)
+	})
+
+	ret = append(ret, others...)
+
+	return lo.UniqBy(ret, func(t *NormalizedTorrent) string {
+		return t.InfoHash
+	})
+}
+
+// isBatchTorrent returns true if the torrent is a batch, or if its name doesn't contain a single episode number.
+func isBatchTorrent(t *NormalizedTorrent) bool {
+	return t.IsBatch || len(t.ParsedData.EpisodeNumber) != 1
+}
+
+func (ad *AutoDownloader) downloadBatchTorrent(t *NormalizedTorrent, rule *anime.AutoDownloaderRule, media *anilist.BaseAnime, missingEpisodes []int) bool {
+	defer util.HandlePanicInModuleThen("autodownloader/downloadBatchTorrent", func() {})
+
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	providerExtension, found := ad.torrentRepository.GetAnimeProviderExtension(t.Provider)
+	if !found {
+		providerExtension, found = ad.torrentRepository.GetDefaultAnimeProviderExtension()
+		if !found {
+			ad.logger.Warn().Msg("autodownloader: Could not download batch torrent. Provider not found")
+			return false
+		}
+	}
+
+	if ad.torrentClientRepository == nil {
+		ad.logger.Error().Msg("autodownloader: torrent client not found")
+		return false
+	}
+
+	magnet, err := t.GetMagnet(providerExtension.GetProvider())
+	if err != nil {
+		ad.logger.Error().Str("link", t.Link).Str("name", t.Name).Msg("autodownloader: Failed to get magnet link for batch torrent")
+		return false
+	}
+
+	downloaded := false
+
+	if ad.settings.UseDebrid {
+		//
+		// Debrid
+		//
+		if !ad.debridClientRepository.HasProvider() || !ad.debridClientRepository.GetSettings().Enabled {
+			ad.logger.Error().Msg("autodownloader: Debrid provider not found or not enabled")
+			return false
+		}
+
+		// DEVNOTE: Files are not deselected when using debrid, the whole batch is downloaded
+		if ad.settings.DownloadAutomatically {
+			_, err := ad.debridClientRepository.AddAndQueueTorrent(debrid.AddTorrentOptions{
+				MagnetLink:   magnet,
+				SelectFileId: "all", // RD-only, select all files
+			}, rule.Destination, rule.MediaId)
+			if err != nil {
+				ad.logger.Error().Err(err).Str("name", t.Name).Msg("autodownloader: Failed to add batch torrent to debrid")
+				return false
+			}
+		} else {
+			debridProvider, err := ad.debridClientRepository.GetProvider()
+			if err != nil {
+				ad.logger.Error().Err(err).Msg("autodownloader: Failed to get debrid provider")
+				return false
+			}
+			_, err = debridProvider.AddTorrent(debrid.AddTorrentOptions{
+				MagnetLink:   magnet,
+				SelectFileId: "all", // RD-only, select all files
+			})
+			if err != nil {
+				ad.logger.Error().Err(err).Str("name", t.Name).Msg("autodownloader: Failed to add batch torrent to debrid")
+				return false
+			}
+		}
+	} else if ad.settings.DownloadAutomatically {
+		//
+		// Torrent client
+		//
+		started := ad.torrentClientRepository.Start()
+		if !started {
+			ad.logger.Error().Str("name", t.Name).Msg("autodownloader: Failed to download batch torrent. torrent client is not running.")
+			return false
+		}
+
+		if ad.torrentClientRepository.TorrentExists(t.InfoHash) {
+			return false
+		}
+
+		ad.logger.Debug().Msgf("autodownloader: Downloading batch torrent: %s", t.Name)
+
+		err := ad.torrentClientRepository.AddMagnets([]string{magnet}, rule.Destination)
+		if err != nil {
+			ad.logger.Error().Err(err).Str("name", t.Name).Msg("autodownloader: Failed to add batch torrent to torrent client")
+			return false
+		}
+
+		// Add the files to the library once the torrent is complete
+		ad.torrentWatcher.Track(t.InfoHash, t.Name, rule.MediaId, rule.Destination, rule.DbID)
+
+		// Deselect the episodes that are already in the library, this can take a while
+		go ad.deselectExistingBatchFiles(t.InfoHash, media, missingEpisodes)
+
+		downloaded = true
+	}
+
+	ad.logger.Info().Str("name", t.Name).Int("missingEpisodes", len(missingEpisodes)).Msg("autodownloader: Added batch torrent")
+	ad.wsEventManager.SendEvent(events.AutoDownloaderItemAdded, t.Name)
+
+	_ = ad.database.InsertAutoDownloaderItem(&models.AutoDownloaderItem{
+		RuleID:      rule.DbID,
+		MediaID:     rule.MediaId,
+		Episode:     BatchItemEpisode,
+		Link:        t.Link,
+		Hash:        t.InfoHash,
+		Magnet:      magnet,
+		TorrentName: t.Name,
+		Downloaded:  downloaded,
+	})
+
+	return true
+}
+
+// deselectExistingBatchFiles analyzes the files of the batch torrent and deselects the episodes that are not missing.
+// If the analysis fails, all files are downloaded.
+func (ad *AutoDownloader) deselectExistingBatchFiles(hash string, media *anilist.BaseAnime, missingEpisodes []int) {
+	defer util.HandlePanicInModuleThen("autodownloader/deselectExistingBatchFiles", func() {})
+
+	if ad.platform == nil {
+		return
+	}
+
+	filepaths, err := ad.torrentClientRepository.GetFiles(hash)
+	if err != nil {
+		ad.logger.Warn().Err(err).Str("hash", hash).Msg("autodownloader: Failed to get batch torrent files")
+		return
+	}
+
+	// Pause the torrent while the files are analyzed
+	_ = ad.torrentClientRepository.PauseTorrents([]string{hash})
+	defer func() {
+		time.Sleep(1 * time.Second)
+		_ = ad.torrentClientRepository.ResumeTorrents([]string{hash})
+	}()
+
+	completeAnime, err := ad.platform.GetAnimeWithRelations(media.GetID())
+	if err != nil {
+		ad.logger.Warn().Err(err).Msg("autodownloader: Failed to fetch media for batch torrent analysis")
+		return
+	}
+
+	analysis, err := torrent_analyzer.NewAnalyzer(&torrent_analyzer.NewAnalyzerOptions{
+		Logger:           ad.logger,
+		Filepaths:        filepaths,
+		Media:            completeAnime,
+		Platform:         ad.platform,
+		MetadataProvider: ad.metadataProvider,
+	}).AnalyzeTorrentFiles()
+	if err != nil {
+		ad.logger.Warn().Err(err).Msg("autodownloader: Failed to analyze batch torrent files")
+		return
+	}
+
+	episodes := lo.MapValues(analysis.GetCorrespondingMainFiles(), func(f *torrent_analyzer.File, _ int) int {
+		return f.GetLocalFile().GetEpisodeNumber()
+	})
+	indices := getBatchIndicesToDeselect(episodes, missingEpisodes)
+	if len(indices) == 0 {
+		return
+	}
+
+	if err := ad.torrentClientRepository.DeselectFiles(hash, indices); err != nil {
+		ad.logger.Warn().Err(err).Msg("autodownloader: Failed to deselect batch torrent files")
+		return
+	}
+
+	ad.logger.Debug().Str("hash", hash).Int("count", len(indices)).Msg("autodownloader: Deselected episodes already in the library")
+}
+
+// getBatchIndicesToDeselect returns the indices of the main episode files that are not missing from the library.
+// The episodes are the episode numbers of the main files, by file index.
+func getBatchIndicesToDeselect(episodes map[int]int, missingEpisodes []int) []int {
+	ret := make([]int, 0)
+	for idx, episode := range episodes {
+		if !lo.Contains(missingEpisodes, episode) {
+			ret = append(ret, idx)
+		}
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// getMissingEpisodeNumbers returns the episode numbers of the media that are not in the library.
+func getMissingEpisodeNumbers(media *anilist.BaseAnime, localEntry *anime.LocalFileWrapperEntry) []int {
+	count := media.GetCurrentEpisodeCount()
+	if count <= 0 {
+		return nil
+	}
+
+	ret := make([]int, 0)
+	for ep := 1; ep <= count; ep++ {
+		if localEntry != nil {
+			if _, found := localEntry.FindLocalFileWithEpisodeNumber(ep); found {
+				continue
+			}
+		}
+		ret = append(ret, ep)
+	}
+	return ret
+}
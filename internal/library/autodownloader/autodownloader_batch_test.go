@@ -0,0 +1,77 @@
+package autodownloader
+
+import (
+	hibiketorrent "github.com/5rahim/hibike/pkg/extension/torrent"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"testing"
+)
+
+func TestGetMissingEpisodeNumbers(t *testing.T) {
+	media := &anilist.BaseAnime{ID: 1, Episodes: lo.ToPtr(5)}
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, getMissingEpisodeNumbers(media, nil))
+
+	lfs := []*anime.LocalFile{
+		{MediaId: 1, Metadata: &anime.LocalFileMetadata{Episode: 1, Type: anime.LocalFileTypeMain}},
+		{MediaId: 1, Metadata: &anime.LocalFileMetadata{Episode: 3, Type: anime.LocalFileTypeMain}},
+		{MediaId: 1, Metadata: &anime.LocalFileMetadata{Episode: 4, Type: anime.LocalFileTypeSpecial}},
+	}
+	localEntry, found := anime.NewLocalFileWrapper(lfs).GetLocalEntryById(1)
+	if assert.True(t, found) {
+		assert.Equal(t, []int{2, 4, 5}, getMissingEpisodeNumbers(media, localEntry))
+	}
+
+	// Unknown episode count
+	assert.Empty(t, getMissingEpisodeNumbers(&anilist.BaseAnime{ID: 2}, nil))
+}
+
+func TestSelectBatchTorrents(t *testing.T) {
+	ad := &AutoDownloader{
+		logger:   util.NewLogger(),
+		settings: &models.AutoDownloaderSettings{},
+	}
+
+	seadexTorrents := []*hibiketorrent.AnimeTorrent{
+		{Name: "[Okay-Subs] Sousou no Frieren (BD Remux)", ReleaseGroup: "Okay-Subs", InfoHash: "seadex", IsBatch: true},
+	}
+	otherTorrents := []*hibiketorrent.AnimeTorrent{
+		{Name: "[SubsPlease] Sousou no Frieren (01-28) (720p) [Batch]", InfoHash: "720p", Seeders: 500},
+		{Name: "[SubsPlease] Sousou no Frieren (01-28) (1080p) [Batch]", InfoHash: "subsplease", Seeders: 100},
+		{Name: "[Erai-raws] Sousou no Frieren - 01 ~ 28 [1080p][Multiple Subtitle]", InfoHash: "erai", Seeders: 300},
+		{Name: "[SubsPlease] Sousou no Frieren - 28 (1080p) [ABCD1234].mkv", InfoHash: "single", Seeders: 1000},
+		// Also returned by the default provider
+		{Name: "[Okay-Subs] Sousou no Frieren (BD Remux)", InfoHash: "seadex", Seeders: 50, IsBatch: true},
+	}
+
+	hashes := func(torrents []*NormalizedTorrent) []string {
+		return lo.Map(torrents, func(t *NormalizedTorrent, _ int) string { return t.InfoHash })
+	}
+
+	// SeaDex releases come first, then batches by resolution and seeders. Single episodes are ignored.
+	rule := &anime.AutoDownloaderRule{EpisodeType: anime.AutoDownloaderRuleEpisodeComplete}
+	assert.Equal(t, []string{"seadex", "erai", "subsplease", "720p"}, hashes(ad.selectBatchTorrents(seadexTorrents, otherTorrents, rule)))
+
+	// The resolution doesn't filter SeaDex releases, their names don't contain it
+	rule.Resolutions = []string{"1080p"}
+	assert.Equal(t, []string{"seadex", "erai", "subsplease"}, hashes(ad.selectBatchTorrents(seadexTorrents, otherTorrents, rule)))
+
+	rule.ReleaseGroups = []string{"SubsPlease"}
+	assert.Equal(t, []string{"subsplease"}, hashes(ad.selectBatchTorrents(seadexTorrents, otherTorrents, rule)))
+
+	// No batch found
+	assert.Empty(t, ad.selectBatchTorrents(nil, otherTorrents[3:4], &anime.AutoDownloaderRule{}))
+}
+
+func TestGetBatchIndicesToDeselect(t *testing.T) {
+	// Episodes 2 and 4 are missing from the library, the other episodes of the batch are not downloaded
+	episodes := map[int]int{0: 1, 1: 2, 2: 3, 5: 4}
+	assert.Equal(t, []int{0, 2}, getBatchIndicesToDeselect(episodes, []int{2, 4}))
+
+	// Every episode is missing
+	assert.Empty(t, getBatchIndicesToDeselect(episodes, []int{1, 2, 3, 4}))
+}
@@ -0,0 +1,67 @@
+package autodownloader
+
+import (
+	"slices"
+	"strings"
+)
+
+// getDebridCachedHashes returns the info hashes of the torrents that are cached by the debrid service, in lowercase.
+// The availability of all the torrents is checked in one batch.
+// It returns nil if debrid is not used.
+func (ad *AutoDownloader) getDebridCachedHashes(torrents []*NormalizedTorrent) map[string]struct{} {
+	if !ad.settings.UseDebrid || ad.debridClientRepository == nil || !ad.debridClientRepository.HasProvider() {
+		return nil
+	}
+
+	provider, err := ad.debridClientRepository.GetProvider()
+	if err != nil {
+		return nil
+	}
+
+	hashes := make([]string, 0, len(torrents))
+	for _, t := range torrents {
+		if t.InfoHash != "" {
+			hashes = append(hashes, strings.ToLower(t.InfoHash))
+		}
+	}
+	hashes = slices.Compact(slices.Sorted(slices.Values(hashes)))
+
+	ret := make(map[string]struct{})
+	if len(hashes) == 0 {
+		return ret
+	}
+
+	for hash := range provider.GetInstantAvailability(hashes) {
+		ret[strings.ToLower(hash)] = struct{}{}
+	}
+
+	ad.logger.Debug().Int("count", len(ret)).Int("total", len(hashes)).Msg("autodownloader: Checked debrid instant availability")
+
+	return ret
+}
+
+func isDebridCached(cached map[string]struct{}, t *NormalizedTorrent) bool {
+	_, found := cached[strings.ToLower(t.InfoHash)]
+	return found
+}
+
+// filterByDebridAvailability moves the torrents cached by the debrid service first, keeping the order otherwise.
+// If cachedOnly is true, the torrents that are not cached are removed.
+// The torrents are returned as is if cached is nil.
+func filterByDebridAvailability(torrents []*NormalizedTorrent, cached map[string]struct{}, cachedOnly bool) []*NormalizedTorrent {
+	if cached == nil {
+		return torrents
+	}
+
+	ret := make([]*NormalizedTorrent, 0, len(torrents))
+	uncached := make([]*NormalizedTorrent, 0)
+	for _, t := range torrents {
+		if isDebridCached(cached, t) {
+			ret = append(ret, t)
+		} else if !cachedOnly {
+			uncached = append(uncached, t)
+		}
+	}
+
+	return append(ret, uncached...)
+}
@@ -0,0 +1,110 @@
+package autodownloader
+
+import (
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+	torrent_client "seanime/internal/torrent_clients/torrent_client"
+	"seanime/internal/util"
+	"testing"
+
+	"github.com/5rahim/habari"
+	hibiketorrent "github.com/5rahim/hibike/pkg/extension/torrent"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterByDebridAvailability(t *testing.T) {
+	newTorrent := func(name string, hash string) *NormalizedTorrent {
+		return &NormalizedTorrent{AnimeTorrent: hibiketorrent.AnimeTorrent{Name: name, InfoHash: hash}}
+	}
+	torrents := []*NormalizedTorrent{
+		newTorrent("1080p", "AAAA"),
+		newTorrent("720p", "bbbb"),
+		newTorrent("480p", "cccc"),
+		newTorrent("No hash", ""),
+	}
+	cached := map[string]struct{}{"aaaa": {}, "cccc": {}}
+
+	names := func(torrents []*NormalizedTorrent) []string {
+		ret := make([]string, 0, len(torrents))
+		for _, t := range torrents {
+			ret = append(ret, t.Name)
+		}
+		return ret
+	}
+
+	// Cached torrents first, in the same order
+	assert.Equal(t, []string{"1080p", "480p", "720p", "No hash"}, names(filterByDebridAvailability(torrents, cached, false)))
+
+	// Only cached torrents
+	assert.Equal(t, []string{"1080p", "480p"}, names(filterByDebridAvailability(torrents, cached, true)))
+
+	// Debrid is not used
+	assert.Equal(t, []string{"1080p", "720p", "480p", "No hash"}, names(filterByDebridAvailability(torrents, nil, true)))
+}
+
+func TestSelectRuleTorrents(t *testing.T) {
+	ad := &AutoDownloader{
+		logger:   util.NewLogger(),
+		settings: &models.AutoDownloaderSettings{},
+	}
+	listEntry := &anilist.AnimeListEntry{
+		Media: &anilist.BaseAnime{
+			ID:       154587,
+			Title:    &anilist.BaseAnime_Title{Romaji: lo.ToPtr("Sousou no Frieren"), English: lo.ToPtr("Frieren")},
+			Episodes: lo.ToPtr(12),
+			Format:   lo.ToPtr(anilist.MediaFormatTv),
+		},
+	}
+	rule := &anime.AutoDownloaderRule{
+		MediaId:             154587,
+		Resolutions:         []string{"1080p"},
+		TitleComparisonType: anime.AutoDownloaderRuleTitleComparisonLikely,
+		ComparisonTitle:     "Frieren",
+		EpisodeType:         anime.AutoDownloaderRuleEpisodeRecent,
+	}
+
+	newTorrent := func(name string, hash string, seeders int) *NormalizedTorrent {
+		return &NormalizedTorrent{
+			AnimeTorrent: hibiketorrent.AnimeTorrent{Name: name, InfoHash: hash, Seeders: seeders},
+			ParsedData:   habari.Parse(name),
+		}
+	}
+	torrents := []*NormalizedTorrent{
+		newTorrent("[SubsPlease] Frieren - 03 (1080p) [A1B2C3D4].mkv", "aaaa", 100),
+		newTorrent("[Erai-raws] Frieren - 03 [1080p][Multiple Subtitle].mkv", "bbbb", 10),
+		newTorrent("[SubsPlease] Frieren - 04 (720p) [A1B2C3D4].mkv", "cccc", 100),
+		newTorrent("[SubsPlease] Frieren - 04 (1080p) [A1B2C3D4].mkv", "dddd", 100),
+		newTorrent("[SubsPlease] Frieren - 05 (1080p) [A1B2C3D4].mkv", "eeee", 100),
+	}
+	// Episode 4 was already added to the torrent client
+	existingTorrents := []*torrent_client.Torrent{{Hash: "dddd"}}
+
+	hashes := func(selected map[int]*NormalizedTorrent) map[int]string {
+		ret := make(map[int]string, len(selected))
+		for ep, t := range selected {
+			ret[ep] = t.InfoHash
+		}
+		return ret
+	}
+
+	// Debrid is not used, the release with the most seeders is selected
+	selected := ad.selectRuleTorrents(torrents, rule, listEntry, nil, nil, existingTorrents, nil)
+	assert.Equal(t, map[int]string{3: "aaaa", 5: "eeee"}, hashes(selected))
+
+	// The release cached by the debrid service is preferred
+	cached := map[string]struct{}{"bbbb": {}}
+	selected = ad.selectRuleTorrents(torrents, rule, listEntry, nil, nil, existingTorrents, cached)
+	assert.Equal(t, map[int]string{3: "bbbb", 5: "eeee"}, hashes(selected))
+
+	// Only the cached releases are downloaded
+	rule.DebridCachedOnly = true
+	selected = ad.selectRuleTorrents(torrents, rule, listEntry, nil, nil, existingTorrents, cached)
+	assert.Equal(t, map[int]string{3: "bbbb"}, hashes(selected))
+
+	// Episodes that were already downloaded are skipped
+	rule.DebridCachedOnly = false
+	selected = ad.selectRuleTorrents(torrents, rule, listEntry, nil, []*models.AutoDownloaderItem{{Episode: 3}}, existingTorrents, cached)
+	assert.Equal(t, map[int]string{5: "eeee"}, hashes(selected))
+}
@@ -0,0 +1,297 @@
+package autodownloader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// RulesFileVersion is the version of the rules file format.
+	// It should be incremented when a breaking change is made to RulesFile.
+	RulesFileVersion = 1
+)
+
+const (
+	RulesFileFormatJSON RulesFileFormat = "json"
+	RulesFileFormatYAML RulesFileFormat = "yaml"
+)
+
+const (
+	RulesImportConflictSkip    RulesImportConflictStrategy = "skip"    // Keep the existing rule
+	RulesImportConflictReplace RulesImportConflictStrategy = "replace" // Overwrite the existing rule with the imported one
+	RulesImportConflictMerge   RulesImportConflictStrategy = "merge"   // Add the imported groups, resolutions, terms and episodes to the existing rule
+)
+
+type (
+	RulesFileFormat             string
+	RulesImportConflictStrategy string
+
+	// RulesFile is the portable representation of the auto downloader rules.
+	// Rules are keyed by AniList ID, the MAL ID is stored as a fallback.
+	RulesFile struct {
+		Version    int              `json:"version" yaml:"version"`
+		ExportedAt time.Time        `json:"exportedAt" yaml:"exportedAt"`
+		Rules      []*RulesFileRule `json:"rules" yaml:"rules"`
+	}
+
+	RulesFileRule struct {
+		MediaId             int                                         `json:"mediaId" yaml:"mediaId"`
+		MalId               int                                         `json:"malId,omitempty" yaml:"malId,omitempty"`
+		Title               string                                      `json:"title,omitempty" yaml:"title,omitempty"` // Only used for readability
+		Enabled             bool                                        `json:"enabled" yaml:"enabled"`
+		ReleaseGroups       []string                                    `json:"releaseGroups,omitempty" yaml:"releaseGroups,omitempty"`
+		Resolutions         []string                                    `json:"resolutions,omitempty" yaml:"resolutions,omitempty"`
+		ComparisonTitle     string                                      `json:"comparisonTitle" yaml:"comparisonTitle"`
+		TitleComparisonType anime.AutoDownloaderRuleTitleComparisonType `json:"titleComparisonType" yaml:"titleComparisonType"`
+		EpisodeType         anime.AutoDownloaderRuleEpisodeType         `json:"episodeType" yaml:"episodeType"`
+		EpisodeNumbers      []int                                       `json:"episodeNumbers,omitempty" yaml:"episodeNumbers,omitempty"`
+		Destination         string                                      `json:"destination" yaml:"destination"`
+		AdditionalTerms     []string                                    `json:"additionalTerms,omitempty" yaml:"additionalTerms,omitempty"`
+	}
+
+	ImportRulesOptions struct {
+		Data             []byte
+		ConflictStrategy RulesImportConflictStrategy
+		// RemapDestinations moves destinations that are not in a library path to the main library path.
+		// If false, rules with such destinations are skipped.
+		RemapDestinations bool
+		AnimeCollection   *anilist.AnimeCollection
+		ExistingRules     []*anime.AutoDownloaderRule
+		LibraryPaths      []string // The first path is the main library path
+	}
+
+	// ImportRulesResult contains the changes that should be persisted by the caller.
+	ImportRulesResult struct {
+		Created []*anime.AutoDownloaderRule `json:"created"`
+		Updated []*anime.AutoDownloaderRule `json:"updated"`
+		Skipped []*ImportRulesSkippedRule   `json:"skipped"`
+	}
+
+	ImportRulesSkippedRule struct {
+		MediaId int    `json:"mediaId"`
+		Title   string `json:"title"`
+		Reason  string `json:"reason"`
+	}
+)
+
+// ExportRules converts the rules to a rules file in the given format.
+func ExportRules(rules []*anime.AutoDownloaderRule, animeCollection *anilist.AnimeCollection, format RulesFileFormat) ([]byte, error) {
+	file := &RulesFile{
+		Version:    RulesFileVersion,
+		ExportedAt: time.Now().UTC(),
+		Rules:      make([]*RulesFileRule, 0, len(rules)),
+	}
+
+	for _, rule := range rules {
+		r := &RulesFileRule{
+			MediaId:             rule.MediaId,
+			Enabled:             rule.Enabled,
+			ReleaseGroups:       rule.ReleaseGroups,
+			Resolutions:         rule.Resolutions,
+			ComparisonTitle:     rule.ComparisonTitle,
+			TitleComparisonType: rule.TitleComparisonType,
+			EpisodeType:         rule.EpisodeType,
+			EpisodeNumbers:      rule.EpisodeNumbers,
+			Destination:         rule.Destination,
+			AdditionalTerms:     rule.AdditionalTerms,
+		}
+		if animeCollection != nil {
+			if media, found := animeCollection.FindAnime(rule.MediaId); found {
+				r.Title = media.GetPreferredTitle()
+				if media.GetIDMal() != nil {
+					r.MalId = *media.GetIDMal()
+				}
+			}
+		}
+		file.Rules = append(file.Rules, r)
+	}
+
+	switch format {
+	case RulesFileFormatYAML:
+		return yaml.Marshal(file)
+	case RulesFileFormatJSON, "":
+		return json.MarshalIndent(file, "", "  ")
+	}
+
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+// ParseRulesFile parses a JSON or YAML rules file.
+func ParseRulesFile(data []byte) (*RulesFile, error) {
+	var file RulesFile
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("rules file is empty")
+	}
+
+	var err error
+	if trimmed[0] == '{' {
+		err = json.Unmarshal(trimmed, &file)
+	} else {
+		err = yaml.Unmarshal(trimmed, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules file: %w", err)
+	}
+
+	if file.Version == 0 || file.Version > RulesFileVersion {
+		return nil, fmt.Errorf("unsupported rules file version: %d", file.Version)
+	}
+
+	return &file, nil
+}
+
+// ImportRules resolves the rules from the rules file against the anime collection and the existing rules.
+// It does not write to the database.
+func ImportRules(opts *ImportRulesOptions) (*ImportRulesResult, error) {
+	if opts.AnimeCollection == nil {
+		return nil, errors.New("anime collection not found")
+	}
+
+	switch opts.ConflictStrategy {
+	case RulesImportConflictSkip, RulesImportConflictReplace, RulesImportConflictMerge:
+	case "":
+		opts.ConflictStrategy = RulesImportConflictSkip
+	default:
+		return nil, fmt.Errorf("invalid conflict strategy: %s", opts.ConflictStrategy)
+	}
+
+	file, err := ParseRulesFile(opts.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &ImportRulesResult{
+		Created: make([]*anime.AutoDownloaderRule, 0),
+		Updated: make([]*anime.AutoDownloaderRule, 0),
+		Skipped: make([]*ImportRulesSkippedRule, 0),
+	}
+
+	existingRules := make(map[int]*anime.AutoDownloaderRule, len(opts.ExistingRules))
+	for _, rule := range opts.ExistingRules {
+		if _, found := existingRules[rule.MediaId]; !found {
+			existingRules[rule.MediaId] = rule
+		}
+	}
+
+	allMedia := opts.AnimeCollection.GetAllAnime()
+
+	for _, r := range file.Rules {
+		skip := func(reason string) {
+			ret.Skipped = append(ret.Skipped, &ImportRulesSkippedRule{
+				MediaId: r.MediaId,
+				Title:   r.Title,
+				Reason:  reason,
+			})
+		}
+
+		// Resolve the media by AniList ID, then by MAL ID
+		media, found := opts.AnimeCollection.FindAnime(r.MediaId)
+		if !found && r.MalId > 0 {
+			media, found = lo.Find(allMedia, func(m *anilist.BaseAnime) bool {
+				return m.GetIDMal() != nil && *m.GetIDMal() == r.MalId
+			})
+		}
+		if !found {
+			skip("media not found in the anime collection")
+			continue
+		}
+
+		destination, ok := resolveImportedDestination(r.Destination, media, opts.LibraryPaths, opts.RemapDestinations)
+		if !ok {
+			skip(fmt.Sprintf("destination is not in a library path: %s", r.Destination))
+			continue
+		}
+
+		rule := &anime.AutoDownloaderRule{
+			Enabled:             r.Enabled,
+			MediaId:             media.GetID(),
+			ReleaseGroups:       r.ReleaseGroups,
+			Resolutions:         r.Resolutions,
+			ComparisonTitle:     r.ComparisonTitle,
+			TitleComparisonType: r.TitleComparisonType,
+			EpisodeType:         r.EpisodeType,
+			EpisodeNumbers:      r.EpisodeNumbers,
+			Destination:         destination,
+			AdditionalTerms:     r.AdditionalTerms,
+		}
+
+		existing, hasConflict := existingRules[rule.MediaId]
+		if !hasConflict {
+			existingRules[rule.MediaId] = rule
+			ret.Created = append(ret.Created, rule)
+			continue
+		}
+
+		switch opts.ConflictStrategy {
+		case RulesImportConflictSkip:
+			skip("a rule already exists for this media")
+			continue
+		case RulesImportConflictReplace:
+			rule.DbID = existing.DbID
+			*existing = *rule
+		case RulesImportConflictMerge:
+			existing.ReleaseGroups = mergeStrings(existing.ReleaseGroups, rule.ReleaseGroups)
+			existing.Resolutions = mergeStrings(existing.Resolutions, rule.Resolutions)
+			existing.AdditionalTerms = mergeStrings(existing.AdditionalTerms, rule.AdditionalTerms)
+			existing.EpisodeNumbers = lo.Uniq(append(existing.EpisodeNumbers, rule.EpisodeNumbers...))
+		}
+
+		// Rules created earlier in the import (duplicates in the file) are already in the result
+		if existing.DbID != 0 && !lo.Contains(ret.Updated, existing) {
+			ret.Updated = append(ret.Updated, existing)
+		}
+	}
+
+	return ret, nil
+}
+
+// resolveImportedDestination returns the destination if it's in one of the library paths.
+// If remap is true, destinations outside the library paths are moved to the main library path, keeping the folder name.
+func resolveImportedDestination(destination string, media *anilist.BaseAnime, libraryPaths []string, remap bool) (string, bool) {
+	libraryPaths = lo.Filter(libraryPaths, func(p string, _ int) bool { return p != "" })
+
+	if destination != "" && filepath.IsAbs(destination) {
+		for _, p := range libraryPaths {
+			if util.IsSameDir(p, destination) || util.IsSubdirectory(p, destination) {
+				return filepath.Clean(destination), true
+			}
+		}
+	}
+
+	if !remap || len(libraryPaths) == 0 {
+		return "", false
+	}
+
+	// Keep the folder name from the file, the paths might come from another OS
+	name := filepath.Base(filepath.FromSlash(strings.ReplaceAll(destination, "\\", "/")))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		name = util.SanitizePathSegment(media.GetRomajiTitleSafe())
+	}
+
+	return filepath.Join(libraryPaths[0], name), true
+}
+
+// mergeStrings appends the values that are not already in the slice, ignoring case.
+func mergeStrings(a []string, b []string) []string {
+	ret := make([]string, 0, len(a)+len(b))
+	ret = append(ret, a...)
+	for _, s := range b {
+		if !lo.ContainsBy(ret, func(r string) bool { return strings.EqualFold(r, s) }) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,122 @@
+package autodownloader
+
+import (
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"seanime/internal/api/anilist"
+	"seanime/internal/library/anime"
+	"testing"
+)
+
+func TestExportImportRules(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix paths")
+	}
+
+	collection := &anilist.AnimeCollection{
+		MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+			Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{
+				{
+					Status: lo.ToPtr(anilist.MediaListStatusCurrent),
+					Entries: []*anilist.AnimeListEntry{
+						{Media: &anilist.BaseAnime{ID: 1, IDMal: lo.ToPtr(101), Title: &anilist.BaseAnime_Title{Romaji: lo.ToPtr("One")}}},
+						{Media: &anilist.BaseAnime{ID: 2, IDMal: lo.ToPtr(102), Title: &anilist.BaseAnime_Title{Romaji: lo.ToPtr("Two")}}},
+						{Media: &anilist.BaseAnime{ID: 30, IDMal: lo.ToPtr(103), Title: &anilist.BaseAnime_Title{Romaji: lo.ToPtr("Three")}}},
+					},
+				},
+			},
+		},
+	}
+
+	exportedRules := []*anime.AutoDownloaderRule{
+		{MediaId: 1, Enabled: true, ReleaseGroups: []string{"SubsPlease"}, Resolutions: []string{"1080p"}, Destination: "/old/library/One"},
+		{MediaId: 2, Enabled: true, ReleaseGroups: []string{"Erai-raws"}, Destination: "/data/library/Two"},
+		{MediaId: 3, Enabled: true, Destination: "/data/library/Three"}, // Different AniList ID, resolved by MAL ID
+		{MediaId: 4, Enabled: true, Destination: "/data/library/Four"},  // Not in the collection
+	}
+
+	for _, format := range []RulesFileFormat{RulesFileFormatJSON, RulesFileFormatYAML} {
+		t.Run(string(format), func(t *testing.T) {
+			// Media 3 is not in the collection on export, set the MAL ID manually
+			exportCollection := &anilist.AnimeCollection{
+				MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+					Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{
+						{
+							Entries: append(collection.MediaListCollection.Lists[0].Entries, &anilist.AnimeListEntry{
+								Media: &anilist.BaseAnime{ID: 3, IDMal: lo.ToPtr(103)},
+							}),
+						},
+					},
+				},
+			}
+
+			data, err := ExportRules(exportedRules, exportCollection, format)
+			require.NoError(t, err)
+
+			file, err := ParseRulesFile(data)
+			require.NoError(t, err)
+			assert.Equal(t, RulesFileVersion, file.Version)
+			require.Len(t, file.Rules, 4)
+			assert.Equal(t, "One", file.Rules[0].Title)
+			assert.Equal(t, 101, file.Rules[0].MalId)
+
+			existingRules := []*anime.AutoDownloaderRule{
+				{DbID: 10, MediaId: 2, ReleaseGroups: []string{"subsplease"}, Destination: "/data/library/Two"},
+			}
+
+			// Skip conflicts, don't remap
+			res, err := ImportRules(&ImportRulesOptions{
+				Data:             data,
+				ConflictStrategy: RulesImportConflictSkip,
+				AnimeCollection:  collection,
+				ExistingRules:    existingRules,
+				LibraryPaths:     []string{"/data/library"},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, []int{30}, lo.Map(res.Created, func(r *anime.AutoDownloaderRule, _ int) int { return r.MediaId }))
+			assert.Empty(t, res.Updated)
+			assert.Len(t, res.Skipped, 3) // Destination, conflict, not found
+
+			// Merge conflicts, remap destinations
+			res, err = ImportRules(&ImportRulesOptions{
+				Data:              data,
+				ConflictStrategy:  RulesImportConflictMerge,
+				RemapDestinations: true,
+				AnimeCollection:   collection,
+				ExistingRules:     existingRules,
+				LibraryPaths:      []string{"/data/library"},
+			})
+			require.NoError(t, err)
+			require.Len(t, res.Created, 2)
+			assert.Equal(t, "/data/library/One", res.Created[0].Destination)
+			require.Len(t, res.Updated, 1)
+			assert.Equal(t, uint(10), res.Updated[0].DbID)
+			assert.Equal(t, []string{"subsplease", "Erai-raws"}, res.Updated[0].ReleaseGroups)
+			assert.Len(t, res.Skipped, 1)
+
+			// Replace conflicts
+			existingRules[0].ReleaseGroups = []string{"subsplease"}
+			res, err = ImportRules(&ImportRulesOptions{
+				Data:             data,
+				ConflictStrategy: RulesImportConflictReplace,
+				AnimeCollection:  collection,
+				ExistingRules:    existingRules,
+				LibraryPaths:     []string{"/data/library"},
+			})
+			require.NoError(t, err)
+			require.Len(t, res.Updated, 1)
+			assert.Equal(t, uint(10), res.Updated[0].DbID)
+			assert.Equal(t, []string{"Erai-raws"}, res.Updated[0].ReleaseGroups)
+		})
+	}
+}
+
+func TestParseRulesFile_Version(t *testing.T) {
+	_, err := ParseRulesFile([]byte(`{"version": 99, "rules": []}`))
+	assert.Error(t, err)
+
+	_, err = ParseRulesFile([]byte("version: 1\nrules: []\n"))
+	assert.NoError(t, err)
+}
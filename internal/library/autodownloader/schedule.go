@@ -0,0 +1,129 @@
+package autodownloader
+
+import (
+	"seanime/internal/database/db_bridge"
+	"time"
+)
+
+const (
+	// minCheckDelay prevents checks from being scheduled too close to each other.
+	minCheckDelay = 30 * time.Second
+)
+
+// airingCheckOffsets are the delays after an episode's expected release time at which extra checks are made.
+// Releases usually show up within minutes of the broadcast, the checks back off until the base interval takes over.
+var airingCheckOffsets = []time.Duration{
+	5 * time.Minute,
+	10 * time.Minute,
+	20 * time.Minute,
+	40 * time.Minute,
+	time.Hour + 20*time.Minute,
+	2*time.Hour + 40*time.Minute,
+	4 * time.Hour,
+}
+
+// getNextCheckDelay returns the delay before the next check.
+// It is the base interval, unless an extra check is scheduled after an episode release before that.
+func (ad *AutoDownloader) getNextCheckDelay(interval time.Duration) time.Duration {
+	if ad.settings == nil || !ad.settings.Enabled {
+		return interval
+	}
+
+	now := time.Now()
+
+	next, found := getNextAiringCheck(ad.getRuleAiringTimes(), now)
+	if !found {
+		return interval
+	}
+
+	delay := next.Sub(now)
+	if delay >= interval {
+		return interval
+	}
+	if delay < minCheckDelay {
+		delay = minCheckDelay
+	}
+
+	ad.logger.Debug().Time("at", next).Msg("autodownloader: Scheduled check after episode release")
+
+	return delay
+}
+
+// ruleAiringTimes are the release times of the episodes around the current position of a rule's media.
+type ruleAiringTimes struct {
+	previous time.Time // Release time of the last episode that aired, zero if unknown
+	next     time.Time // Release time of the next episode, zero if none is scheduled
+}
+
+// update records the release time of the next episode listed by the airing schedule.
+// Once an episode airs, the schedule lists the following one, so the release time of the aired episode is kept for its checks.
+func (a ruleAiringTimes) update(next time.Time, now time.Time) ruleAiringTimes {
+	if !a.next.IsZero() && !a.next.Equal(next) && !a.next.After(now) {
+		a.previous = a.next
+	}
+	a.next = next
+	return a
+}
+
+// getRuleAiringTimes returns the expected release times of the last and next episodes of the media that have an enabled rule.
+// The release times are taken from the anime collection's airing schedule.
+func (ad *AutoDownloader) getRuleAiringTimes() []time.Time {
+	if ad.animeCollection.IsAbsent() || ad.database == nil {
+		return nil
+	}
+
+	rules, err := db_bridge.GetAutoDownloaderRules(ad.database)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if ad.ruleAiringTimes == nil {
+		ad.ruleAiringTimes = make(map[uint]ruleAiringTimes)
+	}
+
+	ret := make([]time.Time, 0)
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		listEntry, found := ad.getRuleListEntry(rule)
+		if !found {
+			continue
+		}
+		var next time.Time
+		if nextAiringEpisode := listEntry.GetMedia().GetNextAiringEpisode(); nextAiringEpisode != nil && nextAiringEpisode.GetAiringAt() != 0 {
+			next = time.Unix(int64(nextAiringEpisode.GetAiringAt()), 0)
+		}
+
+		airingTimes := ad.ruleAiringTimes[rule.DbID].update(next, now)
+		ad.ruleAiringTimes[rule.DbID] = airingTimes
+
+		if !airingTimes.previous.IsZero() {
+			ret = append(ret, airingTimes.previous)
+		}
+		if !airingTimes.next.IsZero() {
+			ret = append(ret, airingTimes.next)
+		}
+	}
+
+	return ret
+}
+
+// getNextAiringCheck returns the earliest check after now scheduled for the given release times.
+func getNextAiringCheck(airingTimes []time.Time, now time.Time) (ret time.Time, found bool) {
+	for _, airingAt := range airingTimes {
+		for _, offset := range airingCheckOffsets {
+			checkAt := airingAt.Add(offset)
+			if !checkAt.After(now) {
+				continue
+			}
+			if !found || checkAt.Before(ret) {
+				ret = checkAt
+				found = true
+			}
+			break // The following offsets are later
+		}
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package autodownloader
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGetNextAiringCheck(t *testing.T) {
+	now := time.Date(2024, time.October, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		airingTimes []time.Time
+		expected    time.Time
+		found       bool
+	}{
+		{
+			name:        "no airing times",
+			airingTimes: nil,
+			found:       false,
+		},
+		{
+			name:        "upcoming release",
+			airingTimes: []time.Time{now.Add(time.Hour)},
+			expected:    now.Add(time.Hour + 5*time.Minute),
+			found:       true,
+		},
+		{
+			name:        "recent release backs off",
+			airingTimes: []time.Time{now.Add(-30 * time.Minute)},
+			expected:    now.Add(-30*time.Minute + 40*time.Minute),
+			found:       true,
+		},
+		{
+			name:        "release too old",
+			airingTimes: []time.Time{now.Add(-5 * time.Hour)},
+			found:       false,
+		},
+		{
+			name:        "earliest check is returned",
+			airingTimes: []time.Time{now.Add(3 * time.Hour), now.Add(-3 * time.Minute), now.Add(-5 * time.Hour)},
+			expected:    now.Add(2 * time.Minute),
+			found:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, found := getNextAiringCheck(tt.airingTimes, now)
+			assert.Equal(t, tt.found, found)
+			if tt.found {
+				assert.Equal(t, tt.expected, next)
+			}
+		})
+	}
+}
+
+func TestRuleAiringTimes_Update(t *testing.T) {
+	airingAt := time.Date(2024, time.October, 10, 12, 0, 0, 0, time.UTC)
+	nextAiringAt := airingAt.Add(7 * 24 * time.Hour)
+
+	// The episode is scheduled
+	a := ruleAiringTimes{}.update(airingAt, airingAt.Add(-time.Hour))
+	assert.True(t, a.previous.IsZero())
+	assert.Equal(t, airingAt, a.next)
+
+	// The episode aired and the schedule lists the next one, its checks are still made
+	now := airingAt.Add(7 * time.Minute)
+	a = a.update(nextAiringAt, now)
+	assert.Equal(t, airingAt, a.previous)
+	assert.Equal(t, nextAiringAt, a.next)
+
+	next, found := getNextAiringCheck([]time.Time{a.previous, a.next}, now)
+	require.True(t, found)
+	assert.Equal(t, airingAt.Add(10*time.Minute), next)
+
+	// The last episode aired, nothing else is scheduled
+	a = a.update(time.Time{}, nextAiringAt.Add(time.Minute))
+	assert.Equal(t, nextAiringAt, a.previous)
+	assert.True(t, a.next.IsZero())
+
+	// A delayed episode doesn't replace the last release
+	a = ruleAiringTimes{next: nextAiringAt}.update(nextAiringAt.Add(24*time.Hour), airingAt)
+	assert.True(t, a.previous.IsZero())
+}
@@ -0,0 +1,181 @@
+package autodownloader
+
+import (
+	"errors"
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultComparisonTitleTemplate = "{romaji}"
+)
+
+var (
+	ErrTemplateDestinationRequired = errors.New("template destination is required")
+	ErrTemplateDestinationNotAbs   = errors.New("template destination must resolve to an absolute path")
+	ErrTemplateLibraryPathRequired = errors.New("template destination uses {libraryPath} but no library path is set")
+)
+
+// ApplyRuleTemplate creates a rule for the given media from the template.
+//
+// Supported placeholders:
+//   - {libraryPath}: The main library path
+//   - {romaji}, {english}, {title}: The media titles, {title} is the preferred title
+//   - {season}, {year}: The media's season (e.g. "Fall") and season year
+//   - {mediaId}: The AniList ID of the media
+func ApplyRuleTemplate(tmpl *anime.AutoDownloaderRuleTemplate, media *anilist.BaseAnime, libraryPath string) (*anime.AutoDownloaderRule, error) {
+	if tmpl == nil || media == nil {
+		return nil, errors.New("invalid template or media")
+	}
+
+	if tmpl.DestinationTemplate == "" {
+		return nil, ErrTemplateDestinationRequired
+	}
+
+	// An empty library path would silently resolve to a folder at the root of the filesystem
+	if strings.Contains(tmpl.DestinationTemplate, "{libraryPath}") && strings.TrimSpace(libraryPath) == "" {
+		return nil, ErrTemplateLibraryPathRequired
+	}
+
+	replacer := newTemplateReplacer(media, libraryPath)
+
+	destination := filepath.Clean(replacer.Replace(tmpl.DestinationTemplate))
+	if !filepath.IsAbs(destination) {
+		return nil, ErrTemplateDestinationNotAbs
+	}
+
+	comparisonTitleTemplate := tmpl.ComparisonTitleTemplate
+	if comparisonTitleTemplate == "" {
+		comparisonTitleTemplate = DefaultComparisonTitleTemplate
+	}
+	// Titles in the comparison title are not sanitized since they are not used as paths
+	comparisonTitle := strings.TrimSpace(newTemplateTitleReplacer(media).Replace(comparisonTitleTemplate))
+
+	return &anime.AutoDownloaderRule{
+		Enabled:             tmpl.Enabled,
+		MediaId:             media.GetID(),
+		ReleaseGroups:       tmpl.ReleaseGroups,
+		Resolutions:         tmpl.Resolutions,
+		ComparisonTitle:     comparisonTitle,
+		TitleComparisonType: tmpl.TitleComparisonType,
+		EpisodeType:         tmpl.EpisodeType,
+		EpisodeNumbers:      tmpl.EpisodeNumbers,
+		Destination:         destination,
+		AdditionalTerms:     tmpl.AdditionalTerms,
+	}, nil
+}
+
+// CreateRulesFromTemplate creates rules from the template for every anime in the collection that is
+// being watched or planned and is airing during the current season.
+// Anime that already have a rule are skipped.
+func CreateRulesFromTemplate(
+	tmpl *anime.AutoDownloaderRuleTemplate,
+	animeCollection *anilist.AnimeCollection,
+	existingRules []*anime.AutoDownloaderRule,
+	libraryPath string,
+	now time.Time,
+) ([]*anime.AutoDownloaderRule, error) {
+	if tmpl == nil {
+		return nil, errors.New("invalid template")
+	}
+	if animeCollection == nil || animeCollection.MediaListCollection == nil {
+		return nil, errors.New("anime collection not found")
+	}
+
+	hasRule := make(map[int]struct{}, len(existingRules))
+	for _, rule := range existingRules {
+		hasRule[rule.MediaId] = struct{}{}
+	}
+
+	season, year := getSeasonFromDate(now)
+
+	ret := make([]*anime.AutoDownloaderRule, 0)
+	for _, list := range animeCollection.MediaListCollection.Lists {
+		if list.GetStatus() == nil {
+			continue
+		}
+		if *list.GetStatus() != anilist.MediaListStatusCurrent && *list.GetStatus() != anilist.MediaListStatusPlanning {
+			continue
+		}
+		for _, entry := range list.GetEntries() {
+			media := entry.GetMedia()
+			if media == nil || !isAiringDuringSeason(media, season, year) {
+				continue
+			}
+			// Skip media that already have a rule
+			if _, found := hasRule[media.GetID()]; found {
+				continue
+			}
+
+			rule, err := ApplyRuleTemplate(tmpl, media, libraryPath)
+			if err != nil {
+				return nil, err
+			}
+
+			hasRule[media.GetID()] = struct{}{}
+			ret = append(ret, rule)
+		}
+	}
+
+	return ret, nil
+}
+
+// isAiringDuringSeason returns true if the media starts airing during the given season
+// or is still airing (e.g. a show continuing from the previous season).
+func isAiringDuringSeason(media *anilist.BaseAnime, season anilist.MediaSeason, year int) bool {
+	if media.GetStatus() != nil && *media.GetStatus() == anilist.MediaStatusReleasing {
+		return true
+	}
+	if media.GetSeason() == nil || media.GetSeasonYear() == nil {
+		return false
+	}
+	return *media.GetSeason() == season && *media.GetSeasonYear() == year
+}
+
+// getSeasonFromDate returns the AniList season and year of the given date.
+func getSeasonFromDate(t time.Time) (anilist.MediaSeason, int) {
+	switch t.Month() {
+	case time.January, time.February, time.March:
+		return anilist.MediaSeasonWinter, t.Year()
+	case time.April, time.May, time.June:
+		return anilist.MediaSeasonSpring, t.Year()
+	case time.July, time.August, time.September:
+		return anilist.MediaSeasonSummer, t.Year()
+	default:
+		return anilist.MediaSeasonFall, t.Year()
+	}
+}
+
+func newTemplateReplacer(media *anilist.BaseAnime, libraryPath string) *strings.Replacer {
+	season, year := "", ""
+	if media.GetSeason() != nil {
+		s := strings.ToLower(string(*media.GetSeason()))
+		season = strings.ToUpper(s[:1]) + s[1:]
+	}
+	if media.GetSeasonYear() != nil {
+		year = strconv.Itoa(*media.GetSeasonYear())
+	}
+
+	return strings.NewReplacer(
+		"{libraryPath}", libraryPath,
+		"{romaji}", util.SanitizePathSegment(media.GetRomajiTitleSafe()),
+		"{english}", util.SanitizePathSegment(media.GetTitleSafe()),
+		"{title}", util.SanitizePathSegment(media.GetPreferredTitle()),
+		"{season}", season,
+		"{year}", year,
+		"{mediaId}", strconv.Itoa(media.GetID()),
+	)
+}
+
+func newTemplateTitleReplacer(media *anilist.BaseAnime) *strings.Replacer {
+	return strings.NewReplacer(
+		"{romaji}", media.GetRomajiTitleSafe(),
+		"{english}", media.GetTitleSafe(),
+		"{title}", media.GetPreferredTitle(),
+	)
+}
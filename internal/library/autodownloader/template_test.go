@@ -0,0 +1,167 @@
+package autodownloader
+
+import (
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"runtime"
+	"seanime/internal/api/anilist"
+	"seanime/internal/library/anime"
+	"testing"
+	"time"
+)
+
+func TestApplyRuleTemplate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix paths")
+	}
+
+	media := &anilist.BaseAnime{
+		ID: 166531,
+		Title: &anilist.BaseAnime_Title{
+			Romaji:  lo.ToPtr("[Oshi no Ko] 2nd Season"),
+			English: lo.ToPtr("Oshi no Ko: Season 2"),
+		},
+		Season:     lo.ToPtr(anilist.MediaSeasonSummer),
+		SeasonYear: lo.ToPtr(2024),
+	}
+
+	tests := []struct {
+		name                string
+		destination         string
+		comparisonTitle     string
+		noLibraryPath       bool
+		expectedDestination string
+		expectedComparison  string
+		expectedErr         error
+	}{
+		{
+			name:                "romaji",
+			destination:         "{libraryPath}/{romaji}",
+			expectedDestination: "/data/library/[Oshi no Ko] 2nd Season",
+			expectedComparison:  "[Oshi no Ko] 2nd Season",
+		},
+		{
+			name:                "english with season folder",
+			destination:         "{libraryPath}/{year} {season}/{english}",
+			comparisonTitle:     "{english}",
+			expectedDestination: "/data/library/2024 Summer/Oshi no Ko Season 2",
+			expectedComparison:  "Oshi no Ko: Season 2",
+		},
+		{
+			name:        "relative path",
+			destination: "{romaji}",
+			expectedErr: ErrTemplateDestinationNotAbs,
+		},
+		{
+			name:        "empty destination",
+			destination: "",
+			expectedErr: ErrTemplateDestinationRequired,
+		},
+		{
+			name:          "no library path",
+			destination:   "{libraryPath}/{title}",
+			noLibraryPath: true,
+			expectedErr:   ErrTemplateLibraryPathRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := &anime.AutoDownloaderRuleTemplate{
+				Enabled:                 true,
+				ReleaseGroups:           []string{"SubsPlease"},
+				Resolutions:             []string{"1080p"},
+				TitleComparisonType:     anime.AutoDownloaderRuleTitleComparisonLikely,
+				EpisodeType:             anime.AutoDownloaderRuleEpisodeRecent,
+				DestinationTemplate:     tt.destination,
+				ComparisonTitleTemplate: tt.comparisonTitle,
+			}
+
+			libraryPath := "/data/library"
+			if tt.noLibraryPath {
+				libraryPath = ""
+			}
+
+			rule, err := ApplyRuleTemplate(tmpl, media, libraryPath)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, 166531, rule.MediaId)
+			assert.Equal(t, filepath.FromSlash(tt.expectedDestination), rule.Destination)
+			assert.Equal(t, tt.expectedComparison, rule.ComparisonTitle)
+			assert.Equal(t, []string{"SubsPlease"}, rule.ReleaseGroups)
+			assert.True(t, rule.Enabled)
+		})
+	}
+}
+
+func TestCreateRulesFromTemplate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix paths")
+	}
+
+	newEntry := func(id int, title string, season anilist.MediaSeason, year int, status anilist.MediaStatus) *anilist.AnimeListEntry {
+		return &anilist.AnimeListEntry{
+			Media: &anilist.BaseAnime{
+				ID:         id,
+				Title:      &anilist.BaseAnime_Title{Romaji: lo.ToPtr(title)},
+				Season:     lo.ToPtr(season),
+				SeasonYear: lo.ToPtr(year),
+				Status:     lo.ToPtr(status),
+			},
+		}
+	}
+
+	collection := &anilist.AnimeCollection{
+		MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+			Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{
+				{
+					Status: lo.ToPtr(anilist.MediaListStatusCurrent),
+					Entries: []*anilist.AnimeListEntry{
+						newEntry(1, "This Season", anilist.MediaSeasonFall, 2024, anilist.MediaStatusReleasing),
+						newEntry(2, "Already Has Rule", anilist.MediaSeasonFall, 2024, anilist.MediaStatusReleasing),
+						newEntry(3, "Continuing", anilist.MediaSeasonSummer, 2024, anilist.MediaStatusReleasing),
+						newEntry(4, "Old Show", anilist.MediaSeasonWinter, 2020, anilist.MediaStatusFinished),
+					},
+				},
+				{
+					Status: lo.ToPtr(anilist.MediaListStatusPlanning),
+					Entries: []*anilist.AnimeListEntry{
+						newEntry(5, "Upcoming", anilist.MediaSeasonFall, 2024, anilist.MediaStatusNotYetReleased),
+					},
+				},
+				{
+					Status: lo.ToPtr(anilist.MediaListStatusDropped),
+					Entries: []*anilist.AnimeListEntry{
+						newEntry(6, "Dropped", anilist.MediaSeasonFall, 2024, anilist.MediaStatusReleasing),
+					},
+				},
+			},
+		},
+	}
+
+	existingRules := []*anime.AutoDownloaderRule{
+		{MediaId: 2},
+	}
+
+	tmpl := &anime.AutoDownloaderRuleTemplate{
+		DestinationTemplate: "{libraryPath}/{romaji}",
+	}
+
+	rules, err := CreateRulesFromTemplate(tmpl, collection, existingRules, "/data/library", time.Date(2024, time.October, 10, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	ids := lo.Map(rules, func(r *anime.AutoDownloaderRule, _ int) int { return r.MediaId })
+	assert.ElementsMatch(t, []int{1, 3, 5}, ids)
+
+	for _, rule := range rules {
+		if rule.MediaId == 5 {
+			assert.Equal(t, "/data/library/Upcoming", rule.Destination)
+		}
+	}
+}
@@ -109,9 +109,14 @@ func GetMediaFilePathsFromDirS(oDirPath string) ([]string, error) {
 			}
 
 			if d.IsDir() {
+				// Font folders shipped with subtitles don't contain media
+				if path != currentPath && util.IsFontDir(d.Name()) {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 
+			// Sidecar subtitles and fonts are not media
 			ext := strings.ToLower(filepath.Ext(path))
 			if util.IsValidMediaFile(path) && util.IsValidVideoExtension(ext) {
 				filePaths = append(filePaths, path)
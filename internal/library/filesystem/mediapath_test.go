@@ -74,3 +74,25 @@ func createFile(t *testing.T, path string) {
 	}
 	defer file.Close()
 }
+
+func TestGetVideoFilePathsFromDir_SkipsSidecarFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	showDir := filepath.Join(tmpDir, "Show")
+	os.MkdirAll(filepath.Join(showDir, "Fonts"), 0755)
+	os.MkdirAll(filepath.Join(showDir, "Subs"), 0755)
+	createFile(t, filepath.Join(showDir, "Show - 01.mkv"))
+	createFile(t, filepath.Join(showDir, "Show - 01.en.ass"))
+	createFile(t, filepath.Join(showDir, "Subs", "Show - 01.srt"))
+	createFile(t, filepath.Join(showDir, "Fonts", "Font.ttf"))
+	createFile(t, filepath.Join(showDir, "Fonts", "preview.mp4"))
+
+	filePaths, err := GetMediaFilePathsFromDirS(tmpDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(filePaths) != 1 || filePaths[0] != filepath.Join(showDir, "Show - 01.mkv") {
+		t.Errorf("Expected only the episode, got %v", filePaths)
+	}
+}
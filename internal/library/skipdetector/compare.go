@@ -0,0 +1,89 @@
+package skipdetector
+
+import "math"
+
+const (
+	maxAvgBitErrors     = 10   // Windows of sub-fingerprints with fewer different bits on average are the same audio, unrelated audio averages 16
+	matchWindowDuration = 1.0  // Seconds of sub-fingerprints compared together
+	maxGapDuration      = 3.5  // Seconds of different audio tolerated inside a shared segment
+	minSegmentDuration  = 15.0 // Seconds, shorter shared audio is ignored (e.g. a jingle)
+)
+
+type (
+	// sharedSegment is the audio shared by two fingerprints.
+	// The times are in seconds from the start of each fingerprint.
+	sharedSegment struct {
+		startA float64
+		endA   float64
+		startB float64
+		endB   float64
+	}
+)
+
+func (s *sharedSegment) duration() float64 {
+	return s.endA - s.startA
+}
+
+// findSharedSegment returns the longest audio segment present in both fingerprints.
+// Every alignment of the fingerprints is tried, since the segment can start at a different time in each episode.
+// Sub-fingerprints are compared over a sliding window, a single sub-fingerprint can match by chance.
+func findSharedSegment(a, b Fingerprint) (*sharedSegment, bool) {
+	maxGap := int(math.Round(maxGapDuration / frameDuration))
+	halfWindow := int(math.Round(matchWindowDuration / frameDuration / 2))
+
+	bestStart, bestEnd, bestShift := 0, 0, 0
+	errs := make([]int, 0, len(a))
+	// a[i] is aligned with b[i-shift]
+	for shift := -(len(b) - 1); shift < len(a); shift++ {
+		from := max(0, shift)
+		to := min(len(a), len(b)+shift)
+		if to-from <= bestEnd-bestStart {
+			continue // Can't beat the best segment
+		}
+
+		errs = errs[:0]
+		for i := from; i < to; i++ {
+			// Digital silence produces empty sub-fingerprints, it's not considered shared audio
+			if a[i] == 0 {
+				errs = append(errs, 32)
+			} else {
+				errs = append(errs, bitErrors(a[i], b[i-shift]))
+			}
+		}
+
+		runStart, lastMatch := -1, -1
+		windowSum, windowStart, windowEnd := 0, 0, 0 // errs[windowStart:windowEnd]
+		for j := range errs {
+			for ; windowEnd < min(len(errs), j+halfWindow+1); windowEnd++ {
+				windowSum += errs[windowEnd]
+			}
+			for ; windowStart < j-halfWindow; windowStart++ {
+				windowSum -= errs[windowStart]
+			}
+			if windowSum > maxAvgBitErrors*(windowEnd-windowStart) {
+				continue
+			}
+
+			i := from + j
+			if runStart == -1 || i-lastMatch > maxGap {
+				runStart = i
+			}
+			lastMatch = i
+			if lastMatch+1-runStart > bestEnd-bestStart {
+				bestStart, bestEnd, bestShift = runStart, lastMatch+1, shift
+			}
+		}
+	}
+
+	ret := &sharedSegment{
+		startA: float64(bestStart) * frameDuration,
+		endA:   float64(bestEnd) * frameDuration,
+		startB: float64(bestStart-bestShift) * frameDuration,
+		endB:   float64(bestEnd-bestShift) * frameDuration,
+	}
+	if ret.duration() < minSegmentDuration {
+		return nil, false
+	}
+
+	return ret, true
+}
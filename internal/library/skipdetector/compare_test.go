@@ -0,0 +1,74 @@
+package skipdetector
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// generateMelody returns a sequence of random notes with harmonics, similar to music.
+func generateMelody(r *rand.Rand, seconds float64) []int16 {
+	samples := make([]int16, int(seconds*sampleRate))
+	noteLength := sampleRate / 4
+	freq := 0.0
+	for i := range samples {
+		if i%noteLength == 0 {
+			freq = 300 + r.Float64()*1200
+		}
+		t := float64(i) / sampleRate
+		v := math.Sin(2*math.Pi*freq*t) + 0.5*math.Sin(4*math.Pi*freq*t) + 0.1*(r.Float64()*2-1)
+		samples[i] = int16(v * 8000)
+	}
+	return samples
+}
+
+func TestFindSharedSegment(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	intro := generateMelody(r, 40)
+
+	// The intro starts at 20.3s in the first episode and 35.7s in the second one
+	a := append(append(generateMelody(r, 20.3), intro...), generateMelody(r, 30)...)
+	b := append(append(generateMelody(r, 35.7), intro...), generateMelody(r, 10)...)
+
+	s, found := findSharedSegment(ComputeFingerprint(a), ComputeFingerprint(b))
+	require.True(t, found)
+
+	assert.InDelta(t, 20.3, s.startA, 1)
+	assert.InDelta(t, 60.3, s.endA, 1)
+	assert.InDelta(t, 35.7, s.startB, 1)
+	assert.InDelta(t, 75.7, s.endB, 1)
+}
+
+func TestFindSharedSegment_NoSharedAudio(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	// Digital silence is not shared audio
+	silence := make([]int16, 30*sampleRate)
+	a := append(generateMelody(r, 60), silence...)
+	b := append(generateMelody(r, 60), silence...)
+
+	_, found := findSharedSegment(ComputeFingerprint(a), ComputeFingerprint(b))
+	assert.False(t, found)
+}
+
+func TestFFT(t *testing.T) {
+	// A sine at bin 8 has all its energy in bins 8 and n-8
+	n := 64
+	x := make([]complex128, n)
+	for i := range x {
+		x[i] = complex(math.Sin(2*math.Pi*8*float64(i)/float64(n)), 0)
+	}
+	fft(x)
+
+	for k := range x {
+		m := math.Hypot(real(x[k]), imag(x[k]))
+		if k == 8 || k == n-8 {
+			assert.InDelta(t, float64(n)/2, m, 1e-9)
+		} else {
+			assert.InDelta(t, 0, m, 1e-9)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package skipdetector
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"seanime/internal/util"
+	"strconv"
+	"time"
+)
+
+// decodeAudio decodes a region of the first audio track of a file to mono 16-bit PCM at 11025 Hz.
+func decodeAudio(ffmpegPath string, path string, start float64, duration float64) ([]int16, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// DEVNOTE: Seeking before the input is fast and accurate since ffmpeg decodes from the previous keyframe
+	cmd := util.NewCmdCtx(
+		ctx,
+		ffmpegPath,
+		"-nostdin",
+		"-v", "error",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+		"-t", strconv.FormatFloat(duration, 'f', 3, 64),
+		"-i", path,
+		"-map", "0:a:0",
+		"-vn",
+		"-ac", "1",
+		"-ar", strconv.Itoa(sampleRate),
+		"-f", "s16le",
+		"-",
+	)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audio: %w", err)
+	}
+
+	samples := make([]int16, len(out)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(out[i*2:]))
+	}
+
+	return samples, nil
+}
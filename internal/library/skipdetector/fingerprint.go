@@ -0,0 +1,120 @@
+package skipdetector
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// Like chromaprint, the audio is described by a sequence of 32-bit sub-fingerprints, one per frame.
+// Each bit is the sign of the energy difference between two adjacent frequency bands, compared to the previous frame.
+// The sign of the differences survives re-encoding, volume changes and small equalization changes,
+// so the same audio in two episodes produces sub-fingerprints that differ by a few bits.
+
+const (
+	sampleRate    = 11025
+	frameSize     = 4096
+	frameHop      = frameSize / 8 // A small hop keeps the frames of two episodes aligned within a few milliseconds
+	bandCount     = 33            // 33 bands give 32 differences
+	minBandFreq   = 300.0
+	maxBandFreq   = 2000.0
+	frameDuration = float64(frameHop) / sampleRate // Seconds between two sub-fingerprints
+)
+
+// Fingerprint is a sequence of sub-fingerprints.
+type Fingerprint []uint32
+
+// ComputeFingerprint returns the fingerprint of mono 16-bit PCM samples at 11025 Hz.
+func ComputeFingerprint(samples []int16) Fingerprint {
+	if len(samples) < frameSize {
+		return Fingerprint{}
+	}
+
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameSize-1)) // Hann
+	}
+
+	// Frequency bins of the band edges, spaced logarithmically
+	edges := make([]int, bandCount+1)
+	for i := range edges {
+		freq := minBandFreq * math.Pow(maxBandFreq/minBandFreq, float64(i)/bandCount)
+		edges[i] = int(math.Round(freq * frameSize / sampleRate))
+	}
+
+	frameCount := (len(samples)-frameSize)/frameHop + 1
+	ret := make(Fingerprint, 0, frameCount)
+
+	buf := make([]complex128, frameSize)
+	prev := make([]float64, bandCount)
+	curr := make([]float64, bandCount)
+
+	for f := 0; f < frameCount; f++ {
+		offset := f * frameHop
+		for i := 0; i < frameSize; i++ {
+			buf[i] = complex(float64(samples[offset+i])*window[i], 0)
+		}
+		fft(buf)
+
+		for b := 0; b < bandCount; b++ {
+			energy := 0.0
+			for k := edges[b]; k < max(edges[b+1], edges[b]+1); k++ {
+				m := cmplx.Abs(buf[k])
+				energy += m * m
+			}
+			curr[b] = energy
+		}
+
+		// The first frame has no previous frame to compare to
+		if f > 0 {
+			var sub uint32
+			for b := 0; b < bandCount-1; b++ {
+				if (curr[b]-curr[b+1])-(prev[b]-prev[b+1]) > 0 {
+					sub |= 1 << b
+				}
+			}
+			ret = append(ret, sub)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return ret
+}
+
+// bitErrors returns the number of different bits between two sub-fingerprints.
+func bitErrors(a, b uint32) int {
+	return bits.OnesCount32(a ^ b)
+}
+
+// fft computes the discrete Fourier transform in place.
+// The length of x must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+
+	// Bit-reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u := x[start+k]
+				v := x[start+k+size/2] * wk
+				x[start+k] = u + v
+				x[start+k+size/2] = u - v
+				wk *= w
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package skipdetector
+
+import (
+	"errors"
+	"fmt"
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+const (
+	introScanDuration   = 300.0 // Seconds at the start of an episode where the intro is looked for
+	creditsScanDuration = 240.0 // Seconds at the end of an episode where the credits are looked for
+	maxIntroDuration    = 150.0 // Seconds, longer shared audio is not an intro (e.g. a recap)
+)
+
+type (
+	// SkipDetector detects the intro and credits of the episodes of a series.
+	// The opening and ending minutes of the episodes are fingerprinted and compared,
+	// the audio shared by two episodes is the intro or the credits.
+	SkipDetector struct {
+		db             *db.Database
+		logger         *zerolog.Logger
+		wsEventManager events.WSEventManagerInterface
+		settings       *Settings
+		analyzing      map[int]struct{} // Media being analyzed
+		mu             sync.Mutex
+		jobMu          sync.Mutex // Only one series is analyzed at a time
+	}
+
+	Settings struct {
+		FfmpegPath  string
+		FfprobePath string
+	}
+
+	NewSkipDetectorOptions struct {
+		DB             *db.Database
+		Logger         *zerolog.Logger
+		WSEventManager events.WSEventManagerInterface
+	}
+
+	// episodeAudio holds the fingerprints of the regions of an episode.
+	episodeAudio struct {
+		lf           *anime.LocalFile
+		intro        Fingerprint
+		credits      Fingerprint
+		creditsStart float64 // Start of the credits region, in seconds
+	}
+)
+
+func New(opts *NewSkipDetectorOptions) *SkipDetector {
+	return &SkipDetector{
+		db:             opts.DB,
+		logger:         opts.Logger,
+		wsEventManager: opts.WSEventManager,
+		settings: &Settings{
+			FfmpegPath:  "ffmpeg",
+			FfprobePath: "ffprobe",
+		},
+		analyzing: make(map[int]struct{}),
+	}
+}
+
+// SetSettings should be called after initializing the SkipDetector.
+func (d *SkipDetector) SetSettings(settings *Settings) {
+	if settings == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settings = &Settings{
+		FfmpegPath:  lo.Ternary(settings.FfmpegPath != "", settings.FfmpegPath, "ffmpeg"),
+		FfprobePath: lo.Ternary(settings.FfprobePath != "", settings.FfprobePath, "ffprobe"),
+	}
+}
+
+// IsAnalyzing returns true if the episodes of the media are being analyzed.
+func (d *SkipDetector) IsAnalyzing(mediaId int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, found := d.analyzing[mediaId]
+	return found
+}
+
+// GetSkipSegments returns the skip segments of the episodes of a media.
+func (d *SkipDetector) GetSkipSegments(mediaId int) ([]*models.SkipSegment, error) {
+	return d.db.GetSkipSegmentsByMediaId(mediaId)
+}
+
+// AnalyzeMedia detects the intro and credits of the main episodes of a media and stores them per file.
+// It's slow since every episode is decoded, it should be called in a goroutine.
+// An events.SkipSegmentsAnalyzed event is sent when it's done.
+func (d *SkipDetector) AnalyzeMedia(mediaId int, lfs []*anime.LocalFile) (err error) {
+	defer util.HandlePanicInModuleWithError("library/skipdetector/AnalyzeMedia", &err)
+
+	episodes := lo.Filter(lfs, func(lf *anime.LocalFile, _ int) bool {
+		return lf.MediaId == mediaId && lf.IsMain()
+	})
+	slices.SortFunc(episodes, func(a, b *anime.LocalFile) int {
+		return a.GetEpisodeNumber() - b.GetEpisodeNumber()
+	})
+	if len(episodes) < 2 {
+		return errors.New("skipdetector: At least 2 episodes are needed")
+	}
+
+	d.mu.Lock()
+	if _, found := d.analyzing[mediaId]; found {
+		d.mu.Unlock()
+		return errors.New("skipdetector: Media is already being analyzed")
+	}
+	d.analyzing[mediaId] = struct{}{}
+	settings := d.settings
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.analyzing, mediaId)
+		d.mu.Unlock()
+	}()
+
+	d.jobMu.Lock()
+	defer d.jobMu.Unlock()
+
+	d.logger.Info().Int("mediaId", mediaId).Msgf("skipdetector: Analyzing %d episodes", len(episodes))
+
+	// Fingerprint the episodes
+	audios := make([]*episodeAudio, 0, len(episodes))
+	for _, lf := range episodes {
+		audio, err := d.fingerprintEpisode(settings, lf)
+		if err != nil {
+			d.logger.Warn().Err(err).Str("path", lf.Path).Msg("skipdetector: Failed to fingerprint episode")
+			continue
+		}
+		audios = append(audios, audio)
+	}
+	if len(audios) < 2 {
+		return errors.New("skipdetector: Not enough episodes could be decoded")
+	}
+
+	// Compare each episode with the next one, the longest shared segment of an episode is kept
+	intros := make(map[*episodeAudio]*models.SkipSegment)
+	credits := make(map[*episodeAudio]*models.SkipSegment)
+	keepLongest := func(m map[*episodeAudio]*models.SkipSegment, a *episodeAudio, segmentType string, start, end float64) {
+		if prev, found := m[a]; !found || end-start > prev.EndTime-prev.StartTime {
+			m[a] = &models.SkipSegment{Type: segmentType, StartTime: start, EndTime: end}
+		}
+	}
+
+	for i := 0; i < len(audios)-1; i++ {
+		a, b := audios[i], audios[i+1]
+
+		if s, found := findSharedSegment(a.intro, b.intro); found && s.duration() <= maxIntroDuration {
+			keepLongest(intros, a, models.SkipSegmentTypeIntro, s.startA, s.endA)
+			keepLongest(intros, b, models.SkipSegmentTypeIntro, s.startB, s.endB)
+		}
+		if s, found := findSharedSegment(a.credits, b.credits); found {
+			keepLongest(credits, a, models.SkipSegmentTypeCredits, a.creditsStart+s.startA, a.creditsStart+s.endA)
+			keepLongest(credits, b, models.SkipSegmentTypeCredits, b.creditsStart+s.startB, b.creditsStart+s.endB)
+		}
+	}
+
+	// Store the segments, replacing the previous ones
+	for _, a := range audios {
+		segments := make([]*models.SkipSegment, 0, 2)
+		if s, found := intros[a]; found {
+			segments = append(segments, s)
+		}
+		if s, found := credits[a]; found {
+			segments = append(segments, s)
+		}
+		if err := d.db.ReplaceSkipSegments(mediaId, a.lf.Path, segments); err != nil {
+			return err
+		}
+	}
+
+	d.logger.Info().Int("mediaId", mediaId).Msgf("skipdetector: Found %d intros and %d credits", len(intros), len(credits))
+
+	d.wsEventManager.SendEvent(events.SkipSegmentsAnalyzed, mediaId)
+
+	return nil
+}
+
+// fingerprintEpisode fingerprints the regions of an episode where the intro and credits are looked for.
+func (d *SkipDetector) fingerprintEpisode(settings *Settings, lf *anime.LocalFile) (*episodeAudio, error) {
+	info, err := videofile.FfprobeGetInfo(settings.FfprobePath, lf.Path, "")
+	if err != nil {
+		return nil, err
+	}
+	duration := float64(info.Duration)
+	if duration <= 0 {
+		return nil, fmt.Errorf("unknown duration")
+	}
+
+	// Each region covers at most half of the episode
+	introDuration := min(introScanDuration, duration/2)
+	creditsDuration := min(creditsScanDuration, duration/2)
+
+	introSamples, err := decodeAudio(settings.FfmpegPath, lf.Path, 0, introDuration)
+	if err != nil {
+		return nil, err
+	}
+	creditsSamples, err := decodeAudio(settings.FfmpegPath, lf.Path, duration-creditsDuration, creditsDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &episodeAudio{
+		lf:           lf,
+		intro:        ComputeFingerprint(introSamples),
+		credits:      ComputeFingerprint(creditsSamples),
+		creditsStart: duration - creditsDuration,
+	}, nil
+}
@@ -0,0 +1,235 @@
+package torrentwatcher
+
+import (
+	"path/filepath"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+	"seanime/internal/torrent_clients/torrent_client"
+	"seanime/internal/util"
+	"strings"
+	"time"
+)
+
+// seedingPolicyInterval is the interval at which the seeding policies are enforced.
+const seedingPolicyInterval = 10 * time.Minute
+
+// enforceSeedingPolicies stops or removes the completed torrents added by Seanime once they reach the seeding limits.
+// A torrent is considered added by Seanime if it is tracked, or if it has one of the qBittorrent tags set in the settings.
+// The policy of the AutoDownloader rule that added the torrent takes precedence over the one in the settings.
+func (w *Watcher) enforceSeedingPolicies() {
+	defer util.HandlePanicInModuleThen("library/torrentwatcher/enforceSeedingPolicies", func() {})
+
+	w.pollMu.Lock()
+	defer w.pollMu.Unlock()
+
+	w.mu.Lock()
+	repo := w.torrentClientRepository
+	w.mu.Unlock()
+
+	if repo == nil || repo.GetProvider() == torrent_client.NoneClient {
+		return
+	}
+
+	settings, err := w.db.GetSettings()
+	if err != nil || settings == nil || settings.Torrent == nil {
+		return
+	}
+
+	tracked, err := w.db.GetTrackedTorrents()
+	if err != nil {
+		return
+	}
+	trackedByHash := make(map[string]*models.TrackedTorrent, len(tracked))
+	for _, tt := range tracked {
+		trackedByHash[tt.Hash] = tt
+	}
+
+	torrents, err := repo.GetList()
+	if err != nil {
+		return
+	}
+
+	defaultPolicy := getSettingsSeedingPolicy(settings.Torrent)
+	tags := getSeanimeTags(repo.GetProvider(), settings.Torrent.QBittorrentTags)
+	rules := make(map[uint]*anime.AutoDownloaderRule)
+
+	for _, t := range torrents {
+		hash := strings.ToLower(t.Hash)
+		tt, isTracked := trackedByHash[hash]
+		if !isTracked && !hasAnyTag(t, tags) {
+			continue // Not added by Seanime
+		}
+		if isTracked && !tt.Imported {
+			continue // Wait for the files to be added to the library
+		}
+
+		policy := defaultPolicy
+		if isTracked && tt.RuleId != 0 {
+			rule, found := rules[tt.RuleId]
+			if !found {
+				rule, _ = db_bridge.GetAutoDownloaderRule(w.db, tt.RuleId)
+				rules[tt.RuleId] = rule
+			}
+			if rule != nil && rule.SeedingPolicy != nil {
+				policy = rule.SeedingPolicy
+			}
+		}
+
+		if !shouldApplySeedingPolicy(t, policy) {
+			continue
+		}
+
+		switch policy.Action {
+		case anime.SeedingPolicyActionStop:
+			if err := repo.PauseTorrents([]string{t.Hash}); err != nil {
+				w.logger.Error().Err(err).Str("hash", hash).Msg("torrent watcher: Failed to stop torrent")
+				continue
+			}
+			w.logger.Info().Str("name", t.Name).Float64("ratio", t.Ratio).Int("seedingTime", t.SeedingTime).Msg("torrent watcher: Stopped torrent, seeding limit reached")
+		case anime.SeedingPolicyActionRemove:
+			removeData := policy.DeleteData
+			if removeData && !w.canRemoveTorrentData(repo, t, tt) {
+				w.logger.Debug().Str("hash", hash).Msg("torrent watcher: Keeping torrent data, files are in the library")
+				removeData = false
+			}
+			if err := repo.RemoveTorrentsWithData([]string{t.Hash}, removeData); err != nil {
+				w.logger.Error().Err(err).Str("hash", hash).Msg("torrent watcher: Failed to remove torrent")
+				continue
+			}
+			if isTracked {
+				_ = w.db.DeleteTrackedTorrentByHash(hash)
+			}
+			w.logger.Info().Str("name", t.Name).Bool("removeData", removeData).Msg("torrent watcher: Removed torrent, seeding limit reached")
+		}
+	}
+}
+
+// canRemoveTorrentData returns false if one of the torrent's files is a local file, or if the files cannot be determined.
+func (w *Watcher) canRemoveTorrentData(repo *torrent_client.Repository, t *torrent_client.Torrent, tt *models.TrackedTorrent) bool {
+	files, err := repo.GetFiles(t.Hash)
+	if err != nil || len(files) == 0 {
+		return false
+	}
+
+	lfs, _, err := db_bridge.GetLocalFiles(w.db)
+	if err != nil {
+		return false
+	}
+	lfPaths := make([]string, 0, len(lfs))
+	for _, lf := range lfs {
+		lfPaths = append(lfPaths, lf.Path)
+	}
+
+	// Clients report the content path differently, every possible download directory is checked
+	dirs := make([]string, 0, 3)
+	if tt != nil && tt.Destination != "" {
+		dirs = append(dirs, tt.Destination)
+	}
+	if t.ContentPath != "" {
+		dirs = append(dirs, t.ContentPath, filepath.Dir(t.ContentPath))
+	}
+	if len(dirs) == 0 {
+		return false
+	}
+
+	return !isAnyPathInRoots(lfPaths, getTorrentRoots(dirs, files))
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// getSettingsSeedingPolicy returns the seeding policy of the torrent settings.
+func getSettingsSeedingPolicy(settings *models.TorrentSettings) *anime.AutoDownloaderRuleSeedingPolicy {
+	return &anime.AutoDownloaderRuleSeedingPolicy{
+		Action:      anime.SeedingPolicyAction(settings.SeedingPolicyAction),
+		Ratio:       settings.SeedingPolicyRatio,
+		SeedingTime: settings.SeedingPolicyTime,
+		DeleteData:  settings.SeedingPolicyDeleteData,
+	}
+}
+
+// getSeanimeTags returns the tags added by Seanime to the torrents, only qBittorrent supports tags.
+func getSeanimeTags(provider string, qbittorrentTags string) []string {
+	ret := make([]string, 0)
+	if provider != torrent_client.QbittorrentClient {
+		return ret
+	}
+	for _, tag := range strings.Split(qbittorrentTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
+
+func hasAnyTag(t *torrent_client.Torrent, tags []string) bool {
+	for _, tag := range t.Tags {
+		for _, seanimeTag := range tags {
+			if strings.EqualFold(tag, seanimeTag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shouldApplySeedingPolicy returns true if the torrent is complete and has reached one of the limits.
+// Stopped torrents are only removed, they are not stopped again.
+func shouldApplySeedingPolicy(t *torrent_client.Torrent, policy *anime.AutoDownloaderRuleSeedingPolicy) bool {
+	if policy == nil || policy.Action == anime.SeedingPolicyActionNone || !isTorrentComplete(t) {
+		return false
+	}
+	if policy.Action == anime.SeedingPolicyActionStop && t.Status != torrent_client.TorrentStatusSeeding {
+		return false
+	}
+	if policy.Ratio > 0 && t.Ratio >= policy.Ratio {
+		return true
+	}
+	if policy.SeedingTime > 0 && t.SeedingTime >= policy.SeedingTime*60 {
+		return true
+	}
+	return false
+}
+
+// getTorrentRoots returns the top-level paths of the torrent's files in each of the directories.
+func getTorrentRoots(dirs []string, files []string) []string {
+	ret := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, f := range files {
+		rel := filepath.Clean(filepath.FromSlash(f))
+		if rel == "." || filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		root := rel
+		for filepath.Dir(root) != "." {
+			root = filepath.Dir(root)
+		}
+		for _, dir := range dirs {
+			p := filepath.Join(dir, root)
+			if _, found := seen[p]; found {
+				continue
+			}
+			seen[p] = struct{}{}
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// isAnyPathInRoots returns true if one of the paths is a root or is inside one.
+// The comparison is case-insensitive so that it errs on the side of keeping files.
+func isAnyPathInRoots(paths []string, roots []string) bool {
+	normalizedRoots := make([]string, 0, len(roots))
+	for _, root := range roots {
+		normalizedRoots = append(normalizedRoots, strings.TrimSuffix(util.NormalizePath(filepath.Clean(root)), "/"))
+	}
+	for _, p := range paths {
+		np := util.NormalizePath(filepath.Clean(p))
+		for _, root := range normalizedRoots {
+			if np == root || strings.HasPrefix(np, root+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
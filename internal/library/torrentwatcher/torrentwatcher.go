@@ -0,0 +1,367 @@
+package torrentwatcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/api/metadata"
+	"seanime/internal/database/db"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/database/models"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/library/scanner"
+	"seanime/internal/notifier"
+	"seanime/internal/platforms/platform"
+	"seanime/internal/torrent_clients/torrent_client"
+	"seanime/internal/util"
+	"seanime/internal/util/limiter"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// pollInterval is the interval at which the torrent client is polled for completed torrents.
+	pollInterval = 30 * time.Second
+	// notFoundTimeout is how long a tracked torrent can be missing from the torrent client before it stops being tracked.
+	notFoundTimeout = time.Hour
+	// maxImportAttempts is the number of polls at which the import of a completed torrent is tried before giving up.
+	maxImportAttempts = 5
+)
+
+type (
+	// Watcher tracks the torrents added by Seanime and adds their files to the library when they complete.
+	// Unlike the auto scanner, only the torrent's files are scanned, and they are matched with the known media.
+	// It also enforces the seeding policies of the completed torrents.
+	Watcher struct {
+		logger                  *zerolog.Logger
+		db                      *db.Database
+		wsEventManager          events.WSEventManagerInterface
+		platform                platform.Platform
+		metadataProvider        metadata.Provider
+		torrentClientRepository *torrent_client.Repository
+		mu                      sync.Mutex
+		pollMu                  sync.Mutex
+	}
+
+	NewWatcherOptions struct {
+		Logger           *zerolog.Logger
+		Database         *db.Database
+		WSEventManager   events.WSEventManagerInterface
+		Platform         platform.Platform
+		MetadataProvider metadata.Provider
+	}
+
+	// ImportResult is sent to the client when a tracked torrent has been imported.
+	ImportResult struct {
+		Hash       string   `json:"hash"`
+		Name       string   `json:"name"`
+		MediaId    int      `json:"mediaId"`
+		AddedPaths []string `json:"addedPaths"`
+		Error      string   `json:"error,omitempty"`
+	}
+)
+
+func New(opts *NewWatcherOptions) *Watcher {
+	return &Watcher{
+		logger:           opts.Logger,
+		db:               opts.Database,
+		wsEventManager:   opts.WSEventManager,
+		platform:         opts.Platform,
+		metadataProvider: opts.MetadataProvider,
+	}
+}
+
+func (w *Watcher) SetTorrentClientRepository(repo *torrent_client.Repository) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.torrentClientRepository = repo
+}
+
+// Track starts watching the torrent.
+// It should be called after the torrent has been added to the torrent client.
+// ruleId is the AutoDownloader rule that added the torrent, 0 if it was added manually.
+func (w *Watcher) Track(hash string, name string, mediaId int, destination string, ruleId uint) {
+	if w == nil || hash == "" || mediaId == 0 || destination == "" {
+		return
+	}
+
+	err := w.db.UpsertTrackedTorrent(&models.TrackedTorrent{
+		Hash:        strings.ToLower(hash),
+		Name:        name,
+		MediaId:     mediaId,
+		Destination: destination,
+		RuleId:      ruleId,
+	})
+	if err != nil {
+		w.logger.Error().Err(err).Str("hash", hash).Msg("torrent watcher: Failed to track torrent")
+		return
+	}
+
+	w.logger.Debug().Str("hash", hash).Int("mediaId", mediaId).Msg("torrent watcher: Tracking torrent")
+}
+
+// TrackMagnet is like Track, the hash is read from the magnet link.
+func (w *Watcher) TrackMagnet(magnet string, name string, mediaId int, destination string, ruleId uint) {
+	w.Track(torrent_client.GetInfoHashFromMagnet(magnet), name, mediaId, destination, ruleId)
+}
+
+// Start polls the torrent client in a goroutine.
+func (w *Watcher) Start() {
+	go func() {
+		defer util.HandlePanicInModuleThen("library/torrentwatcher/Start", func() {})
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		seedingTicker := time.NewTicker(seedingPolicyInterval)
+		defer seedingTicker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.poll()
+			case <-seedingTicker.C:
+				w.enforceSeedingPolicies()
+			}
+		}
+	}()
+}
+
+// poll checks the tracked torrents and imports the completed ones.
+func (w *Watcher) poll() {
+	defer util.HandlePanicInModuleThen("library/torrentwatcher/poll", func() {})
+
+	w.pollMu.Lock()
+	defer w.pollMu.Unlock()
+
+	w.mu.Lock()
+	repo := w.torrentClientRepository
+	w.mu.Unlock()
+
+	if repo == nil || repo.GetProvider() == torrent_client.NoneClient {
+		return
+	}
+
+	tracked, err := w.db.GetTrackedTorrents()
+	if err != nil || len(tracked) == 0 {
+		return
+	}
+
+	torrents, err := repo.GetList()
+	if err != nil {
+		return
+	}
+
+	torrentsByHash := make(map[string]*torrent_client.Torrent, len(torrents))
+	for _, t := range torrents {
+		torrentsByHash[strings.ToLower(t.Hash)] = t
+	}
+
+	for _, tt := range tracked {
+		t, found := torrentsByHash[tt.Hash]
+		if !found {
+			// The torrent was removed, or the client hasn't fetched the magnet's metadata yet
+			if tt.Imported || time.Since(tt.CreatedAt) > notFoundTimeout {
+				w.logger.Debug().Str("hash", tt.Hash).Msg("torrent watcher: Torrent not found, no longer tracking")
+				_ = w.db.DeleteTrackedTorrentByHash(tt.Hash)
+			}
+			continue
+		}
+
+		if tt.Imported || !isTorrentComplete(t) {
+			continue
+		}
+
+		if tt.Name == "" {
+			tt.Name = t.Name
+		}
+
+		result := &ImportResult{Hash: tt.Hash, Name: tt.Name, MediaId: tt.MediaId, AddedPaths: []string{}}
+		var added []string
+		files, err := repo.GetFiles(tt.Hash)
+		if err == nil {
+			added, err = w.importFiles(tt, files)
+		}
+		if err != nil {
+			// e.g. The client is still moving the files, the import is retried on the next poll
+			tt.ImportAttempts++
+			if tt.ImportAttempts < maxImportAttempts {
+				w.logger.Warn().Err(err).Str("hash", tt.Hash).Int("attempt", tt.ImportAttempts).Msg("torrent watcher: Failed to import torrent, retrying")
+				_ = w.db.UpdateTrackedTorrentImportError(tt.Hash, err.Error(), tt.ImportAttempts)
+				continue
+			}
+			result.Error = err.Error()
+		} else {
+			result.AddedPaths = added
+		}
+
+		// The torrent stays tracked for the seeding policies
+		_ = w.db.MarkTrackedTorrentImported(tt.Hash)
+		w.sendResult(result)
+	}
+}
+
+// importFiles adds the media files of the torrent to the library, matched with the tracked media.
+// The files are locked like manually matched files, so that the auto scanner does not match them again.
+func (w *Watcher) importFiles(tt *models.TrackedTorrent, files []string) ([]string, error) {
+	settings, err := w.db.GetSettings()
+	if err != nil || settings == nil || settings.Library == nil {
+		return nil, errors.New("library settings not found")
+	}
+
+	libraryPaths := make([]string, 0)
+	for _, p := range append([]string{settings.Library.LibraryPath}, settings.Library.LibraryPaths...) {
+		if p != "" {
+			libraryPaths = append(libraryPaths, p)
+		}
+	}
+
+	paths := getTorrentMediaFilePaths(tt.Destination, files, libraryPaths)
+	if len(paths) == 0 {
+		return nil, errors.New("no media files in library paths")
+	}
+
+	lfs, _, err := db_bridge.GetLocalFiles(w.db)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]*anime.LocalFile, len(lfs))
+	for _, lf := range lfs {
+		existing[lf.GetNormalizedPath()] = lf
+	}
+
+	newLfs := make([]*anime.LocalFile, 0, len(paths))
+	for _, p := range paths {
+		if lf, found := existing[util.NormalizePath(p)]; found && lf.MediaId != 0 {
+			continue // Already in the library
+		}
+		if _, err := os.Stat(p); err != nil {
+			continue // Not reachable from this machine
+		}
+		lf := anime.NewLocalFile(p, getLibraryPath(libraryPaths, p))
+		lf.MediaId = tt.MediaId
+		lf.Locked = true
+		newLfs = append(newLfs, lf)
+	}
+	if len(newLfs) == 0 {
+		return []string{}, nil
+	}
+
+	media, err := w.platform.GetAnime(tt.MediaId)
+	if err != nil {
+		return nil, err
+	}
+
+	fh := scanner.FileHydrator{
+		LocalFiles:         newLfs,
+		AllMedia:           []*anime.NormalizedMedia{anime.NewNormalizedMedia(media)},
+		CompleteAnimeCache: anilist.NewCompleteAnimeCache(),
+		Platform:           w.platform,
+		MetadataProvider:   w.metadataProvider,
+		AnilistRateLimiter: limiter.NewAnilistLimiter(),
+		Logger:             w.logger,
+		ForceMediaId:       media.GetID(),
+	}
+	fh.HydrateMetadata()
+
+	// The local files are reloaded since they may have been saved while the files were hydrated
+	_, err = db_bridge.UpdateLocalFiles(w.db, func(lfs []*anime.LocalFile) []*anime.LocalFile {
+		newLfs = excludeMatchedLocalFiles(lfs, newLfs)
+		return mergeLocalFiles(lfs, newLfs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	added := make([]string, 0, len(newLfs))
+	for _, lf := range newLfs {
+		added = append(added, lf.Path)
+	}
+
+	w.logger.Info().Str("hash", tt.Hash).Int("mediaId", tt.MediaId).Int("count", len(added)).Msg("torrent watcher: Added torrent files to the library")
+
+	return added, nil
+}
+
+func (w *Watcher) sendResult(result *ImportResult) {
+	w.wsEventManager.SendEvent(events.TrackedTorrentImported, result)
+
+	if result.Error != "" {
+		w.logger.Warn().Str("hash", result.Hash).Str("error", result.Error).Msg("torrent watcher: Failed to import torrent")
+		notifier.GlobalNotifier.Notify(notifier.Downloads, fmt.Sprintf("%q finished downloading but could not be added to your library.", result.Name))
+		return
+	}
+
+	notifier.GlobalNotifier.Notify(notifier.Downloads, fmt.Sprintf("%q finished downloading. %d file(s) added to your library.", result.Name, len(result.AddedPaths)))
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func isTorrentComplete(t *torrent_client.Torrent) bool {
+	return t.Progress >= 1 || t.Status == torrent_client.TorrentStatusSeeding
+}
+
+// getTorrentMediaFilePaths returns the absolute paths of the torrent's video files that are in a library path.
+// The file paths from the torrent client are relative to the destination.
+func getTorrentMediaFilePaths(destination string, files []string, libraryPaths []string) []string {
+	ret := make([]string, 0, len(files))
+	for _, f := range files {
+		p := filepath.Clean(filepath.Join(destination, filepath.FromSlash(f)))
+		if !util.IsValidVideoExtension(filepath.Ext(p)) || !util.IsValidMediaFile(filepath.Base(p)) {
+			continue
+		}
+		if !util.IsSubdirectoryOfAny(libraryPaths, p) {
+			continue
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// getLibraryPath returns the library path containing the file.
+func getLibraryPath(libraryPaths []string, p string) string {
+	for _, lp := range libraryPaths {
+		if util.IsSubdirectory(lp, p) {
+			return lp
+		}
+	}
+	return filepath.Dir(p)
+}
+
+// excludeMatchedLocalFiles returns the new local files that are not already matched in the library.
+func excludeMatchedLocalFiles(lfs []*anime.LocalFile, newLfs []*anime.LocalFile) []*anime.LocalFile {
+	matched := make(map[string]struct{}, len(lfs))
+	for _, lf := range lfs {
+		if lf.MediaId != 0 {
+			matched[lf.GetNormalizedPath()] = struct{}{}
+		}
+	}
+	ret := make([]*anime.LocalFile, 0, len(newLfs))
+	for _, lf := range newLfs {
+		if _, found := matched[lf.GetNormalizedPath()]; !found {
+			ret = append(ret, lf)
+		}
+	}
+	return ret
+}
+
+// mergeLocalFiles replaces the local files that have the same path as the new ones and adds the others.
+func mergeLocalFiles(lfs []*anime.LocalFile, newLfs []*anime.LocalFile) []*anime.LocalFile {
+	newPaths := make(map[string]struct{}, len(newLfs))
+	for _, lf := range newLfs {
+		newPaths[lf.GetNormalizedPath()] = struct{}{}
+	}
+
+	ret := make([]*anime.LocalFile, 0, len(lfs)+len(newLfs))
+	for _, lf := range lfs {
+		if _, found := newPaths[lf.GetNormalizedPath()]; !found {
+			ret = append(ret, lf)
+		}
+	}
+	return append(ret, newLfs...)
+}
@@ -0,0 +1,124 @@
+package torrentwatcher
+
+import (
+	"path/filepath"
+	"seanime/internal/library/anime"
+	"seanime/internal/torrent_clients/torrent_client"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTorrentComplete(t *testing.T) {
+	assert.True(t, isTorrentComplete(&torrent_client.Torrent{Progress: 1, Status: torrent_client.TorrentStatusStopped}))
+	assert.True(t, isTorrentComplete(&torrent_client.Torrent{Progress: 0.99, Status: torrent_client.TorrentStatusSeeding}))
+	assert.False(t, isTorrentComplete(&torrent_client.Torrent{Progress: 0.5, Status: torrent_client.TorrentStatusDownloading}))
+	assert.False(t, isTorrentComplete(&torrent_client.Torrent{Progress: 0.5, Status: torrent_client.TorrentStatusPaused}))
+}
+
+func TestGetTorrentMediaFilePaths(t *testing.T) {
+	library := filepath.FromSlash("/anime")
+	destination := filepath.FromSlash("/anime/Show")
+
+	files := []string{
+		"[Group] Show (BD)/[Group] Show - 01.mkv",
+		"[Group] Show (BD)/[Group] Show - 02.mkv",
+		"[Group] Show (BD)/Extras/NCOP.mkv",
+		"[Group] Show (BD)/Fonts/font.ttf",
+		"[Group] Show (BD)/[Group] Show - 01.ass",
+	}
+
+	paths := getTorrentMediaFilePaths(destination, files, []string{library})
+	require.Len(t, paths, 3)
+	assert.Equal(t, filepath.FromSlash("/anime/Show/[Group] Show (BD)/[Group] Show - 01.mkv"), paths[0])
+
+	// Destination outside the library
+	paths = getTorrentMediaFilePaths(filepath.FromSlash("/downloads"), files, []string{library})
+	assert.Empty(t, paths)
+}
+
+func TestMergeLocalFiles(t *testing.T) {
+	library := filepath.FromSlash("/anime")
+	lfs := []*anime.LocalFile{
+		anime.NewLocalFile(filepath.FromSlash("/anime/Other/Other - 01.mkv"), library),
+		anime.NewLocalFile(filepath.FromSlash("/anime/Show/Show - 01.mkv"), library),
+	}
+	newLf := anime.NewLocalFile(filepath.FromSlash("/anime/Show/Show - 01.mkv"), library)
+	newLf.MediaId = 1
+
+	ret := mergeLocalFiles(lfs, []*anime.LocalFile{newLf})
+	require.Len(t, ret, 2)
+	assert.Equal(t, 0, ret[0].MediaId)
+	assert.Equal(t, 1, ret[1].MediaId)
+}
+
+func TestExcludeMatchedLocalFiles(t *testing.T) {
+	library := filepath.FromSlash("/anime")
+	// The first episode was matched by a scan while the torrent files were hydrated
+	matched := anime.NewLocalFile(filepath.FromSlash("/anime/Show/Show - 01.mkv"), library)
+	matched.MediaId = 2
+	lfs := []*anime.LocalFile{
+		matched,
+		anime.NewLocalFile(filepath.FromSlash("/anime/Show/Show - 02.mkv"), library),
+	}
+	newLfs := []*anime.LocalFile{
+		anime.NewLocalFile(filepath.FromSlash("/anime/Show/Show - 01.mkv"), library),
+		anime.NewLocalFile(filepath.FromSlash("/anime/Show/Show - 02.mkv"), library),
+	}
+
+	ret := excludeMatchedLocalFiles(lfs, newLfs)
+	require.Len(t, ret, 1)
+	assert.Equal(t, newLfs[1], ret[0])
+}
+
+func TestShouldApplySeedingPolicy(t *testing.T) {
+	seeding := &torrent_client.Torrent{Progress: 1, Status: torrent_client.TorrentStatusSeeding, Ratio: 1.5, SeedingTime: 3600}
+	stopped := &torrent_client.Torrent{Progress: 1, Status: torrent_client.TorrentStatusStopped, Ratio: 1.5, SeedingTime: 3600}
+	downloading := &torrent_client.Torrent{Progress: 0.5, Status: torrent_client.TorrentStatusDownloading, Ratio: 2}
+
+	tests := []struct {
+		name     string
+		torrent  *torrent_client.Torrent
+		policy   *anime.AutoDownloaderRuleSeedingPolicy
+		expected bool
+	}{
+		{"no action", seeding, &anime.AutoDownloaderRuleSeedingPolicy{Ratio: 1}, false},
+		{"ratio reached", seeding, &anime.AutoDownloaderRuleSeedingPolicy{Action: anime.SeedingPolicyActionStop, Ratio: 1}, true},
+		{"ratio not reached", seeding, &anime.AutoDownloaderRuleSeedingPolicy{Action: anime.SeedingPolicyActionStop, Ratio: 2}, false},
+		{"seeding time reached", seeding, &anime.AutoDownloaderRuleSeedingPolicy{Action: anime.SeedingPolicyActionStop, SeedingTime: 60}, true},
+		{"seeding time not reached", seeding, &anime.AutoDownloaderRuleSeedingPolicy{Action: anime.SeedingPolicyActionStop, Ratio: 2, SeedingTime: 120}, false},
+		{"no limits", seeding, &anime.AutoDownloaderRuleSeedingPolicy{Action: anime.SeedingPolicyActionRemove}, false},
+		{"already stopped", stopped, &anime.AutoDownloaderRuleSeedingPolicy{Action: anime.SeedingPolicyActionStop, Ratio: 1}, false},
+		{"remove stopped", stopped, &anime.AutoDownloaderRuleSeedingPolicy{Action: anime.SeedingPolicyActionRemove, Ratio: 1}, true},
+		{"incomplete", downloading, &anime.AutoDownloaderRuleSeedingPolicy{Action: anime.SeedingPolicyActionRemove, Ratio: 1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, shouldApplySeedingPolicy(tt.torrent, tt.policy))
+		})
+	}
+}
+
+func TestIsAnyPathInRoots(t *testing.T) {
+	files := []string{"[Group] Show (BD)/[Group] Show - 01.mkv", "[Group] Show (BD)/Extras/NCOP.mkv"}
+	roots := getTorrentRoots([]string{filepath.FromSlash("/anime/Show")}, files)
+	require.Equal(t, []string{filepath.FromSlash("/anime/Show/[Group] Show (BD)")}, roots)
+
+	assert.True(t, isAnyPathInRoots([]string{filepath.FromSlash("/anime/Show/[Group] Show (BD)/[Group] Show - 01.mkv")}, roots))
+	assert.True(t, isAnyPathInRoots([]string{filepath.FromSlash("/anime/show/[group] show (bd)/other.mkv")}, roots))
+	assert.False(t, isAnyPathInRoots([]string{filepath.FromSlash("/anime/Show/[Group] Show (BD) v2/[Group] Show - 01.mkv")}, roots))
+	assert.False(t, isAnyPathInRoots([]string{filepath.FromSlash("/anime/Other/Other - 01.mkv")}, roots))
+
+	// Single file torrent
+	roots = getTorrentRoots([]string{filepath.FromSlash("/downloads")}, []string{"Show - 01.mkv"})
+	assert.True(t, isAnyPathInRoots([]string{filepath.FromSlash("/downloads/Show - 01.mkv")}, roots))
+}
+
+func TestHasAnyTag(t *testing.T) {
+	tags := getSeanimeTags(torrent_client.QbittorrentClient, "seanime, anime")
+	assert.True(t, hasAnyTag(&torrent_client.Torrent{Tags: []string{"Seanime"}}, tags))
+	assert.False(t, hasAnyTag(&torrent_client.Torrent{Tags: []string{"movies"}}, tags))
+	assert.Empty(t, getSeanimeTags(torrent_client.TransmissionClient, "seanime"))
+}
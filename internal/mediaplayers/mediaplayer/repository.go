@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"seanime/internal/continuity"
+	"seanime/internal/database/models"
 	"seanime/internal/events"
 	mpchc2 "seanime/internal/mediaplayers/mpchc"
 	"seanime/internal/mediaplayers/mpv"
 	vlc2 "seanime/internal/mediaplayers/vlc"
+	"seanime/internal/util"
 	"seanime/internal/util/result"
 	"sync"
 	"time"
@@ -226,6 +228,9 @@ func (m *Repository) Play(path string) error {
 			}
 		}
 
+		// Add the intro and credits as chapters so they can be skipped
+		go m.setMpvChapters(path)
+
 		return nil
 	default:
 		return errors.New("no default media player set")
@@ -362,6 +367,8 @@ func (m *Repository) StartTrackingTorrentStream() {
 	var filename string
 	var completed bool
 	var retries int
+	var creditsStartTime float64
+	var hasCredits bool
 	maxTries := 5
 
 	// Unlike normal tracking when the file is downloaded, we may need to wait a bit before we can get the status
@@ -462,10 +469,12 @@ func (m *Repository) StartTrackingTorrentStream() {
 					m.streamingTrackingStarted(m.currentPlaybackStatus)
 					filename = m.currentPlaybackStatus.Filename
 					completed = false
+					// Load the credits once instead of querying them on every status update
+					creditsStartTime, hasCredits = m.continuityManager.GetCreditsStartTime(m.currentPlaybackStatus.Filepath)
 				}
 
 				// Video completed \/
-				if m.currentPlaybackStatus.CompletionPercentage > m.completionThreshold && !completed {
+				if !completed && m.isVideoCompleted(creditsStartTime, hasCredits) {
 					m.Logger.Debug().Msg("media player: Video completed")
 					m.streamingVideoCompleted(m.currentPlaybackStatus)
 					completed = true
@@ -495,6 +504,8 @@ func (m *Repository) StartTracking() {
 	var filename string
 	var completed bool
 	var retries int
+	var creditsStartTime float64
+	var hasCredits bool
 
 	m.isRunning = true
 
@@ -567,10 +578,12 @@ func (m *Repository) StartTracking() {
 					m.trackingStarted(m.currentPlaybackStatus)
 					filename = m.currentPlaybackStatus.Filename
 					completed = false
+					// Load the credits once instead of querying them on every status update
+					creditsStartTime, hasCredits = m.continuityManager.GetCreditsStartTime(m.currentPlaybackStatus.Filepath)
 				}
 
 				// Video completed \/
-				if m.currentPlaybackStatus.CompletionPercentage > m.completionThreshold && !completed {
+				if !completed && m.isVideoCompleted(creditsStartTime, hasCredits) {
 					m.Logger.Debug().Msg("media player: Video completed")
 					m.videoCompleted(m.currentPlaybackStatus)
 					completed = true
@@ -654,6 +667,48 @@ func (m *Repository) streamingPlaybackStatus(status *PlaybackStatus) {
 	})
 }
 
+// isVideoCompleted returns true if the video is past the completion threshold or has reached its credits.
+func (m *Repository) isVideoCompleted(creditsStartTime float64, hasCredits bool) bool {
+	st := m.currentPlaybackStatus
+	return st.CompletionPercentage > m.completionThreshold || (hasCredits && st.CurrentTimeInSeconds >= creditsStartTime)
+}
+
+// setMpvChapters adds the intro and credits of the file as chapters in mpv.
+func (m *Repository) setMpvChapters(path string) {
+	defer util.HandlePanicInModuleThen("mediaplayer/setMpvChapters", func() {})
+
+	segments := m.continuityManager.GetSkipSegments(path)
+	if len(segments) == 0 {
+		return
+	}
+
+	err := m.Mpv.SetChapters(path, skipSegmentsToChapters(segments))
+	if err != nil {
+		m.Logger.Warn().Err(err).Msg("media player: Could not set MPV chapters")
+		return
+	}
+	m.Logger.Debug().Msgf("media player: Added %d skip segments as MPV chapters", len(segments))
+}
+
+// skipSegmentsToChapters returns chapters for the skip segments and the parts of the episode around them.
+func skipSegmentsToChapters(segments []*models.SkipSegment) []mpv.Chapter {
+	chapters := make([]mpv.Chapter, 0, len(segments)*2+1)
+	position := 0.0
+	for _, s := range segments {
+		if s.StartTime > position+1 {
+			chapters = append(chapters, mpv.Chapter{Title: "Episode", Time: position})
+		}
+		title := "Intro"
+		if s.Type == models.SkipSegmentTypeCredits {
+			title = "Credits"
+		}
+		chapters = append(chapters, mpv.Chapter{Title: title, Time: s.StartTime})
+		position = s.EndTime
+	}
+	chapters = append(chapters, mpv.Chapter{Title: "Episode", Time: position})
+	return chapters
+}
+
 func (m *Repository) getStatus() (interface{}, error) {
 	switch m.Default {
 	case "vlc":
@@ -43,6 +43,12 @@ type (
 	Subscriber struct {
 		ClosedCh chan struct{}
 	}
+
+	// Chapter is a chapter of the file being played.
+	Chapter struct {
+		Title string  `json:"title"`
+		Time  float64 `json:"time"` // Start time in seconds
+	}
 )
 
 var cmdCtx, cmdCancel = context.WithCancel(context.Background())
@@ -258,6 +264,34 @@ func (m *Mpv) SeekTo(position float64) error {
 	return nil
 }
 
+// SetChapters replaces the chapters of the file being played, once it's loaded.
+// The user can then skip between the chapters, e.g. to skip the intro.
+func (m *Mpv) SetChapters(filePath string, chapters []Chapter) error {
+	// Wait for the file to be loaded, mpv resets the chapters when loading a file
+	for i := 0; i < 20; i++ {
+		m.mu.Lock()
+		conn := m.conn
+		m.mu.Unlock()
+		if conn == nil || conn.IsClosed() {
+			return errors.New("mpv is not running")
+		}
+
+		path, _ := conn.Get("path")
+		duration, _ := conn.Get("duration")
+		if path == filePath && duration != nil {
+			list := make([]map[string]interface{}, 0, len(chapters))
+			for _, c := range chapters {
+				list = append(list, map[string]interface{}{"title": c.Title, "time": c.Time})
+			}
+			return conn.Set("chapter-list", list)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return errors.New("file not loaded")
+}
+
 func (m *Mpv) establishConnection() error {
 	tries := 1
 	for {
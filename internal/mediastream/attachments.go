@@ -2,12 +2,15 @@ package mediastream
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
+	"os"
 	"path/filepath"
 	"seanime/internal/events"
 	"seanime/internal/mediastream/videofile"
 
 	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
 )
 
 func (r *Repository) ServeEchoExtractedSubtitles(c echo.Context) error {
@@ -39,9 +42,45 @@ func (r *Repository) ServeEchoExtractedSubtitles(c echo.Context) error {
 
 	r.logger.Trace().Msgf("mediastream: Serving subtitles from %s", retPath)
 
+	// Convert the track to WebVTT on the fly if it's requested in that format, e.g. "/2.vtt" for "/2.ass"
+	var index int32
+	if _, err := fmt.Sscanf(subFilePath, "%d.vtt", &index); err == nil && subFilePath == fmt.Sprintf("%d.vtt", index) {
+		if _, err := os.Stat(filepath.Join(retPath, subFilePath)); err != nil {
+			return r.serveWebVttSubtitle(c, mediaContainer, index)
+		}
+	}
+
 	return c.File(filepath.Join(retPath, subFilePath))
 }
 
+// getExtractedSubtitlePath returns the path of an extracted subtitle track of the media.
+func (r *Repository) getExtractedSubtitlePath(mediaContainer *MediaContainer, index int32) (string, error) {
+	sub, found := lo.Find(mediaContainer.MediaInfo.Subtitles, func(sub videofile.Subtitle) bool {
+		return int32(sub.Index) == index
+	})
+	if !found || sub.Extension == nil {
+		return "", fmt.Errorf("subtitle track %d not found", index)
+	}
+
+	return filepath.Join(videofile.GetFileSubsCacheDir(r.cacheDir, mediaContainer.Hash), fmt.Sprintf("%d.%s", index, *sub.Extension)), nil
+}
+
+// serveWebVttSubtitle converts a subtitle track to WebVTT, for clients that only support text tracks.
+func (r *Repository) serveWebVttSubtitle(c echo.Context, mediaContainer *MediaContainer, index int32) error {
+	subPath, err := r.getExtractedSubtitlePath(mediaContainer, index)
+	if err != nil {
+		return err
+	}
+
+	ret, err := videofile.ConvertFileToWebVtt(subPath)
+	if err != nil {
+		r.logger.Error().Err(err).Int32("index", index).Msg("mediastream: Failed to convert subtitles to WebVTT")
+		return err
+	}
+
+	return c.Blob(200, "text/vtt; charset=utf-8", []byte(ret))
+}
+
 func (r *Repository) ServeEchoExtractedAttachments(c echo.Context) error {
 	if !r.IsInitialized() {
 		r.wsEventManager.SendEvent(events.MediastreamShutdownStream, "Module not initialized")
@@ -7,7 +7,9 @@ import (
 	"net/url"
 	"os"
 	"seanime/internal/events"
+	"seanime/internal/mediastream/transcoder"
 	"seanime/internal/util"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 )
@@ -35,24 +37,125 @@ func (r *Repository) ServeEchoFile(c echo.Context, rawFilePath string, clientId
 }
 
 func (r *Repository) ServeEchoDirectPlay(c echo.Context, clientId string) error {
+	mediaContainer, err := r.getCurrentMediaContainer()
+	if err != nil {
+		return err
+	}
+
+	return r.serveEchoMediaFile(c, mediaContainer.Filepath)
+}
+
+// ServeEchoDirectPlayAudioRemux streams the current media with a processed audio track, the video stream is copied untouched.
+// The audio options are the same as the transcode stream's, the track is selected with "audioTrack".
+// The output is a fragmented MP4 that can't be seeked with range requests, the client requests the stream again from the seek position with "start".
+// e.g. /direct/audio?audioTrack=1&audioDownmix=dialogue&audioNormalize=true&start=120.5
+func (r *Repository) ServeEchoDirectPlayAudioRemux(c echo.Context, clientId string) error {
+	mediaContainer, err := r.getCurrentMediaContainer()
+	if err != nil {
+		return err
+	}
+
+	audioOptions, err := getAudioOptionsFromQuery(c)
+	if err != nil {
+		return err
+	}
+
+	track := int64(0)
+	if audioTrack := c.QueryParam("audioTrack"); audioTrack != "" {
+		track, err = strconv.ParseInt(audioTrack, 10, 32)
+		if err != nil {
+			return err
+		}
+	}
+
+	start := float64(0)
+	if s := c.QueryParam("start"); s != "" {
+		start, err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	args, err := getAudioRemuxArgs(mediaContainer, int32(track), audioOptions, start)
+	if err != nil {
+		return err
+	}
 
+	r.logger.Debug().Str("filepath", mediaContainer.Filepath).Int64("track", track).Str("profile", audioOptions.Profile()).Msg("mediastream: Remuxing audio for direct play")
+
+	// The encoder is stopped when the client disconnects
+	cmd := util.NewCmdCtx(c.Request().Context(), r.settings.MustGet().FfmpegPath, args...)
+	cmd.Stdout = c.Response()
+
+	c.Response().Header().Set(echo.HeaderContentType, "video/mp4")
+	c.Response().WriteHeader(http.StatusOK)
+
+	if err := cmd.Run(); err != nil && c.Request().Context().Err() == nil {
+		r.logger.Error().Err(err).Msg("mediastream: Audio remux failed")
+	}
+	return nil
+}
+
+// getAudioRemuxArgs returns the FFmpeg arguments that copy the video stream and encode the audio track into a fragmented MP4.
+func getAudioRemuxArgs(mediaContainer *MediaContainer, track int32, audioOptions *transcoder.AudioOptions, start float64) ([]string, error) {
+	var channels uint32
+	found := false
+	for _, audio := range mediaContainer.MediaInfo.Audios {
+		if int32(audio.Index) == track {
+			channels = audio.Channels
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("audio track %d not found", track)
+	}
+
+	args := []string{"-nostats", "-hide_banner", "-loglevel", "warning"}
+	if start > 0 {
+		// Seeks to the keyframe before the start position, the output starts at 0s
+		args = append(args, "-ss", fmt.Sprintf("%.6f", start))
+	}
+	args = append(args,
+		"-i", mediaContainer.Filepath,
+		"-map", "0:v:0?",
+		"-map", fmt.Sprintf("0:a:%d", track),
+		"-c:v", "copy",
+	)
+	// Safari only plays HEVC in MP4 with the hvc1 tag
+	if mediaContainer.MediaInfo.Video != nil && mediaContainer.MediaInfo.Video.Codec == "hevc" {
+		args = append(args, "-tag:v", "hvc1")
+	}
+	args = append(args, audioOptions.GetEncodeArgs(channels)...)
+	args = append(args,
+		"-f", "mp4",
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"pipe:1",
+	)
+	return args, nil
+}
+
+func (r *Repository) getCurrentMediaContainer() (*MediaContainer, error) {
 	if !r.IsInitialized() {
 		r.wsEventManager.SendEvent(events.MediastreamShutdownStream, "Module not initialized")
-		return errors.New("module not initialized")
+		return nil, errors.New("module not initialized")
 	}
 
 	// Get current media
 	mediaContainer, found := r.playbackManager.currentMediaContainer.Get()
 	if !found {
 		r.wsEventManager.SendEvent(events.MediastreamShutdownStream, "no file has been loaded")
-		return errors.New("no file has been loaded")
+		return nil, errors.New("no file has been loaded")
 	}
 
+	return mediaContainer, nil
+}
+
+func (r *Repository) serveEchoMediaFile(c echo.Context, filepath string) error {
 	if c.Request().Method == http.MethodHead {
 		r.logger.Trace().Msg("mediastream: Received HEAD request for direct play")
 
 		// Get the file size
-		fileInfo, err := os.Stat(mediaContainer.Filepath)
+		fileInfo, err := os.Stat(filepath)
 		if err != nil {
 			r.logger.Error().Msg("mediastream: Failed to get file info")
 			return c.NoContent(http.StatusInternalServerError)
@@ -62,9 +165,9 @@ func (r *Repository) ServeEchoDirectPlay(c echo.Context, clientId string) error
 		c.Response().Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
 		c.Response().Header().Set("Content-Type", "video/mp4")
 		c.Response().Header().Set("Accept-Ranges", "bytes")
-		c.Response().Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", mediaContainer.Filepath))
+		c.Response().Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filepath))
 		return c.NoContent(http.StatusOK)
 	}
 
-	return c.File(mediaContainer.Filepath)
+	return c.File(filepath)
 }
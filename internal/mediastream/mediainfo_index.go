@@ -0,0 +1,325 @@
+package mediastream
+
+import (
+	"errors"
+	"os"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+	"seanime/internal/mediastream/optimizer"
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/samber/lo"
+	"golang.org/x/text/language"
+)
+
+type (
+	// MediaInfoIndexer probes the local files in the background, one file at a time, and stores their media information in the library index.
+	MediaInfoIndexer struct {
+		repository *Repository
+		mu         sync.Mutex
+		queue      []*anime.LocalFile
+		running    bool
+	}
+
+	// MediaInfoIndexFilter selects the files of the library index.
+	// Zero values don't filter.
+	MediaInfoIndexFilter struct {
+		MediaId                 int      `json:"mediaId"`
+		VideoCodecs             []string `json:"videoCodecs"` // e.g. "hevc"
+		MinBitDepth             uint32   `json:"minBitDepth"`
+		MinHeight               uint32   `json:"minHeight"`
+		MaxHeight               uint32   `json:"maxHeight"`
+		AudioLanguage           string   `json:"audioLanguage"`           // e.g. "ja", files with an audio track in this language
+		SubtitleLanguage        string   `json:"subtitleLanguage"`        // e.g. "en", files with a subtitle track in this language
+		MissingSubtitleLanguage string   `json:"missingSubtitleLanguage"` // e.g. "en", files without a subtitle track in this language
+		MinDuration             float64  `json:"minDuration"`             // Seconds
+		MaxDuration             float64  `json:"maxDuration"`             // Seconds
+		MinSize                 int64    `json:"minSize"`                 // Bytes
+		MaxSize                 int64    `json:"maxSize"`                 // Bytes
+		FailedOnly              bool     `json:"failedOnly"`              // Only the files that couldn't be probed
+	}
+
+	// MediaInfoIndexResult holds the files matching a filter and their statistics.
+	MediaInfoIndexResult struct {
+		Entries []*models.MediastreamMediaInfoEntry `json:"entries"`
+		Stats   *MediaInfoIndexStats                `json:"stats"`
+		Pending int                                 `json:"pending"` // Number of files waiting to be indexed
+	}
+
+	MediaInfoIndexStats struct {
+		Count             int            `json:"count"`
+		Failed            int            `json:"failed"`
+		TotalDuration     float64        `json:"totalDuration"` // Seconds
+		TotalSize         int64          `json:"totalSize"`     // Bytes
+		VideoCodecs       map[string]int `json:"videoCodecs"`   // Number of files per codec
+		Qualities         map[string]int `json:"qualities"`     // Number of files per quality, e.g. "1080p"
+		BitDepths         map[uint32]int `json:"bitDepths"`
+		AudioLanguages    map[string]int `json:"audioLanguages"` // Number of files with at least one track per language
+		SubtitleLanguages map[string]int `json:"subtitleLanguages"`
+	}
+)
+
+func NewMediaInfoIndexer(repository *Repository) *MediaInfoIndexer {
+	return &MediaInfoIndexer{
+		repository: repository,
+		queue:      make([]*anime.LocalFile, 0),
+	}
+}
+
+// IndexLibraryMediaInfo queues the local files that haven't been indexed yet, or that were modified since.
+// The files that are no longer in the library are removed from the index.
+func (r *Repository) IndexLibraryMediaInfo(lfs []*anime.LocalFile) error {
+	if !r.IsInitialized() {
+		return errors.New("module not initialized")
+	}
+	if r.db == nil {
+		return errors.New("database not set")
+	}
+
+	lfs = lo.Filter(lfs, func(lf *anime.LocalFile, _ int) bool {
+		return lf != nil && lf.Path != ""
+	})
+
+	err := r.db.DeleteMediastreamMediaInfoEntriesExcept(lo.Map(lfs, func(lf *anime.LocalFile, _ int) string { return lf.Path }))
+	if err != nil {
+		r.logger.Warn().Err(err).Msg("mediastream: Failed to remove old files from the media info index")
+	}
+
+	r.mediaInfoIndexer.enqueue(lfs)
+	return nil
+}
+
+// QueryMediaInfoIndex returns the indexed files matching the filter, with their statistics.
+func (r *Repository) QueryMediaInfoIndex(filter *MediaInfoIndexFilter) (*MediaInfoIndexResult, error) {
+	if r.db == nil {
+		return nil, errors.New("database not set")
+	}
+
+	entries, err := r.db.GetMediastreamMediaInfoEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	entries = filterMediaInfoEntries(entries, filter)
+
+	return &MediaInfoIndexResult{
+		Entries: entries,
+		Stats:   getMediaInfoIndexStats(entries),
+		Pending: r.mediaInfoIndexer.pending(),
+	}, nil
+}
+
+func (g *MediaInfoIndexer) enqueue(lfs []*anime.LocalFile) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, lf := range lfs {
+		if slices.ContainsFunc(g.queue, func(q *anime.LocalFile) bool { return q.HasSamePath(lf.Path) }) {
+			continue
+		}
+		g.queue = append(g.queue, lf)
+	}
+
+	if !g.running && len(g.queue) > 0 {
+		g.running = true
+		go g.run()
+	}
+}
+
+func (g *MediaInfoIndexer) pending() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.queue)
+}
+
+// run indexes the queued files until the queue is empty.
+func (g *MediaInfoIndexer) run() {
+	count := 0
+	for {
+		g.mu.Lock()
+		if len(g.queue) == 0 || !g.repository.IsInitialized() {
+			g.queue = g.queue[:0]
+			g.running = false
+			g.mu.Unlock()
+			if count > 0 {
+				g.repository.logger.Info().Int("count", count).Msg("mediastream: Indexed media information")
+			}
+			return
+		}
+		lf := g.queue[0]
+		g.queue = g.queue[1:]
+		g.mu.Unlock()
+
+		if g.index(lf) {
+			count++
+		}
+	}
+}
+
+// index probes a file and stores its media information.
+// It returns false if the file was already indexed.
+func (g *MediaInfoIndexer) index(lf *anime.LocalFile) (indexed bool) {
+	defer util.HandlePanicInModuleThen("mediastream/mediainfo/index", func() {})
+
+	r := g.repository
+
+	hash, err := videofile.GetHashFromPath(lf.Path)
+	if err != nil {
+		// The file was removed after the scan
+		return false
+	}
+
+	existing, err := r.db.GetMediastreamMediaInfoEntryByPath(lf.Path)
+	if err != nil {
+		return false
+	}
+	if existing != nil && existing.Hash == hash {
+		// Keep the mapping up to date without probing the file again
+		if existing.MediaId != lf.MediaId {
+			existing.MediaId = lf.MediaId
+			_ = r.db.UpsertMediastreamMediaInfoEntry(existing)
+		}
+		return false
+	}
+
+	entry := &models.MediastreamMediaInfoEntry{
+		Path:    lf.Path,
+		Hash:    hash,
+		MediaId: lf.MediaId,
+	}
+	if info, err := os.Stat(lf.Path); err == nil {
+		entry.Size = info.Size()
+	}
+
+	mediaInfo, err := r.mediaInfoExtractor.GetInfo(r.settings.MustGet().FfprobePath, lf.Path)
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		setMediaInfoEntry(entry, mediaInfo)
+	}
+
+	if err := r.db.UpsertMediastreamMediaInfoEntry(entry); err != nil {
+		r.logger.Error().Err(err).Str("filepath", lf.Path).Msg("mediastream: Failed to save media info in the index")
+		return false
+	}
+
+	return true
+}
+
+func setMediaInfoEntry(entry *models.MediastreamMediaInfoEntry, mediaInfo *videofile.MediaInfo) {
+	entry.Duration = float64(mediaInfo.Duration)
+	if mediaInfo.Video != nil {
+		entry.VideoCodec = mediaInfo.Video.Codec
+		entry.Quality = string(mediaInfo.Video.Quality)
+		entry.Width = mediaInfo.Video.Width
+		entry.Height = mediaInfo.Video.Height
+		entry.BitDepth = mediaInfo.Video.GetBitDepth()
+	}
+	entry.AudioCodecs = lo.Uniq(lo.Map(mediaInfo.Audios, func(audio videofile.Audio, _ int) string {
+		return audio.Codec
+	}))
+	entry.AudioLanguages = lo.Uniq(lo.FilterMap(mediaInfo.Audios, func(audio videofile.Audio, _ int) (string, bool) {
+		return lo.FromPtr(audio.Language), audio.Language != nil
+	}))
+	entry.SubtitleLanguages = lo.Uniq(lo.FilterMap(mediaInfo.Subtitles, func(sub videofile.Subtitle, _ int) (string, bool) {
+		return lo.FromPtr(sub.Language), sub.Language != nil
+	}))
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func filterMediaInfoEntries(entries []*models.MediastreamMediaInfoEntry, filter *MediaInfoIndexFilter) []*models.MediastreamMediaInfoEntry {
+	if filter == nil {
+		return entries
+	}
+
+	videoCodecs := lo.Map(filter.VideoCodecs, func(codec string, _ int) string { return optimizer.NormalizeCodec(codec) })
+	audioLanguage := normalizeLanguage(filter.AudioLanguage)
+	subtitleLanguage := normalizeLanguage(filter.SubtitleLanguage)
+	missingSubtitleLanguage := normalizeLanguage(filter.MissingSubtitleLanguage)
+
+	hasLanguage := func(languages []string, lang string) bool {
+		return lo.ContainsBy(languages, func(l string) bool { return normalizeLanguage(l) == lang })
+	}
+
+	return lo.Filter(entries, func(entry *models.MediastreamMediaInfoEntry, _ int) bool {
+		switch {
+		case filter.FailedOnly && entry.Error == "":
+			return false
+		case filter.MediaId != 0 && entry.MediaId != filter.MediaId:
+			return false
+		case len(videoCodecs) > 0 && !slices.Contains(videoCodecs, optimizer.NormalizeCodec(entry.VideoCodec)):
+			return false
+		case filter.MinBitDepth > 0 && entry.BitDepth < filter.MinBitDepth:
+			return false
+		case filter.MinHeight > 0 && entry.Height < filter.MinHeight:
+			return false
+		case filter.MaxHeight > 0 && entry.Height > filter.MaxHeight:
+			return false
+		case audioLanguage != "" && !hasLanguage(entry.AudioLanguages, audioLanguage):
+			return false
+		case subtitleLanguage != "" && !hasLanguage(entry.SubtitleLanguages, subtitleLanguage):
+			return false
+		case missingSubtitleLanguage != "" && hasLanguage(entry.SubtitleLanguages, missingSubtitleLanguage):
+			return false
+		case filter.MinDuration > 0 && entry.Duration < filter.MinDuration:
+			return false
+		case filter.MaxDuration > 0 && entry.Duration > filter.MaxDuration:
+			return false
+		case filter.MinSize > 0 && entry.Size < filter.MinSize:
+			return false
+		case filter.MaxSize > 0 && entry.Size > filter.MaxSize:
+			return false
+		}
+		return true
+	})
+}
+
+func getMediaInfoIndexStats(entries []*models.MediastreamMediaInfoEntry) *MediaInfoIndexStats {
+	ret := &MediaInfoIndexStats{
+		VideoCodecs:       make(map[string]int),
+		Qualities:         make(map[string]int),
+		BitDepths:         make(map[uint32]int),
+		AudioLanguages:    make(map[string]int),
+		SubtitleLanguages: make(map[string]int),
+	}
+
+	for _, entry := range entries {
+		ret.Count++
+		ret.TotalSize += entry.Size
+		if entry.Error != "" {
+			ret.Failed++
+			continue
+		}
+		ret.TotalDuration += entry.Duration
+		if entry.VideoCodec != "" {
+			ret.VideoCodecs[entry.VideoCodec]++
+			ret.Qualities[entry.Quality]++
+			ret.BitDepths[entry.BitDepth]++
+		}
+		for _, lang := range lo.Uniq(lo.Map(entry.AudioLanguages, func(l string, _ int) string { return normalizeLanguage(l) })) {
+			ret.AudioLanguages[lang]++
+		}
+		for _, lang := range lo.Uniq(lo.Map(entry.SubtitleLanguages, func(l string, _ int) string { return normalizeLanguage(l) })) {
+			ret.SubtitleLanguages[lang]++
+		}
+	}
+	return ret
+}
+
+// normalizeLanguage returns the language tag of a language code, so that "eng" and "en" are the same language.
+func normalizeLanguage(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	lang, err := language.Parse(s)
+	if err != nil {
+		return strings.ToLower(s)
+	}
+	return lang.String()
+}
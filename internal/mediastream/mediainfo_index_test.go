@@ -0,0 +1,68 @@
+package mediastream
+
+import (
+	"seanime/internal/database/models"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterMediaInfoEntries(t *testing.T) {
+	entries := []*models.MediastreamMediaInfoEntry{
+		{Path: "/anime/A - 01.mkv", MediaId: 1, VideoCodec: "hevc", Quality: "1080p", Height: 1080, BitDepth: 10, Duration: 1420, Size: 400_000_000, AudioLanguages: []string{"ja"}, SubtitleLanguages: []string{"en", "fr"}},
+		{Path: "/anime/A - 02.mkv", MediaId: 1, VideoCodec: "h264", Quality: "720p", Height: 720, BitDepth: 8, Duration: 1420, Size: 200_000_000, AudioLanguages: []string{"ja", "en"}},
+		{Path: "/anime/B - 01.mkv", MediaId: 2, Size: 1000, Error: "invalid data found when processing input"},
+	}
+
+	paths := func(entries []*models.MediastreamMediaInfoEntry) []string {
+		return lo.Map(entries, func(e *models.MediastreamMediaInfoEntry, _ int) string { return e.Path })
+	}
+
+	// 10-bit HEVC files
+	assert.Equal(t, []string{"/anime/A - 01.mkv"}, paths(filterMediaInfoEntries(entries, &MediaInfoIndexFilter{VideoCodecs: []string{"x265"}, MinBitDepth: 10})))
+
+	// Files without English subtitles, ISO-639-2 codes are accepted
+	assert.Equal(t, []string{"/anime/A - 02.mkv", "/anime/B - 01.mkv"}, paths(filterMediaInfoEntries(entries, &MediaInfoIndexFilter{MissingSubtitleLanguage: "eng"})))
+	assert.Equal(t, []string{"/anime/A - 02.mkv"}, paths(filterMediaInfoEntries(entries, &MediaInfoIndexFilter{AudioLanguage: "en"})))
+
+	assert.Equal(t, []string{"/anime/B - 01.mkv"}, paths(filterMediaInfoEntries(entries, &MediaInfoIndexFilter{FailedOnly: true})))
+	assert.Equal(t, []string{"/anime/A - 02.mkv"}, paths(filterMediaInfoEntries(entries, &MediaInfoIndexFilter{MaxHeight: 720, MinDuration: 60})))
+	assert.Len(t, filterMediaInfoEntries(entries, &MediaInfoIndexFilter{}), 3)
+
+	stats := getMediaInfoIndexStats(entries)
+	assert.Equal(t, 3, stats.Count)
+	assert.Equal(t, 1, stats.Failed)
+	assert.Equal(t, float64(2840), stats.TotalDuration)
+	assert.Equal(t, int64(600_001_000), stats.TotalSize)
+	assert.Equal(t, map[string]int{"hevc": 1, "h264": 1}, stats.VideoCodecs)
+	assert.Equal(t, map[string]int{"ja": 2, "en": 1}, stats.AudioLanguages)
+	assert.Equal(t, map[uint32]int{10: 1, 8: 1}, stats.BitDepths)
+}
+
+func TestMatchOptimizationRule_Indexed(t *testing.T) {
+	rules := []*models.MediastreamOptimizationRule{
+		{Name: "Watching", Enabled: true, WatchingOnly: true, Quality: "high"},
+		{Name: "10-bit HEVC", Enabled: true, VideoCodecs: []string{"x265"}, MinBitDepth: 10, Quality: "medium"},
+	}
+
+	// The rules are matched on the indexed information, without probing the files
+	hevc := getIndexedMediaInfo(&models.MediastreamMediaInfoEntry{Path: "/anime/A - 01.mkv", Hash: "a", VideoCodec: "hevc", Height: 1080, BitDepth: 10})
+	rule, found := matchOptimizationRule(rules, hevc, false)
+	require.True(t, found)
+	assert.Equal(t, "10-bit HEVC", rule.Name)
+
+	rule, found = matchOptimizationRule(rules, hevc, true)
+	require.True(t, found)
+	assert.Equal(t, "Watching", rule.Name)
+
+	// 8-bit H.264 files are never optimized
+	h264 := getIndexedMediaInfo(&models.MediastreamMediaInfoEntry{Path: "/anime/A - 02.mkv", Hash: "b", VideoCodec: "h264", Height: 720, BitDepth: 8})
+	_, found = matchOptimizationRule(rules, h264, true)
+	assert.False(t, found)
+
+	// Files without video aren't matched
+	_, found = matchOptimizationRule(rules, getIndexedMediaInfo(&models.MediastreamMediaInfoEntry{Path: "/anime/A - 03.mka"}), true)
+	assert.False(t, found)
+}
@@ -0,0 +1,198 @@
+package mediastream
+
+import (
+	"errors"
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+	"seanime/internal/mediastream/optimizer"
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util"
+
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Optimize
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// QueueLibraryOptimizations adds the local files matching the optimization rules to the queue.
+// The anime collection is used to find the shows that are currently being watched.
+// It returns the number of files that were queued.
+func (r *Repository) QueueLibraryOptimizations(lfs []*anime.LocalFile, animeCollection *anilist.AnimeCollection) (int, error) {
+	if !r.IsInitialized() {
+		return 0, errors.New("module not initialized")
+	}
+
+	settings := r.settings.MustGet()
+	if !settings.PreTranscodeEnabled {
+		return 0, errors.New("pre-transcoding is disabled")
+	}
+
+	rules := make([]*models.MediastreamOptimizationRule, 0)
+	for _, rule := range settings.PreTranscodeRules {
+		if rule != nil && rule.Enabled {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return 0, nil
+	}
+
+	watching := getWatchingMediaIds(animeCollection)
+
+	// The files are matched using the library index, only the new or modified files are probed
+	indexed := make(map[string]*models.MediastreamMediaInfoEntry)
+	if r.db != nil {
+		if entries, err := r.db.GetMediastreamMediaInfoEntries(); err == nil {
+			indexed = lo.KeyBy(entries, func(e *models.MediastreamMediaInfoEntry) string { return e.Path })
+		}
+	}
+
+	count := 0
+	for _, lf := range lfs {
+		if lf == nil || lf.Path == "" {
+			continue
+		}
+
+		hash, err := videofile.GetHashFromPath(lf.Path)
+		if err != nil {
+			continue
+		}
+
+		_, isWatching := watching[lf.MediaId]
+
+		if entry, ok := indexed[util.NormalizePath(lf.Path)]; ok && entry.Hash == hash {
+			if entry.Error != "" {
+				continue
+			}
+			if _, found := matchOptimizationRule(rules, getIndexedMediaInfo(entry), isWatching); !found {
+				continue
+			}
+			if _, found := r.optimizer.GetOptimizedFile(hash); found {
+				continue
+			}
+		}
+
+		mediaInfo, err := r.mediaInfoExtractor.GetInfo(settings.FfprobePath, lf.Path)
+		if err != nil {
+			r.logger.Warn().Err(err).Str("filepath", lf.Path).Msg("mediastream: Failed to get media info for optimization")
+			continue
+		}
+
+		rule, found := matchOptimizationRule(rules, mediaInfo, isWatching)
+		if !found {
+			continue
+		}
+		err = r.optimizer.StartMediaOptimization(&optimizer.StartMediaOptimizationOptions{
+			Filepath:  lf.Path,
+			MediaId:   lf.MediaId,
+			Quality:   optimizer.Quality(rule.Quality),
+			MaxHeight: rule.MaxHeight,
+			Rule:      rule.Name,
+			MediaInfo: mediaInfo,
+		})
+		if err == nil {
+			count++
+		}
+	}
+
+	r.logger.Info().Int("count", count).Msg("mediastream: Queued library files for optimization")
+
+	return count, nil
+}
+
+// matchOptimizationRule returns the first rule matching the file.
+func matchOptimizationRule(rules []*models.MediastreamOptimizationRule, mediaInfo *videofile.MediaInfo, isWatching bool) (*models.MediastreamOptimizationRule, bool) {
+	return lo.Find(rules, func(rule *models.MediastreamOptimizationRule) bool {
+		return optimizer.MatchRule(rule, mediaInfo, isWatching)
+	})
+}
+
+// getIndexedMediaInfo returns the video information of an indexed file, as used by the optimization rules.
+func getIndexedMediaInfo(entry *models.MediastreamMediaInfoEntry) *videofile.MediaInfo {
+	ret := &videofile.MediaInfo{
+		Path: entry.Path,
+		Sha:  entry.Hash,
+	}
+	if entry.VideoCodec != "" {
+		ret.Video = &videofile.Video{
+			Codec:    entry.VideoCodec,
+			Width:    entry.Width,
+			Height:   entry.Height,
+			BitDepth: entry.BitDepth,
+		}
+	}
+	return ret
+}
+
+func getWatchingMediaIds(animeCollection *anilist.AnimeCollection) map[int]struct{} {
+	ret := make(map[int]struct{})
+	if animeCollection == nil || animeCollection.MediaListCollection == nil {
+		return ret
+	}
+	for _, list := range animeCollection.MediaListCollection.Lists {
+		if list.GetStatus() == nil || *list.GetStatus() != anilist.MediaListStatusCurrent {
+			continue
+		}
+		for _, entry := range list.GetEntries() {
+			if entry.GetMedia() != nil {
+				ret[entry.GetMedia().GetID()] = struct{}{}
+			}
+		}
+	}
+	return ret
+}
+
+// IsOptimized returns true if the file has an optimized version.
+func (r *Repository) IsOptimized(filepath string) bool {
+	if !r.IsInitialized() || !r.settings.MustGet().PreTranscodeEnabled {
+		return false
+	}
+	hash, err := videofile.GetHashFromPath(filepath)
+	if err != nil {
+		return false
+	}
+	_, found := r.optimizer.GetOptimizedFile(hash)
+	return found
+}
+
+func (r *Repository) GetOptimizationQueue() ([]*models.MediastreamOptimizationTask, error) {
+	return r.optimizer.GetQueue()
+}
+
+func (r *Repository) DeleteOptimizationTask(id uint) error {
+	return r.optimizer.DeleteTask(id)
+}
+
+// getOptimizedMediaInfo returns the media information of the optimized version of a file.
+// The subtitles, fonts and chapters are not copied to the optimized file, they're still extracted from the original.
+func (r *Repository) getOptimizedMediaInfo(original *videofile.MediaInfo, optimizedPath string) (*videofile.MediaInfo, error) {
+	mi, err := r.mediaInfoExtractor.GetInfo(r.settings.MustGet().FfprobePath, optimizedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := *mi
+	ret.Sha = original.Sha
+	ret.Subtitles = original.Subtitles
+	ret.Fonts = original.Fonts
+	ret.ExternalFonts = original.ExternalFonts
+	ret.Chapters = original.Chapters
+	return &ret, nil
+}
+
+// ServeEchoOptimizedPlay serves the optimized version of the current media.
+func (r *Repository) ServeEchoOptimizedPlay(c echo.Context, clientId string) error {
+	mediaContainer, err := r.getCurrentMediaContainer()
+	if err != nil {
+		return err
+	}
+
+	if mediaContainer.StreamType != StreamTypeOptimized || mediaContainer.OptimizedFilepath == "" {
+		return errors.New("current media is not optimized")
+	}
+
+	return r.serveEchoMediaFile(c, mediaContainer.OptimizedFilepath)
+}
@@ -0,0 +1,36 @@
+package mediastream
+
+import (
+	"seanime/internal/database/models"
+	"seanime/internal/mediastream/videofile"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchOptimizationRule(t *testing.T) {
+	rules := []*models.MediastreamOptimizationRule{
+		{Name: "Watching", Enabled: true, WatchingOnly: true, Quality: "high"},
+		{Name: "10-bit HEVC", Enabled: true, VideoCodecs: []string{"x265"}, MinBitDepth: 10, Quality: "medium"},
+	}
+
+	hevc := &videofile.MediaInfo{Video: &videofile.Video{Codec: "hevc", Height: 1080, BitDepth: 10}}
+	rule, found := matchOptimizationRule(rules, hevc, false)
+	require.True(t, found)
+	assert.Equal(t, "10-bit HEVC", rule.Name)
+
+	// The first matching rule wins
+	rule, found = matchOptimizationRule(rules, hevc, true)
+	require.True(t, found)
+	assert.Equal(t, "Watching", rule.Name)
+
+	// 8-bit H.264 files are never optimized
+	h264 := &videofile.MediaInfo{Video: &videofile.Video{Codec: "h264", Height: 720, BitDepth: 8}}
+	_, found = matchOptimizationRule(rules, h264, true)
+	assert.False(t, found)
+
+	// Files without video aren't matched
+	_, found = matchOptimizationRule(rules, &videofile.MediaInfo{}, true)
+	assert.False(t, found)
+}
@@ -0,0 +1,176 @@
+package optimizer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"seanime/internal/database/models"
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util"
+	"seanime/internal/util/crashlog"
+	"strconv"
+	"strings"
+)
+
+// GetOptimizedFilePath returns the path of the optimized version of a file in the library directory.
+func GetOptimizedFilePath(libraryDir string, hash string) string {
+	return filepath.Join(libraryDir, hash+".mp4")
+}
+
+// optimizeFile transcodes the file of a task to the library directory.
+// The file is written under a temporary name and renamed once complete, an interrupted task starts over.
+func (o *Optimizer) optimizeFile(ctx context.Context, settings *Settings, task *models.MediastreamOptimizationTask, onProgress func(int)) (string, error) {
+	if o.mediaInfoExtractor == nil {
+		return "", errors.New("media information extractor not set")
+	}
+
+	mediaInfo, err := o.mediaInfoExtractor.GetInfo(settings.FfprobePath, task.Path)
+	if err != nil {
+		return "", err
+	}
+	if mediaInfo.Video == nil {
+		return "", errors.New("no video stream")
+	}
+
+	outputPath := GetOptimizedFilePath(settings.LibraryDir, mediaInfo.Sha)
+	// Already optimized by another task
+	if _, err := os.Stat(outputPath); err == nil {
+		return outputPath, nil
+	}
+
+	if err := os.MkdirAll(settings.LibraryDir, 0755); err != nil {
+		return "", err
+	}
+
+	tmpPath := outputPath + ".part"
+	defer os.Remove(tmpPath)
+
+	crashLogger := crashlog.GlobalCrashLogger.InitArea("ffmpeg")
+	defer crashLogger.Close()
+
+	crashLogger.LogInfof("Optimizing %s", task.Path)
+
+	cmd := util.NewCmdCtx(ctx, settings.FfmpegPath, getOptimizeArgs(settings, task, mediaInfo, tmpPath)...)
+	cmd.Stderr = crashLogger.Stdout()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	// Read the progress reported by FFmpeg
+	lastProgress := 0
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found || key != "out_time_us" || mediaInfo.Duration <= 0 {
+			continue
+		}
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		progress := min(int(float64(us)/1e6/float64(mediaInfo.Duration)*100), 99)
+		if progress > lastProgress {
+			lastProgress = progress
+			onProgress(progress)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		crashlog.GlobalCrashLogger.WriteAreaLogToFile(crashLogger)
+		return "", fmt.Errorf("ffmpeg: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, outputPath); err != nil {
+		return "", err
+	}
+
+	return outputPath, nil
+}
+
+// getOptimizeArgs returns the FFmpeg arguments to transcode a file to H.264/AAC.
+// Every audio track is kept so that the language can still be selected, subtitles are served from the original file.
+func getOptimizeArgs(settings *Settings, task *models.MediastreamOptimizationTask, mediaInfo *videofile.MediaInfo, outputPath string) []string {
+	args := []string{
+		"-nostats", "-hide_banner", "-loglevel", "warning",
+		"-y",
+		"-i", mediaInfo.Path,
+		// Ignore attached pictures
+		"-map", "0:V:0",
+		"-map", "0:a?",
+		"-map_chapters", "0",
+		"-c:v", "libx264",
+		"-preset", qualityToPreset(Quality(task.Quality)),
+		"-crf", strconv.Itoa(qualityToCrf(Quality(task.Quality))),
+		"-profile:v", "high",
+		// 8-bit 4:2:0 is the only format supported by every H.264 decoder
+		"-pix_fmt", "yuv420p",
+	}
+
+	if task.MaxHeight > 0 && mediaInfo.Video != nil && int(mediaInfo.Video.Height) > task.MaxHeight {
+		// -2 keeps the aspect ratio with an even width
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", task.MaxHeight))
+	}
+
+	args = append(args,
+		"-c:a", "aac",
+		"-ac", "2",
+		"-b:a", "192k",
+		"-threads", strconv.Itoa(getThreads(settings.Threads)),
+		// Move the index to the start of the file so that it can be played before being fully downloaded
+		"-movflags", "+faststart",
+		"-progress", "pipe:1",
+		"-f", "mp4",
+		outputPath,
+	)
+	return args
+}
+
+// getThreads returns the number of threads of the encoder.
+func getThreads(threads int) int {
+	if threads > 0 {
+		return threads
+	}
+	return max(runtime.NumCPU()/2, 1)
+}
+
+func qualityToPreset(quality Quality) string {
+	switch quality {
+	case QualityLow:
+		return "ultrafast"
+	case QualityMedium:
+		return "veryfast"
+	case QualityHigh:
+		return "fast"
+	case QualityMax:
+		return "medium"
+	default:
+		return "veryfast"
+	}
+}
+
+func qualityToCrf(quality Quality) int {
+	switch quality {
+	case QualityLow:
+		return 26
+	case QualityMedium:
+		return 23
+	case QualityHigh:
+		return 21
+	case QualityMax:
+		return 18
+	default:
+		return 23
+	}
+}
@@ -1,12 +1,19 @@
 package optimizer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/samber/mo"
+	"os"
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
 	"seanime/internal/events"
 	"seanime/internal/mediastream/videofile"
 	"seanime/internal/util"
+	"sync"
+	"time"
 )
 
 const (
@@ -19,48 +26,144 @@ const (
 type (
 	Quality string
 
+	// Optimizer pre-transcodes the files of the optimization queue to H.264/AAC MP4 files that can be played directly.
+	// The queue is stored in the database, files are optimized one at a time within the CPU budget and the time window.
 	Optimizer struct {
-		wsEventManager  events.WSEventManagerInterface
-		logger          *zerolog.Logger
-		libraryDir      mo.Option[string]
-		concurrentTasks int
+		db                 *db.Database
+		wsEventManager     events.WSEventManagerInterface
+		logger             *zerolog.Logger
+		mediaInfoExtractor *videofile.MediaInfoExtractor
+		libraryDir         mo.Option[string]
+		settings           mo.Option[*Settings]
+		mu                 sync.Mutex
+		current            *runningTask // The task being optimized, guarded by mu
+		wakeCh             chan struct{}
+		startOnce          sync.Once
+	}
+
+	Settings struct {
+		Enabled     bool
+		FfmpegPath  string
+		FfprobePath string
+		LibraryDir  string
+		Threads     int    // CPU budget, 0 for half of the CPUs
+		StartTime   string // HH:MM, empty for the whole day
+		EndTime     string // HH:MM, empty for the whole day
+	}
+
+	runningTask struct {
+		id       uint
+		cancel   context.CancelFunc
+		progress int  // Percent
+		deleted  bool // The task was removed from the queue while running
+	}
+
+	// OptimizationEvent is sent when the status or the progress of a task changes.
+	OptimizationEvent struct {
+		Task     *models.MediastreamOptimizationTask `json:"task"`
+		Progress int                                 `json:"progress"` // Percent
 	}
 
 	NewOptimizerOptions struct {
-		Logger         *zerolog.Logger
-		WSEventManager events.WSEventManagerInterface
+		Logger             *zerolog.Logger
+		WSEventManager     events.WSEventManagerInterface
+		Database           *db.Database
+		MediaInfoExtractor *videofile.MediaInfoExtractor
 	}
 )
 
 func NewOptimizer(opts *NewOptimizerOptions) *Optimizer {
 	ret := &Optimizer{
-		logger:          opts.Logger,
-		wsEventManager:  opts.WSEventManager,
-		libraryDir:      mo.None[string](),
-		concurrentTasks: 2,
+		db:                 opts.Database,
+		logger:             opts.Logger,
+		wsEventManager:     opts.WSEventManager,
+		mediaInfoExtractor: opts.MediaInfoExtractor,
+		libraryDir:         mo.None[string](),
+		settings:           mo.None[*Settings](),
+		wakeCh:             make(chan struct{}, 1),
 	}
 	return ret
 }
 
-func (o *Optimizer) SetLibraryDir(libraryDir string) {
-	o.libraryDir = mo.Some[string](libraryDir)
+// SetSettings updates the settings and starts processing the queue.
+// The task being optimized is interrupted if the optimizer can no longer run.
+func (o *Optimizer) SetSettings(settings *Settings) {
+	o.mu.Lock()
+	o.settings = mo.Some(settings)
+	if settings.LibraryDir != "" {
+		o.libraryDir = mo.Some(settings.LibraryDir)
+	} else {
+		o.libraryDir = mo.None[string]()
+	}
+	current := o.current
+	o.mu.Unlock()
+
+	if current != nil && !o.canRun(time.Now()) {
+		current.cancel()
+	}
+
+	if o.db == nil {
+		return
+	}
+
+	o.startOnce.Do(func() {
+		// Resume the tasks that were interrupted by a shutdown
+		if err := o.db.ResetRunningMediastreamOptimizationTasks(); err != nil {
+			o.logger.Error().Err(err).Msg("optimizer: Failed to reset interrupted tasks")
+		}
+		go o.run()
+	})
+
+	o.wake()
+}
+
+func (o *Optimizer) getSettings() (*Settings, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.settings.Get()
+}
+
+func (o *Optimizer) getLibraryDir() (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.libraryDir.Get()
+}
+
+// canRun returns true if files can be optimized at the given time.
+func (o *Optimizer) canRun(now time.Time) bool {
+	settings, ok := o.getSettings()
+	if !ok || !settings.Enabled || settings.LibraryDir == "" {
+		return false
+	}
+	return isInTimeWindow(settings.StartTime, settings.EndTime, now)
+}
+
+func (o *Optimizer) wake() {
+	select {
+	case o.wakeCh <- struct{}{}:
+	default:
+	}
 }
 
 /////////////
 
 type StartMediaOptimizationOptions struct {
 	Filepath          string
+	MediaId           int
 	Quality           Quality
+	MaxHeight         int    // 0 to keep the original height
+	Rule              string // Name of the rule that matched the file, empty if it was requested manually
 	AudioChannelIndex int
 	MediaInfo         *videofile.MediaInfo
 }
 
+// StartMediaOptimization adds a file to the optimization queue.
 func (o *Optimizer) StartMediaOptimization(opts *StartMediaOptimizationOptions) (err error) {
 	defer util.HandlePanicInModuleWithError("mediastream/optimizer/StartMediaOptimization", &err)
 
-	o.logger.Debug().Any("opts", opts).Msg("mediastream: Starting media optimization")
+	o.logger.Debug().Str("filepath", opts.Filepath).Str("quality", string(opts.Quality)).Msg("mediastream: Starting media optimization")
 
-	if !o.libraryDir.IsPresent() {
+	if _, ok := o.getLibraryDir(); !ok {
 		return fmt.Errorf("library directory not set")
 	}
 
@@ -68,20 +171,240 @@ func (o *Optimizer) StartMediaOptimization(opts *StartMediaOptimizationOptions)
 		return fmt.Errorf("no filepath")
 	}
 
+	if o.db == nil {
+		return errors.New("database not set")
+	}
+
+	if opts.MediaInfo == nil {
+		return errors.New("no media information")
+	}
+
+	if opts.Quality == "" {
+		opts.Quality = QualityMedium
+	}
+
+	if _, found := o.GetOptimizedFile(opts.MediaInfo.Sha); found {
+		return errors.New("file is already optimized")
+	}
+
+	// The file is queued again if it has been modified since the last task
+	if task, err := o.db.GetMediastreamOptimizationTaskByPath(opts.Filepath); err == nil && task.Hash == opts.MediaInfo.Sha {
+		switch task.Status {
+		case models.MediastreamOptimizationStatusPending, models.MediastreamOptimizationStatusRunning:
+			return errors.New("file is already queued")
+		case models.MediastreamOptimizationStatusFailed:
+			// Only retry failed tasks that are requested manually
+			if opts.Rule != "" {
+				return errors.New("file failed to be optimized")
+			}
+		}
+	}
+
+	task := &models.MediastreamOptimizationTask{
+		Path:      opts.Filepath,
+		Hash:      opts.MediaInfo.Sha,
+		MediaId:   opts.MediaId,
+		Rule:      opts.Rule,
+		Quality:   string(opts.Quality),
+		MaxHeight: opts.MaxHeight,
+		Status:    models.MediastreamOptimizationStatusPending,
+	}
+	if err = o.db.InsertMediastreamOptimizationTask(task); err != nil {
+		return err
+	}
+
+	o.sendEvent(task, 0)
+	o.wake()
 	return
 }
 
-func qualityToPreset(quality Quality) string {
-	switch quality {
-	case QualityLow:
-		return "ultrafast"
-	case QualityMedium:
-		return "veryfast"
-	case QualityHigh:
-		return "fast"
-	case QualityMax:
-		return "medium"
+// GetOptimizedFile returns the path of the optimized version of a file, if it exists.
+func (o *Optimizer) GetOptimizedFile(hash string) (string, bool) {
+	libraryDir, ok := o.getLibraryDir()
+	if !ok {
+		return "", false
+	}
+
+	path := GetOptimizedFilePath(libraryDir, hash)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// GetQueue returns the tasks of the optimization queue.
+func (o *Optimizer) GetQueue() ([]*models.MediastreamOptimizationTask, error) {
+	if o.db == nil {
+		return nil, errors.New("database not set")
+	}
+	return o.db.GetMediastreamOptimizationTasks()
+}
+
+// GetProgress returns the progress of the task being optimized.
+func (o *Optimizer) GetProgress() (id uint, progress int, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.current == nil {
+		return 0, 0, false
+	}
+	return o.current.id, o.current.progress, true
+}
+
+// DeleteTask removes a task from the queue, it's interrupted if it's running.
+// The optimized file is kept.
+func (o *Optimizer) DeleteTask(id uint) error {
+	if o.db == nil {
+		return errors.New("database not set")
+	}
+
+	// The row is deleted under the lock so that a running task cannot save it back
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.current != nil && o.current.id == id {
+		o.current.deleted = true
+		o.current.cancel()
+	}
+
+	return o.db.DeleteMediastreamOptimizationTask(id)
+}
+
+/////////////
+
+// run processes the queue whenever a task is queued, the settings change, or every minute for the time window.
+func (o *Optimizer) run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		o.processQueue()
+		select {
+		case <-o.wakeCh:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Optimizer) processQueue() {
+	defer util.HandlePanicInModuleThen("mediastream/optimizer/processQueue", func() {})
+
+	for o.canRun(time.Now()) {
+		task, err := o.db.GetNextMediastreamOptimizationTask()
+		if err != nil {
+			o.logger.Error().Err(err).Msg("optimizer: Failed to get the next task")
+			return
+		}
+		if task == nil {
+			return
+		}
+		if interrupted := o.runTask(task); interrupted {
+			return
+		}
+	}
+}
+
+// runTask optimizes the file of a task.
+// It returns true if the task was interrupted by the end of the time window or a settings change.
+func (o *Optimizer) runTask(task *models.MediastreamOptimizationTask) (interrupted bool) {
+	settings, ok := o.getSettings()
+	if !ok {
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	current := &runningTask{id: task.ID, cancel: cancel}
+	o.mu.Lock()
+	o.current = current
+	o.mu.Unlock()
+
+	defer func() {
+		cancel()
+		o.mu.Lock()
+		o.current = nil
+		o.mu.Unlock()
+	}()
+
+	// Interrupt the task at the end of the time window
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !o.canRun(time.Now()) {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	task.Status = models.MediastreamOptimizationStatusRunning
+	task.Error = ""
+	o.mu.Lock()
+	if current.deleted {
+		o.mu.Unlock()
+		return false
+	}
+	if err := o.db.UpdateMediastreamOptimizationTask(task); err != nil {
+		o.logger.Error().Err(err).Msg("optimizer: Failed to update task")
+	}
+	o.mu.Unlock()
+	o.sendEvent(task, 0)
+
+	o.logger.Info().Str("filepath", task.Path).Msg("optimizer: Optimizing file")
+
+	outputPath, err := o.optimizeFile(ctx, settings, task, func(progress int) {
+		o.mu.Lock()
+		current.progress = progress
+		o.mu.Unlock()
+		o.sendEvent(task, progress)
+	})
+
+	// The lock is held until the task is saved, see DeleteTask
+	o.mu.Lock()
+	if current.deleted {
+		o.mu.Unlock()
+		o.logger.Debug().Str("filepath", task.Path).Msg("optimizer: Task removed from the queue")
+		return false
+	}
+
+	switch {
+	case err == nil:
+		o.logger.Info().Str("filepath", task.Path).Str("output", outputPath).Msg("optimizer: File optimized")
+		task.Status = models.MediastreamOptimizationStatusDone
+		task.OutputPath = outputPath
+	case ctx.Err() != nil:
+		o.logger.Debug().Str("filepath", task.Path).Msg("optimizer: Task interrupted, it will be resumed later")
+		task.Status = models.MediastreamOptimizationStatusPending
+		interrupted = true
 	default:
-		return "veryfast"
+		o.logger.Error().Err(err).Str("filepath", task.Path).Msg("optimizer: Failed to optimize file")
+		task.Status = models.MediastreamOptimizationStatusFailed
+		task.Error = err.Error()
+	}
+
+	if err := o.db.UpdateMediastreamOptimizationTask(task); err != nil {
+		o.logger.Error().Err(err).Msg("optimizer: Failed to update task")
+	}
+	o.mu.Unlock()
+
+	progress := 0
+	if task.Status == models.MediastreamOptimizationStatusDone {
+		progress = 100
+	}
+	o.sendEvent(task, progress)
+
+	return
+}
+
+func (o *Optimizer) sendEvent(task *models.MediastreamOptimizationTask, progress int) {
+	if o.wsEventManager == nil {
+		return
 	}
+	o.wsEventManager.SendEvent(events.MediastreamOptimization, OptimizationEvent{
+		Task:     task,
+		Progress: progress,
+	})
 }
@@ -0,0 +1,91 @@
+package optimizer
+
+import (
+	"fmt"
+	"seanime/internal/database/models"
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MatchRule returns true if a file should be optimized according to the rule.
+// Files that are already H.264 8-bit within the maximum height are never matched.
+func MatchRule(rule *models.MediastreamOptimizationRule, mediaInfo *videofile.MediaInfo, isWatching bool) bool {
+	if rule == nil || !rule.Enabled || mediaInfo == nil || mediaInfo.Video == nil {
+		return false
+	}
+
+	video := mediaInfo.Video
+	codec := NormalizeCodec(video.Codec)
+	bitDepth := int(video.GetBitDepth())
+
+	if codec == "h264" && bitDepth <= 8 && (rule.MaxHeight <= 0 || int(video.Height) <= rule.MaxHeight) {
+		return false
+	}
+
+	if rule.WatchingOnly && !isWatching {
+		return false
+	}
+
+	if len(rule.VideoCodecs) > 0 && !slices.ContainsFunc(rule.VideoCodecs, func(c string) bool { return NormalizeCodec(c) == codec }) {
+		return false
+	}
+
+	if rule.MinBitDepth > 0 && bitDepth < rule.MinBitDepth {
+		return false
+	}
+
+	return true
+}
+
+// NormalizeCodec returns the FFmpeg name of a video codec (e.g. "x265" -> "hevc").
+func NormalizeCodec(codec string) string {
+	switch codec = strings.ToLower(strings.TrimSpace(codec)); codec {
+	case "h265", "x265", "hevc":
+		return "hevc"
+	case "h264", "x264", "avc":
+		return "h264"
+	}
+	return codec
+}
+
+// ValidateSettings returns an error if the optimization rules or the time window are invalid.
+func ValidateSettings(settings *models.MediastreamSettings) error {
+	if settings.PreTranscodeStartTime != "" || settings.PreTranscodeEndTime != "" {
+		if _, err := util.ParseTimeOfDay(settings.PreTranscodeStartTime); err != nil {
+			return fmt.Errorf("optimizer: Invalid start time")
+		}
+		if _, err := util.ParseTimeOfDay(settings.PreTranscodeEndTime); err != nil {
+			return fmt.Errorf("optimizer: Invalid end time")
+		}
+	}
+	if settings.PreTranscodeThreads < 0 {
+		return fmt.Errorf("optimizer: Invalid number of threads")
+	}
+
+	for _, rule := range settings.PreTranscodeRules {
+		if rule == nil {
+			continue
+		}
+		switch Quality(rule.Quality) {
+		case "", QualityLow, QualityMedium, QualityHigh, QualityMax:
+		default:
+			return fmt.Errorf("optimizer: Invalid quality for rule %q", rule.Name)
+		}
+		if rule.MaxHeight < 0 {
+			return fmt.Errorf("optimizer: Invalid maximum height for rule %q", rule.Name)
+		}
+	}
+	return nil
+}
+
+// isInTimeWindow returns true if the time is within the window.
+// An empty window is the whole day, a window that ends before it starts spans midnight.
+func isInTimeWindow(startTime string, endTime string, now time.Time) bool {
+	if startTime == "" && endTime == "" {
+		return true
+	}
+	return util.IsInTimeWindow(startTime, endTime, nil, now)
+}
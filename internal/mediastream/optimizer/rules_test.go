@@ -0,0 +1,110 @@
+package optimizer
+
+import (
+	"seanime/internal/database/models"
+	"seanime/internal/mediastream/videofile"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRule(t *testing.T) {
+	// Every HEVC 10-bit file in currently watching shows -> H.264 1080p
+	rule := &models.MediastreamOptimizationRule{
+		Name:         "HEVC 10-bit",
+		Enabled:      true,
+		VideoCodecs:  []string{"h265"},
+		MinBitDepth:  10,
+		WatchingOnly: true,
+		Quality:      "medium",
+		MaxHeight:    1080,
+	}
+
+	newMediaInfo := func(codec string, bitDepth uint32, height uint32) *videofile.MediaInfo {
+		return &videofile.MediaInfo{Video: &videofile.Video{Codec: codec, BitDepth: bitDepth, Height: height}}
+	}
+
+	tests := []struct {
+		name       string
+		mediaInfo  *videofile.MediaInfo
+		isWatching bool
+		expected   bool
+	}{
+		{"HEVC 10-bit", newMediaInfo("hevc", 10, 1080), true, true},
+		{"HEVC 10-bit not watching", newMediaInfo("hevc", 10, 1080), false, false},
+		{"HEVC 8-bit", newMediaInfo("hevc", 8, 1080), true, false},
+		{"H.264 8-bit", newMediaInfo("h264", 8, 1080), true, false},
+		{"HEVC Main 10 from the cache", &videofile.MediaInfo{Video: &videofile.Video{Codec: "hevc", MimeCodec: lo.ToPtr("hvc1.2.4.L120.BO"), Height: 1080}}, true, true},
+		{"No video", &videofile.MediaInfo{}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, MatchRule(rule, tt.mediaInfo, tt.isWatching))
+		})
+	}
+
+	// A rule without filters only matches files that need to be transcoded
+	anyRule := &models.MediastreamOptimizationRule{Enabled: true, MaxHeight: 720}
+	assert.True(t, MatchRule(anyRule, newMediaInfo("h264", 8, 1080), false))
+	assert.False(t, MatchRule(anyRule, newMediaInfo("h264", 8, 720), false))
+	assert.True(t, MatchRule(anyRule, newMediaInfo("av1", 8, 720), false))
+
+	anyRule.Enabled = false
+	assert.False(t, MatchRule(anyRule, newMediaInfo("av1", 8, 720), false))
+}
+
+func TestIsInTimeWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	assert.True(t, isInTimeWindow("", "", at(12, 0)))
+
+	assert.True(t, isInTimeWindow("09:00", "17:00", at(9, 0)))
+	assert.False(t, isInTimeWindow("09:00", "17:00", at(17, 0)))
+
+	// Spans midnight
+	assert.True(t, isInTimeWindow("23:00", "07:00", at(23, 30)))
+	assert.True(t, isInTimeWindow("23:00", "07:00", at(6, 59)))
+	assert.False(t, isInTimeWindow("23:00", "07:00", at(12, 0)))
+
+	assert.False(t, isInTimeWindow("invalid", "07:00", at(6, 0)))
+}
+
+func TestGetOptimizeArgs(t *testing.T) {
+	settings := &Settings{Threads: 4}
+	task := &models.MediastreamOptimizationTask{Quality: string(QualityHigh), MaxHeight: 1080}
+	mediaInfo := &videofile.MediaInfo{Path: "/anime/Show - 01.mkv", Video: &videofile.Video{Codec: "hevc", Height: 2160}}
+
+	args := getOptimizeArgs(settings, task, mediaInfo, "/library/hash.mp4.part")
+
+	assert.Subset(t, args, []string{"-i", "/anime/Show - 01.mkv", "libx264", "fast", "21", "scale=-2:1080", "yuv420p", "+faststart"})
+	assert.Equal(t, "/library/hash.mp4.part", args[len(args)-1])
+
+	idx := lo.IndexOf(args, "-threads")
+	assert.Equal(t, "4", args[idx+1])
+
+	// The original height is kept
+	mediaInfo.Video.Height = 720
+	args = getOptimizeArgs(settings, task, mediaInfo, "/library/hash.mp4.part")
+	assert.NotContains(t, args, "-vf")
+}
+
+func TestValidateSettings(t *testing.T) {
+	settings := &models.MediastreamSettings{
+		PreTranscodeStartTime: "23:00",
+		PreTranscodeEndTime:   "07:00",
+		PreTranscodeRules:     models.MediastreamOptimizationRules{{Name: "Rule", Quality: "high"}},
+	}
+	assert.NoError(t, ValidateSettings(settings))
+
+	settings.PreTranscodeEndTime = ""
+	assert.Error(t, ValidateSettings(settings))
+
+	settings.PreTranscodeEndTime = "07:00"
+	settings.PreTranscodeRules[0].Quality = "best"
+	assert.Error(t, ValidateSettings(settings))
+}
@@ -12,6 +12,7 @@ import (
 const (
 	StreamTypeTranscode StreamType = "transcode" // On-the-fly transcoding
 	StreamTypeOptimized StreamType = "optimized" // Pre-transcoded
+	StreamTypeRemux     StreamType = "remux"     // On-the-fly remuxing, the video is not transcoded
 	StreamTypeDirect    StreamType = "direct"    // Direct streaming
 )
 
@@ -35,6 +36,13 @@ type (
 		StreamType StreamType           `json:"streamType"` // Tells the frontend how to play the media.
 		StreamUrl  string               `json:"streamUrl"`  // The relative endpoint to stream the media.
 		MediaInfo  *videofile.MediaInfo `json:"mediaInfo"`
+		// The relative endpoint of the WebVTT index of the seek previews.
+		// It's served once the thumbnails have been generated, see events.MediastreamThumbnailsReady.
+		ThumbnailsUrl string `json:"thumbnailsUrl"`
+		// The path of the pre-transcoded file, if the stream type is StreamTypeOptimized.
+		OptimizedFilepath string `json:"-"`
+		// The audio tracks supported by the client, copied without encoding if the stream type is StreamTypeRemux.
+		CopyAudios []int32 `json:"-"`
 		//Metadata  *Metadata       `json:"metadata"`
 		// todo: add more fields (e.g. metadata)
 	}
@@ -72,6 +80,11 @@ func (p *PlaybackManager) RequestPlayback(filepath string, streamType StreamType
 	// Set the current media container.
 	p.currentMediaContainer = mo.Some(ret)
 
+	// Generate the thumbnails on first play
+	if p.repository.settings.MustGet().GenerateThumbnails && !videofile.ThumbnailsExist(p.repository.cacheDir, ret.Hash) {
+		p.repository.thumbnailGenerator.enqueue([]string{filepath}, true)
+	}
+
 	p.logger.Info().Str("filepath", filepath).Msg("mediastream: Ready to play media")
 
 	return
@@ -95,10 +108,6 @@ func (p *PlaybackManager) PreloadPlayback(filepath string, streamType StreamType
 	return
 }
 
-//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
-// Optimize
-//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
-
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 func (p *PlaybackManager) newMediaContainer(filepath string, streamType StreamType) (ret *MediaContainer, err error) {
@@ -152,10 +161,21 @@ func (p *PlaybackManager) newMediaContainer(filepath string, streamType StreamTy
 	case StreamTypeTranscode:
 		// Live transcode the file.
 		streamUrl = "/api/v1/mediastream/transcode/master.m3u8"
+	case StreamTypeRemux:
+		// Live remux the file, the master playlist only lists the original quality.
+		streamUrl = "/api/v1/mediastream/transcode/master.m3u8"
 	case StreamTypeOptimized:
-		// TODO: Check if the file is already transcoded when the feature is implemented.
-		// ...
-		streamUrl = "/api/v1/mediastream/hls/master.m3u8"
+		// Directly serve the pre-transcoded file.
+		optimizedPath, found := p.repository.optimizer.GetOptimizedFile(hash)
+		if !found {
+			return nil, errors.New("file has not been optimized")
+		}
+		ret.OptimizedFilepath = optimizedPath
+		ret.MediaInfo, err = p.repository.getOptimizedMediaInfo(ret.MediaInfo, optimizedPath)
+		if err != nil {
+			return nil, err
+		}
+		streamUrl = "/api/v1/mediastream/optimized"
 	}
 
 	// TODO: Add metadata to the media container.
@@ -167,6 +187,7 @@ func (p *PlaybackManager) newMediaContainer(filepath string, streamType StreamTy
 
 	// Set the stream URL.
 	ret.StreamUrl = streamUrl
+	ret.ThumbnailsUrl = GetThumbnailsUrl(hash)
 
 	// Store the media container in the map.
 	p.mediaContainers.Set(hash, ret)
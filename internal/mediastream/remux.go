@@ -0,0 +1,68 @@
+package mediastream
+
+import (
+	"seanime/internal/mediastream/transcoder"
+	"seanime/internal/mediastream/videofile"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Remux
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// CanRemux returns true if the video stream of a file is supported by the client, so that it can be remuxed instead of transcoded.
+// The supported codecs are the MIME codecs reported by the client (e.g. "avc1", "hvc1", "mp4a.40").
+func (r *Repository) CanRemux(filepath string, supportedCodecs []string) bool {
+	if !r.IsInitialized() || !r.settings.MustGet().TranscodeEnabled || len(supportedCodecs) == 0 {
+		return false
+	}
+
+	mediaInfo, err := r.mediaInfoExtractor.GetInfo(r.settings.MustGet().FfprobePath, filepath)
+	if err != nil {
+		return false
+	}
+
+	return isVideoRemuxable(mediaInfo, supportedCodecs)
+}
+
+// isVideoRemuxable returns true if the video stream can be copied into the segments.
+// The segments are MPEG-TS, which browsers only play with H.264 video.
+// HEVC and AV1 would need fMP4 segments, which the transcoder doesn't produce, so these files are still transcoded.
+func isVideoRemuxable(mediaInfo *videofile.MediaInfo, supportedCodecs []string) bool {
+	if mediaInfo == nil || mediaInfo.Video == nil || mediaInfo.Video.MimeCodec == nil {
+		return false
+	}
+	if !strings.HasPrefix(strings.ToLower(*mediaInfo.Video.MimeCodec), "avc1") {
+		return false
+	}
+	return isCodecSupported(mediaInfo.Video.MimeCodec, supportedCodecs)
+}
+
+// getCopyableAudios returns the indexes of the audio tracks that are supported by the client and can be copied into the segments.
+func getCopyableAudios(mediaInfo *videofile.MediaInfo, supportedCodecs []string) []int32 {
+	ret := make([]int32, 0)
+	for _, audio := range mediaInfo.Audios {
+		if transcoder.CanCopyAudio(audio.Codec) && isCodecSupported(audio.MimeCodec, supportedCodecs) {
+			ret = append(ret, int32(audio.Index))
+		}
+	}
+	return ret
+}
+
+// isCodecSupported returns true if the MIME codec of a stream starts with one of the supported codecs.
+// e.g. "avc1.640028" is supported by "avc1" and "avc1.640028", not by "avc1.6400"
+func isCodecSupported(mimeCodec *string, supportedCodecs []string) bool {
+	if mimeCodec == nil {
+		return false
+	}
+	codec := strings.ToLower(*mimeCodec)
+	return lo.ContainsBy(supportedCodecs, func(supported string) bool {
+		supported = strings.ToLower(strings.TrimSpace(supported))
+		if supported == "" {
+			return false
+		}
+		return codec == supported || strings.HasPrefix(codec, supported+".")
+	})
+}
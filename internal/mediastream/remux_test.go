@@ -0,0 +1,33 @@
+package mediastream
+
+import (
+	"seanime/internal/mediastream/videofile"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemuxableStreams(t *testing.T) {
+	supportedCodecs := []string{"avc1", "hvc1", "mp4a.40", "ec-3"}
+
+	mediaInfo := &videofile.MediaInfo{
+		Video: &videofile.Video{MimeCodec: lo.ToPtr("avc1.640028")},
+		Audios: []videofile.Audio{
+			{Index: 0, Codec: "aac", MimeCodec: lo.ToPtr("mp4a.40.2")},
+			{Index: 1, Codec: "eac3", MimeCodec: lo.ToPtr("ec-3")},
+			{Index: 2, Codec: "flac", MimeCodec: lo.ToPtr("fLaC")},
+		},
+	}
+	assert.True(t, isVideoRemuxable(mediaInfo, supportedCodecs))
+	// Only the AAC track can be copied into the MPEG-TS segments
+	assert.Equal(t, []int32{0}, getCopyableAudios(mediaInfo, supportedCodecs))
+
+	// HEVC isn't played from MPEG-TS segments, even if the client supports it
+	mediaInfo.Video.MimeCodec = lo.ToPtr("hvc1.1.6.L120.90")
+	assert.False(t, isVideoRemuxable(mediaInfo, supportedCodecs))
+
+	mediaInfo.Video.MimeCodec = lo.ToPtr("avc1.640028")
+	assert.False(t, isVideoRemuxable(mediaInfo, []string{"hvc1"}))
+	assert.False(t, isVideoRemuxable(&videofile.MediaInfo{}, supportedCodecs))
+}
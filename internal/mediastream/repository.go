@@ -6,6 +6,7 @@ import (
 	"github.com/samber/mo"
 	"os"
 	"path/filepath"
+	"seanime/internal/database/db"
 	"seanime/internal/database/models"
 	"seanime/internal/events"
 	"seanime/internal/mediastream/optimizer"
@@ -21,10 +22,14 @@ type (
 		optimizer          *optimizer.Optimizer
 		settings           mo.Option[*models.MediastreamSettings]
 		playbackManager    *PlaybackManager
+		thumbnailGenerator *ThumbnailGenerator
+		mediaInfoIndexer   *MediaInfoIndexer
+		segmentCache       *transcoder.SegmentCache // Transcoded segments kept across sessions
 		mediaInfoExtractor *videofile.MediaInfoExtractor
 		logger             *zerolog.Logger
 		wsEventManager     events.WSEventManagerInterface
 		fileCacher         *filecache.Cacher
+		db                 *db.Database
 		reqMu              sync.Mutex
 		cacheDir           string // where attachments are stored
 		transcodeDir       string // where stream segments are stored
@@ -34,23 +39,29 @@ type (
 		Logger         *zerolog.Logger
 		WSEventManager events.WSEventManagerInterface
 		FileCacher     *filecache.Cacher
+		Database       *db.Database
 	}
 )
 
 func NewRepository(opts *NewRepositoryOptions) *Repository {
 	ret := &Repository{
-		logger: opts.Logger,
-		optimizer: optimizer.NewOptimizer(&optimizer.NewOptimizerOptions{
-			Logger:         opts.Logger,
-			WSEventManager: opts.WSEventManager,
-		}),
+		logger:             opts.Logger,
 		settings:           mo.None[*models.MediastreamSettings](),
 		transcoder:         mo.None[*transcoder.Transcoder](),
 		wsEventManager:     opts.WSEventManager,
 		fileCacher:         opts.FileCacher,
+		db:                 opts.Database,
 		mediaInfoExtractor: videofile.NewMediaInfoExtractor(opts.FileCacher, opts.Logger),
 	}
+	ret.optimizer = optimizer.NewOptimizer(&optimizer.NewOptimizerOptions{
+		Logger:             opts.Logger,
+		WSEventManager:     opts.WSEventManager,
+		Database:           opts.Database,
+		MediaInfoExtractor: ret.mediaInfoExtractor,
+	})
 	ret.playbackManager = NewPlaybackManager(ret)
+	ret.thumbnailGenerator = NewThumbnailGenerator(ret)
+	ret.mediaInfoIndexer = NewMediaInfoIndexer(ret)
 
 	return ret
 }
@@ -88,8 +99,24 @@ func (r *Repository) InitializeModules(settings *models.MediastreamSettings, cac
 	r.cacheDir = cacheDir
 	r.transcodeDir = transcodeDir
 
+	// The segment cache outlives the transcoders
+	segmentCacheMaxSize := getSegmentCacheMaxSize(settings)
+	if r.segmentCache == nil {
+		r.segmentCache = transcoder.NewSegmentCache(cacheDir, segmentCacheMaxSize, r.logger)
+	} else {
+		r.segmentCache.SetMaxSize(segmentCacheMaxSize)
+	}
+
 	// Set the optimizer settings
-	r.optimizer.SetLibraryDir(settings.PreTranscodeLibraryDir)
+	r.optimizer.SetSettings(&optimizer.Settings{
+		Enabled:     settings.PreTranscodeEnabled,
+		FfmpegPath:  settings.FfmpegPath,
+		FfprobePath: settings.FfprobePath,
+		LibraryDir:  settings.PreTranscodeLibraryDir,
+		Threads:     settings.PreTranscodeThreads,
+		StartTime:   settings.PreTranscodeStartTime,
+		EndTime:     settings.PreTranscodeEndTime,
+	})
 
 	// Initialize the transcoder
 	if ok := r.initializeTranscoder(r.settings); ok {
@@ -101,6 +128,22 @@ func (r *Repository) InitializeModules(settings *models.MediastreamSettings, cac
 // CacheWasCleared should be called when the cache directory is manually cleared.
 func (r *Repository) CacheWasCleared() {
 	r.playbackManager.mediaContainers.Clear()
+	r.segmentCache.Reset()
+}
+
+// defaultTranscodeCacheMaxSize is the size of the segment cache in MB when none is set.
+const defaultTranscodeCacheMaxSize = 4096
+
+// getSegmentCacheMaxSize returns the maximum size of the segment cache in bytes, 0 if the cache is disabled.
+func getSegmentCacheMaxSize(settings *models.MediastreamSettings) int64 {
+	if settings.DisableTranscodeCache {
+		return 0
+	}
+	size := settings.TranscodeCacheMaxSize
+	if size <= 0 {
+		size = defaultTranscodeCacheMaxSize
+	}
+	return int64(size) * 1024 * 1024
 }
 
 func (r *Repository) ClearTranscodeDir() {
@@ -136,29 +179,40 @@ func (r *Repository) ClearTranscodeDir() {
 
 type StartMediaOptimizationOptions struct {
 	Filepath          string
+	MediaId           int
 	Quality           optimizer.Quality
+	MaxHeight         int
 	AudioChannelIndex int
 }
 
+// StartMediaOptimization adds a file to the optimization queue.
 func (r *Repository) StartMediaOptimization(opts *StartMediaOptimizationOptions) (err error) {
 	if !r.IsInitialized() {
 		return errors.New("module not initialized")
 	}
 
-	mediaInfo, err := r.mediaInfoExtractor.GetInfo(r.settings.MustGet().FfmpegPath, opts.Filepath)
+	mediaInfo, err := r.mediaInfoExtractor.GetInfo(r.settings.MustGet().FfprobePath, opts.Filepath)
 	if err != nil {
 		return
 	}
 
 	err = r.optimizer.StartMediaOptimization(&optimizer.StartMediaOptimizationOptions{
 		Filepath:  opts.Filepath,
+		MediaId:   opts.MediaId,
 		Quality:   opts.Quality,
+		MaxHeight: opts.MaxHeight,
 		MediaInfo: mediaInfo,
 	})
 	return
 }
 
+// RequestOptimizedStream plays the optimized version of a file.
 func (r *Repository) RequestOptimizedStream(filepath string) (ret *MediaContainer, err error) {
+	r.reqMu.Lock()
+	defer r.reqMu.Unlock()
+
+	r.logger.Debug().Str("filepath", filepath).Msg("mediastream: Optimized stream requested")
+
 	if !r.IsInitialized() {
 		return nil, errors.New("module not initialized")
 	}
@@ -168,6 +222,18 @@ func (r *Repository) RequestOptimizedStream(filepath string) (ret *MediaContaine
 	return
 }
 
+func (r *Repository) RequestPreloadOptimizedStream(filepath string) (err error) {
+	r.logger.Debug().Str("filepath", filepath).Msg("mediastream: Optimized stream preloading requested")
+
+	if !r.IsInitialized() {
+		return errors.New("module not initialized")
+	}
+
+	_, err = r.playbackManager.PreloadPlayback(filepath, StreamTypeOptimized)
+
+	return
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // Transcode
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -208,6 +274,53 @@ func (r *Repository) RequestPreloadTranscodeStream(filepath string) (err error)
 	return
 }
 
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Remux
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// RequestRemuxStream requests the playback of a file whose video stream is supported by the client.
+// The audio tracks supported by the client are copied, the others are encoded.
+func (r *Repository) RequestRemuxStream(filepath string, clientId string, supportedCodecs []string) (ret *MediaContainer, err error) {
+	r.reqMu.Lock()
+	defer r.reqMu.Unlock()
+
+	r.logger.Debug().Str("filepath", filepath).Msg("mediastream: Remux stream requested")
+
+	if !r.IsInitialized() {
+		return nil, errors.New("module not initialized")
+	}
+
+	// The remuxed segments are generated by the transcoder
+	if ok := r.initializeTranscoder(r.settings); !ok {
+		return nil, errors.New("real-time transcoder not initialized, check your settings")
+	}
+
+	ret, err = r.playbackManager.RequestPlayback(filepath, StreamTypeRemux)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isVideoRemuxable(ret.MediaInfo, supportedCodecs) {
+		r.playbackManager.KillPlayback()
+		return nil, errors.New("video codec not supported by the client")
+	}
+	ret.CopyAudios = getCopyableAudios(ret.MediaInfo, supportedCodecs)
+
+	return
+}
+
+func (r *Repository) RequestPreloadRemuxStream(filepath string) (err error) {
+	r.logger.Debug().Str("filepath", filepath).Msg("mediastream: Remux stream preloading requested")
+
+	if !r.IsInitialized() {
+		return errors.New("module not initialized")
+	}
+
+	_, err = r.playbackManager.PreloadPlayback(filepath, StreamTypeRemux)
+
+	return
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // Direct Play
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -269,6 +382,8 @@ func (r *Repository) initializeTranscoder(settings mo.Option[*models.Mediastream
 		FfprobePath:           settings.MustGet().FfprobePath,
 		HwAccelCustomSettings: settings.MustGet().TranscodeHwAccelCustomSettings,
 		TempOutDir:            r.transcodeDir,
+		SegmentCache:          r.segmentCache,
+		WarmQualities:         !settings.MustGet().DisableQualityWarming,
 	}
 
 	tc, err := transcoder.NewTranscoder(opts)
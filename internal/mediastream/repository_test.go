@@ -0,0 +1,15 @@
+package mediastream
+
+import (
+	"seanime/internal/database/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSegmentCacheMaxSize(t *testing.T) {
+	// Settings saved before the cache existed use the default size
+	assert.Equal(t, int64(4096*1024*1024), getSegmentCacheMaxSize(&models.MediastreamSettings{}))
+	assert.Equal(t, int64(512*1024*1024), getSegmentCacheMaxSize(&models.MediastreamSettings{TranscodeCacheMaxSize: 512}))
+	assert.Equal(t, int64(0), getSegmentCacheMaxSize(&models.MediastreamSettings{TranscodeCacheMaxSize: 512, DisableTranscodeCache: true}))
+}
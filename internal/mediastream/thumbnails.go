@@ -0,0 +1,159 @@
+package mediastream
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"seanime/internal/events"
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+var thumbnailsHashRegex = regexp.MustCompile(`^[a-f0-9]{40}$`)
+
+type (
+	// ThumbnailGenerator generates the thumbnail sprites of files in the background, one file at a time.
+	ThumbnailGenerator struct {
+		repository *Repository
+		mu         sync.Mutex
+		queue      []string // File paths
+		running    bool
+	}
+
+	// ThumbnailsReadyEvent is sent when the thumbnails of a file have been generated.
+	ThumbnailsReadyEvent struct {
+		Filepath      string `json:"filepath"`
+		Hash          string `json:"hash"`
+		ThumbnailsUrl string `json:"thumbnailsUrl"`
+	}
+)
+
+func NewThumbnailGenerator(repository *Repository) *ThumbnailGenerator {
+	return &ThumbnailGenerator{
+		repository: repository,
+		queue:      make([]string, 0),
+	}
+}
+
+// GetThumbnailsUrl returns the relative endpoint of the WebVTT index of a file's thumbnails.
+func GetThumbnailsUrl(hash string) string {
+	return fmt.Sprintf("/api/v1/mediastream/thumbnails/%s/%s", hash, videofile.ThumbnailsVttFilename)
+}
+
+// RequestThumbnails queues the generation of the thumbnails of the files.
+// Files being played should be queued with priority, so they're generated before the rest of the library.
+func (r *Repository) RequestThumbnails(paths []string, priority bool) error {
+	if !r.IsInitialized() {
+		return errors.New("module not initialized")
+	}
+
+	r.thumbnailGenerator.enqueue(paths, priority)
+	return nil
+}
+
+func (g *ThumbnailGenerator) enqueue(paths []string, priority bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if idx := slices.Index(g.queue, p); idx != -1 {
+			if !priority {
+				continue
+			}
+			g.queue = slices.Delete(g.queue, idx, idx+1)
+		}
+		if priority {
+			g.queue = slices.Insert(g.queue, 0, p)
+		} else {
+			g.queue = append(g.queue, p)
+		}
+	}
+
+	if !g.running && len(g.queue) > 0 {
+		g.running = true
+		go g.run()
+	}
+}
+
+// run generates the thumbnails of the queued files until the queue is empty.
+func (g *ThumbnailGenerator) run() {
+	for {
+		g.mu.Lock()
+		if len(g.queue) == 0 || !g.repository.IsInitialized() {
+			g.queue = g.queue[:0]
+			g.running = false
+			g.mu.Unlock()
+			return
+		}
+		path := g.queue[0]
+		g.queue = g.queue[1:]
+		g.mu.Unlock()
+
+		g.generate(path)
+	}
+}
+
+func (g *ThumbnailGenerator) generate(path string) {
+	defer util.HandlePanicInModuleThen("mediastream/thumbnails/generate", func() {})
+
+	r := g.repository
+	settings := r.settings.MustGet()
+
+	mediaInfo, err := r.mediaInfoExtractor.GetInfo(settings.FfprobePath, path)
+	if err != nil {
+		r.logger.Error().Err(err).Str("filepath", path).Msg("mediastream: Failed to get media info for thumbnails")
+		return
+	}
+
+	if videofile.ThumbnailsExist(r.cacheDir, mediaInfo.Sha) {
+		return
+	}
+
+	r.logger.Debug().Str("filepath", path).Msg("mediastream: Generating thumbnails")
+
+	err = videofile.ExtractThumbnails(settings.FfmpegPath, path, mediaInfo.Sha, mediaInfo, r.cacheDir, r.logger)
+	if err != nil {
+		r.logger.Error().Err(err).Str("filepath", path).Msg("mediastream: Failed to generate thumbnails")
+		return
+	}
+
+	r.logger.Info().Str("filepath", path).Msg("mediastream: Thumbnails generated")
+
+	r.wsEventManager.SendEvent(events.MediastreamThumbnailsReady, ThumbnailsReadyEvent{
+		Filepath:      path,
+		Hash:          mediaInfo.Sha,
+		ThumbnailsUrl: GetThumbnailsUrl(mediaInfo.Sha),
+	})
+}
+
+// ServeEchoThumbnails serves the WebVTT index and the sprite sheets of a file.
+// e.g. /api/v1/mediastream/thumbnails/{hash}/thumbnails.vtt
+func (r *Repository) ServeEchoThumbnails(c echo.Context) error {
+	if !r.IsInitialized() {
+		return errors.New("module not initialized")
+	}
+
+	hash, filename, found := strings.Cut(c.Param("*"), "/")
+	if !found || !thumbnailsHashRegex.MatchString(hash) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	// Only serve the files of the directory
+	if filename == "" || filename != filepath.Base(filename) || strings.Contains(filename, "..") {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if !videofile.ThumbnailsExist(r.cacheDir, hash) {
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	return c.File(filepath.Join(videofile.GetFileThumbnailsCacheDir(r.cacheDir, hash), filename))
+}
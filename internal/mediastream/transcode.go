@@ -4,6 +4,7 @@ import (
 	"errors"
 	"seanime/internal/events"
 	"seanime/internal/mediastream/transcoder"
+	"seanime/internal/mediastream/videofile"
 	"strconv"
 	"strings"
 
@@ -35,8 +36,34 @@ func (r *Repository) ServeEchoTranscodeStream(c echo.Context, clientId string) e
 		return errors.New("no file has been loaded")
 	}
 
+	// The session options are selected with the query parameters of the master playlist
+	// e.g. master.m3u8?burnSubtitle=2&subtitleFormat=webvtt&audioDownmix=dialogue&audioNormalize=true
 	if path == "master.m3u8" {
-		ret, err := r.transcoder.MustGet().GetMaster(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, clientId)
+		audioOptions, err := getAudioOptionsFromQuery(c)
+		if err != nil {
+			return err
+		}
+
+		opts := &transcoder.MasterOptions{
+			WebVttSubtitles: c.QueryParam("subtitleFormat") == "webvtt",
+			Audio:           audioOptions,
+		}
+		if mediaContainer.StreamType == StreamTypeRemux {
+			opts.Remux = true
+			opts.CopyAudios = mediaContainer.CopyAudios
+		}
+		if burnSubtitle := c.QueryParam("burnSubtitle"); burnSubtitle != "" {
+			index, err := strconv.ParseInt(burnSubtitle, 10, 32)
+			if err != nil {
+				return err
+			}
+			opts.BurnSubtitle, err = r.getBurnSubtitle(mediaContainer, int32(index))
+			if err != nil {
+				return err
+			}
+		}
+
+		ret, err := r.transcoder.MustGet().GetMaster(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, opts, clientId)
 		if err != nil {
 			return err
 		}
@@ -44,6 +71,79 @@ func (r *Repository) ServeEchoTranscodeStream(c echo.Context, clientId string) e
 		return c.String(200, ret)
 	}
 
+	// WebVTT subtitles
+	// /subtitles/:subtitle/index.m3u8
+	// /subtitles/:subtitle/subtitles.vtt
+	if strings.HasPrefix(path, "subtitles/") {
+		split := strings.Split(path, "/")
+		if len(split) != 3 {
+			return errors.New("invalid subtitles path")
+		}
+
+		index, err := strconv.ParseInt(split[1], 10, 32)
+		if err != nil {
+			return err
+		}
+
+		switch split[2] {
+		case "index.m3u8":
+			ret, err := r.transcoder.MustGet().GetSubtitleIndex(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo)
+			if err != nil {
+				return err
+			}
+			return c.String(200, ret)
+		case "subtitles.vtt":
+			return r.serveWebVttSubtitle(c, mediaContainer, int32(index))
+		}
+
+		return errors.New("invalid subtitles path")
+	}
+
+	// Video stream with burned-in subtitles
+	// /burn/:subtitle/:quality/index.m3u8
+	// /burn/:subtitle/:quality/segments-:chunk.ts
+	if strings.HasPrefix(path, "burn/") {
+		split := strings.Split(path, "/")
+		if len(split) != 4 {
+			return errors.New("invalid burn path")
+		}
+
+		index, err := strconv.ParseInt(split[1], 10, 32)
+		if err != nil {
+			return err
+		}
+
+		subtitle, err := r.getBurnSubtitle(mediaContainer, int32(index))
+		if err != nil {
+			return err
+		}
+
+		quality, err := transcoder.QualityFromString(split[2])
+		if err != nil {
+			return err
+		}
+
+		if split[3] == "index.m3u8" {
+			ret, err := r.transcoder.MustGet().GetVideoIndex(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, quality, subtitle, clientId)
+			if err != nil {
+				return err
+			}
+			return c.String(200, ret)
+		}
+
+		segment, err := transcoder.ParseSegment(split[3])
+		if err != nil {
+			return err
+		}
+
+		ret, err := r.transcoder.MustGet().GetVideoSegment(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, quality, subtitle, segment, clientId)
+		if err != nil {
+			return err
+		}
+
+		return c.File(ret)
+	}
+
 	// Video stream
 	// /:quality/index.m3u8
 	if strings.HasSuffix(path, "index.m3u8") && !strings.Contains(path, "audio") {
@@ -57,7 +157,7 @@ func (r *Repository) ServeEchoTranscodeStream(c echo.Context, clientId string) e
 			return err
 		}
 
-		ret, err := r.transcoder.MustGet().GetVideoIndex(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, quality, clientId)
+		ret, err := r.transcoder.MustGet().GetVideoIndex(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, quality, nil, clientId)
 		if err != nil {
 			return err
 		}
@@ -67,9 +167,10 @@ func (r *Repository) ServeEchoTranscodeStream(c echo.Context, clientId string) e
 
 	// Audio stream
 	// /audio/:audio/index.m3u8
+	// /audio/:audio/:profile/index.m3u8
 	if strings.HasSuffix(path, "index.m3u8") && strings.Contains(path, "audio") {
 		split := strings.Split(path, "/")
-		if len(split) != 3 {
+		if len(split) != 3 && len(split) != 4 {
 			return errors.New("invalid index.m3u8 path")
 		}
 
@@ -78,7 +179,12 @@ func (r *Repository) ServeEchoTranscodeStream(c echo.Context, clientId string) e
 			return err
 		}
 
-		ret, err := r.transcoder.MustGet().GetAudioIndex(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, int32(audio), clientId)
+		audioOptions, err := getAudioOptionsFromPath(split)
+		if err != nil {
+			return err
+		}
+
+		ret, err := r.transcoder.MustGet().GetAudioIndex(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, int32(audio), audioOptions, clientId)
 		if err != nil {
 			return err
 		}
@@ -104,7 +210,7 @@ func (r *Repository) ServeEchoTranscodeStream(c echo.Context, clientId string) e
 			return err
 		}
 
-		ret, err := r.transcoder.MustGet().GetVideoSegment(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, quality, segment, clientId)
+		ret, err := r.transcoder.MustGet().GetVideoSegment(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, quality, nil, segment, clientId)
 		if err != nil {
 			return err
 		}
@@ -114,9 +220,10 @@ func (r *Repository) ServeEchoTranscodeStream(c echo.Context, clientId string) e
 
 	// Audio segment
 	// /audio/:audio/segments-:chunk.ts
+	// /audio/:audio/:profile/segments-:chunk.ts
 	if strings.HasSuffix(path, ".ts") && strings.Contains(path, "audio") {
 		split := strings.Split(path, "/")
-		if len(split) != 3 {
+		if len(split) != 3 && len(split) != 4 {
 			return errors.New("invalid segments-:chunk.ts path")
 		}
 
@@ -125,12 +232,17 @@ func (r *Repository) ServeEchoTranscodeStream(c echo.Context, clientId string) e
 			return err
 		}
 
-		segment, err := transcoder.ParseSegment(split[2])
+		audioOptions, err := getAudioOptionsFromPath(split)
+		if err != nil {
+			return err
+		}
+
+		segment, err := transcoder.ParseSegment(split[len(split)-1])
 		if err != nil {
 			return err
 		}
 
-		ret, err := r.transcoder.MustGet().GetAudioSegment(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, int32(audio), segment, clientId)
+		ret, err := r.transcoder.MustGet().GetAudioSegment(mediaContainer.Filepath, mediaContainer.Hash, mediaContainer.MediaInfo, int32(audio), audioOptions, segment, clientId)
 		if err != nil {
 			return err
 		}
@@ -141,6 +253,35 @@ func (r *Repository) ServeEchoTranscodeStream(c echo.Context, clientId string) e
 	return errors.New("invalid path")
 }
 
+// getAudioOptionsFromQuery returns the audio options selected with the query parameters.
+// e.g. ?audioCodec=eac3&audioDownmix=none&audioNormalize=true
+func getAudioOptionsFromQuery(c echo.Context) (*transcoder.AudioOptions, error) {
+	return transcoder.ParseAudioOptions(c.QueryParam("audioCodec"), c.QueryParam("audioDownmix"), c.QueryParam("audioNormalize") == "true")
+}
+
+// getAudioOptionsFromPath returns the audio options of an audio rendition path.
+// The profile is omitted from the path for the default options.
+func getAudioOptionsFromPath(split []string) (*transcoder.AudioOptions, error) {
+	if len(split) != 4 {
+		return nil, nil
+	}
+	return transcoder.ParseAudioProfile(split[2])
+}
+
+// getBurnSubtitle returns the subtitle track to burn into the video stream, with the extracted fonts.
+func (r *Repository) getBurnSubtitle(mediaContainer *MediaContainer, index int32) (*transcoder.BurnSubtitle, error) {
+	subPath, err := r.getExtractedSubtitlePath(mediaContainer, index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transcoder.BurnSubtitle{
+		Index:    index,
+		Path:     subPath,
+		FontsDir: videofile.GetFileAttCacheDir(r.cacheDir, mediaContainer.Hash),
+	}, nil
+}
+
 // ShutdownTranscodeStream It should be called when unmounting the player (playback is no longer needed).
 // This will also send an events.MediastreamShutdownStream event.
 func (r *Repository) ShutdownTranscodeStream(clientId string) {
@@ -4,41 +4,281 @@ import (
 	"fmt"
 	"github.com/rs/zerolog"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-type AudioStream struct {
-	Stream
-	index    int32
-	logger   *zerolog.Logger
-	settings *Settings
-}
+type (
+	AudioStream struct {
+		Stream
+		index    int32
+		options  AudioOptions
+		channels uint32 // Channels of the source track, 0 if unknown
+		logger   *zerolog.Logger
+		settings *Settings
+	}
+
+	AudioCodec   string
+	AudioDownmix string
+
+	// AudioOptions are the audio processing options of a session.
+	// The zero value is the default stereo AAC encode.
+	AudioOptions struct {
+		// Normalize the loudness (EBU R128) so that quiet dialogues and loud scenes are closer
+		Normalize bool
+		Downmix   AudioDownmix
+		Codec     AudioCodec
+	}
+
+	// audioKey identifies an audio stream of a file.
+	audioKey struct {
+		index   int32
+		profile string // Empty for the default options
+	}
+)
+
+const (
+	AudioCodecAac  AudioCodec = "aac"
+	AudioCodecAc3  AudioCodec = "ac3"
+	AudioCodecEac3 AudioCodec = "eac3"
+	AudioCodecCopy AudioCodec = "copy" // Original track, without processing
+
+	AudioDownmixStereo   AudioDownmix = "stereo"   // Default downmix of FFmpeg
+	AudioDownmixDialogue AudioDownmix = "dialogue" // Center channel boosted, for surround tracks played on stereo speakers
+	AudioDownmixNone     AudioDownmix = "none"     // Original channels, up to 5.1
+)
+
+const audioNormalizeProfile = "loudnorm"
 
 // NewAudioStream creates a new AudioStream for a file, at a given audio index.
-func NewAudioStream(file *FileStream, idx int32, logger *zerolog.Logger, settings *Settings) *AudioStream {
+func NewAudioStream(file *FileStream, idx int32, options *AudioOptions, logger *zerolog.Logger, settings *Settings) *AudioStream {
 	logger.Trace().Str("file", filepath.Base(file.Path)).Int32("idx", idx).Msgf("trancoder: Creating audio stream")
 	ret := new(AudioStream)
 	ret.index = idx
+	ret.options = options.withDefaults()
 	ret.logger = logger
 	ret.settings = settings
+	for _, audio := range file.Info.Audios {
+		if int32(audio.Index) == idx {
+			ret.channels = audio.Channels
+		}
+	}
 	NewStream(fmt.Sprintf("audio %d", idx), file, ret, &ret.Stream, settings, logger)
 	return ret
 }
 
+func newAudioKey(index int32, options *AudioOptions) audioKey {
+	return audioKey{index: index, profile: options.Profile()}
+}
+
 func (as *AudioStream) getOutPath(encoderId int) string {
+	if profile := as.options.Profile(); profile != "" {
+		return filepath.Join(as.file.Out, fmt.Sprintf("segment-a%d-%s-%d-%%d.ts", as.index, profile, encoderId))
+	}
 	return filepath.Join(as.file.Out, fmt.Sprintf("segment-a%d-%d-%%d.ts", as.index, encoderId))
 }
 
+func (as *AudioStream) getCacheKey() string {
+	if profile := as.options.Profile(); profile != "" {
+		return fmt.Sprintf("audio-%d-%s", as.index, profile)
+	}
+	return fmt.Sprintf("audio-%d", as.index)
+}
+
+func (as *AudioStream) getDecodeFlags() []string {
+	return as.settings.HwAccel.DecodeFlags
+}
+
 func (as *AudioStream) getFlags() Flags {
 	return AudioF
 }
 
 func (as *AudioStream) getTranscodeArgs(segments string) []string {
-	return []string{
+	ret := []string{
 		"-map", fmt.Sprintf("0:a:%d", as.index),
-		"-c:a", "aac",
-		// TODO: Support 5.1 audio streams.
-		"-ac", "2",
-		// TODO: Support multi audio qualities.
-		"-b:a", "128k",
 	}
+	return append(ret, as.options.GetEncodeArgs(as.channels)...)
+}
+
+/////////////
+
+// ParseAudioOptions returns the audio options selected by a client.
+// Empty values fall back to the defaults.
+func ParseAudioOptions(codec string, downmix string, normalize bool) (*AudioOptions, error) {
+	ret := &AudioOptions{
+		Normalize: normalize,
+		Downmix:   AudioDownmix(strings.ToLower(downmix)),
+		Codec:     AudioCodec(strings.ToLower(codec)),
+	}
+	if err := ret.validate(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ParseAudioProfile returns the audio options of a profile generated by AudioOptions.Profile.
+func ParseAudioProfile(profile string) (*AudioOptions, error) {
+	ret := &AudioOptions{}
+	for i, part := range strings.Split(profile, "-") {
+		switch {
+		case i == 0:
+			ret.Codec = AudioCodec(part)
+		case part == audioNormalizeProfile:
+			ret.Normalize = true
+		case ret.Downmix == "":
+			ret.Downmix = AudioDownmix(part)
+		default:
+			return nil, fmt.Errorf("invalid audio profile: %s", profile)
+		}
+	}
+	if err := ret.validate(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (o *AudioOptions) validate() error {
+	switch o.Codec {
+	case "", AudioCodecAac, AudioCodecAc3, AudioCodecEac3, AudioCodecCopy:
+	default:
+		return fmt.Errorf("unsupported audio codec: %s", o.Codec)
+	}
+	switch o.Downmix {
+	case "", AudioDownmixStereo, AudioDownmixDialogue, AudioDownmixNone:
+	default:
+		return fmt.Errorf("unsupported audio downmix: %s", o.Downmix)
+	}
+	if o.Codec == AudioCodecCopy && (o.Normalize || (o.Downmix != "" && o.Downmix != AudioDownmixStereo)) {
+		return fmt.Errorf("the audio track must be encoded to be processed")
+	}
+	return nil
+}
+
+func (o *AudioOptions) withDefaults() AudioOptions {
+	ret := AudioOptions{}
+	if o != nil {
+		ret = *o
+	}
+	if ret.Codec == "" {
+		ret.Codec = AudioCodecAac
+	}
+	if ret.Downmix == "" || ret.Codec == AudioCodecCopy {
+		ret.Downmix = AudioDownmixStereo
+	}
+	return ret
+}
+
+// IsDefault returns true if the options produce the default stereo AAC encode.
+func (o *AudioOptions) IsDefault() bool {
+	return o.Profile() == ""
+}
+
+// Profile returns the identifier of the options used in the stream URLs and the segment cache (e.g. "eac3-none", "aac-dialogue-loudnorm").
+// It's empty for the default options so that the URLs and cached segments of the default encode don't change.
+func (o *AudioOptions) Profile() string {
+	opts := o.withDefaults()
+	if opts.Codec == AudioCodecAac && opts.Downmix == AudioDownmixStereo && !opts.Normalize {
+		return ""
+	}
+	ret := string(opts.Codec)
+	if opts.Downmix != AudioDownmixStereo {
+		ret += "-" + string(opts.Downmix)
+	}
+	if opts.Normalize {
+		ret += "-" + audioNormalizeProfile
+	}
+	return ret
+}
+
+// GetChannels returns the number of output channels for a source track.
+func (o *AudioOptions) GetChannels(sourceChannels uint32) uint32 {
+	opts := o.withDefaults()
+	if sourceChannels == 0 {
+		return 2
+	}
+	if opts.Codec == AudioCodecCopy {
+		return sourceChannels
+	}
+	if opts.Downmix != AudioDownmixNone {
+		return 2
+	}
+	// The AC-3 encoders of FFmpeg don't support more than 5.1
+	return min(sourceChannels, 6)
+}
+
+// GetMimeCodec returns the codec string of the output, as listed in the master playlist.
+// It's empty for a copied track, the codec is the one of the source track.
+func (o *AudioOptions) GetMimeCodec() string {
+	switch o.withDefaults().Codec {
+	case AudioCodecCopy:
+		return ""
+	case AudioCodecAc3:
+		return "ac-3"
+	case AudioCodecEac3:
+		return "ec-3"
+	}
+	return "mp4a.40.2"
+}
+
+// GetEncodeArgs returns the FFmpeg arguments that process and encode the selected audio track.
+// The dialogue downmix needs the channel count of the track, the default downmix is used when it's unknown (e.g. media information cached by older versions).
+func (o *AudioOptions) GetEncodeArgs(sourceChannels uint32) []string {
+	opts := o.withDefaults()
+	if opts.Codec == AudioCodecCopy {
+		return []string{"-c:a", "copy"}
+	}
+	channels := opts.GetChannels(sourceChannels)
+
+	filters := make([]string, 0, 3)
+	if opts.Downmix == AudioDownmixDialogue && sourceChannels >= 6 {
+		// Input channels are referenced by position (FL FR FC LFE BL/SL BR/SR) so that the filter works with both 5.1 layouts.
+		// The LFE channel is dropped, laptop speakers can't reproduce it.
+		// The gains are renormalized ("<") so that they sum to 1 and the boosted mix doesn't clip.
+		filters = append(filters, "pan=stereo|FL<c2+0.30*c0+0.30*c4|FR<c2+0.30*c1+0.30*c5")
+	}
+	if opts.Normalize {
+		// Single pass dynamic normalization, the filter outputs 192kHz so the stream is resampled afterward
+		filters = append(filters, "loudnorm=I=-16:TP=-1.5:LRA=11", "aresample=48000")
+	}
+
+	ret := make([]string, 0, 8)
+	if len(filters) > 0 {
+		ret = append(ret, "-af", strings.Join(filters, ","))
+	}
+	ret = append(ret,
+		"-c:a", string(opts.Codec),
+		"-ac", strconv.Itoa(int(channels)),
+		"-b:a", getAudioBitrate(opts.Codec, channels),
+	)
+	return ret
+}
+
+func getAudioBitrate(codec AudioCodec, channels uint32) string {
+	surround := channels > 2
+	switch codec {
+	case AudioCodecAc3:
+		if surround {
+			return "448k"
+		}
+		return "192k"
+	case AudioCodecEac3:
+		if surround {
+			return "384k"
+		}
+		return "128k"
+	}
+	if surround {
+		return "384k"
+	}
+	return "128k"
+}
+
+// CanCopyAudio returns true if an audio codec can be copied into the MPEG-TS segments without encoding.
+// Only MPEG audio (mp4a) is played by browsers from MPEG-TS segments, the other codecs are encoded.
+func CanCopyAudio(codec string) bool {
+	switch codec {
+	case "aac", "mp3":
+		return true
+	}
+	return false
 }
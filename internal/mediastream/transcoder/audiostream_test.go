@@ -0,0 +1,117 @@
+package transcoder
+
+import (
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util/result"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudioOptions_Profile(t *testing.T) {
+	tests := []struct {
+		options  *AudioOptions
+		expected string
+	}{
+		{nil, ""},
+		{&AudioOptions{}, ""},
+		{&AudioOptions{Codec: AudioCodecAac, Downmix: AudioDownmixStereo}, ""},
+		{&AudioOptions{Normalize: true}, "aac-loudnorm"},
+		{&AudioOptions{Downmix: AudioDownmixDialogue, Normalize: true}, "aac-dialogue-loudnorm"},
+		{&AudioOptions{Codec: AudioCodecEac3, Downmix: AudioDownmixNone}, "eac3-none"},
+		{&AudioOptions{Codec: AudioCodecAc3}, "ac3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.options.Profile())
+			if tt.expected == "" {
+				return
+			}
+			parsed, err := ParseAudioProfile(tt.expected)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, parsed.Profile())
+		})
+	}
+
+	_, err := ParseAudioProfile("opus")
+	assert.Error(t, err)
+	_, err = ParseAudioProfile("aac-dialogue-none")
+	assert.Error(t, err)
+	_, err = ParseAudioOptions("aac", "mono", false)
+	assert.Error(t, err)
+}
+
+func TestAudioOptions_GetEncodeArgs(t *testing.T) {
+	// Default stereo AAC encode
+	args := (*AudioOptions)(nil).GetEncodeArgs(6)
+	assert.Equal(t, []string{"-c:a", "aac", "-ac", "2", "-b:a", "128k"}, args)
+
+	// Dialogue boost of a 5.1 track, normalized
+	opts := &AudioOptions{Downmix: AudioDownmixDialogue, Normalize: true}
+	args = opts.GetEncodeArgs(6)
+	idx := lo.IndexOf(args, "-af")
+	require.NotEqual(t, -1, idx)
+	// The gains are renormalized to avoid clipping
+	assert.Contains(t, args[idx+1], "pan=stereo|FL<c2+")
+	assert.Contains(t, args[idx+1], "|FR<c2+")
+	assert.Contains(t, args[idx+1], "loudnorm=")
+	assert.Equal(t, "2", args[lo.IndexOf(args, "-ac")+1])
+
+	// The dialogue boost is skipped for stereo tracks and tracks with an unknown layout
+	for _, channels := range []uint32{0, 2} {
+		args = (&AudioOptions{Downmix: AudioDownmixDialogue}).GetEncodeArgs(channels)
+		assert.NotContains(t, args, "-af")
+	}
+
+	// Surround tracks are kept up to 5.1
+	opts = &AudioOptions{Codec: AudioCodecEac3, Downmix: AudioDownmixNone}
+	args = opts.GetEncodeArgs(8)
+	assert.Equal(t, []string{"-c:a", "eac3", "-ac", "6", "-b:a", "384k"}, args)
+	assert.Equal(t, "ec-3", opts.GetMimeCodec())
+}
+
+func TestFileStream_GetMaster_Remux(t *testing.T) {
+	fs := &FileStream{
+		videos: result.NewResultMap[videoKey, *VideoStream](),
+		Info: &videofile.MediaInfo{
+			Duration: 1420,
+			Video: &videofile.Video{
+				Quality:   videofile.P1080,
+				Width:     1920,
+				Height:    1080,
+				Bitrate:   4_000_000,
+				MimeCodec: lo.ToPtr("avc1.640028"),
+			},
+			Audios: []videofile.Audio{
+				{Index: 0, Codec: "mp3", MimeCodec: lo.ToPtr("mp4a.40.34"), Channels: 2},
+				{Index: 1, Codec: "flac", MimeCodec: lo.ToPtr("fLaC"), Channels: 2},
+			},
+		},
+	}
+
+	opts := &MasterOptions{Remux: true, CopyAudios: []int32{0}}
+	master := fs.GetMaster(opts)
+
+	// Only the original quality is listed
+	assert.Contains(t, master, "./original/index.m3u8")
+	assert.NotContains(t, master, "720p")
+	assert.Contains(t, master, `CODECS="avc1.640028,mp4a.40.34"`)
+	assert.True(t, opts.isRemuxed())
+
+	// The supported track is copied, the other one is encoded
+	assert.Contains(t, master, `CHANNELS="2",URI="./audio/0/copy/index.m3u8"`)
+	assert.Contains(t, master, `CHANNELS="2",URI="./audio/1/index.m3u8"`)
+
+	// Processed tracks are encoded
+	master = fs.GetMaster(&MasterOptions{Remux: true, CopyAudios: []int32{0}, Audio: &AudioOptions{Normalize: true}})
+	assert.Contains(t, master, `URI="./audio/0/aac-loudnorm/index.m3u8"`)
+
+	// The transcoded qualities are listed when the subtitles are burned in
+	opts = &MasterOptions{Remux: true, BurnSubtitle: &BurnSubtitle{Index: 0}}
+	master = fs.GetMaster(opts)
+	assert.Contains(t, master, "./burn/0/720p/index.m3u8")
+	assert.False(t, opts.isRemuxed())
+}
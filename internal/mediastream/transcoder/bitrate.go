@@ -0,0 +1,85 @@
+package transcoder
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	// Bitrate of the transcoded audio streams, see AudioStream.getTranscodeArgs
+	audioBitrate = 128_000
+	// Number of segments needed before the measured bitrate is trusted over the estimate
+	minMeasuredSegments = 3
+	// Shorter segments are ignored for the peak bitrate, a keyframe alone would make it spike
+	minPeakSegmentDuration = 1.0
+)
+
+// bitrateStats measures the bitrate of a stream from the size of its generated segments.
+type bitrateStats struct {
+	mu       sync.Mutex
+	bytes    int64
+	duration float64 // Seconds
+	peak     float64 // Bits per second
+	count    int
+}
+
+func (s *bitrateStats) add(size int64, duration float64) {
+	if size <= 0 || duration <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes += size
+	s.duration += duration
+	s.count++
+	if duration >= minPeakSegmentDuration {
+		s.peak = max(s.peak, float64(size*8)/duration)
+	}
+}
+
+// get returns the average and peak bitrates in bits per second.
+// It returns false if not enough segments have been measured.
+func (s *bitrateStats) get() (average uint32, peak uint32, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count < minMeasuredSegments || s.duration == 0 {
+		return 0, 0, false
+	}
+	average = uint32(float64(s.bytes*8) / s.duration)
+	return average, max(average, uint32(s.peak)), true
+}
+
+// recordSegment measures the size of a segment once it's ready.
+func (ts *Stream) recordSegment(outpath string, segment int32) {
+	info, err := os.Stat(fmt.Sprintf(outpath, segment))
+	if err != nil {
+		return
+	}
+
+	length, isDone := ts.file.Keyframes.Length()
+	var duration float64
+	switch {
+	case segment+1 < length:
+		duration = ts.file.Keyframes.Get(segment+1) - ts.file.Keyframes.Get(segment)
+	case isDone:
+		duration = float64(ts.file.Info.Duration) - ts.file.Keyframes.Get(segment)
+	default:
+		return
+	}
+
+	ts.bitrate.add(info.Size(), duration)
+}
+
+// getVariantBitrates returns the average and peak bitrates of a video variant in bits per second, audio included.
+// The bitrates are measured from the generated segments once there are enough of them, the estimates are used until then.
+func (fs *FileStream) getVariantBitrates(quality Quality, subtitle *BurnSubtitle, estimatedAverage uint32, estimatedPeak uint32) (uint32, uint32) {
+	average, peak := estimatedAverage, estimatedPeak
+	if stream, found := fs.videos.Get(newVideoKey(quality, subtitle)); found {
+		if measuredAverage, measuredPeak, ok := stream.bitrate.get(); ok {
+			average, peak = measuredAverage, measuredPeak
+		}
+	}
+	return average + audioBitrate, peak + audioBitrate
+}
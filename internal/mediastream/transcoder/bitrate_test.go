@@ -0,0 +1,72 @@
+package transcoder
+
+import (
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util/result"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitrateStats(t *testing.T) {
+	var s bitrateStats
+
+	s.add(500_000, 4)
+	s.add(1_000_000, 4)
+	_, _, ok := s.get()
+	assert.False(t, ok, "not enough segments")
+
+	// A short segment counts toward the average but not the peak
+	s.add(200_000, 0.5)
+	average, peak, ok := s.get()
+	require.True(t, ok)
+	assert.Equal(t, uint32(1_700_000*8/8.5), average)
+	assert.Equal(t, uint32(2_000_000), peak)
+}
+
+func TestFileStream_GetVariantBitrates(t *testing.T) {
+	fs := &FileStream{videos: result.NewResultMap[videoKey, *VideoStream]()}
+
+	// Estimates until the stream is measured
+	average, peak := fs.getVariantBitrates(P720, nil, P720.AverageBitrate(), P720.MaxBitrate())
+	assert.Equal(t, P720.AverageBitrate()+audioBitrate, average)
+	assert.Equal(t, P720.MaxBitrate()+audioBitrate, peak)
+
+	vs := &VideoStream{quality: P720}
+	for range minMeasuredSegments {
+		vs.bitrate.add(1_000_000, 4)
+	}
+	fs.videos.Set(newVideoKey(P720, nil), vs)
+
+	average, peak = fs.getVariantBitrates(P720, nil, P720.AverageBitrate(), P720.MaxBitrate())
+	assert.Equal(t, uint32(2_000_000+audioBitrate), average)
+	assert.Equal(t, uint32(2_000_000+audioBitrate), peak)
+
+	// Streams with burned-in subtitles are measured separately
+	average, _ = fs.getVariantBitrates(P720, &BurnSubtitle{Index: 1}, P720.AverageBitrate(), P720.MaxBitrate())
+	assert.Equal(t, P720.AverageBitrate()+audioBitrate, average)
+}
+
+func TestTracker_GetNeighborQualities(t *testing.T) {
+	fs := &FileStream{
+		videos: result.NewResultMap[videoKey, *VideoStream](),
+		Info: &videofile.MediaInfo{
+			Video: &videofile.Video{Quality: videofile.P1080, Width: 1920, Height: 1080, MimeCodec: lo.ToPtr("avc1.640028")},
+		},
+	}
+	tracker := &Tracker{transcoder: &Transcoder{streams: result.NewResultMap[string, *FileStream]()}}
+	tracker.transcoder.streams.Set("/video.mkv", fs)
+
+	neighbors := func(quality Quality, subtitle int32) []Quality {
+		return tracker.getNeighborQualities(ClientInfo{path: "/video.mkv", quality: &quality, subtitle: subtitle})
+	}
+
+	// The original quality is transmuxed, 1080p is not listed
+	assert.Equal(t, []Quality{P360, P720}, neighbors(P480, -1))
+	assert.Equal(t, []Quality{P720}, neighbors(Original, -1))
+	assert.Equal(t, []Quality{P360}, neighbors(P240, -1))
+	// Every quality is transcoded when the subtitles are burned in
+	assert.Equal(t, []Quality{P720}, neighbors(P1080, 0))
+}
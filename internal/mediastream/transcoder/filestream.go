@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 	"math"
 	"os"
 	"path/filepath"
 	"seanime/internal/mediastream/videofile"
 	"seanime/internal/util/result"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -17,14 +19,15 @@ import (
 // FileStream represents a stream of file data.
 // It holds the keyframes, media information, video streams, and audio streams.
 type FileStream struct {
-	ready     sync.WaitGroup                     // A WaitGroup to synchronize go routines.
-	err       error                              // An error that might occur during processing.
-	Path      string                             // The path of the file.
-	Out       string                             // The output path.
-	Keyframes *Keyframe                          // The keyframes of the video.
-	Info      *videofile.MediaInfo               // The media information of the file.
-	videos    *result.Map[Quality, *VideoStream] // A map of video streams.
-	audios    *result.Map[int32, *AudioStream]   // A map of audio streams.
+	ready     sync.WaitGroup                      // A WaitGroup to synchronize go routines.
+	err       error                               // An error that might occur during processing.
+	Path      string                              // The path of the file.
+	Out       string                              // The output path.
+	sha       string                              // The hash of the file.
+	Keyframes *Keyframe                           // The keyframes of the video.
+	Info      *videofile.MediaInfo                // The media information of the file.
+	videos    *result.Map[videoKey, *VideoStream] // A map of video streams.
+	audios    *result.Map[audioKey, *AudioStream] // A map of audio streams.
 	logger    *zerolog.Logger
 	settings  *Settings
 }
@@ -40,13 +43,17 @@ func NewFileStream(
 	ret := &FileStream{
 		Path:     path,
 		Out:      filepath.Join(settings.StreamDir, sha),
-		videos:   result.NewResultMap[Quality, *VideoStream](),
-		audios:   result.NewResultMap[int32, *AudioStream](),
+		sha:      sha,
+		videos:   result.NewResultMap[videoKey, *VideoStream](),
+		audios:   result.NewResultMap[audioKey, *AudioStream](),
 		logger:   logger,
 		settings: settings,
 		Info:     mediaInfo,
 	}
 
+	// Keep the cached segments of the file while it's being played
+	settings.SegmentCache.acquire(sha)
+
 	ret.ready.Add(1)
 	go func() {
 		defer ret.ready.Done()
@@ -58,80 +65,103 @@ func NewFileStream(
 
 // Kill stops all streams.
 func (fs *FileStream) Kill() {
-	fs.videos.Range(func(_ Quality, s *VideoStream) bool {
+	fs.videos.Range(func(_ videoKey, s *VideoStream) bool {
 		s.Kill()
 		return true
 	})
-	fs.audios.Range(func(_ int32, s *AudioStream) bool {
+	fs.audios.Range(func(_ audioKey, s *AudioStream) bool {
 		s.Kill()
 		return true
 	})
 }
 
 // Destroy stops all streams and removes the output directory.
+// The segments stored in the segment cache are kept.
 func (fs *FileStream) Destroy() {
 	fs.logger.Debug().Msg("filestream: Destroying streams")
 	fs.Kill()
 	_ = os.RemoveAll(fs.Out)
+	fs.settings.SegmentCache.release(fs.sha)
 }
 
 // GetMaster generates the master playlist.
-func (fs *FileStream) GetMaster() string {
+func (fs *FileStream) GetMaster(opts *MasterOptions) string {
+	if opts == nil {
+		opts = &MasterOptions{}
+	}
+
+	// Renditions referenced by the video variants
+	renditions := "AUDIO=\"audio\","
+	if opts.WebVttSubtitles && len(fs.getWebVttSubtitles(opts)) > 0 {
+		renditions += "SUBTITLES=\"subs\","
+	}
+
+	// The transcoded qualities aren't listed when remuxing, unless the subtitles are burned in
+	remux := opts.isRemuxed()
+
+	// Players assume AAC when the audio codec isn't listed
+	audioCodec := ""
+	for _, mimeCodec := range lo.Uniq(lo.Map(fs.Info.Audios, func(audio videofile.Audio, _ int) string {
+		return fs.getAudioMimeCodec(audio, opts.getAudioOptions(audio, remux))
+	})) {
+		if mimeCodec != "" && mimeCodec != "mp4a.40.2" {
+			audioCodec += "," + mimeCodec
+		}
+	}
+
 	master := "#EXTM3U\n"
 	if fs.Info.Video != nil {
-		var transmuxQuality Quality
-		for _, quality := range Qualities {
-			if quality.Height() >= fs.Info.Video.Quality.Height() || quality.AverageBitrate() >= fs.Info.Video.Bitrate {
-				transmuxQuality = quality
-				break
-			}
+		aspectRatio := float32(fs.Info.Video.Width) / float32(fs.Info.Video.Height)
+		// The bandwidths are measured from the generated segments once available, so that players can switch qualities accurately
+		variants := fs.getVariantQualities(opts.BurnSubtitle != nil)
+		if remux {
+			variants = []Quality{Original}
 		}
-		{
-			bitrate := float64(fs.Info.Video.Bitrate)
-			master += "#EXT-X-STREAM-INF:"
-			master += fmt.Sprintf("AVERAGE-BANDWIDTH=%d,", int(math.Min(bitrate*0.8, float64(transmuxQuality.AverageBitrate()))))
-			master += fmt.Sprintf("BANDWIDTH=%d,", int(math.Min(bitrate, float64(transmuxQuality.MaxBitrate()))))
-			master += fmt.Sprintf("RESOLUTION=%dx%d,", fs.Info.Video.Width, fs.Info.Video.Height)
-			if fs.Info.Video.MimeCodec != nil {
-				master += fmt.Sprintf("CODECS=\"%s\",", *fs.Info.Video.MimeCodec)
-			}
-			master += "AUDIO=\"audio\","
-			master += "CLOSED-CAPTIONS=NONE\n"
-			master += fmt.Sprintf("./%s/index.m3u8\n", Original)
+		// The original quality is listed first since players start with the first variant
+		if idx := slices.Index(variants, Original); idx != -1 {
+			variants = append([]Quality{Original}, slices.Delete(variants, idx, idx+1)...)
 		}
-		aspectRatio := float32(fs.Info.Video.Width) / float32(fs.Info.Video.Height)
-		// codec is the prefix + the level, the level is not part of the codec we want to compare for the same_codec check bellow
-		transmuxPrefix := "avc1.6400"
-		transmuxCodec := transmuxPrefix + "28"
-
-		for _, quality := range Qualities {
-			sameCodec := fs.Info.Video.MimeCodec != nil && strings.HasPrefix(*fs.Info.Video.MimeCodec, transmuxPrefix)
-			includeLvl := quality.Height() < fs.Info.Video.Quality.Height() || (quality.Height() == fs.Info.Video.Quality.Height() && !sameCodec)
-
-			if includeLvl {
+		for _, quality := range variants {
+			if quality == Original {
+				var transmuxQuality Quality
+				for _, quality := range Qualities {
+					if quality.Height() >= fs.Info.Video.Quality.Height() || quality.AverageBitrate() >= fs.Info.Video.Bitrate {
+						transmuxQuality = quality
+						break
+					}
+				}
+				bitrate := float64(fs.Info.Video.Bitrate)
+				averageBandwidth, bandwidth := fs.getVariantBitrates(Original, nil,
+					uint32(math.Min(bitrate*0.8, float64(transmuxQuality.AverageBitrate()))),
+					uint32(math.Min(bitrate, float64(transmuxQuality.MaxBitrate()))),
+				)
 				master += "#EXT-X-STREAM-INF:"
-				master += fmt.Sprintf("AVERAGE-BANDWIDTH=%d,", quality.AverageBitrate())
-				master += fmt.Sprintf("BANDWIDTH=%d,", quality.MaxBitrate())
-				master += fmt.Sprintf("RESOLUTION=%dx%d,", int(aspectRatio*float32(quality.Height())+0.5), quality.Height())
-				master += fmt.Sprintf("CODECS=\"%s\",", transmuxCodec)
-				master += "AUDIO=\"audio\","
+				master += fmt.Sprintf("AVERAGE-BANDWIDTH=%d,", averageBandwidth)
+				master += fmt.Sprintf("BANDWIDTH=%d,", bandwidth)
+				master += fmt.Sprintf("RESOLUTION=%dx%d,", fs.Info.Video.Width, fs.Info.Video.Height)
+				if fs.Info.Video.MimeCodec != nil {
+					master += fmt.Sprintf("CODECS=\"%s%s\",", *fs.Info.Video.MimeCodec, audioCodec)
+				}
+				master += renditions
 				master += "CLOSED-CAPTIONS=NONE\n"
+				master += fmt.Sprintf("./%s/index.m3u8\n", Original)
+				continue
+			}
+
+			averageBandwidth, bandwidth := fs.getVariantBitrates(quality, opts.BurnSubtitle, quality.AverageBitrate(), quality.MaxBitrate())
+			master += "#EXT-X-STREAM-INF:"
+			master += fmt.Sprintf("AVERAGE-BANDWIDTH=%d,", averageBandwidth)
+			master += fmt.Sprintf("BANDWIDTH=%d,", bandwidth)
+			master += fmt.Sprintf("RESOLUTION=%dx%d,", int(aspectRatio*float32(quality.Height())+0.5), quality.Height())
+			master += fmt.Sprintf("CODECS=\"%s%s\",", transmuxCodec, audioCodec)
+			master += renditions
+			master += "CLOSED-CAPTIONS=NONE\n"
+			if opts.BurnSubtitle != nil {
+				master += fmt.Sprintf("./burn/%d/%s/index.m3u8\n", opts.BurnSubtitle.Index, quality)
+			} else {
 				master += fmt.Sprintf("./%s/index.m3u8\n", quality)
 			}
 		}
-
-		//for _, quality := range Qualities {
-		//	if quality.Height() < fs.Info.Video.Quality.Height() && quality.AverageBitrate() < fs.Info.Video.Bitrate {
-		//		master += "#EXT-X-STREAM-INF:"
-		//		master += fmt.Sprintf("AVERAGE-BANDWIDTH=%d,", quality.AverageBitrate())
-		//		master += fmt.Sprintf("BANDWIDTH=%d,", quality.MaxBitrate())
-		//		master += fmt.Sprintf("RESOLUTION=%dx%d,", int(aspectRatio*float32(quality.Height())+0.5), quality.Height())
-		//		master += "CODECS=\"avc1.640028\","
-		//		master += "AUDIO=\"audio\","
-		//		master += "CLOSED-CAPTIONS=NONE\n"
-		//		master += fmt.Sprintf("./%s/index.m3u8\n", quality)
-		//	}
-		//}
 	}
 	for _, audio := range fs.Info.Audios {
 		master += "#EXT-X-MEDIA:TYPE=AUDIO,"
@@ -149,23 +179,117 @@ func (fs *FileStream) GetMaster() string {
 		if audio.IsDefault {
 			master += "DEFAULT=YES,"
 		}
-		master += "CHANNELS=\"2\","
-		master += fmt.Sprintf("URI=\"./audio/%d/index.m3u8\"\n", audio.Index)
+		audioOptions := opts.getAudioOptions(audio, remux)
+		master += fmt.Sprintf("CHANNELS=\"%d\",", audioOptions.GetChannels(audio.Channels))
+		if profile := audioOptions.Profile(); profile != "" {
+			master += fmt.Sprintf("URI=\"./audio/%d/%s/index.m3u8\"\n", audio.Index, profile)
+		} else {
+			master += fmt.Sprintf("URI=\"./audio/%d/index.m3u8\"\n", audio.Index)
+		}
+	}
+	if opts.WebVttSubtitles {
+		for _, sub := range fs.getWebVttSubtitles(opts) {
+			master += "#EXT-X-MEDIA:TYPE=SUBTITLES,"
+			master += "GROUP-ID=\"subs\","
+			if sub.Language != nil {
+				master += fmt.Sprintf("LANGUAGE=\"%s\",", *sub.Language)
+			}
+			if sub.Title != nil {
+				master += fmt.Sprintf("NAME=\"%s\",", *sub.Title)
+			} else if sub.Language != nil {
+				master += fmt.Sprintf("NAME=\"%s\",", *sub.Language)
+			} else {
+				master += fmt.Sprintf("NAME=\"Subtitle %d\",", sub.Index)
+			}
+			if sub.IsDefault {
+				master += "DEFAULT=YES,AUTOSELECT=YES,"
+			}
+			if sub.IsForced {
+				master += "FORCED=YES,"
+			}
+			master += fmt.Sprintf("URI=\"./subtitles/%d/index.m3u8\"\n", sub.Index)
+		}
 	}
 	return master
 }
 
+// getAudioOptions returns the options of the audio rendition of a track.
+// The tracks supported by the client are copied when remuxing, unless they're processed.
+func (opts *MasterOptions) getAudioOptions(audio videofile.Audio, remux bool) *AudioOptions {
+	if remux && opts.Audio.IsDefault() && slices.Contains(opts.CopyAudios, int32(audio.Index)) {
+		return &AudioOptions{Codec: AudioCodecCopy}
+	}
+	return opts.Audio
+}
+
+// getAudioMimeCodec returns the codec of an audio rendition, empty if unknown.
+func (fs *FileStream) getAudioMimeCodec(audio videofile.Audio, options *AudioOptions) string {
+	if options.withDefaults().Codec == AudioCodecCopy {
+		return lo.FromPtr(audio.MimeCodec)
+	}
+	return options.GetMimeCodec()
+}
+
+// isRemuxed returns true if the client plays the file in remux mode.
+func (opts *MasterOptions) isRemuxed() bool {
+	return opts != nil && opts.Remux && opts.BurnSubtitle == nil
+}
+
+// codec is the prefix + the level, the level is not part of the codec we want to compare for the same_codec check in getVariantQualities
+const (
+	transmuxPrefix = "avc1.6400"
+	transmuxCodec  = transmuxPrefix + "28"
+)
+
+// getVariantQualities returns the qualities of the video variants listed in the master playlist, from the lowest to the highest.
+// The original quality can't be transmuxed when the subtitles are burned in, every variant is transcoded.
+func (fs *FileStream) getVariantQualities(burn bool) []Quality {
+	if fs.Info.Video == nil {
+		return []Quality{}
+	}
+
+	ret := make([]Quality, 0, len(Qualities)+1)
+	sameCodec := fs.Info.Video.MimeCodec != nil && strings.HasPrefix(*fs.Info.Video.MimeCodec, transmuxPrefix)
+	for _, quality := range Qualities {
+		if burn {
+			if quality.Height() <= fs.Info.Video.Quality.Height() {
+				ret = append(ret, quality)
+			}
+			continue
+		}
+		includeLvl := quality.Height() < fs.Info.Video.Quality.Height() || (quality.Height() == fs.Info.Video.Quality.Height() && !sameCodec)
+		if includeLvl {
+			ret = append(ret, quality)
+		}
+	}
+	if !burn {
+		ret = append(ret, Original)
+	}
+	return ret
+}
+
+// getWebVttSubtitles returns the subtitle tracks listed as WebVTT renditions.
+// The burned-in track is not listed.
+func (fs *FileStream) getWebVttSubtitles(opts *MasterOptions) []videofile.Subtitle {
+	return lo.Filter(fs.Info.Subtitles, func(sub videofile.Subtitle, _ int) bool {
+		if opts.BurnSubtitle != nil && int32(sub.Index) == opts.BurnSubtitle.Index {
+			return false
+		}
+		return sub.Extension != nil && videofile.IsWebVttConvertible(*sub.Extension)
+	})
+}
+
 // GetVideoIndex gets the index of a video stream of a specific quality.
-func (fs *FileStream) GetVideoIndex(quality Quality) (string, error) {
-	stream := fs.getVideoStream(quality)
+func (fs *FileStream) GetVideoIndex(quality Quality, subtitle *BurnSubtitle) (string, error) {
+	stream := fs.getVideoStream(quality, subtitle)
 	return stream.GetIndex()
 }
 
-// getVideoStream gets a video stream of a specific quality.
+// getVideoStream gets a video stream of a specific quality, with the subtitle track burned in if provided.
 // It creates a new stream if it does not exist.
-func (fs *FileStream) getVideoStream(quality Quality) *VideoStream {
-	stream, _ := fs.videos.GetOrSet(quality, func() (*VideoStream, error) {
-		return NewVideoStream(fs, quality, fs.logger, fs.settings), nil
+func (fs *FileStream) getVideoStream(quality Quality, subtitle *BurnSubtitle) *VideoStream {
+	stream, _ := fs.videos.GetOrSet(newVideoKey(quality, subtitle), func() (*VideoStream, error) {
+		return NewVideoStream(fs, quality, subtitle, fs.logger, fs.settings), nil
 	})
 	return stream
 }
@@ -177,7 +301,7 @@ func (fs *FileStream) getVideoStream(quality Quality) *VideoStream {
 //}
 
 // GetVideoSegment gets a segment of a video stream of a specific quality.
-func (fs *FileStream) GetVideoSegment(quality Quality, segment int32) (string, error) {
+func (fs *FileStream) GetVideoSegment(quality Quality, subtitle *BurnSubtitle, segment int32) (string, error) {
 	streamLogger.Debug().Msgf("filestream: Retrieving video segment %d (%s)", segment, quality)
 	// Debug
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
@@ -196,7 +320,7 @@ func (fs *FileStream) GetVideoSegment(quality Quality, segment int32) (string, e
 	// Execute the retrieval operation in a goroutine
 	go func() {
 		defer close(done)
-		stream := fs.getVideoStream(quality)
+		stream := fs.getVideoStream(quality, subtitle)
 		ret, err = stream.GetSegment(segment)
 	}()
 
@@ -210,28 +334,28 @@ func (fs *FileStream) GetVideoSegment(quality Quality, segment int32) (string, e
 }
 
 // GetAudioIndex gets the index of an audio stream of a specific index.
-func (fs *FileStream) GetAudioIndex(audio int32) (string, error) {
-	stream := fs.getAudioStream(audio)
+func (fs *FileStream) GetAudioIndex(audio int32, options *AudioOptions) (string, error) {
+	stream := fs.getAudioStream(audio, options)
 	return stream.GetIndex()
 }
 
 // GetAudioSegment gets a segment of an audio stream of a specific index.
-func (fs *FileStream) GetAudioSegment(audio int32, segment int32) (string, error) {
+func (fs *FileStream) GetAudioSegment(audio int32, options *AudioOptions, segment int32) (string, error) {
 	streamLogger.Debug().Msgf("filestream: Retrieving audio %d segment %d", audio, segment)
 	// Debug
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	debugStreamRequest(fmt.Sprintf("audio %d, segment %d", audio, segment), ctx)
 
-	stream := fs.getAudioStream(audio)
+	stream := fs.getAudioStream(audio, options)
 	return stream.GetSegment(segment)
 }
 
-// getAudioStream gets an audio stream of a specific index.
+// getAudioStream gets an audio stream of a specific index, processed with the given options.
 // It creates a new stream if it does not exist.
-func (fs *FileStream) getAudioStream(audio int32) *AudioStream {
-	stream, _ := fs.audios.GetOrSet(audio, func() (*AudioStream, error) {
-		return NewAudioStream(fs, audio, fs.logger, fs.settings), nil
+func (fs *FileStream) getAudioStream(audio int32, options *AudioOptions) *AudioStream {
+	stream, _ := fs.audios.GetOrSet(newAudioKey(audio, options), func() (*AudioStream, error) {
+		return NewAudioStream(fs, audio, options, fs.logger, fs.settings), nil
 	})
 	return stream
 }
@@ -37,7 +37,7 @@ func QualityFromString(str string) (Quality, error) {
 }
 
 // AverageBitrate
-// Note: Not accurate
+// Note: Not accurate, it's only used until the bitrate of the generated segments is measured (see FileStream.getVariantBitrates)
 func (q Quality) AverageBitrate() uint32 {
 	switch q {
 	case P240:
@@ -0,0 +1,303 @@
+package transcoder
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"seanime/internal/util"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Encoder ID of the segments served from the segment cache
+const cachedEncoderId = -1
+
+type (
+	// SegmentCache keeps the transcoded segments after the sessions end, so that playing a file again doesn't re-encode it.
+	// Segments are stored per file and stream (quality or audio track).
+	// The streams are evicted from the least recently used when the cache exceeds its maximum size.
+	SegmentCache struct {
+		dir      string
+		logger   *zerolog.Logger
+		mu       sync.Mutex
+		maxSize  int64          // Bytes, 0 disables the cache
+		size     int64          // Bytes, -1 if it needs to be computed
+		inUse    map[string]int // Number of file streams per file hash, their segments are not evicted
+		evicting bool
+	}
+
+	cachedStream struct {
+		dir      string
+		hash     string
+		size     int64
+		lastUsed time.Time
+	}
+)
+
+// GetSegmentCacheDir returns the directory of the segment cache.
+func GetSegmentCacheDir(cacheDir string) string {
+	return filepath.Join(cacheDir, "segments")
+}
+
+func NewSegmentCache(cacheDir string, maxSize int64, logger *zerolog.Logger) *SegmentCache {
+	return &SegmentCache{
+		dir:     GetSegmentCacheDir(cacheDir),
+		logger:  logger,
+		maxSize: max(maxSize, 0),
+		size:    -1,
+		inUse:   make(map[string]int),
+	}
+}
+
+// SetMaxSize updates the maximum size of the cache and evicts the streams that no longer fit.
+func (c *SegmentCache) SetMaxSize(maxSize int64) {
+	c.mu.Lock()
+	c.maxSize = max(maxSize, 0)
+	c.mu.Unlock()
+
+	go c.evict()
+}
+
+// Reset should be called when the cache directory is cleared externally.
+func (c *SegmentCache) Reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = -1
+}
+
+func (c *SegmentCache) isEnabled() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxSize > 0
+}
+
+// acquire protects the streams of a file from eviction while it's being played.
+func (c *SegmentCache) acquire(hash string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inUse[hash]++
+}
+
+func (c *SegmentCache) release(hash string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inUse[hash] <= 1 {
+		delete(c.inUse, hash)
+		return
+	}
+	c.inUse[hash]--
+}
+
+func (c *SegmentCache) getStreamDir(hash string, key string) string {
+	return filepath.Join(c.dir, hash, key)
+}
+
+// getSegmentPathFormat returns the path of the cached segments of a stream, with a %d for the segment number.
+func (c *SegmentCache) getSegmentPathFormat(hash string, key string) string {
+	return filepath.Join(c.getStreamDir(hash, key), "segment-%d.ts")
+}
+
+// getSegments returns the cached segments of a stream and marks it as recently used.
+func (c *SegmentCache) getSegments(hash string, key string) map[int32]struct{} {
+	ret := make(map[int32]struct{})
+	if !c.isEnabled() {
+		return ret
+	}
+
+	dir := c.getStreamDir(hash, key)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ret
+	}
+	now := time.Now()
+	_ = os.Chtimes(dir, now, now)
+
+	for _, entry := range entries {
+		var segment int32
+		if n, _ := fmt.Sscanf(entry.Name(), "segment-%d.ts", &segment); n == 1 && filepath.Ext(entry.Name()) == ".ts" {
+			ret[segment] = struct{}{}
+		}
+	}
+	return ret
+}
+
+// add stores a segment in the cache.
+// The segment is hard linked when the transcode directory is on the same device, it's copied otherwise.
+func (c *SegmentCache) add(hash string, key string, segment int32, src string) {
+	if !c.isEnabled() {
+		return
+	}
+
+	dst := fmt.Sprintf(c.getSegmentPathFormat(hash, key), segment)
+	if _, err := os.Stat(dst); err == nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return
+	}
+
+	// Write under a temporary name so that a partial segment is never served
+	tmp := dst + ".tmp"
+	if err := os.Link(src, tmp); err != nil {
+		if err := util.CopyFile(src, tmp); err != nil {
+			_ = os.Remove(tmp)
+			return
+		}
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.size >= 0 {
+		c.size += info.Size()
+	}
+	shouldEvict := c.size < 0 || c.size > c.maxSize
+	c.mu.Unlock()
+
+	if shouldEvict {
+		c.evict()
+	}
+}
+
+// evict removes the least recently used streams until the cache fits in its maximum size.
+// The streams of the files being played are kept.
+func (c *SegmentCache) evict() {
+	c.mu.Lock()
+	if c.evicting {
+		c.mu.Unlock()
+		return
+	}
+	c.evicting = true
+	maxSize := c.maxSize
+	inUse := maps.Clone(c.inUse)
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.evicting = false
+		c.mu.Unlock()
+	}()
+
+	streams, total := c.getStreams()
+
+	slices.SortFunc(streams, func(a, b *cachedStream) int {
+		return a.lastUsed.Compare(b.lastUsed)
+	})
+
+	for _, s := range streams {
+		if total <= maxSize {
+			break
+		}
+		if _, found := inUse[s.hash]; found {
+			continue
+		}
+		if err := os.RemoveAll(s.dir); err != nil {
+			c.logger.Warn().Err(err).Str("dir", s.dir).Msg("transcoder: Failed to evict cached segments")
+			continue
+		}
+		total -= s.size
+		c.logger.Debug().Str("hash", s.hash).Str("stream", filepath.Base(s.dir)).Msg("transcoder: Evicted cached segments")
+		// Remove the directory of the file once all its streams are evicted
+		_ = os.Remove(filepath.Dir(s.dir))
+	}
+
+	c.mu.Lock()
+	c.size = total
+	c.mu.Unlock()
+}
+
+// getStreams returns the cached streams and the total size of the cache.
+func (c *SegmentCache) getStreams() ([]*cachedStream, int64) {
+	ret := make([]*cachedStream, 0)
+	var total int64
+
+	hashDirs, err := os.ReadDir(c.dir)
+	if err != nil {
+		return ret, 0
+	}
+	for _, hashDir := range hashDirs {
+		if !hashDir.IsDir() {
+			continue
+		}
+		streamDirs, err := os.ReadDir(filepath.Join(c.dir, hashDir.Name()))
+		if err != nil {
+			continue
+		}
+		for _, streamDir := range streamDirs {
+			info, err := streamDir.Info()
+			if err != nil || !streamDir.IsDir() {
+				continue
+			}
+			s := &cachedStream{
+				dir:      filepath.Join(c.dir, hashDir.Name(), streamDir.Name()),
+				hash:     hashDir.Name(),
+				lastUsed: info.ModTime(),
+			}
+			segments, _ := os.ReadDir(s.dir)
+			for _, segment := range segments {
+				if info, err := segment.Info(); err == nil && !segment.IsDir() {
+					s.size += info.Size()
+				}
+			}
+			total += s.size
+			ret = append(ret, s)
+		}
+	}
+	return ret, total
+}
+
+/////////////
+
+// markCachedSegments marks the segments from the cache as ready, starting at the given segment.
+// The stream segments are assumed to be locked.
+func (ts *Stream) markCachedSegments(from int) {
+	if len(ts.cached) == 0 {
+		return
+	}
+	format := ts.settings.SegmentCache.getSegmentPathFormat(ts.file.sha, ts.handle.getCacheKey())
+	for seg := from; seg < len(ts.segments); seg++ {
+		if _, found := ts.cached[int32(seg)]; !found {
+			continue
+		}
+		ts.segments[seg].encoder = cachedEncoderId
+		close(ts.segments[seg].channel)
+		ts.recordSegment(format, int32(seg))
+	}
+}
+
+// getSegmentPath returns the path of a ready segment.
+func (ts *Stream) getSegmentPath(segment int32) string {
+	encoderId := ts.segments[segment].encoder
+	if encoderId == cachedEncoderId {
+		return fmt.Sprintf(filepath.ToSlash(ts.settings.SegmentCache.getSegmentPathFormat(ts.file.sha, ts.handle.getCacheKey())), segment)
+	}
+	return fmt.Sprintf(filepath.ToSlash(ts.handle.getOutPath(encoderId)), segment)
+}
+
+// cacheSegment stores a segment once it's ready.
+func (ts *Stream) cacheSegment(outpath string, segment int32) {
+	ts.settings.SegmentCache.add(ts.file.sha, ts.handle.getCacheKey(), segment, fmt.Sprintf(outpath, segment))
+}
@@ -0,0 +1,90 @@
+package transcoder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestSegment(t *testing.T, dir string, size int) string {
+	f, err := os.CreateTemp(dir, "segment-*.ts")
+	require.NoError(t, err)
+	_, err = f.Write(make([]byte, size))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return f.Name()
+}
+
+func TestSegmentCache_Eviction(t *testing.T) {
+	transcodeDir := t.TempDir()
+	c := NewSegmentCache(t.TempDir(), 1024*1024, util.NewLogger())
+
+	src := writeTestSegment(t, transcodeDir, 400*1024)
+
+	c.add("a", "video-720p", 0, src)
+	c.add("a", "video-720p", 1, src)
+	assert.Equal(t, map[int32]struct{}{0: {}, 1: {}}, c.getSegments("a", "video-720p"))
+
+	c.add("b", "audio-0", 0, src)
+	// Mark the stream of "b" as the least recently used, it's still kept while "b" is being played
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(c.getStreamDir("b", "audio-0"), past, past))
+	c.acquire("b")
+
+	c.add("c", "video-480p", 0, src)
+
+	assert.DirExists(t, c.getStreamDir("b", "audio-0"))
+	assert.NoDirExists(t, c.getStreamDir("a", "video-720p"), "least recently used stream")
+	assert.DirExists(t, c.getStreamDir("c", "video-480p"))
+
+	// Once released, "b" is evicted first
+	c.release("b")
+	c.acquire("c")
+	c.add("c", "video-480p", 1, src)
+	assert.NoDirExists(t, filepath.Join(c.dir, "b"))
+	assert.Len(t, c.getSegments("c", "video-480p"), 2)
+
+	// The stream being played can exceed the maximum size until it's released
+	c.add("c", "video-480p", 2, src)
+	assert.Len(t, c.getSegments("c", "video-480p"), 3)
+}
+
+func TestSegmentCache_Disabled(t *testing.T) {
+	c := NewSegmentCache(t.TempDir(), 0, util.NewLogger())
+
+	c.add("a", "audio-0", 0, writeTestSegment(t, t.TempDir(), 1024))
+	assert.Empty(t, c.getSegments("a", "audio-0"))
+	assert.NoDirExists(t, c.getStreamDir("a", "audio-0"))
+}
+
+func TestStream_CachedSegments(t *testing.T) {
+	c := NewSegmentCache(t.TempDir(), 1024*1024, util.NewLogger())
+	c.add("hash", "audio-1", 1, writeTestSegment(t, t.TempDir(), 1024))
+
+	settings := &Settings{StreamDir: t.TempDir(), SegmentCache: c}
+	fs := &FileStream{
+		sha:       "hash",
+		Out:       filepath.Join(settings.StreamDir, "hash"),
+		Keyframes: &Keyframe{Keyframes: []float64{0, 4, 8}, IsDone: true, info: &KeyframeInfo{}},
+		Info:      &videofile.MediaInfo{Duration: 12},
+		settings:  settings,
+	}
+
+	as := NewAudioStream(fs, 1, nil, util.NewLogger(), settings)
+
+	assert.False(t, as.isSegmentReady(0))
+	assert.True(t, as.isSegmentReady(1))
+	assert.False(t, as.isSegmentReady(2))
+	assert.Equal(t, filepath.ToSlash(fmt.Sprintf(c.getSegmentPathFormat("hash", "audio-1"), 1)), as.getSegmentPath(1))
+
+	// Cached segments of other streams are not used
+	other := NewAudioStream(fs, 0, nil, util.NewLogger(), settings)
+	assert.False(t, other.isSegmentReady(1))
+}
@@ -32,7 +32,9 @@ const (
 type StreamHandle interface {
 	getTranscodeArgs(segments string) []string
 	getOutPath(encoderId int) string
+	getDecodeFlags() []string
 	getFlags() Flags
+	getCacheKey() string
 }
 
 type Stream struct {
@@ -47,6 +49,11 @@ type Stream struct {
 	segmentsLock sync.RWMutex
 	headsLock    sync.RWMutex
 
+	// measured bitrate of the generated segments
+	bitrate bitrateStats
+	// segments found in the segment cache, they're not encoded again
+	cached map[int32]struct{}
+
 	logger   *zerolog.Logger
 	settings *Settings
 	killCh   chan struct{}
@@ -104,6 +111,10 @@ func NewStream(
 		ret.segments[seg].channel = make(chan struct{})
 	}
 
+	// Reuse the segments of the previous sessions
+	ret.cached = settings.SegmentCache.getSegments(file.sha, handle.getCacheKey())
+	ret.markCachedSegments(0)
+
 	if !isDone {
 		file.Keyframes.AddListener(func(keyframes []float64) {
 			ret.segmentsLock.Lock()
@@ -117,6 +128,7 @@ func NewStream(
 			for seg := oldLength; seg < len(keyframes); seg++ {
 				ret.segments[seg].channel = make(chan struct{})
 			}
+			ret.markCachedSegments(oldLength)
 		})
 	}
 }
@@ -204,7 +216,7 @@ func (ts *Stream) GetSegment(segment int32) (string, error) {
 	}
 	//go ts.prepareNextSegments(segment)
 	ts.prepareNextSegments(segment)
-	return fmt.Sprintf(filepath.ToSlash(ts.handle.getOutPath(ts.segments[segment].encoder)), segment), nil
+	return ts.getSegmentPath(segment), nil
 }
 
 // prepareNextSegments will start the next segments if they are not already started.
@@ -242,6 +254,31 @@ func (ts *Stream) prepareNextSegments(segment int32) {
 	}
 }
 
+// warm starts an encoder at the segment if no encoder is about to reach it.
+// It's used to keep the qualities a client could switch to ready.
+func (ts *Stream) warm(segment int32) {
+	ts.segmentsLock.RLock()
+	ts.headsLock.RLock()
+	if segment < 0 || segment >= int32(len(ts.segments)) {
+		ts.headsLock.RUnlock()
+		ts.segmentsLock.RUnlock()
+		return
+	}
+	ready := ts.isSegmentReady(segment)
+	distance := ts.getMinEncoderDistance(segment)
+	ts.headsLock.RUnlock()
+	ts.segmentsLock.RUnlock()
+
+	if ready || distance <= 60 {
+		return
+	}
+
+	streamLogger.Trace().Msgf("transcoder: Warming %s stream at segment %d", ts.kind, segment)
+	go func() {
+		_ = ts.run(segment)
+	}()
+}
+
 func (ts *Stream) getMinEncoderDistance(segment int32) float64 {
 	t := ts.file.Keyframes.Get(segment)
 	distances := lop.Map(ts.heads, func(head Head, _ int) float64 {
@@ -283,16 +320,15 @@ func (ts *Stream) IsKilled() bool {
 func (ts *Stream) KillHead(encoderId int) {
 	//streamLogger.Trace().Int("eid", encoderId).Msgf("transcoder: Killing %s encoder head", ts.kind)
 	defer streamLogger.Trace().Int("eid", encoderId).Msgf("transcoder: Killed %s encoder head", ts.kind)
-	defer func() {
-		if r := recover(); r != nil {
-		}
-	}()
-	close(ts.killCh)
+	// The kill channel is shared by all the heads of the stream, it's only closed once per kill cycle
+	if !ts.IsKilled() {
+		close(ts.killCh)
+	}
 	ts.cancel()
-	if ts.heads[encoderId] == DeletedHead || ts.heads[encoderId].command == nil {
+	if ts.heads[encoderId] == DeletedHead || ts.heads[encoderId].command == nil || ts.heads[encoderId].command.Process == nil {
 		return
 	}
-	ts.heads[encoderId].command.Process.Signal(os.Interrupt)
+	_ = ts.heads[encoderId].command.Process.Signal(os.Interrupt)
 	//_, _ = ts.heads[encoderId].stdin.Write([]byte("q"))
 	//_ = ts.heads[encoderId].stdin.Close()
 
@@ -364,6 +400,14 @@ func (ts *Stream) run(start int32) error {
 	ts.lockHeads()
 	encoderId := len(ts.heads)
 	ts.heads = append(ts.heads, Head{segment: start, end: end, command: nil})
+	// The context is canceled and the kill channel closed when the stream is killed, the new encoder needs live ones
+	if ts.ctx.Err() != nil {
+		ts.ctx, ts.cancel = context.WithCancel(context.Background())
+	}
+	if ts.IsKilled() {
+		ts.killCh = make(chan struct{})
+	}
+	ctx := ts.ctx
 	ts.unlockHeads()
 
 	streamLogger.Trace().Any("eid", encoderId).Msgf(
@@ -421,7 +465,7 @@ func (ts *Stream) run(start int32) error {
 		"-nostats", "-hide_banner", "-loglevel", "warning",
 	}
 
-	args = append(args, ts.settings.HwAccel.DecodeFlags...)
+	args = append(args, ts.handle.getDecodeFlags()...)
 
 	if startRef != 0 {
 		if ts.handle.getFlags()&VideoF != 0 {
@@ -519,6 +563,7 @@ func (ts *Stream) run(start int32) error {
 
 		for scanner.Scan() {
 			var segment int32
+			recorded := false
 			_, _ = fmt.Sscanf(scanner.Text(), format, &segment)
 
 			// If the segment number is less than the starting segment (start), it means it's not relevant for the current processing, so we skip it
@@ -549,6 +594,7 @@ func (ts *Stream) run(start int32) error {
 				// Mark the segment as ready
 				ts.segments[segment].encoder = encoderId
 				close(ts.segments[segment].channel)
+				recorded = true
 				if segment == end-1 {
 					// file finished, ffmpeg will finish soon on its own
 					shouldStop = true
@@ -564,6 +610,10 @@ func (ts *Stream) run(start int32) error {
 				}
 			}
 			ts.unlockSegments()
+			if recorded {
+				ts.recordSegment(outpath, segment)
+				go ts.cacheSegment(outpath, segment)
+			}
 			// we need this and not a return in the condition because we want to unlock
 			// the lock (and can't defer since this is a loop)
 			if shouldStop {
@@ -583,7 +633,7 @@ func (ts *Stream) run(start int32) error {
 	// Listen for kill signal
 	go func(stdin io.WriteCloser) {
 		select {
-		case <-ts.ctx.Done():
+		case <-ctx.Done():
 			streamLogger.Trace().Int("eid", encoderId).Msgf("transcoder: Aborting ffmpeg process for %s", ts.kind)
 			_, _ = stdin.Write([]byte("q"))
 			_ = stdin.Close()
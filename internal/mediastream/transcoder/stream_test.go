@@ -0,0 +1,78 @@
+package transcoder
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFakeFfmpeg writes an executable that blocks like a running encode until it's interrupted.
+func writeFakeFfmpeg(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\nexec sleep 30\n"), 0755))
+	return path
+}
+
+func TestStream_KillWarmKill(t *testing.T) {
+	settings := &Settings{StreamDir: t.TempDir(), FfmpegPath: writeFakeFfmpeg(t)}
+	fs := &FileStream{
+		sha:       "hash",
+		Out:       filepath.Join(settings.StreamDir, "hash"),
+		Keyframes: &Keyframe{Keyframes: []float64{0, 4, 8}, IsDone: true, info: &KeyframeInfo{}},
+		Info:      &videofile.MediaInfo{Duration: 12},
+		settings:  settings,
+	}
+	as := NewAudioStream(fs, 0, nil, util.NewLogger(), settings)
+
+	// Waits for the encoder head to be started and returns its process
+	waitForHead := func(id int) *os.Process {
+		var process *os.Process
+		require.Eventually(t, func() bool {
+			as.lockHeads()
+			defer as.unlockHeads()
+			if len(as.heads) <= id || as.heads[id].command == nil {
+				return false
+			}
+			process = as.heads[id].command.Process
+			return true
+		}, 5*time.Second, 10*time.Millisecond)
+		return process
+	}
+	// Waits for the encoder head to be marked as deleted once its process exits
+	waitForExit := func(id int) {
+		require.Eventually(t, func() bool {
+			as.lockHeads()
+			defer as.unlockHeads()
+			return as.heads[id] == DeletedHead
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	as.warm(0)
+	waitForHead(0)
+
+	as.Kill()
+	assert.True(t, as.IsKilled())
+	waitForExit(0)
+
+	// Warming a killed stream starts a head that can be killed again
+	as.warm(0)
+	waitForHead(1)
+	assert.False(t, as.IsKilled())
+
+	assert.NotPanics(t, as.Kill)
+	assert.True(t, as.IsKilled())
+	waitForExit(1)
+
+	// Killing an already killed stream is a no-op
+	assert.NotPanics(t, as.Kill)
+}
@@ -0,0 +1,79 @@
+package transcoder
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// BurnSubtitle is a subtitle track rendered into the video stream.
+	// It's used by clients that can't render the subtitles themselves (e.g. ASS with embedded fonts on TVs).
+	BurnSubtitle struct {
+		Index    int32  // Index of the subtitle track in the media information
+		Path     string // Path of the extracted subtitle file
+		FontsDir string // Directory of the extracted fonts
+	}
+
+	// MasterOptions are the options of a session, selected when requesting the master playlist.
+	MasterOptions struct {
+		// The video variants have the subtitle track burned in
+		BurnSubtitle *BurnSubtitle
+		// The text subtitle tracks are listed as WebVTT renditions
+		WebVttSubtitles bool
+		// Processing of the audio renditions, nil for the default stereo AAC encode
+		Audio *AudioOptions
+		// Only the original quality is listed, the video stream is copied
+		Remux bool
+		// Indexes of the audio tracks copied when remuxing, the other tracks are encoded
+		CopyAudios []int32
+	}
+
+	// videoKey identifies a video stream of a file.
+	videoKey struct {
+		quality  Quality
+		subtitle int32 // -1 if no subtitle track is burned in
+	}
+)
+
+func newVideoKey(quality Quality, subtitle *BurnSubtitle) videoKey {
+	if subtitle == nil {
+		return videoKey{quality: quality, subtitle: -1}
+	}
+	return videoKey{quality: quality, subtitle: subtitle.Index}
+}
+
+// getSubtitlesFilter returns the filter that renders the subtitle track onto the video frames.
+// The frames keep their original timestamps (-copyts), so the subtitles are in sync after seeking.
+func (s *BurnSubtitle) getSubtitlesFilter() string {
+	ret := fmt.Sprintf("subtitles=filename='%s'", escapeFilterPath(s.Path))
+	if s.FontsDir != "" {
+		ret += fmt.Sprintf(":fontsdir='%s'", escapeFilterPath(s.FontsDir))
+	}
+	return ret
+}
+
+// escapeFilterPath escapes a path used as a filter option.
+// Quoting protects the filtergraph separators, but the option separator ':' still needs to be escaped (e.g. "C:/").
+func escapeFilterPath(path string) string {
+	path = filepath.ToSlash(path)
+	path = strings.ReplaceAll(path, `'`, `'\''`)
+	path = strings.ReplaceAll(path, ":", `\:`)
+	return path
+}
+
+// GetSubtitleIndex returns the playlist of a WebVTT subtitle rendition.
+// The whole track is served as a single segment spanning the file.
+func (fs *FileStream) GetSubtitleIndex() string {
+	duration := float64(fs.Info.Duration)
+	index := "#EXTM3U\n"
+	index += "#EXT-X-VERSION:3\n"
+	index += fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(duration)))
+	index += "#EXT-X-MEDIA-SEQUENCE:0\n"
+	index += "#EXT-X-PLAYLIST-TYPE:VOD\n"
+	index += fmt.Sprintf("#EXTINF:%.6f,\n", duration)
+	index += "subtitles.vtt\n"
+	index += "#EXT-X-ENDLIST"
+	return index
+}
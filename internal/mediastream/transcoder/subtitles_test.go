@@ -0,0 +1,57 @@
+package transcoder
+
+import (
+	"seanime/internal/mediastream/videofile"
+	"seanime/internal/util/result"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStream_GetMaster_Subtitles(t *testing.T) {
+	fs := &FileStream{
+		videos: result.NewResultMap[videoKey, *VideoStream](),
+		Info: &videofile.MediaInfo{
+			Duration: 1420,
+			Video: &videofile.Video{
+				Quality: videofile.P720,
+				Width:   1280,
+				Height:  720,
+				Bitrate: 2_000_000,
+			},
+			Audios: []videofile.Audio{{Index: 0, Language: lo.ToPtr("ja")}},
+			Subtitles: []videofile.Subtitle{
+				{Index: 0, Language: lo.ToPtr("en"), Extension: lo.ToPtr("ass"), IsDefault: true},
+				{Index: 1, Title: lo.ToPtr("Signs"), Extension: lo.ToPtr("srt")},
+			},
+		},
+	}
+
+	master := fs.GetMaster(&MasterOptions{
+		BurnSubtitle:    &BurnSubtitle{Index: 0},
+		WebVttSubtitles: true,
+	})
+
+	// Every variant is transcoded with the subtitle track burned in
+	assert.NotContains(t, master, "./original/index.m3u8")
+	assert.Contains(t, master, "./burn/0/720p/index.m3u8")
+	assert.Contains(t, master, "./burn/0/240p/index.m3u8")
+	assert.NotContains(t, master, "1080p")
+
+	// The burned-in track is not listed as a rendition
+	assert.Contains(t, master, `SUBTITLES="subs"`)
+	assert.NotContains(t, master, `URI="./subtitles/0/index.m3u8"`)
+	assert.Contains(t, master, `#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Signs",URI="./subtitles/1/index.m3u8"`)
+
+	// Without options, the playlist is unchanged
+	master = fs.GetMaster(nil)
+	assert.Contains(t, master, "./original/index.m3u8")
+	assert.False(t, strings.Contains(master, "SUBTITLES"))
+}
+
+func TestBurnSubtitle_GetSubtitlesFilter(t *testing.T) {
+	s := &BurnSubtitle{Index: 2, Path: "C:/cache/videofiles/abc/subs/2.ass", FontsDir: "C:/cache/videofiles/abc/att"}
+	assert.Equal(t, `subtitles=filename='C\:/cache/videofiles/abc/subs/2.ass':fontsdir='C\:/cache/videofiles/abc/att'`, s.getSubtitlesFilter())
+}
@@ -1,16 +1,25 @@
 package transcoder
 
 import (
-	"github.com/rs/zerolog"
+	"slices"
 	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 )
 
 type ClientInfo struct {
 	client  string
 	path    string
 	quality *Quality
-	audio   int32
-	head    int32
+	// The subtitle track burned in the video stream, -1 if none
+	subtitle int32
+	audio    int32
+	// The profile of the audio options, see AudioOptions.Profile
+	audioProfile string
+	head         int32
+	// Whether the client plays the file in remux mode, nil if not reported by the request
+	remux *bool
 }
 
 type Tracker struct {
@@ -69,13 +78,18 @@ func (t *Tracker) start() {
 			if ok && old.path == info.path {
 				if info.quality == nil {
 					info.quality = old.quality
+					info.subtitle = old.subtitle
 				}
 				if info.audio == -1 {
 					info.audio = old.audio
+					info.audioProfile = old.audioProfile
 				}
 				if info.head == -1 {
 					info.head = old.head
 				}
+				if info.remux == nil {
+					info.remux = old.remux
+				}
 			}
 
 			t.clients[info.client] = info
@@ -84,19 +98,24 @@ func (t *Tracker) start() {
 
 			// now that the new info is stored and fixed, kill old streams
 			if ok && old.path == info.path {
-				if old.audio != info.audio && old.audio != -1 {
-					t.KillAudioIfDead(old.path, old.audio)
+				if (old.audio != info.audio || old.audioProfile != info.audioProfile) && old.audio != -1 {
+					t.KillAudioIfDead(old.path, old.audio, old.audioProfile)
 				}
-				if old.quality != info.quality && old.quality != nil {
-					t.KillQualityIfDead(old.path, *old.quality)
+				if old.quality != nil && (info.quality == nil || *old.quality != *info.quality || old.subtitle != info.subtitle) {
+					t.KillUnwatchedQualities(old.path)
 				}
 				if old.head != -1 && Abs(info.head-old.head) > 100 {
-					t.KillOrphanedHeads(old.path, old.quality, old.audio)
+					t.KillOrphanedHeads(old.path, old.quality, old.subtitle, old.audio, old.audioProfile)
 				}
 			} else if ok {
 				t.KillStreamIfDead(old.path)
 			}
 
+			// Keep the neighboring qualities ready so that the player can switch on bandwidth
+			if info.quality != nil && info.head != -1 {
+				t.WarmNeighborQualities(info)
+			}
+
 		case <-timer.C:
 			// Purge old clients
 			for client, date := range t.visitDate {
@@ -107,10 +126,10 @@ func (t *Tracker) start() {
 				info := t.clients[client]
 
 				if !t.KillStreamIfDead(info.path) {
-					audioCleanup := info.audio != -1 && t.KillAudioIfDead(info.path, info.audio)
-					videoCleanup := info.quality != nil && t.KillQualityIfDead(info.path, *info.quality)
+					audioCleanup := info.audio != -1 && t.KillAudioIfDead(info.path, info.audio, info.audioProfile)
+					videoCleanup := info.quality != nil && t.KillQualityIfDead(info.path, *info.quality, info.subtitle)
 					if !audioCleanup || !videoCleanup {
-						t.KillOrphanedHeads(info.path, info.quality, info.audio)
+						t.KillOrphanedHeads(info.path, info.quality, info.subtitle, info.audio, info.audioProfile)
 					}
 				}
 
@@ -161,9 +180,9 @@ func (t *Tracker) DestroyStreamIfOld(path string) {
 	stream.Destroy()
 }
 
-func (t *Tracker) KillAudioIfDead(path string, audio int32) bool {
+func (t *Tracker) KillAudioIfDead(path string, audio int32, profile string) bool {
 	for _, stream := range t.clients {
-		if stream.path == path && stream.audio == audio {
+		if stream.path == path && stream.audio == audio && stream.audioProfile == profile {
 			return false
 		}
 	}
@@ -173,7 +192,7 @@ func (t *Tracker) KillAudioIfDead(path string, audio int32) bool {
 	if !ok {
 		return false
 	}
-	astream, aok := stream.audios.Get(audio)
+	astream, aok := stream.audios.Get(audioKey{index: audio, profile: profile})
 	if !aok {
 		return false
 	}
@@ -181,11 +200,9 @@ func (t *Tracker) KillAudioIfDead(path string, audio int32) bool {
 	return true
 }
 
-func (t *Tracker) KillQualityIfDead(path string, quality Quality) bool {
-	for _, stream := range t.clients {
-		if stream.path == path && stream.quality != nil && *stream.quality == quality {
-			return false
-		}
+func (t *Tracker) KillQualityIfDead(path string, quality Quality, subtitle int32) bool {
+	if t.isQualityWatched(path, quality, subtitle) {
+		return false
 	}
 	//start := time.Now()
 	t.logger.Trace().Msgf("transcoder: Killing %s video stream ", quality)
@@ -194,7 +211,7 @@ func (t *Tracker) KillQualityIfDead(path string, quality Quality) bool {
 	if !ok {
 		return false
 	}
-	vstream, vok := stream.videos.Get(quality)
+	vstream, vok := stream.videos.Get(videoKey{quality: quality, subtitle: subtitle})
 	if !vok {
 		return false
 	}
@@ -204,20 +221,91 @@ func (t *Tracker) KillQualityIfDead(path string, quality Quality) bool {
 	return true
 }
 
-func (t *Tracker) KillOrphanedHeads(path string, quality *Quality, audio int32) {
+// KillUnwatchedQualities kills the video streams of a file that no client is watching or could switch to.
+func (t *Tracker) KillUnwatchedQualities(path string) {
+	stream, ok := t.transcoder.streams.Get(path)
+	if !ok {
+		return
+	}
+	stream.videos.Range(func(key videoKey, _ *VideoStream) bool {
+		t.KillQualityIfDead(path, key.quality, key.subtitle)
+		return true
+	})
+}
+
+// isQualityWatched returns true if a client is watching the quality or one of its neighbors.
+func (t *Tracker) isQualityWatched(path string, quality Quality, subtitle int32) bool {
+	for _, info := range t.clients {
+		if info.path != path || info.quality == nil || info.subtitle != subtitle {
+			continue
+		}
+		if *info.quality == quality || slices.Contains(t.getNeighborQualities(info), quality) {
+			return true
+		}
+	}
+	return false
+}
+
+// getNeighborQualities returns the qualities right below and above the one watched by a client, among the variants of the file.
+func (t *Tracker) getNeighborQualities(info ClientInfo) []Quality {
+	stream, ok := t.transcoder.streams.Get(info.path)
+	if !ok || info.quality == nil {
+		return []Quality{}
+	}
+
+	variants := stream.getVariantQualities(info.subtitle != -1)
+	idx := slices.Index(variants, *info.quality)
+	if idx == -1 {
+		return []Quality{}
+	}
+
+	ret := make([]Quality, 0, 2)
+	if idx > 0 {
+		ret = append(ret, variants[idx-1])
+	}
+	if idx < len(variants)-1 {
+		ret = append(ret, variants[idx+1])
+	}
+	return ret
+}
+
+// WarmNeighborQualities starts the encoders of the neighboring qualities at the position of the client.
+// Nothing is warmed when the file is remuxed, the client only plays the original quality.
+func (t *Tracker) WarmNeighborQualities(info ClientInfo) {
+	if !t.transcoder.settings.WarmQualities {
+		return
+	}
+	if lo.FromPtr(info.remux) {
+		return
+	}
+	stream, ok := t.transcoder.streams.Get(info.path)
+	if !ok {
+		return
+	}
+	vstream, ok := stream.videos.Get(videoKey{quality: *info.quality, subtitle: info.subtitle})
+	if !ok {
+		return
+	}
+
+	for _, quality := range t.getNeighborQualities(info) {
+		stream.getVideoStream(quality, vstream.subtitle).warm(info.head)
+	}
+}
+
+func (t *Tracker) KillOrphanedHeads(path string, quality *Quality, subtitle int32, audio int32, audioProfile string) {
 	stream, ok := t.transcoder.streams.Get(path)
 	if !ok {
 		return
 	}
 
 	if quality != nil {
-		vstream, vok := stream.videos.Get(*quality)
+		vstream, vok := stream.videos.Get(videoKey{quality: *quality, subtitle: subtitle})
 		if vok {
 			t.killOrphanedHeads(&vstream.Stream)
 		}
 	}
 	if audio != -1 {
-		astream, aok := stream.audios.Get(audio)
+		astream, aok := stream.audios.Get(audioKey{index: audio, profile: audioProfile})
 		if aok {
 			t.killOrphanedHeads(&astream.Stream)
 		}
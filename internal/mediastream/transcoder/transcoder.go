@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 )
 
 type (
@@ -23,10 +24,13 @@ type (
 	}
 
 	Settings struct {
-		StreamDir   string
-		HwAccel     HwAccelSettings
-		FfmpegPath  string
-		FfprobePath string
+		StreamDir    string
+		HwAccel      HwAccelSettings
+		FfmpegPath   string
+		FfprobePath  string
+		SegmentCache *SegmentCache // Shared by the transcoders, nil if segments are not cached
+		// WarmQualities starts the encoders of the neighboring qualities so that ABR switches are instant
+		WarmQualities bool
 	}
 
 	NewTranscoderOptions struct {
@@ -37,6 +41,8 @@ type (
 		FfmpegPath            string
 		FfprobePath           string
 		HwAccelCustomSettings string
+		SegmentCache          *SegmentCache
+		WarmQualities         bool
 	}
 )
 
@@ -66,8 +72,10 @@ func NewTranscoder(opts *NewTranscoderOptions) (*Transcoder, error) {
 				Preset:         opts.Preset,
 				CustomSettings: opts.HwAccelCustomSettings,
 			}),
-			FfmpegPath:  opts.FfmpegPath,
-			FfprobePath: opts.FfprobePath,
+			FfmpegPath:    opts.FfmpegPath,
+			FfprobePath:   opts.FfprobePath,
+			SegmentCache:  opts.SegmentCache,
+			WarmQualities: opts.WarmQualities,
 		},
 	}
 	ret.tracker = NewTracker(ret)
@@ -115,12 +123,13 @@ func (t *Transcoder) getFileStream(path string, hash string, mediaInfo *videofil
 	ret.ready.Wait()
 	if ret.err != nil {
 		t.streams.Delete(path)
+		t.settings.SegmentCache.release(hash)
 		return nil, ret.err
 	}
 	return ret, nil
 }
 
-func (t *Transcoder) GetMaster(path string, hash string, mediaInfo *videofile.MediaInfo, client string) (string, error) {
+func (t *Transcoder) GetMaster(path string, hash string, mediaInfo *videofile.MediaInfo, opts *MasterOptions, client string) (string, error) {
 	if debugStream {
 		start := time.Now()
 		t.logger.Trace().Msgf("transcoder: Retrieving master file")
@@ -131,22 +140,39 @@ func (t *Transcoder) GetMaster(path string, hash string, mediaInfo *videofile.Me
 		return "", err
 	}
 	t.clientChan <- ClientInfo{
-		client:  client,
-		path:    path,
-		quality: nil,
-		audio:   -1,
-		head:    -1,
+		client:   client,
+		path:     path,
+		quality:  nil,
+		subtitle: -1,
+		audio:    -1,
+		head:     -1,
+		remux:    lo.ToPtr(opts.isRemuxed()),
 	}
-	return stream.GetMaster(), nil
+	return stream.GetMaster(opts), nil
 }
 
+// GetSubtitleIndex returns the playlist of a WebVTT subtitle rendition.
+func (t *Transcoder) GetSubtitleIndex(path string, hash string, mediaInfo *videofile.MediaInfo) (string, error) {
+	stream, err := t.getFileStream(path, hash, mediaInfo)
+	if err != nil {
+		return "", err
+	}
+	return stream.GetSubtitleIndex(), nil
+}
+
+// GetVideoIndex returns the playlist of a video stream.
+// The subtitle track is burned in if provided.
 func (t *Transcoder) GetVideoIndex(
 	path string,
 	hash string,
 	mediaInfo *videofile.MediaInfo,
 	quality Quality,
+	subtitle *BurnSubtitle,
 	client string,
 ) (string, error) {
+	if subtitle != nil && quality == Original {
+		return "", fmt.Errorf("cannot burn subtitles in the original quality")
+	}
 	if debugStream {
 		start := time.Now()
 		t.logger.Trace().Msgf("transcoder: Retrieving video index file (%s)", quality)
@@ -157,13 +183,14 @@ func (t *Transcoder) GetVideoIndex(
 		return "", err
 	}
 	t.clientChan <- ClientInfo{
-		client:  client,
-		path:    path,
-		quality: &quality,
-		audio:   -1,
-		head:    -1,
+		client:   client,
+		path:     path,
+		quality:  &quality,
+		subtitle: newVideoKey(quality, subtitle).subtitle,
+		audio:    -1,
+		head:     -1,
 	}
-	return stream.GetVideoIndex(quality)
+	return stream.GetVideoIndex(quality, subtitle)
 }
 
 func (t *Transcoder) GetAudioIndex(
@@ -171,6 +198,7 @@ func (t *Transcoder) GetAudioIndex(
 	hash string,
 	mediaInfo *videofile.MediaInfo,
 	audio int32,
+	options *AudioOptions,
 	client string,
 ) (string, error) {
 	if debugStream {
@@ -183,12 +211,14 @@ func (t *Transcoder) GetAudioIndex(
 		return "", err
 	}
 	t.clientChan <- ClientInfo{
-		client: client,
-		path:   path,
-		audio:  audio,
-		head:   -1,
+		client:       client,
+		path:         path,
+		subtitle:     -1,
+		audio:        audio,
+		audioProfile: options.Profile(),
+		head:         -1,
 	}
-	return stream.GetAudioIndex(audio)
+	return stream.GetAudioIndex(audio, options)
 }
 
 func (t *Transcoder) GetVideoSegment(
@@ -196,9 +226,13 @@ func (t *Transcoder) GetVideoSegment(
 	hash string,
 	mediaInfo *videofile.MediaInfo,
 	quality Quality,
+	subtitle *BurnSubtitle,
 	segment int32,
 	client string,
 ) (string, error) {
+	if subtitle != nil && quality == Original {
+		return "", fmt.Errorf("cannot burn subtitles in the original quality")
+	}
 	if debugStream {
 		start := time.Now()
 		t.logger.Trace().Msgf("transcoder: Retrieving video segment %d (%s) [GetVideoSegment]", segment, quality)
@@ -210,14 +244,15 @@ func (t *Transcoder) GetVideoSegment(
 	}
 	//t.logger.Trace().Msgf("transcoder: Sending client info, segment %d (%s) [GetVideoSegment]", segment, quality)
 	t.clientChan <- ClientInfo{
-		client:  client,
-		path:    path,
-		quality: &quality,
-		audio:   -1,
-		head:    segment,
+		client:   client,
+		path:     path,
+		quality:  &quality,
+		subtitle: newVideoKey(quality, subtitle).subtitle,
+		audio:    -1,
+		head:     segment,
 	}
 	//t.logger.Trace().Msgf("transcoder: Getting video segment %d (%s) [GetVideoSegment]", segment, quality)
-	return stream.GetVideoSegment(quality, segment)
+	return stream.GetVideoSegment(quality, subtitle, segment)
 }
 
 func (t *Transcoder) GetAudioSegment(
@@ -225,6 +260,7 @@ func (t *Transcoder) GetAudioSegment(
 	hash string,
 	mediaInfo *videofile.MediaInfo,
 	audio int32,
+	options *AudioOptions,
 	segment int32,
 	client string,
 ) (string, error) {
@@ -238,10 +274,12 @@ func (t *Transcoder) GetAudioSegment(
 		return "", err
 	}
 	t.clientChan <- ClientInfo{
-		client: client,
-		path:   path,
-		audio:  audio,
-		head:   segment,
+		client:       client,
+		path:         path,
+		subtitle:     -1,
+		audio:        audio,
+		audioProfile: options.Profile(),
+		head:         segment,
 	}
-	return stream.GetAudioSegment(audio, segment)
+	return stream.GetAudioSegment(audio, options, segment)
 }
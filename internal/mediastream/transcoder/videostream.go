@@ -10,17 +10,23 @@ import (
 type VideoStream struct {
 	Stream
 	quality  Quality
+	subtitle *BurnSubtitle // Subtitle track burned in, nil if none
 	logger   *zerolog.Logger
 	settings *Settings
 }
 
-func NewVideoStream(file *FileStream, quality Quality, logger *zerolog.Logger, settings *Settings) *VideoStream {
+func NewVideoStream(file *FileStream, quality Quality, subtitle *BurnSubtitle, logger *zerolog.Logger, settings *Settings) *VideoStream {
 	logger.Trace().Str("file", filepath.Base(file.Path)).Any("quality", quality).Msgf("transcoder: Creating video stream")
 	ret := new(VideoStream)
 	ret.quality = quality
+	ret.subtitle = subtitle
 	ret.logger = logger
 	ret.settings = settings
-	NewStream(fmt.Sprintf("video (%s)", quality), file, ret, &ret.Stream, settings, logger)
+	kind := fmt.Sprintf("video (%s)", quality)
+	if subtitle != nil {
+		kind = fmt.Sprintf("video (%s, subtitle %d)", quality, subtitle.Index)
+	}
+	NewStream(kind, file, ret, &ret.Stream, settings, logger)
 	return ret
 }
 
@@ -31,10 +37,29 @@ func (vs *VideoStream) getFlags() Flags {
 	return VideoF
 }
 
+func (vs *VideoStream) getCacheKey() string {
+	if vs.subtitle != nil {
+		return fmt.Sprintf("video-%s-s%d", vs.quality, vs.subtitle.Index)
+	}
+	return fmt.Sprintf("video-%s", vs.quality)
+}
+
 func (vs *VideoStream) getOutPath(encoderId int) string {
+	if vs.subtitle != nil {
+		return filepath.Join(vs.file.Out, fmt.Sprintf("segment-%s-s%d-%d-%%d.ts", vs.quality, vs.subtitle.Index, encoderId))
+	}
 	return filepath.Join(vs.file.Out, fmt.Sprintf("segment-%s-%d-%%d.ts", vs.quality, encoderId))
 }
 
+func (vs *VideoStream) getDecodeFlags() []string {
+	// The subtitles filter renders on software frames.
+	// The scale filters of the hardware accelerators upload the frames back to the GPU.
+	if vs.subtitle != nil {
+		return []string{}
+	}
+	return vs.settings.HwAccel.DecodeFlags
+}
+
 func closestMultiple(n int32, x int32) int32 {
 	if x > n {
 		return x
@@ -64,8 +89,12 @@ func (vs *VideoStream) getTranscodeArgs(segments string) []string {
 	width := int32(float64(vs.quality.Height()) / float64(vs.file.Info.Video.Height) * float64(vs.file.Info.Video.Width))
 	// force a width that is a multiple of two else some apps behave badly.
 	width = closestMultiple(width, 2)
+	filter := fmt.Sprintf(vs.settings.HwAccel.ScaleFilter, width, vs.quality.Height())
+	if vs.subtitle != nil {
+		filter = vs.subtitle.getSubtitlesFilter() + "," + filter
+	}
 	args = append(args,
-		"-vf", fmt.Sprintf(vs.settings.HwAccel.ScaleFilter, width, vs.quality.Height()),
+		"-vf", filter,
 		// Even less sure but buf size are 5x the average bitrate since the average bitrate is only
 		// useful for hls segments.
 		"-bufsize", fmt.Sprint(vs.quality.MaxBitrate()*5),
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 	"os"
 	"path/filepath"
 	"seanime/internal/util"
@@ -26,6 +27,26 @@ func ExtractAttachment(ffmpegPath string, path string, hash string, mediaInfo *M
 	_ = os.MkdirAll(attachmentPath, 0755)
 	_ = os.MkdirAll(subsPath, 0755)
 
+	// Copy the sidecar files next to the extracted ones so that they're served the same way
+	for _, sub := range mediaInfo.Subtitles {
+		if !sub.IsExternal || sub.ExternalPath == nil || sub.Extension == nil {
+			continue
+		}
+		if err := copySidecarFile(*sub.ExternalPath, filepath.Join(subsPath, fmt.Sprintf("%d.%s", sub.Index, *sub.Extension))); err != nil {
+			logger.Warn().Err(err).Str("path", *sub.ExternalPath).Msgf("videofile: Failed to copy sidecar subtitle")
+		}
+	}
+	for _, fontPath := range mediaInfo.ExternalFonts {
+		if err := copySidecarFile(fontPath, filepath.Join(attachmentPath, filepath.Base(fontPath))); err != nil {
+			logger.Warn().Err(err).Str("path", fontPath).Msgf("videofile: Failed to copy sidecar font")
+		}
+	}
+
+	// Nothing to extract from the container
+	if !lo.ContainsBy(mediaInfo.Subtitles, func(sub Subtitle) bool { return !sub.IsExternal }) {
+		return nil
+	}
+
 	subsDir, err := os.ReadDir(subsPath)
 	if err == nil {
 		if len(subsDir) == len(mediaInfo.Subtitles) {
@@ -60,6 +81,9 @@ func ExtractAttachment(ffmpegPath string, path string, hash string, mediaInfo *M
 	cmd.Dir = attachmentPath
 
 	for _, sub := range mediaInfo.Subtitles {
+		if sub.IsExternal {
+			continue
+		}
 		if ext := sub.Extension; ext != nil {
 			cmd.Args = append(
 				cmd.Args,
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"mime"
 	"path/filepath"
+	"regexp"
 	"seanime/internal/util/filecache"
 	"strconv"
 	"strings"
@@ -43,6 +44,8 @@ type MediaInfo struct {
 	Subtitles []Subtitle `json:"subtitles"`
 	// The list of fonts that can be used to display subtitles
 	Fonts []string `json:"fonts"`
+	// The paths of the sidecar fonts, they are copied next to the extracted fonts
+	ExternalFonts []string `json:"-"`
 	// The list of chapters. See Chapter for more information
 	Chapters []Chapter `json:"chapters"`
 }
@@ -62,6 +65,8 @@ type Video struct {
 	Height uint32 `json:"height"`
 	// The average bitrate of the video in bytes/s
 	Bitrate uint32 `json:"bitrate"`
+	// The number of bits per color component (e.g. 10 for "yuv420p10le"), 0 if unknown
+	BitDepth uint32 `json:"bitDepth"`
 }
 
 type Audio struct {
@@ -100,6 +105,8 @@ type Subtitle struct {
 	IsExternal bool `json:"isExternal"`
 	// The link to access this subtitle
 	Link *string `json:"link"`
+	// The path of the subtitle file, if it's external
+	ExternalPath *string `json:"-"`
 }
 
 type Chapter struct {
@@ -143,6 +150,7 @@ func (e *MediaInfoExtractor) GetInfo(ffprobePath, path string) (mi *MediaInfo, e
 	// Look in the cache
 	if found, _ := e.fileCacher.Get(bucket, hash, &mi); found {
 		e.logger.Debug().Str("hash", hash).Msg("mediastream: Media information cache HIT [MediaInfoExtractor]")
+		e.addSidecarFiles(mi)
 		return mi, nil
 	}
 
@@ -160,9 +168,21 @@ func (e *MediaInfoExtractor) GetInfo(ffprobePath, path string) (mi *MediaInfo, e
 
 	e.logger.Debug().Str("hash", hash).Msg("mediastream: Extracted media information using FFprobe")
 
+	e.addSidecarFiles(mi)
+
 	return mi, nil
 }
 
+// addSidecarFiles merges the sidecar subtitles and fonts of the file.
+// They are not cached since they can be added or removed without changing the video file.
+func (e *MediaInfoExtractor) addSidecarFiles(mi *MediaInfo) {
+	sf := FindSidecarFiles(mi.Path)
+	if len(sf.Subtitles) > 0 || len(sf.Fonts) > 0 {
+		e.logger.Debug().Int("subtitles", len(sf.Subtitles)).Int("fonts", len(sf.Fonts)).Msg("mediastream: Found sidecar files [MediaInfoExtractor]")
+	}
+	mi.AddSidecarFiles(sf)
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 func FfprobeGetInfo(ffprobePath, path, hash string) (*MediaInfo, error) {
@@ -205,7 +225,8 @@ func FfprobeGetInfo(ffprobePath, path, hash string) (*MediaInfo, error) {
 			Height:    uint32(stream.Height),
 			// ffmpeg does not report bitrate in mkv files, fallback to bitrate of the whole container
 			// (bigger than the result since it contains audio and other videos but better than nothing).
-			Bitrate: uint32(bitrate),
+			Bitrate:  uint32(bitrate),
+			BitDepth: pixelFormatToBitDepth(stream.PixFmt),
 		}
 	})
 
@@ -220,6 +241,7 @@ func FfprobeGetInfo(ffprobePath, path, hash string) (*MediaInfo, error) {
 			MimeCodec: streamToMimeCodec(stream),
 			IsDefault: stream.Disposition.Default != 0,
 			IsForced:  stream.Disposition.Forced != 0,
+			Channels:  uint32(stream.Channels),
 		}
 	})
 
@@ -297,6 +319,33 @@ func FfprobeGetInfo(ffprobePath, path, hash string) (*MediaInfo, error) {
 	return mi, nil
 }
 
+var pixelFormatBitDepthRegex = regexp.MustCompile(`p(9|10|12|14|16)(le|be)?$`)
+
+// pixelFormatToBitDepth returns the bit depth of a planar pixel format, e.g. "yuv420p10le" -> 10.
+func pixelFormatToBitDepth(pixFmt string) uint32 {
+	if pixFmt == "" {
+		return 0
+	}
+	if m := pixelFormatBitDepthRegex.FindStringSubmatch(pixFmt); m != nil {
+		depth, _ := strconv.ParseUint(m[1], 10, 32)
+		return uint32(depth)
+	}
+	return 8
+}
+
+// GetBitDepth returns the bit depth of the video.
+// The media information cached before the bit depth was probed only has the codec profile to go on.
+func (v *Video) GetBitDepth() uint32 {
+	if v.BitDepth > 0 {
+		return v.BitDepth
+	}
+	// HEVC Main 10 profile
+	if v.MimeCodec != nil && strings.HasPrefix(*v.MimeCodec, "hvc1.2.") {
+		return 10
+	}
+	return 8
+}
+
 func nullIfZero[T comparable](v T) *T {
 	var zero T
 	if v != zero {
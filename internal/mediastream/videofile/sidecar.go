@@ -0,0 +1,291 @@
+package videofile
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"seanime/internal/util"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	"golang.org/x/text/language"
+)
+
+// Sidecar files are the subtitle files and fonts shipped next to a video, usually by fansub releases.
+//
+//	Show - 01.mkv
+//	Show - 01.en.ass            <- same basename, language suffix
+//	Show - 01.en.forced.srt
+//	Subs/Show - 01.pt-BR.ass    <- subtitle folder
+//	Subs/Show - 01/2_English.srt
+//	Fonts/Font.ttf              <- font folder
+
+type (
+	SidecarSubtitle struct {
+		Path      string
+		Extension string
+		Title     *string
+		Language  *string
+		IsDefault bool
+		IsForced  bool
+	}
+
+	SidecarFiles struct {
+		Subtitles []*SidecarSubtitle
+		// Paths of the font files
+		Fonts []string
+	}
+)
+
+var subtitleDirNames = []string{"subs", "sub", "subtitles", "subtitle"}
+
+// Common language names used in the filenames of subtitles, e.g. "2_English.srt"
+var languageNames = map[string]string{
+	"english":    "en",
+	"japanese":   "ja",
+	"spanish":    "es",
+	"french":     "fr",
+	"german":     "de",
+	"italian":    "it",
+	"portuguese": "pt",
+	"brazilian":  "pt-BR",
+	"russian":    "ru",
+	"arabic":     "ar",
+	"chinese":    "zh",
+	"korean":     "ko",
+	"polish":     "pl",
+	"turkish":    "tr",
+	"indonesian": "id",
+	"vietnamese": "vi",
+	"thai":       "th",
+	"dutch":      "nl",
+	"swedish":    "sv",
+	"hindi":      "hi",
+}
+
+var trackNumberPrefixRegex = regexp.MustCompile(`^\d+_`)
+
+// FindSidecarFiles returns the external subtitles and fonts of a video file.
+func FindSidecarFiles(videoPath string) *SidecarFiles {
+	ret := &SidecarFiles{
+		Subtitles: make([]*SidecarSubtitle, 0),
+		Fonts:     make([]string, 0),
+	}
+
+	dir := filepath.Dir(videoPath)
+	basename := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ret
+	}
+
+	ret.Subtitles = append(ret.Subtitles, findSidecarSubtitles(dir, basename)...)
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		switch {
+		case slices.Contains(subtitleDirNames, strings.ToLower(entry.Name())):
+			subsDir := filepath.Join(dir, entry.Name())
+			ret.Subtitles = append(ret.Subtitles, findSidecarSubtitles(subsDir, basename)...)
+			// Subtitles of the episode in their own folder, e.g. "Subs/Show - 01/2_English.srt"
+			ret.Subtitles = append(ret.Subtitles, findSidecarSubtitles(filepath.Join(subsDir, basename), "")...)
+			ret.Fonts = append(ret.Fonts, findSidecarFonts(subsDir)...)
+		case util.IsFontDir(entry.Name()):
+			ret.Fonts = append(ret.Fonts, findSidecarFonts(filepath.Join(dir, entry.Name()))...)
+		}
+	}
+
+	return ret
+}
+
+// findSidecarSubtitles returns the subtitle files of a directory whose name starts with the basename.
+// If the basename is empty, all subtitle files are returned.
+func findSidecarSubtitles(dir string, basename string) []*SidecarSubtitle {
+	ret := make([]*SidecarSubtitle, 0)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ret
+	}
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || !util.IsValidSubtitleExtension(ext) {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if basename != "" {
+			if name != basename && !strings.HasPrefix(name, basename+".") {
+				continue
+			}
+			name = strings.TrimPrefix(strings.TrimPrefix(name, basename), ".")
+		}
+
+		sub := parseSidecarSubtitleTags(name)
+		sub.Path = filepath.Join(dir, entry.Name())
+		sub.Extension = strings.ToLower(ext[1:])
+		ret = append(ret, sub)
+	}
+
+	return ret
+}
+
+// parseSidecarSubtitleTags parses the tags following the basename of a subtitle file, e.g. "en.forced" or "2_English".
+// Tags that are not a language or a flag make up the title.
+func parseSidecarSubtitleTags(tags string) *SidecarSubtitle {
+	ret := &SidecarSubtitle{}
+	if tags == "" {
+		return ret
+	}
+
+	titleParts := make([]string, 0)
+	for _, tag := range strings.Split(tags, ".") {
+		switch strings.ToLower(tag) {
+		case "forced":
+			ret.IsForced = true
+			continue
+		case "default":
+			ret.IsDefault = true
+			continue
+		}
+
+		if ret.Language == nil {
+			if lang, ok := parseSidecarLanguage(trackNumberPrefixRegex.ReplaceAllString(tag, "")); ok {
+				ret.Language = &lang
+				continue
+			}
+		}
+
+		titleParts = append(titleParts, tag)
+	}
+
+	ret.Title = nullIfZero(strings.Join(titleParts, "."))
+	return ret
+}
+
+// parseSidecarLanguage returns the language tag of a language code ("en", "eng", "pt-BR") or name ("English").
+func parseSidecarLanguage(s string) (string, bool) {
+	if tag, found := languageNames[strings.ToLower(s)]; found {
+		return tag, true
+	}
+
+	// Only accept codes, random words can be valid BCP 47 tags
+	code, _, _ := strings.Cut(s, "-")
+	if len(code) < 2 || len(code) > 3 {
+		return "", false
+	}
+	lang, err := language.Parse(s)
+	if err != nil || lang == language.Und {
+		return "", false
+	}
+	return lang.String(), true
+}
+
+// findSidecarFonts returns the font files of a directory and its subdirectories.
+func findSidecarFonts(dir string) []string {
+	ret := make([]string, 0)
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() && util.IsValidFontExtension(filepath.Ext(path)) {
+			ret = append(ret, path)
+		}
+		return nil
+	})
+	return ret
+}
+
+// AddSidecarFiles merges the sidecar files into the media information.
+// The sidecar subtitles are indexed after the embedded ones and served from the same directory once extracted.
+func (mi *MediaInfo) AddSidecarFiles(sf *SidecarFiles) {
+	if sf == nil {
+		return
+	}
+
+	index := uint32(0)
+	for _, sub := range mi.Subtitles {
+		if !sub.IsExternal {
+			index = max(index, sub.Index+1)
+		}
+	}
+	mi.Subtitles = lo.Filter(mi.Subtitles, func(sub Subtitle, _ int) bool {
+		return !sub.IsExternal
+	})
+
+	for _, sub := range sf.Subtitles {
+		link := fmt.Sprintf("/%d.%s", index, sub.Extension)
+		mi.Subtitles = append(mi.Subtitles, Subtitle{
+			Index:        index,
+			Title:        sub.Title,
+			Language:     sub.Language,
+			Codec:        sidecarSubtitleCodec(sub.Extension),
+			Extension:    lo.ToPtr(sub.Extension),
+			IsDefault:    sub.IsDefault,
+			IsForced:     sub.IsForced,
+			IsExternal:   true,
+			Link:         &link,
+			ExternalPath: lo.ToPtr(sub.Path),
+		})
+		index++
+	}
+
+	// Embedded fonts take precedence over sidecar fonts with the same filename
+	mi.Fonts = lo.Filter(mi.Fonts, func(font string, _ int) bool {
+		return !lo.ContainsBy(mi.ExternalFonts, func(path string) bool { return filepath.Base(path) == font })
+	})
+	mi.ExternalFonts = make([]string, 0, len(sf.Fonts))
+	for _, path := range sf.Fonts {
+		filename := filepath.Base(path)
+		if slices.Contains(mi.Fonts, filename) {
+			continue
+		}
+		mi.Fonts = append(mi.Fonts, filename)
+		mi.ExternalFonts = append(mi.ExternalFonts, path)
+	}
+}
+
+func sidecarSubtitleCodec(extension string) string {
+	switch extension {
+	case "srt":
+		return "subrip"
+	case "vtt":
+		return "webvtt"
+	default:
+		return extension
+	}
+}
+
+// copySidecarFile copies a sidecar file to the cache, unless it's already there.
+func copySidecarFile(src string, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && dstInfo.Size() == srcInfo.Size() && !dstInfo.ModTime().Before(srcInfo.ModTime()) {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,93 @@
+package videofile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindSidecarFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	files := []string{
+		"Show - 01.mkv",
+		"Show - 01.ass",
+		"Show - 01.en.forced.srt",
+		"Show - 01.pt-BR.Signs & Songs.ass",
+		"Show - 02.en.ass",
+		"Subs/Show - 01.ja.ass",
+		"Subs/Show - 01/2_English.srt",
+		"Subs/Show - 02/2_English.srt",
+		"Fonts/Font.ttf",
+		"Fonts/Bold/Font-Bold.otf",
+		"Fonts/readme.txt",
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("test"), 0644))
+	}
+
+	sf := FindSidecarFiles(filepath.Join(dir, "Show - 01.mkv"))
+
+	type subtitle struct {
+		Filename string
+		Language string
+		Title    string
+		IsForced bool
+	}
+	subs := lo.Map(sf.Subtitles, func(s *SidecarSubtitle, _ int) subtitle {
+		return subtitle{
+			Filename: filepath.Base(s.Path),
+			Language: lo.FromPtr(s.Language),
+			Title:    lo.FromPtr(s.Title),
+			IsForced: s.IsForced,
+		}
+	})
+
+	assert.ElementsMatch(t, []subtitle{
+		{Filename: "Show - 01.ass"},
+		{Filename: "Show - 01.en.forced.srt", Language: "en", IsForced: true},
+		{Filename: "Show - 01.pt-BR.Signs & Songs.ass", Language: "pt-BR", Title: "Signs & Songs"},
+		{Filename: "Show - 01.ja.ass", Language: "ja"},
+		{Filename: "2_English.srt", Language: "en"},
+	}, subs)
+
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "Fonts/Font.ttf"),
+		filepath.Join(dir, "Fonts/Bold/Font-Bold.otf"),
+	}, sf.Fonts)
+}
+
+func TestMediaInfo_AddSidecarFiles(t *testing.T) {
+	mi := &MediaInfo{
+		Subtitles: []Subtitle{
+			{Index: 0, Extension: lo.ToPtr("ass"), Link: lo.ToPtr("/0.ass")},
+			{Index: 2, Extension: lo.ToPtr("srt"), Link: lo.ToPtr("/2.srt")},
+		},
+		Fonts: []string{"Font.ttf"},
+	}
+	sf := &SidecarFiles{
+		Subtitles: []*SidecarSubtitle{{Path: "/anime/Show - 01.en.ass", Extension: "ass", Language: lo.ToPtr("en")}},
+		Fonts:     []string{"/anime/Fonts/Font.ttf", "/anime/Fonts/Other.ttf"},
+	}
+
+	// Adding the sidecar files again replaces the previous ones
+	mi.AddSidecarFiles(sf)
+	mi.AddSidecarFiles(sf)
+
+	require.Len(t, mi.Subtitles, 3)
+	external := mi.Subtitles[2]
+	assert.True(t, external.IsExternal)
+	assert.Equal(t, uint32(3), external.Index)
+	assert.Equal(t, "/3.ass", *external.Link)
+	assert.Equal(t, "/anime/Show - 01.en.ass", *external.ExternalPath)
+
+	// The embedded font is kept over the sidecar font with the same filename
+	assert.Equal(t, []string{"Font.ttf", "Other.ttf"}, mi.Fonts)
+	assert.Equal(t, []string{"/anime/Fonts/Other.ttf"}, mi.ExternalFonts)
+}
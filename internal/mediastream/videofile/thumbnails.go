@@ -0,0 +1,124 @@
+package videofile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"seanime/internal/util"
+	"seanime/internal/util/crashlog"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	ThumbnailsVttFilename = "thumbnails.vtt"
+	thumbnailInterval     = 10  // Seconds between two thumbnails
+	thumbnailWidth        = 240 // Pixels, the height follows the aspect ratio
+	thumbnailColumns      = 10  // Thumbnails per row of a sprite sheet
+	thumbnailRows         = 10  // Rows of a sprite sheet
+)
+
+// GetFileThumbnailsCacheDir returns the directory of the thumbnail sprites of a file.
+// Unlike the "videofiles" directory, it's not trimmed, so thumbnails generated ahead of time are kept.
+func GetFileThumbnailsCacheDir(outDir string, hash string) string {
+	return filepath.Join(outDir, "thumbnails", hash)
+}
+
+// ThumbnailsExist returns true if the thumbnails of the file have been generated.
+func ThumbnailsExist(cacheDir string, hash string) bool {
+	_, err := os.Stat(filepath.Join(GetFileThumbnailsCacheDir(cacheDir, hash), ThumbnailsVttFilename))
+	return err == nil
+}
+
+// ExtractThumbnails generates the thumbnail sprite sheets of a file and their WebVTT index.
+// The index is written last, so its presence means the generation is complete.
+func ExtractThumbnails(ffmpegPath string, path string, hash string, mediaInfo *MediaInfo, cacheDir string, logger *zerolog.Logger) (err error) {
+	if ThumbnailsExist(cacheDir, hash) {
+		logger.Debug().Str("hash", hash).Msgf("videofile: Thumbnails already generated")
+		return nil
+	}
+
+	if mediaInfo.Video == nil || mediaInfo.Video.Width == 0 || mediaInfo.Video.Height == 0 {
+		return errors.New("videofile: No video stream")
+	}
+	if mediaInfo.Duration <= 0 {
+		return errors.New("videofile: Unknown duration")
+	}
+
+	logger.Debug().Str("hash", hash).Msgf("videofile: Starting thumbnail generation")
+
+	outDir := GetFileThumbnailsCacheDir(cacheDir, hash)
+	_ = os.MkdirAll(outDir, 0755)
+
+	// Keep the aspect ratio, the height must be even for the encoder
+	height := int(math.Round(float64(thumbnailWidth)*float64(mediaInfo.Video.Height)/float64(mediaInfo.Video.Width)/2)) * 2
+
+	// Instantiate a new crash logger
+	crashLogger := crashlog.GlobalCrashLogger.InitArea("ffmpeg")
+	defer crashLogger.Close()
+
+	crashLogger.LogInfof("Generating thumbnails for %s", path)
+
+	// DEVNOTE: All paths fed into this command should be absolute
+	cmd := util.NewCmdCtx(
+		context.Background(),
+		ffmpegPath,
+		"-nostdin",
+		"-y",
+		"-i", path,
+		"-map", "0:V:0",
+		"-an", "-sn",
+		"-vf", fmt.Sprintf("fps=1/%d,scale=%d:%d,tile=%dx%d", thumbnailInterval, thumbnailWidth, height, thumbnailColumns, thumbnailRows),
+		"-q:v", "5",
+		filepath.Join(outDir, "sprite-%d.jpg"),
+	)
+	cmd.Stdout = crashLogger.Stdout()
+	cmd.Stderr = crashLogger.Stdout()
+	err = cmd.Run()
+	if err != nil {
+		logger.Error().Err(err).Msgf("videofile: Error generating thumbnails")
+		crashlog.GlobalCrashLogger.WriteAreaLogToFile(crashLogger)
+		return err
+	}
+
+	vtt := generateThumbnailsVtt(float64(mediaInfo.Duration), thumbnailWidth, height)
+	err = os.WriteFile(filepath.Join(outDir, ThumbnailsVttFilename), []byte(vtt), 0644)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug().Str("hash", hash).Msgf("videofile: Generated thumbnails")
+	return nil
+}
+
+// generateThumbnailsVtt returns the WebVTT index of the sprite sheets.
+// Each cue points to the region of a sprite sheet with the media fragment "#xywh=x,y,w,h".
+func generateThumbnailsVtt(duration float64, width int, height int) string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n")
+
+	perSprite := thumbnailColumns * thumbnailRows
+	count := int(math.Ceil(duration / thumbnailInterval))
+	for i := 0; i < count; i++ {
+		start := float64(i * thumbnailInterval)
+		end := min(float64((i+1)*thumbnailInterval), duration)
+
+		sprite := i/perSprite + 1 // ffmpeg numbers the output files from 1
+		x := (i % thumbnailColumns) * width
+		y := (i % perSprite / thumbnailColumns) * height
+
+		sb.WriteString(fmt.Sprintf("\n%s --> %s\nsprite-%d.jpg#xywh=%d,%d,%d,%d\n", formatVttTimestamp(start), formatVttTimestamp(end), sprite, x, y, width, height))
+	}
+
+	return sb.String()
+}
+
+// formatVttTimestamp formats seconds as "HH:MM:SS.mmm".
+func formatVttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
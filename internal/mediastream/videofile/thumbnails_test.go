@@ -0,0 +1,30 @@
+package videofile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateThumbnailsVtt(t *testing.T) {
+	// 1005 seconds -> 101 thumbnails, the last one is on the second sprite sheet
+	vtt := generateThumbnailsVtt(1005, 240, 136)
+
+	require.True(t, strings.HasPrefix(vtt, "WEBVTT\n"))
+	cues := strings.Split(strings.TrimSpace(strings.TrimPrefix(vtt, "WEBVTT\n")), "\n\n")
+	require.Len(t, cues, 101)
+
+	assert.Equal(t, "00:00:00.000 --> 00:00:10.000\nsprite-1.jpg#xywh=0,0,240,136", cues[0])
+	assert.Equal(t, "00:00:10.000 --> 00:00:20.000\nsprite-1.jpg#xywh=240,0,240,136", cues[1])
+	assert.Equal(t, "00:01:40.000 --> 00:01:50.000\nsprite-1.jpg#xywh=0,136,240,136", cues[10])
+	assert.Equal(t, "00:16:30.000 --> 00:16:40.000\nsprite-1.jpg#xywh=2160,1224,240,136", cues[99])
+	assert.Equal(t, "00:16:40.000 --> 00:16:45.000\nsprite-2.jpg#xywh=0,0,240,136", cues[100])
+}
+
+func TestFormatVttTimestamp(t *testing.T) {
+	assert.Equal(t, "00:00:00.000", formatVttTimestamp(0))
+	assert.Equal(t, "00:01:05.500", formatVttTimestamp(65.5))
+	assert.Equal(t, "01:02:03.040", formatVttTimestamp(3723.04))
+}
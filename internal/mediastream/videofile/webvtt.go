@@ -0,0 +1,226 @@
+package videofile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// WebVTT is the only subtitle format supported by the text tracks of browsers and HLS players.
+// ASS and SRT subtitles are converted on the fly for clients that can't render them.
+// The ASS styling is dropped, only the text is kept.
+
+type webVttCue struct {
+	start float64 // In seconds
+	end   float64
+	text  string
+}
+
+var (
+	assOverrideRegex = regexp.MustCompile(`\{[^}]*}`)
+	assDrawingRegex  = regexp.MustCompile(`\\p[1-9]`)
+	srtTimingRegex   = regexp.MustCompile(`(\d+:\d{2}:\d{2})[,.](\d{3})\s*-->\s*(\d+:\d{2}:\d{2})[,.](\d{3})`)
+	srtFontTagRegex  = regexp.MustCompile(`(?i)</?font[^>]*>`)
+)
+
+// IsWebVttConvertible returns true if subtitles with this extension can be converted to WebVTT.
+func IsWebVttConvertible(extension string) bool {
+	switch strings.ToLower(extension) {
+	case "ass", "ssa", "srt", "vtt":
+		return true
+	}
+	return false
+}
+
+// ConvertFileToWebVtt converts a subtitle file to WebVTT based on its extension.
+func ConvertFileToWebVtt(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); ext {
+	case "ass", "ssa":
+		return ConvertAssToWebVtt(f)
+	case "srt":
+		return ConvertSrtToWebVtt(f)
+	case "vtt":
+		b, err := io.ReadAll(f)
+		return string(b), err
+	default:
+		return "", fmt.Errorf("videofile: Cannot convert %s subtitles to WebVTT", ext)
+	}
+}
+
+// ConvertAssToWebVtt converts ASS/SSA subtitles to WebVTT.
+func ConvertAssToWebVtt(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	cues := make([]*webVttCue, 0)
+	inEvents := false
+	// Default field order of the [Events] section
+	format := []string{"layer", "start", "end", "style", "name", "marginl", "marginr", "marginv", "effect", "text"}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "format":
+			format = make([]string, 0)
+			for _, field := range strings.Split(value, ",") {
+				format = append(format, strings.ToLower(strings.TrimSpace(field)))
+			}
+		case "dialogue":
+			// The text is the last field and can contain commas
+			fields := strings.SplitN(value, ",", len(format))
+			if len(fields) != len(format) {
+				continue
+			}
+
+			var cue webVttCue
+			for i, field := range format {
+				switch field {
+				case "start":
+					cue.start = parseAssTimestamp(fields[i])
+				case "end":
+					cue.end = parseAssTimestamp(fields[i])
+				case "text":
+					cue.text = convertAssText(fields[i])
+				}
+			}
+			if cue.text == "" || cue.end <= cue.start {
+				continue
+			}
+			cues = append(cues, &cue)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	// Events are not necessarily ordered in ASS files
+	slices.SortStableFunc(cues, func(a, b *webVttCue) int {
+		switch {
+		case a.start < b.start:
+			return -1
+		case a.start > b.start:
+			return 1
+		}
+		return 0
+	})
+
+	return formatWebVtt(cues), nil
+}
+
+// convertAssText removes the override tags of an ASS dialogue.
+// Drawings are vector shapes, not text, they're dropped.
+func convertAssText(text string) string {
+	for _, tag := range assOverrideRegex.FindAllString(text, -1) {
+		if assDrawingRegex.MatchString(tag) {
+			return ""
+		}
+	}
+
+	text = assOverrideRegex.ReplaceAllString(text, "")
+	text = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(text)
+	text = escapeWebVttText(text)
+
+	lines := strings.Split(text, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	lines = slices.DeleteFunc(lines, func(l string) bool { return l == "" })
+	return strings.Join(lines, "\n")
+}
+
+// parseAssTimestamp parses a timestamp in the "H:MM:SS.cc" format.
+func parseAssTimestamp(s string) float64 {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	h, _ := strconv.ParseFloat(parts[0], 64)
+	m, _ := strconv.ParseFloat(parts[1], 64)
+	sec, _ := strconv.ParseFloat(parts[2], 64)
+	return h*3600 + m*60 + sec
+}
+
+// ConvertSrtToWebVtt converts SRT subtitles to WebVTT.
+// The basic formatting tags (<i>, <b>, <u>) are supported by WebVTT and kept.
+func ConvertSrtToWebVtt(r io.Reader) (string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	content := strings.TrimPrefix(string(b), "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+
+	for _, block := range strings.Split(content, "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+
+		// Look for the timing line, the counter before it is dropped
+		timingIdx := slices.IndexFunc(lines, func(l string) bool { return srtTimingRegex.MatchString(l) })
+		if timingIdx == -1 {
+			continue
+		}
+		m := srtTimingRegex.FindStringSubmatch(lines[timingIdx])
+		textLines := lines[timingIdx+1:]
+		text := strings.TrimSpace(srtFontTagRegex.ReplaceAllString(strings.Join(textLines, "\n"), ""))
+		if text == "" {
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("%s.%s --> %s.%s\n", padSrtHours(m[1]), m[2], padSrtHours(m[3]), m[4]))
+		sb.WriteString(text)
+		sb.WriteString("\n\n")
+	}
+
+	return sb.String(), nil
+}
+
+func padSrtHours(s string) string {
+	if strings.Index(s, ":") == 1 {
+		return "0" + s
+	}
+	return s
+}
+
+func formatWebVtt(cues []*webVttCue) string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+	for _, cue := range cues {
+		sb.WriteString(fmt.Sprintf("%s --> %s\n", formatVttTimestamp(cue.start), formatVttTimestamp(cue.end)))
+		sb.WriteString(cue.text)
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
+
+func escapeWebVttText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,63 @@
+package videofile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertAssToWebVtt(t *testing.T) {
+	ass := `[Script Info]
+Title: Test
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize
+Style: Default,Arial,20
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:05.50,0:00:07.00,Default,,0,0,0,,{\i1}Second{\i0}, with a comma
+Dialogue: 0,0:00:01.00,0:00:03.25,Default,,0,0,0,,First line\NSecond line
+Comment: 0,0:00:02.00,0:00:03.00,Default,,0,0,0,,Not displayed
+Dialogue: 0,0:00:02.00,0:00:03.00,Sign,,0,0,0,,{\p1}m 0 0 l 100 0 100 100{\p0}
+Dialogue: 0,1:02:03.04,1:02:04.00,Default,,0,0,0,,Tom & Jerry <3
+`
+
+	ret, err := ConvertAssToWebVtt(strings.NewReader(ass))
+	require.NoError(t, err)
+
+	expected := `WEBVTT
+
+00:00:01.000 --> 00:00:03.250
+First line
+Second line
+
+00:00:05.500 --> 00:00:07.000
+Second, with a comma
+
+01:02:03.040 --> 01:02:04.000
+Tom &amp; Jerry &lt;3
+
+`
+	assert.Equal(t, expected, ret)
+}
+
+func TestConvertSrtToWebVtt(t *testing.T) {
+	srt := "\ufeff1\r\n00:00:01,000 --> 00:00:03,500\r\n<i>Hello</i>\r\n\r\n2\r\n0:00:04,000 --> 0:00:05,000\r\n<font color=\"#fff\">World</font>\r\n"
+
+	ret, err := ConvertSrtToWebVtt(strings.NewReader(srt))
+	require.NoError(t, err)
+
+	expected := `WEBVTT
+
+00:00:01.000 --> 00:00:03.500
+<i>Hello</i>
+
+00:00:04.000 --> 00:00:05.000
+World
+
+`
+	assert.Equal(t, expected, ret)
+}
@@ -24,6 +24,7 @@ const (
 	AutoDownloader Notification = "Auto Downloader"
 	AutoScanner    Notification = "Auto Scanner"
 	Debrid         Notification = "Debrid"
+	Downloads      Notification = "Downloads"
 )
 
 var GlobalNotifier = NewNotifier()
@@ -66,7 +67,7 @@ func (n *Notifier) canProceed(id Notification) bool {
 	switch id {
 	case AutoDownloader:
 		return !n.settings.MustGet().DisableAutoDownloaderNotifications
-	case AutoScanner:
+	case AutoScanner, Downloads: // Downloads are imported like auto scans
 		return !n.settings.MustGet().DisableAutoScannerNotifications
 	}
 
@@ -0,0 +1,83 @@
+package test_utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type (
+	// FixtureServer serves the JSON fixtures of a testdata folder in place of an API.
+	FixtureServer struct {
+		URL   string
+		dir   string
+		route func(r *http.Request) string
+		// Fixture served with a 404 when the fixture returned by route doesn't exist
+		missingFixture string
+
+		mu    sync.Mutex
+		forms map[string]url.Values // Path -> form values of the last request
+	}
+
+	NewFixtureServerOptions struct {
+		Dir string // Defaults to "testdata"
+		// Route returns the name of the fixture to serve for a request, empty for a 404
+		Route          func(r *http.Request) string
+		MissingFixture string
+	}
+)
+
+// NewFixtureServer starts a FixtureServer, it's closed when the test ends.
+func NewFixtureServer(t *testing.T, opts *NewFixtureServerOptions) *FixtureServer {
+	s := &FixtureServer{
+		dir:            opts.Dir,
+		route:          opts.Route,
+		missingFixture: opts.MissingFixture,
+		forms:          make(map[string]url.Values),
+	}
+	if s.dir == "" {
+		s.dir = "testdata"
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(srv.Close)
+	s.URL = srv.URL
+
+	return s
+}
+
+// Form returns the form values of the last request to the path, nil if the path wasn't requested.
+func (s *FixtureServer) Form(path string) url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.forms[path]
+}
+
+func (s *FixtureServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	s.mu.Lock()
+	s.forms[r.URL.Path] = r.PostForm
+	s.mu.Unlock()
+
+	name := s.route(r)
+	if name == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		if s.missingFixture != "" {
+			data, _ = os.ReadFile(filepath.Join(s.dir, s.missingFixture))
+			_, _ = w.Write(data)
+		}
+		return
+	}
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,374 @@
+package aria2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+)
+
+const (
+	StatusActive   = "active"
+	StatusWaiting  = "waiting"
+	StatusPaused   = "paused"
+	StatusError    = "error"
+	StatusComplete = "complete"
+	StatusRemoved  = "removed"
+)
+
+var ErrNotFound = errors.New("aria2: download not found")
+
+type (
+	// Aria2 is a client for the aria2 JSON-RPC interface (--enable-rpc).
+	Aria2 struct {
+		url    string
+		secret string
+		client *http.Client
+		logger *zerolog.Logger
+		reqId  atomic.Uint64
+	}
+
+	NewAria2Options struct {
+		Logger *zerolog.Logger
+		Host   string // Default: 127.0.0.1
+		Port   int    // Default: 6800
+		Secret string // --rpc-secret
+	}
+
+	// Download is the status of a download, aria2 returns all numbers as strings.
+	Download struct {
+		Gid             string      `json:"gid"`
+		Status          string      `json:"status"`
+		TotalLength     string      `json:"totalLength"`
+		CompletedLength string      `json:"completedLength"`
+		UploadLength    string      `json:"uploadLength"`
+		DownloadSpeed   string      `json:"downloadSpeed"`
+		UploadSpeed     string      `json:"uploadSpeed"`
+		InfoHash        string      `json:"infoHash"`
+		NumSeeders      string      `json:"numSeeders"`
+		Seeder          string      `json:"seeder"`
+		Dir             string      `json:"dir"`
+		ErrorMessage    string      `json:"errorMessage"`
+		FollowedBy      []string    `json:"followedBy"`
+		Files           []*File     `json:"files"`
+		Bittorrent      *Bittorrent `json:"bittorrent"`
+	}
+
+	File struct {
+		Index           string `json:"index"` // 1-based
+		Path            string `json:"path"`
+		Length          string `json:"length"`
+		CompletedLength string `json:"completedLength"`
+		Selected        string `json:"selected"`
+		Uris            []struct {
+			Uri string `json:"uri"`
+		} `json:"uris"`
+	}
+
+	Bittorrent struct {
+		Info *struct {
+			Name string `json:"name"`
+		} `json:"info"`
+	}
+
+	request struct {
+		JsonRPC string        `json:"jsonrpc"`
+		Method  string        `json:"method"`
+		Params  []interface{} `json:"params"`
+		ID      string        `json:"id"`
+	}
+
+	response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+// downloadKeys are the status keys requested for each download.
+var downloadKeys = []string{
+	"gid", "status", "totalLength", "completedLength", "uploadLength", "downloadSpeed", "uploadSpeed",
+	"infoHash", "numSeeders", "seeder", "dir", "errorMessage", "followedBy", "files", "bittorrent",
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("aria2: %s (code %d)", e.Message, e.Code)
+}
+
+func New(opts *NewAria2Options) *Aria2 {
+	if opts.Host == "" {
+		opts.Host = "127.0.0.1"
+	}
+	if opts.Port == 0 {
+		opts.Port = 6800
+	}
+
+	url := fmt.Sprintf("http://%s:%d/jsonrpc", opts.Host, opts.Port)
+	if strings.HasPrefix(opts.Host, "https://") || strings.HasPrefix(opts.Host, "http://") {
+		url = fmt.Sprintf("%s:%d/jsonrpc", strings.TrimSuffix(opts.Host, "/"), opts.Port)
+	}
+
+	return &Aria2{
+		url:    url,
+		secret: opts.Secret,
+		client: &http.Client{Timeout: 30 * time.Second},
+		logger: opts.Logger,
+	}
+}
+
+// CheckStart returns true if aria2 is reachable.
+func (a *Aria2) CheckStart() bool {
+	if a == nil {
+		return false
+	}
+	if err := a.call("aria2.getVersion", nil, nil); err != nil {
+		a.logger.Debug().Err(err).Msg("aria2: Not reachable")
+		return false
+	}
+	return true
+}
+
+// AddUri adds a download and returns its GID.
+// The URIs must point to the same resource (mirrors), or be a single magnet link.
+func (a *Aria2) AddUri(uris []string, options map[string]string) (string, error) {
+	params := []interface{}{uris}
+	if len(options) > 0 {
+		params = append(params, options)
+	}
+	var gid string
+	if err := a.call("aria2.addUri", params, &gid); err != nil {
+		return "", err
+	}
+	return gid, nil
+}
+
+func (a *Aria2) TellStatus(gid string) (*Download, error) {
+	var ret Download
+	if err := a.call("aria2.tellStatus", []interface{}{gid, downloadKeys}, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetDownloads returns the active, waiting and stopped downloads.
+func (a *Aria2) GetDownloads() ([]*Download, error) {
+	ret := make([]*Download, 0)
+
+	var active []*Download
+	if err := a.call("aria2.tellActive", []interface{}{downloadKeys}, &active); err != nil {
+		return nil, err
+	}
+	ret = append(ret, active...)
+
+	var waiting []*Download
+	if err := a.call("aria2.tellWaiting", []interface{}{0, 1000, downloadKeys}, &waiting); err != nil {
+		return nil, err
+	}
+	ret = append(ret, waiting...)
+
+	var stopped []*Download
+	if err := a.call("aria2.tellStopped", []interface{}{0, 1000, downloadKeys}, &stopped); err != nil {
+		return nil, err
+	}
+	ret = append(ret, stopped...)
+
+	return ret, nil
+}
+
+// GetTorrents returns the torrent downloads.
+// The metadata downloads of magnet links are skipped once they are followed by the actual download.
+func (a *Aria2) GetTorrents() ([]*Download, error) {
+	downloads, err := a.GetDownloads()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Download, 0, len(downloads))
+	for _, d := range downloads {
+		if d.InfoHash == "" || len(d.FollowedBy) > 0 {
+			continue
+		}
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+// FindTorrent returns the torrent download with the given info hash.
+func (a *Aria2) FindTorrent(hash string) (*Download, error) {
+	torrents, err := a.GetTorrents()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range torrents {
+		if strings.EqualFold(t.InfoHash, hash) {
+			return t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (a *Aria2) Pause(gid string) error {
+	return a.call("aria2.pause", []interface{}{gid}, nil)
+}
+
+func (a *Aria2) Unpause(gid string) error {
+	return a.call("aria2.unpause", []interface{}{gid}, nil)
+}
+
+// Remove removes the download and its result.
+func (a *Aria2) Remove(gid string) error {
+	if status, err := a.TellStatus(gid); err == nil {
+		switch status.Status {
+		case StatusActive, StatusWaiting, StatusPaused:
+			if err := a.call("aria2.remove", []interface{}{gid}, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return a.call("aria2.removeDownloadResult", []interface{}{gid}, nil)
+}
+
+func (a *Aria2) ChangeOption(gid string, options map[string]string) error {
+	return a.call("aria2.changeOption", []interface{}{gid, options}, nil)
+}
+
+// DeselectFiles updates the "select-file" option to exclude the files at the given 0-based indices.
+// aria2 only accepts the option for paused downloads, active downloads are paused and unpaused.
+func (a *Aria2) DeselectFiles(gid string, indices []int) error {
+	status, err := a.TellStatus(gid)
+	if err != nil {
+		return err
+	}
+
+	selected := make([]string, 0, len(status.Files))
+	for _, f := range status.Files {
+		idx, err := strconv.Atoi(f.Index)
+		if err != nil || f.Selected == "false" {
+			continue
+		}
+		deselect := false
+		for _, i := range indices {
+			if i == idx-1 {
+				deselect = true
+				break
+			}
+		}
+		if !deselect {
+			selected = append(selected, f.Index)
+		}
+	}
+	if len(selected) == 0 {
+		return errors.New("aria2: cannot deselect all files")
+	}
+
+	wasActive := status.Status == StatusActive || status.Status == StatusWaiting
+	if wasActive {
+		if err := a.call("aria2.forcePause", []interface{}{gid}, nil); err != nil {
+			return err
+		}
+	}
+
+	err = a.ChangeOption(gid, map[string]string{"select-file": strings.Join(selected, ",")})
+
+	if wasActive {
+		if uerr := a.Unpause(gid); uerr != nil && err == nil {
+			err = uerr
+		}
+	}
+
+	return err
+}
+
+// GetName returns the name of the download.
+func (d *Download) GetName() string {
+	if d.Bittorrent != nil && d.Bittorrent.Info != nil && d.Bittorrent.Info.Name != "" {
+		return d.Bittorrent.Info.Name
+	}
+	if len(d.Files) > 0 && d.Files[0].Path != "" {
+		return filepath.Base(d.Files[0].Path)
+	}
+	return d.Gid
+}
+
+// GetFilePaths returns the paths of the files relative to the download directory.
+func (d *Download) GetFilePaths() []string {
+	ret := make([]string, 0, len(d.Files))
+	for _, f := range d.Files {
+		p := f.Path
+		if rel, err := filepath.Rel(d.Dir, p); err == nil && d.Dir != "" {
+			p = rel
+		}
+		ret = append(ret, filepath.ToSlash(p))
+	}
+	return ret
+}
+
+func (d *Download) GetTotalLength() int64     { return parseInt(d.TotalLength) }
+func (d *Download) GetCompletedLength() int64 { return parseInt(d.CompletedLength) }
+func (d *Download) GetDownloadSpeed() int64   { return parseInt(d.DownloadSpeed) }
+func (d *Download) GetUploadSpeed() int64     { return parseInt(d.UploadSpeed) }
+func (d *Download) GetUploadLength() int64    { return parseInt(d.UploadLength) }
+func (d *Download) GetNumSeeders() int        { return int(parseInt(d.NumSeeders)) }
+func (d *Download) IsSeeder() bool            { return d.Seeder == "true" }
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (a *Aria2) call(method string, params []interface{}, result interface{}) error {
+	if a.secret != "" {
+		params = append([]interface{}{"token:" + a.secret}, params...)
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(&request{
+		JsonRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      strconv.FormatUint(a.reqId.Add(1), 10),
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var res response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("aria2: invalid response (%s): %w", resp.Status, err)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if result == nil || len(res.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(res.Result, result)
+}
+
+func parseInt(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
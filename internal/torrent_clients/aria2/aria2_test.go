@@ -0,0 +1,212 @@
+package aria2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"seanime/internal/util"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockServer imitates the aria2 JSON-RPC interface.
+// Magnet links are added as a metadata download followed by the torrent download.
+type mockServer struct {
+	mu        sync.Mutex
+	secret    string
+	nextGid   int
+	downloads []*Download
+	options   map[string]map[string]string
+}
+
+func newMockServer(t *testing.T, secret string) (*mockServer, *Aria2) {
+	m := &mockServer{secret: secret, options: make(map[string]map[string]string)}
+	srv := httptest.NewServer(http.HandlerFunc(m.handle))
+	t.Cleanup(srv.Close)
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return m, New(&NewAria2Options{Logger: util.NewLogger(), Host: u.Hostname(), Port: port, Secret: secret})
+}
+
+func (m *mockServer) find(gid string) *Download {
+	for _, d := range m.downloads {
+		if d.Gid == gid {
+			return d
+		}
+	}
+	return nil
+}
+
+func (m *mockServer) newGid() string {
+	m.nextGid++
+	return strconv.Itoa(m.nextGid)
+}
+
+func (m *mockServer) handle(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+		ID     string            `json:"id"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	reply := func(result interface{}, err *Error) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result, "error": err})
+	}
+
+	var token string
+	if len(req.Params) > 0 {
+		_ = json.Unmarshal(req.Params[0], &token)
+	}
+	if token != "token:"+m.secret {
+		reply(nil, &Error{Code: 1, Message: "Unauthorized"})
+		return
+	}
+	params := req.Params[1:]
+	gidParam := func() string {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		return gid
+	}
+
+	switch req.Method {
+	case "aria2.getVersion":
+		reply(map[string]string{"version": "1.37.0"}, nil)
+	case "aria2.addUri":
+		var uris []string
+		var options map[string]string
+		_ = json.Unmarshal(params[0], &uris)
+		if len(params) > 1 {
+			_ = json.Unmarshal(params[1], &options)
+		}
+		dir := options["dir"]
+		if strings.HasPrefix(uris[0], "magnet:") {
+			u, _ := url.Parse(uris[0])
+			hash := strings.TrimPrefix(u.Query().Get("xt"), "urn:btih:")
+			name := u.Query().Get("dn")
+			metadata := &Download{Gid: m.newGid(), Status: StatusComplete, InfoHash: hash, Dir: dir, Files: []*File{{Index: "1", Path: "[METADATA]" + hash}}}
+			torrent := &Download{
+				Gid: m.newGid(), Status: StatusActive, InfoHash: hash, Dir: dir, TotalLength: "300", CompletedLength: "150",
+				DownloadSpeed: "1024", NumSeeders: "3", Seeder: "false",
+				Bittorrent: &Bittorrent{Info: &struct {
+					Name string `json:"name"`
+				}{Name: name}},
+				Files: []*File{
+					{Index: "1", Path: dir + "/" + name + "/Show - 01.mkv", Selected: "true"},
+					{Index: "2", Path: dir + "/" + name + "/Show - 02.mkv", Selected: "true"},
+					{Index: "3", Path: dir + "/" + name + "/Show - 03.mkv", Selected: "true"},
+				},
+			}
+			metadata.FollowedBy = []string{torrent.Gid}
+			m.downloads = append(m.downloads, metadata, torrent)
+			reply(metadata.Gid, nil)
+			return
+		}
+		d := &Download{Gid: m.newGid(), Status: StatusComplete, Dir: dir, TotalLength: "100", CompletedLength: "100",
+			Files: []*File{{Index: "1", Path: dir + "/" + uris[0][strings.LastIndex(uris[0], "/")+1:], Selected: "true"}}}
+		m.downloads = append(m.downloads, d)
+		reply(d.Gid, nil)
+	case "aria2.tellStatus":
+		d := m.find(gidParam())
+		if d == nil {
+			reply(nil, &Error{Code: 1, Message: "GID is not found"})
+			return
+		}
+		reply(d, nil)
+	case "aria2.tellActive", "aria2.tellWaiting", "aria2.tellStopped":
+		ret := make([]*Download, 0)
+		for _, d := range m.downloads {
+			switch {
+			case req.Method == "aria2.tellActive" && d.Status == StatusActive,
+				req.Method == "aria2.tellWaiting" && (d.Status == StatusWaiting || d.Status == StatusPaused),
+				req.Method == "aria2.tellStopped" && (d.Status == StatusComplete || d.Status == StatusError || d.Status == StatusRemoved):
+				ret = append(ret, d)
+			}
+		}
+		reply(ret, nil)
+	case "aria2.pause", "aria2.forcePause":
+		m.find(gidParam()).Status = StatusPaused
+		reply("OK", nil)
+	case "aria2.unpause":
+		m.find(gidParam()).Status = StatusActive
+		reply("OK", nil)
+	case "aria2.changeOption":
+		d := m.find(gidParam())
+		if d.Status != StatusPaused {
+			reply(nil, &Error{Code: 1, Message: "select-file can only be changed for paused downloads"})
+			return
+		}
+		var options map[string]string
+		_ = json.Unmarshal(params[1], &options)
+		m.options[d.Gid] = options
+		selected := strings.Split(options["select-file"], ",")
+		for _, f := range d.Files {
+			f.Selected = strconv.FormatBool(strings.Contains(","+strings.Join(selected, ",")+",", ","+f.Index+","))
+		}
+		reply("OK", nil)
+	case "aria2.remove":
+		m.find(gidParam()).Status = StatusRemoved
+		reply("OK", nil)
+	case "aria2.removeDownloadResult":
+		gid := gidParam()
+		ret := make([]*Download, 0)
+		for _, d := range m.downloads {
+			if d.Gid != gid {
+				ret = append(ret, d)
+			}
+		}
+		m.downloads = ret
+		reply("OK", nil)
+	default:
+		reply(nil, &Error{Code: 1, Message: "No such method"})
+	}
+}
+
+func TestAria2_Torrent(t *testing.T) {
+	m, client := newMockServer(t, "secret")
+
+	require.True(t, client.CheckStart())
+
+	_, err := client.AddUri([]string{"magnet:?xt=urn:btih:abcdef&dn=Show"}, map[string]string{"dir": "/downloads"})
+	require.NoError(t, err)
+
+	// The metadata download is skipped
+	torrents, err := client.GetTorrents()
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	assert.Equal(t, "Show", torrents[0].GetName())
+	assert.Equal(t, int64(150), torrents[0].GetCompletedLength())
+
+	d, err := client.FindTorrent("ABCDEF")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Show/Show - 01.mkv", "Show/Show - 02.mkv", "Show/Show - 03.mkv"}, d.GetFilePaths())
+
+	// The download is paused while the option is changed
+	require.NoError(t, client.DeselectFiles(d.Gid, []int{0, 2}))
+	assert.Equal(t, "2", m.options[d.Gid]["select-file"])
+	assert.Equal(t, StatusActive, m.find(d.Gid).Status)
+
+	require.NoError(t, client.Pause(d.Gid))
+	assert.Equal(t, StatusPaused, m.find(d.Gid).Status)
+
+	require.NoError(t, client.Remove(d.Gid))
+	_, err = client.FindTorrent("abcdef")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestAria2_InvalidSecret(t *testing.T) {
+	_, client := newMockServer(t, "secret")
+	client.secret = "wrong"
+
+	assert.False(t, client.CheckStart())
+}
@@ -0,0 +1,318 @@
+package deluge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// errCodeNotAuthenticated is returned by the web API when the session cookie is missing or expired.
+	errCodeNotAuthenticated = 1
+)
+
+type (
+	// Deluge is a client for the Deluge Web UI JSON-RPC API.
+	Deluge struct {
+		baseUrl  string
+		password string
+		client   *http.Client
+		logger   *zerolog.Logger
+		reqId    atomic.Uint64
+		loginMu  sync.Mutex
+	}
+
+	NewDelugeOptions struct {
+		Logger   *zerolog.Logger
+		Password string
+		Host     string // Default: 127.0.0.1
+		Port     int    // Default: 8112
+	}
+
+	Torrent struct {
+		Hash         string  `json:"hash"`
+		Name         string  `json:"name"`
+		State        string  `json:"state"`
+		Progress     float64 `json:"progress"` // 0-100
+		TotalSize    int64   `json:"total_size"`
+		UploadRate   int     `json:"upload_payload_rate"`
+		DownloadRate int     `json:"download_payload_rate"`
+		NumSeeds     int     `json:"num_seeds"`
+		Eta          int     `json:"eta"`
+		SavePath     string  `json:"save_path"`
+		IsFinished   bool    `json:"is_finished"`
+		TimeAdded    float64 `json:"time_added"`
+		Ratio        float64 `json:"ratio"`
+		SeedingTime  int     `json:"seeding_time"`
+		ActiveTime   int     `json:"active_time"`
+	}
+
+	File struct {
+		Index int    `json:"index"`
+		Path  string `json:"path"`
+		Size  int64  `json:"size"`
+	}
+
+	request struct {
+		Method string        `json:"method"`
+		Params []interface{} `json:"params"`
+		ID     uint64        `json:"id"`
+	}
+
+	response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+		ID     uint64          `json:"id"`
+	}
+
+	Error struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+	}
+)
+
+// TorrentKeys are the status keys requested for each torrent.
+var TorrentKeys = []string{
+	"hash", "name", "state", "progress", "total_size", "upload_payload_rate", "download_payload_rate",
+	"num_seeds", "eta", "save_path", "is_finished", "time_added", "ratio", "seeding_time", "active_time",
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("deluge: %s (code %d)", e.Message, e.Code)
+}
+
+func New(opts *NewDelugeOptions) *Deluge {
+	if opts.Host == "" {
+		opts.Host = "127.0.0.1"
+	}
+	if opts.Port == 0 {
+		opts.Port = 8112
+	}
+
+	baseUrl := fmt.Sprintf("http://%s:%d/json", opts.Host, opts.Port)
+	if strings.HasPrefix(opts.Host, "https://") || strings.HasPrefix(opts.Host, "http://") {
+		baseUrl = fmt.Sprintf("%s:%d/json", strings.TrimSuffix(opts.Host, "/"), opts.Port)
+	}
+
+	jar, _ := cookiejar.New(nil)
+
+	return &Deluge{
+		baseUrl:  baseUrl,
+		password: opts.Password,
+		client:   &http.Client{Jar: jar, Timeout: 30 * time.Second},
+		logger:   opts.Logger,
+	}
+}
+
+// Login authenticates the session, the session cookie is kept in the client's cookie jar.
+func (d *Deluge) Login() error {
+	d.loginMu.Lock()
+	defer d.loginMu.Unlock()
+
+	var ok bool
+	if err := d.do("auth.login", []interface{}{d.password}, &ok); err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("deluge: invalid password")
+	}
+	return nil
+}
+
+// CheckStart returns true if the Web UI is reachable and connected to a daemon.
+// If the Web UI is not connected, it connects to the first daemon it knows about.
+func (d *Deluge) CheckStart() bool {
+	if d == nil {
+		return false
+	}
+
+	var connected bool
+	if err := d.call("web.connected", nil, &connected); err != nil {
+		d.logger.Debug().Err(err).Msg("deluge: Web UI is not reachable")
+		return false
+	}
+	if connected {
+		return true
+	}
+
+	// Each host is [id, host, port, username]
+	var hosts [][]interface{}
+	if err := d.call("web.get_hosts", nil, &hosts); err != nil || len(hosts) == 0 {
+		d.logger.Warn().Msg("deluge: No daemon configured in the Web UI")
+		return false
+	}
+	hostId, _ := hosts[0][0].(string)
+	if err := d.call("web.connect", []interface{}{hostId}, nil); err != nil {
+		d.logger.Warn().Err(err).Msg("deluge: Failed to connect to daemon")
+		return false
+	}
+
+	return true
+}
+
+// AddMagnet adds a magnet link and returns the hash of the torrent.
+func (d *Deluge) AddMagnet(magnet string, dest string) (string, error) {
+	options := map[string]interface{}{}
+	if dest != "" {
+		options["download_location"] = dest
+	}
+
+	var hash string
+	if err := d.call("core.add_torrent_magnet", []interface{}{magnet, options}, &hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// GetTorrents returns the torrents matching the hashes, or all torrents if no hash is given.
+func (d *Deluge) GetTorrents(hashes []string) ([]*Torrent, error) {
+	filter := map[string]interface{}{}
+	if len(hashes) > 0 {
+		filter["id"] = hashes
+	}
+
+	var res map[string]*Torrent
+	if err := d.call("core.get_torrents_status", []interface{}{filter, TorrentKeys}, &res); err != nil {
+		return nil, err
+	}
+
+	ret := make([]*Torrent, 0, len(res))
+	for hash, t := range res {
+		if t == nil {
+			continue
+		}
+		if t.Hash == "" {
+			t.Hash = hash
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+func (d *Deluge) PauseTorrents(hashes []string) error {
+	return d.call("core.pause_torrent", []interface{}{hashes}, nil)
+}
+
+func (d *Deluge) ResumeTorrents(hashes []string) error {
+	return d.call("core.resume_torrent", []interface{}{hashes}, nil)
+}
+
+func (d *Deluge) RemoveTorrents(hashes []string, removeData bool) error {
+	for _, hash := range hashes {
+		if err := d.call("core.remove_torrent", []interface{}{hash, removeData}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetFiles returns the files of the torrent, ordered by index.
+func (d *Deluge) GetFiles(hash string) ([]*File, error) {
+	var res struct {
+		Files []*File `json:"files"`
+	}
+	if err := d.call("core.get_torrent_status", []interface{}{hash, []string{"files"}}, &res); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(res.Files, func(a, b *File) int {
+		return a.Index - b.Index
+	})
+	return res.Files, nil
+}
+
+// DeselectFiles sets the priority of the files at the given indices to 0 (skip).
+func (d *Deluge) DeselectFiles(hash string, indices []int) error {
+	var res struct {
+		FilePriorities []int `json:"file_priorities"`
+	}
+	if err := d.call("core.get_torrent_status", []interface{}{hash, []string{"file_priorities"}}, &res); err != nil {
+		return err
+	}
+
+	for _, idx := range indices {
+		if idx >= 0 && idx < len(res.FilePriorities) {
+			res.FilePriorities[idx] = 0
+		}
+	}
+
+	return d.call("core.set_torrent_options", []interface{}{[]string{hash}, map[string]interface{}{"file_priorities": res.FilePriorities}}, nil)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// call sends a request, logging in again if the session has expired.
+func (d *Deluge) call(method string, params []interface{}, result interface{}) error {
+	err := d.do(method, params, result)
+
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) && rpcErr.Code == errCodeNotAuthenticated {
+		if err := d.Login(); err != nil {
+			return err
+		}
+		return d.do(method, params, result)
+	}
+
+	return err
+}
+
+func (d *Deluge) do(method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(&request{
+		Method: method,
+		Params: params,
+		ID:     d.reqId.Add(1),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.baseUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("deluge: invalid status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var res response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("deluge: invalid response: %w", err)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if result == nil || len(res.Result) == 0 || string(res.Result) == "null" {
+		return nil
+	}
+
+	return json.Unmarshal(res.Result, result)
+}
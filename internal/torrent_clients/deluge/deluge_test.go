@@ -0,0 +1,220 @@
+package deluge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"seanime/internal/util"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockServer imitates the Deluge Web UI JSON-RPC API.
+type mockServer struct {
+	mu        sync.Mutex
+	password  string
+	connected bool
+	torrents  map[string]*mockTorrent
+}
+
+type mockTorrent struct {
+	status     map[string]interface{}
+	files      []*File
+	priorities []int
+}
+
+func newMockServer(t *testing.T, password string) (*mockServer, *httptest.Server) {
+	m := &mockServer{password: password, torrents: make(map[string]*mockTorrent)}
+	srv := httptest.NewServer(http.HandlerFunc(m.handle))
+	t.Cleanup(srv.Close)
+	return m, srv
+}
+
+func (m *mockServer) handle(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+		ID     uint64            `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reply := func(result interface{}, err *Error) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": err, "id": req.ID})
+	}
+	param := func(i int, v interface{}) {
+		_ = json.Unmarshal(req.Params[i], v)
+	}
+
+	if req.Method == "auth.login" {
+		var password string
+		param(0, &password)
+		if password != m.password {
+			reply(false, nil)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: "session"})
+		reply(true, nil)
+		return
+	}
+
+	if c, err := r.Cookie("_session_id"); err != nil || c.Value != "session" {
+		reply(nil, &Error{Message: "Not authenticated", Code: errCodeNotAuthenticated})
+		return
+	}
+
+	switch req.Method {
+	case "web.connected":
+		reply(m.connected, nil)
+	case "web.get_hosts":
+		reply([][]interface{}{{"host-id", "127.0.0.1", 58846, "localclient"}}, nil)
+	case "web.connect":
+		m.connected = true
+		reply(nil, nil)
+	case "core.add_torrent_magnet":
+		var magnet string
+		var options map[string]interface{}
+		param(0, &magnet)
+		param(1, &options)
+		u, _ := url.Parse(magnet)
+		hash := u.Query().Get("xt")[len("urn:btih:"):]
+		m.torrents[hash] = &mockTorrent{
+			status: map[string]interface{}{"hash": hash, "name": u.Query().Get("dn"), "state": "Downloading", "save_path": options["download_location"]},
+			files: []*File{
+				{Index: 0, Path: "Show/Show - 01.mkv", Size: 100},
+				{Index: 1, Path: "Show/Show - 02.mkv", Size: 100},
+				{Index: 2, Path: "Show/Show - 03.mkv", Size: 100},
+			},
+			priorities: []int{1, 1, 1},
+		}
+		reply(hash, nil)
+	case "core.get_torrents_status":
+		var filter map[string][]string
+		param(0, &filter)
+		res := make(map[string]interface{})
+		for hash, t := range m.torrents {
+			if ids, ok := filter["id"]; ok && !contains(ids, hash) {
+				continue
+			}
+			res[hash] = t.status
+		}
+		reply(res, nil)
+	case "core.get_torrent_status":
+		var hash string
+		param(0, &hash)
+		t, ok := m.torrents[hash]
+		if !ok {
+			reply(map[string]interface{}{}, nil)
+			return
+		}
+		reply(map[string]interface{}{"files": t.files, "file_priorities": t.priorities}, nil)
+	case "core.set_torrent_options":
+		var hashes []string
+		var options struct {
+			FilePriorities []int `json:"file_priorities"`
+		}
+		param(0, &hashes)
+		param(1, &options)
+		for _, hash := range hashes {
+			if t, ok := m.torrents[hash]; ok {
+				t.priorities = options.FilePriorities
+			}
+		}
+		reply(nil, nil)
+	case "core.pause_torrent", "core.resume_torrent":
+		var hashes []string
+		param(0, &hashes)
+		for _, hash := range hashes {
+			if t, ok := m.torrents[hash]; ok {
+				t.status["state"] = map[bool]string{true: "Paused", false: "Downloading"}[req.Method == "core.pause_torrent"]
+			}
+		}
+		reply(nil, nil)
+	case "core.remove_torrent":
+		var hash string
+		param(0, &hash)
+		_, ok := m.torrents[hash]
+		delete(m.torrents, hash)
+		reply(ok, nil)
+	default:
+		reply(nil, &Error{Message: "Unknown method", Code: 2})
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server, password string) *Deluge {
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	port, _ := strconv.Atoi(u.Port())
+	return New(&NewDelugeOptions{
+		Logger:   util.NewLogger(),
+		Password: password,
+		Host:     u.Hostname(),
+		Port:     port,
+	})
+}
+
+func TestDeluge(t *testing.T) {
+	m, srv := newMockServer(t, "deluge")
+	client := newTestClient(t, srv, "deluge")
+
+	// Logs in and connects to the daemon
+	require.True(t, client.CheckStart())
+	assert.True(t, m.connected)
+
+	hash, err := client.AddMagnet("magnet:?xt=urn:btih:abcdef&dn=Show", "/downloads/Show")
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", hash)
+
+	torrents, err := client.GetTorrents(nil)
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	assert.Equal(t, "Show", torrents[0].Name)
+	assert.Equal(t, "/downloads/Show", torrents[0].SavePath)
+
+	files, err := client.GetFiles(hash)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	assert.Equal(t, "Show/Show - 02.mkv", files[1].Path)
+
+	require.NoError(t, client.DeselectFiles(hash, []int{0, 2}))
+	assert.Equal(t, []int{0, 1, 0}, m.torrents[hash].priorities)
+
+	require.NoError(t, client.PauseTorrents([]string{hash}))
+	torrents, err = client.GetTorrents([]string{hash})
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	assert.Equal(t, "Paused", torrents[0].State)
+
+	require.NoError(t, client.ResumeTorrents([]string{hash}))
+	assert.Equal(t, "Downloading", m.torrents[hash].status["state"])
+
+	require.NoError(t, client.RemoveTorrents([]string{hash}, true))
+	assert.Empty(t, m.torrents)
+}
+
+func TestDeluge_InvalidPassword(t *testing.T) {
+	_, srv := newMockServer(t, "deluge")
+	client := newTestClient(t, srv, "wrong")
+
+	assert.False(t, client.CheckStart())
+	assert.Error(t, client.Login())
+}
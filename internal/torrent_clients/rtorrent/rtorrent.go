@@ -0,0 +1,353 @@
+package rtorrent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type (
+	// RTorrent is a client for the rTorrent XML-RPC interface.
+	// The interface is reached over HTTP (e.g. the /RPC2 mount of a web server) or directly over SCGI.
+	RTorrent struct {
+		url      string // HTTP endpoint, empty when using SCGI
+		scgiAddr string // SCGI address, empty when using HTTP
+		username string
+		password string
+		client   *http.Client
+		logger   *zerolog.Logger
+	}
+
+	NewRTorrentOptions struct {
+		Logger   *zerolog.Logger
+		Host     string // Default: 127.0.0.1, prefix with "scgi://" to connect over SCGI
+		Port     int
+		Username string
+		Password string
+		RPCPath  string // Default: /RPC2
+	}
+
+	Torrent struct {
+		Hash           string
+		Name           string
+		Size           int64
+		CompletedBytes int64
+		UpRate         int64
+		DownRate       int64
+		Started        bool // d.state
+		Active         bool // d.is_active
+		Complete       bool
+		Directory      string
+		Seeders        int
+		Ratio          float64
+		FinishedAt     int64 // Unix timestamp, 0 if not finished
+	}
+)
+
+// torrentFields are the d.multicall2 commands, in the order they are read by torrentFromRow.
+var torrentFields = []string{
+	"d.hash=", "d.name=", "d.size_bytes=", "d.completed_bytes=", "d.up.rate=", "d.down.rate=",
+	"d.state=", "d.is_active=", "d.complete=", "d.directory=", "d.peers_complete=", "d.ratio=", "d.timestamp.finished=",
+}
+
+func New(opts *NewRTorrentOptions) *RTorrent {
+	if opts.Host == "" {
+		opts.Host = "127.0.0.1"
+	}
+	if opts.RPCPath == "" {
+		opts.RPCPath = "/RPC2"
+	}
+	if !strings.HasPrefix(opts.RPCPath, "/") {
+		opts.RPCPath = "/" + opts.RPCPath
+	}
+
+	ret := &RTorrent{
+		username: opts.Username,
+		password: opts.Password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		logger:   opts.Logger,
+	}
+
+	switch {
+	case strings.HasPrefix(opts.Host, "scgi://"):
+		ret.scgiAddr = net.JoinHostPort(strings.TrimPrefix(opts.Host, "scgi://"), strconv.Itoa(opts.Port))
+	case strings.HasPrefix(opts.Host, "https://"), strings.HasPrefix(opts.Host, "http://"):
+		ret.url = fmt.Sprintf("%s:%d%s", strings.TrimSuffix(opts.Host, "/"), opts.Port, opts.RPCPath)
+	default:
+		ret.url = fmt.Sprintf("http://%s:%d%s", opts.Host, opts.Port, opts.RPCPath)
+	}
+
+	return ret
+}
+
+// CheckStart returns true if rTorrent is reachable.
+func (c *RTorrent) CheckStart() bool {
+	if c == nil {
+		return false
+	}
+	_, err := c.call("system.client_version")
+	if err != nil {
+		c.logger.Debug().Err(err).Msg("rtorrent: Not reachable")
+		return false
+	}
+	return true
+}
+
+// AddMagnet adds a magnet link and starts it.
+func (c *RTorrent) AddMagnet(magnet string, dest string) error {
+	params := []interface{}{"", magnet}
+	if dest != "" {
+		params = append(params, "d.directory.set=\""+strings.ReplaceAll(dest, "\"", "\\\"")+"\"")
+	}
+	_, err := c.call("load.start", params...)
+	return err
+}
+
+// GetTorrents returns all torrents of the main view.
+func (c *RTorrent) GetTorrents() ([]*Torrent, error) {
+	params := []interface{}{"", "main"}
+	for _, f := range torrentFields {
+		params = append(params, f)
+	}
+
+	res, err := c.call("d.multicall2", params...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, ok := res.([]interface{})
+	if !ok {
+		return nil, errUnexpectedType
+	}
+
+	ret := make([]*Torrent, 0, len(rows))
+	for _, row := range rows {
+		values, ok := row.([]interface{})
+		if !ok || len(values) < len(torrentFields) {
+			continue
+		}
+		ret = append(ret, torrentFromRow(values))
+	}
+	return ret, nil
+}
+
+// TorrentExists returns true if rTorrent knows the torrent.
+func (c *RTorrent) TorrentExists(hash string) bool {
+	_, err := c.call("d.hash", toHash(hash))
+	return err == nil
+}
+
+func (c *RTorrent) PauseTorrents(hashes []string) error {
+	for _, hash := range hashes {
+		if _, err := c.call("d.stop", toHash(hash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RTorrent) ResumeTorrents(hashes []string) error {
+	for _, hash := range hashes {
+		if _, err := c.call("d.start", toHash(hash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveTorrents removes the torrents from rTorrent.
+// rTorrent cannot delete the data itself, so it is deleted by Seanime when it is reachable from this machine.
+func (c *RTorrent) RemoveTorrents(hashes []string, removeData bool) error {
+	for _, hash := range hashes {
+		basePath := ""
+		if removeData {
+			if res, err := c.call("d.base_path", toHash(hash)); err == nil {
+				basePath, _ = res.(string)
+			}
+		}
+
+		if _, err := c.call("d.erase", toHash(hash)); err != nil {
+			return err
+		}
+
+		if basePath != "" && filepath.IsAbs(basePath) && filepath.Dir(basePath) != basePath {
+			if _, err := os.Stat(basePath); err == nil {
+				if err := os.RemoveAll(basePath); err != nil {
+					c.logger.Warn().Err(err).Str("path", basePath).Msg("rtorrent: Failed to remove torrent data")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// GetFiles returns the paths of the torrent's files, ordered by index.
+// Like other clients, paths of multi-file torrents are prefixed with the torrent name.
+func (c *RTorrent) GetFiles(hash string) ([]string, error) {
+	res, err := c.call("f.multicall", toHash(hash), "", "f.path=")
+	if err != nil {
+		return nil, err
+	}
+	rows, ok := res.([]interface{})
+	if !ok {
+		return nil, errUnexpectedType
+	}
+
+	prefix := ""
+	if multi, err := c.call("d.is_multi_file", toHash(hash)); err == nil && toInt64(multi) == 1 {
+		if name, err := c.call("d.name", toHash(hash)); err == nil {
+			prefix, _ = name.(string)
+		}
+	}
+
+	ret := make([]string, 0, len(rows))
+	for _, row := range rows {
+		values, ok := row.([]interface{})
+		if !ok || len(values) == 0 {
+			continue
+		}
+		p, _ := values[0].(string)
+		if prefix != "" {
+			p = prefix + "/" + p
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+// DeselectFiles sets the priority of the files at the given indices to 0 (off).
+func (c *RTorrent) DeselectFiles(hash string, indices []int) error {
+	for _, idx := range indices {
+		if _, err := c.call("f.priority.set", fmt.Sprintf("%s:f%d", toHash(hash), idx), 0); err != nil {
+			return err
+		}
+	}
+	_, err := c.call("d.update_priorities", toHash(hash))
+	return err
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (c *RTorrent) call(method string, params ...interface{}) (interface{}, error) {
+	body, err := encodeRequest(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []byte
+	if c.scgiAddr != "" {
+		res, err = c.doSCGI(body)
+	} else {
+		res, err = c.doHTTP(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeResponse(bytes.NewReader(res))
+}
+
+func (c *RTorrent) doHTTP(body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rtorrent: invalid status %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// doSCGI sends the request over SCGI, rTorrent's native interface (network.scgi.open_port).
+func (c *RTorrent) doSCGI(body []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", c.scgiAddr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	headers := "CONTENT_LENGTH\x00" + strconv.Itoa(len(body)) + "\x00SCGI\x001\x00REQUEST_METHOD\x00POST\x00REQUEST_URI\x00/RPC2\x00"
+	if _, err := fmt.Fprintf(conn, "%d:%s,", len(headers), headers); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(body); err != nil {
+		return nil, err
+	}
+
+	res, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// The response starts with CGI headers
+	idx := bytes.Index(res, []byte("\r\n\r\n"))
+	if idx == -1 {
+		return nil, errors.New("rtorrent: invalid scgi response")
+	}
+	return res[idx+4:], nil
+}
+
+func torrentFromRow(values []interface{}) *Torrent {
+	str := func(i int) string {
+		s, _ := values[i].(string)
+		return s
+	}
+	return &Torrent{
+		Hash:           strings.ToLower(str(0)),
+		Name:           str(1),
+		Size:           toInt64(values[2]),
+		CompletedBytes: toInt64(values[3]),
+		UpRate:         toInt64(values[4]),
+		DownRate:       toInt64(values[5]),
+		Started:        toInt64(values[6]) == 1,
+		Active:         toInt64(values[7]) == 1,
+		Complete:       toInt64(values[8]) == 1,
+		Directory:      str(9),
+		Seeders:        int(toInt64(values[10])),
+		Ratio:          float64(toInt64(values[11])) / 1000, // d.ratio is in thousandths
+		FinishedAt:     toInt64(values[12]),
+	}
+}
+
+// toHash returns the hash in the format used by rTorrent.
+func toHash(hash string) string {
+	return strings.ToUpper(hash)
+}
+
+func toInt64(v interface{}) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,274 @@
+package rtorrent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"seanime/internal/util"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockServer imitates the rTorrent XML-RPC interface.
+type mockServer struct {
+	mu       sync.Mutex
+	torrents []*mockTorrent
+}
+
+type mockTorrent struct {
+	hash       string
+	name       string
+	directory  string
+	state      int64
+	files      []string
+	priorities []int64
+}
+
+func (m *mockServer) find(hash string) *mockTorrent {
+	for _, t := range m.torrents {
+		if t.hash == hash {
+			return t
+		}
+	}
+	return nil
+}
+
+// handle returns the XML-RPC response for the request body.
+func (m *mockServer) handle(body []byte) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	method, params := decodeMockRequest(body)
+	str := func(i int) string {
+		s, _ := params[i].(string)
+		return s
+	}
+
+	var result interface{}
+	var fault *Fault
+
+	switch method {
+	case "system.client_version":
+		result = "0.9.8"
+	case "load.start":
+		u, _ := url.Parse(str(1))
+		t := &mockTorrent{
+			hash:       strings.ToUpper(strings.TrimPrefix(u.Query().Get("xt"), "urn:btih:")),
+			name:       u.Query().Get("dn"),
+			state:      1,
+			files:      []string{"Show - 01.mkv", "Show - 02.mkv", "Show - 03.mkv"},
+			priorities: []int64{1, 1, 1},
+		}
+		if len(params) > 2 {
+			t.directory = strings.Trim(strings.TrimPrefix(str(2), "d.directory.set="), "\"")
+		}
+		m.torrents = append(m.torrents, t)
+		result = int64(0)
+	case "d.multicall2":
+		rows := make([]interface{}, 0)
+		for _, t := range m.torrents {
+			rows = append(rows, []interface{}{
+				t.hash, t.name, int64(300), int64(100), int64(0), int64(1024),
+				t.state, t.state, int64(0), t.directory, int64(5), int64(1500), int64(0),
+			})
+		}
+		result = rows
+	default:
+		t := m.find(strings.Split(str(0), ":")[0])
+		if t == nil {
+			fault = &Fault{Code: -501, String: "Could not find info-hash."}
+			break
+		}
+		result = int64(0)
+		switch method {
+		case "d.hash":
+			result = t.hash
+		case "d.name":
+			result = t.name
+		case "d.is_multi_file":
+			result = int64(1)
+		case "d.base_path":
+			result = ""
+		case "d.stop":
+			t.state = 0
+		case "d.start":
+			t.state = 1
+		case "d.erase":
+			m.torrents = withoutTorrent(m.torrents, t)
+		case "f.multicall":
+			rows := make([]interface{}, 0)
+			for _, f := range t.files {
+				rows = append(rows, []interface{}{f})
+			}
+			result = rows
+		case "f.priority.set":
+			idx, _ := strconv.Atoi(strings.TrimPrefix(strings.Split(str(0), ":")[1], "f"))
+			t.priorities[idx] = params[1].(int64)
+		case "d.update_priorities":
+		default:
+			fault = &Fault{Code: -506, String: "Method not defined"}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?><methodResponse>`)
+	if fault != nil {
+		buf.WriteString(`<fault>`)
+		_ = encodeValue(&buf, map[string]interface{}{"faultCode": int64(fault.Code), "faultString": fault.String})
+		buf.WriteString(`</fault>`)
+	} else {
+		buf.WriteString(`<params><param>`)
+		_ = encodeValue(&buf, result)
+		buf.WriteString(`</param></params>`)
+	}
+	buf.WriteString(`</methodResponse>`)
+	return buf.Bytes()
+}
+
+func withoutTorrent(s []*mockTorrent, t *mockTorrent) []*mockTorrent {
+	ret := make([]*mockTorrent, 0, len(s))
+	for _, e := range s {
+		if e != t {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+func decodeMockRequest(body []byte) (method string, params []interface{}) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "methodName":
+			_ = dec.DecodeElement(&method, &se)
+		case "value":
+			v, err := decodeValue(dec)
+			if err != nil {
+				return
+			}
+			params = append(params, v)
+		}
+	}
+}
+
+func newHTTPMockServer(t *testing.T, m *mockServer) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" || r.URL.Path != "/RPC2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write(m.handle(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newSCGIMockServer(t *testing.T, m *mockServer) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				// Netstring headers
+				lenStr, _ := r.ReadString(':')
+				n, _ := strconv.Atoi(strings.TrimSuffix(lenStr, ":"))
+				headers := make([]byte, n+1) // Includes the trailing comma
+				_, _ = io.ReadFull(r, headers)
+				parts := strings.Split(string(headers), "\x00")
+				contentLength, _ := strconv.Atoi(parts[1])
+				body := make([]byte, contentLength)
+				_, _ = io.ReadFull(r, body)
+
+				res := m.handle(body)
+				_, _ = fmt.Fprintf(conn, "Status: 200 OK\r\nContent-Type: text/xml\r\nContent-Length: %d\r\n\r\n", len(res))
+				_, _ = conn.Write(res)
+			}(conn)
+		}
+	}()
+
+	return l
+}
+
+func TestRTorrent(t *testing.T) {
+	newClients := map[string]func(m *mockServer) *RTorrent{
+		"http": func(m *mockServer) *RTorrent {
+			u, _ := url.Parse(newHTTPMockServer(t, m).URL)
+			port, _ := strconv.Atoi(u.Port())
+			return New(&NewRTorrentOptions{Logger: util.NewLogger(), Host: u.Hostname(), Port: port, Username: "user", Password: "pass"})
+		},
+		"scgi": func(m *mockServer) *RTorrent {
+			addr := newSCGIMockServer(t, m).Addr().(*net.TCPAddr)
+			return New(&NewRTorrentOptions{Logger: util.NewLogger(), Host: "scgi://127.0.0.1", Port: addr.Port})
+		},
+	}
+
+	for name, newClient := range newClients {
+		t.Run(name, func(t *testing.T) {
+			m := &mockServer{}
+			client := newClient(m)
+
+			require.True(t, client.CheckStart())
+
+			require.NoError(t, client.AddMagnet("magnet:?xt=urn:btih:abcdef&dn=Show", "/downloads/Show"))
+
+			torrents, err := client.GetTorrents()
+			require.NoError(t, err)
+			require.Len(t, torrents, 1)
+			assert.Equal(t, "abcdef", torrents[0].Hash)
+			assert.Equal(t, "Show", torrents[0].Name)
+			assert.Equal(t, "/downloads/Show", torrents[0].Directory)
+			assert.Equal(t, 1.5, torrents[0].Ratio)
+			assert.True(t, torrents[0].Started)
+
+			assert.True(t, client.TorrentExists("abcdef"))
+			assert.False(t, client.TorrentExists("123456"))
+
+			files, err := client.GetFiles("abcdef")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"Show/Show - 01.mkv", "Show/Show - 02.mkv", "Show/Show - 03.mkv"}, files)
+
+			require.NoError(t, client.DeselectFiles("abcdef", []int{0, 2}))
+			assert.Equal(t, []int64{0, 1, 0}, m.torrents[0].priorities)
+
+			require.NoError(t, client.PauseTorrents([]string{"abcdef"}))
+			assert.Equal(t, int64(0), m.torrents[0].state)
+			require.NoError(t, client.ResumeTorrents([]string{"abcdef"}))
+			assert.Equal(t, int64(1), m.torrents[0].state)
+
+			require.NoError(t, client.RemoveTorrents([]string{"abcdef"}, true))
+			assert.Empty(t, m.torrents)
+
+			var fault *Fault
+			assert.ErrorAs(t, client.PauseTorrents([]string{"abcdef"}), &fault)
+		})
+	}
+}
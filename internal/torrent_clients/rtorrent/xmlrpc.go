@@ -0,0 +1,262 @@
+package rtorrent
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Minimal XML-RPC encoding, only the types used by rTorrent are supported.
+
+type Fault struct {
+	Code   int
+	String string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("rtorrent: %s (code %d)", f.String, f.Code)
+}
+
+func encodeRequest(method string, params []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0"?><methodCall><methodName>`)
+	_ = xml.EscapeText(&buf, []byte(method))
+	buf.WriteString(`</methodName><params>`)
+	for _, p := range params {
+		buf.WriteString(`<param>`)
+		if err := encodeValue(&buf, p); err != nil {
+			return nil, err
+		}
+		buf.WriteString(`</param>`)
+	}
+	buf.WriteString(`</params></methodCall>`)
+	return buf.Bytes(), nil
+}
+
+func encodeValue(buf *bytes.Buffer, v interface{}) error {
+	buf.WriteString(`<value>`)
+	switch v := v.(type) {
+	case string:
+		buf.WriteString(`<string>`)
+		_ = xml.EscapeText(buf, []byte(v))
+		buf.WriteString(`</string>`)
+	case int:
+		buf.WriteString(`<i8>` + strconv.Itoa(v) + `</i8>`)
+	case int64:
+		buf.WriteString(`<i8>` + strconv.FormatInt(v, 10) + `</i8>`)
+	case bool:
+		if v {
+			buf.WriteString(`<boolean>1</boolean>`)
+		} else {
+			buf.WriteString(`<boolean>0</boolean>`)
+		}
+	case []string:
+		buf.WriteString(`<array><data>`)
+		for _, e := range v {
+			_ = encodeValue(buf, e)
+		}
+		buf.WriteString(`</data></array>`)
+	case []interface{}:
+		buf.WriteString(`<array><data>`)
+		for _, e := range v {
+			if err := encodeValue(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(`</data></array>`)
+	case map[string]interface{}:
+		buf.WriteString(`<struct>`)
+		for k, e := range v {
+			buf.WriteString(`<member><name>`)
+			_ = xml.EscapeText(buf, []byte(k))
+			buf.WriteString(`</name>`)
+			if err := encodeValue(buf, e); err != nil {
+				return err
+			}
+			buf.WriteString(`</member>`)
+		}
+		buf.WriteString(`</struct>`)
+	default:
+		return fmt.Errorf("rtorrent: unsupported xml-rpc type %T", v)
+	}
+	buf.WriteString(`</value>`)
+	return nil
+}
+
+// decodeResponse returns the value of a method response.
+// Integers are decoded as int64, arrays as []interface{} and structs as map[string]interface{}.
+func decodeResponse(r io.Reader) (interface{}, error) {
+	dec := xml.NewDecoder(r)
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("rtorrent: invalid response: %w", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "fault":
+			v, err := decodeNextValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			m, _ := v.(map[string]interface{})
+			code, _ := m["faultCode"].(int64)
+			str, _ := m["faultString"].(string)
+			return nil, &Fault{Code: int(code), String: str}
+		case "param":
+			return decodeNextValue(dec)
+		}
+	}
+}
+
+// decodeNextValue decodes the next <value> element.
+func decodeNextValue(dec *xml.Decoder) (interface{}, error) {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "value" {
+			return decodeValue(dec)
+		}
+	}
+}
+
+// decodeValue decodes the content of a <value> element, consuming its end tag.
+func decodeValue(dec *xml.Decoder) (interface{}, error) {
+	var text strings.Builder
+	var ret interface{}
+	typed := false
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if t.Name.Local == "value" {
+				if !typed {
+					return text.String(), nil // Untyped values are strings
+				}
+				return ret, nil
+			}
+		case xml.StartElement:
+			typed = true
+			switch t.Name.Local {
+			case "string":
+				var s string
+				if err := dec.DecodeElement(&s, &t); err != nil {
+					return nil, err
+				}
+				ret = s
+			case "i4", "i8", "int":
+				var s string
+				if err := dec.DecodeElement(&s, &t); err != nil {
+					return nil, err
+				}
+				n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				ret = n
+			case "boolean":
+				var s string
+				if err := dec.DecodeElement(&s, &t); err != nil {
+					return nil, err
+				}
+				ret = strings.TrimSpace(s) == "1"
+			case "double":
+				var s string
+				if err := dec.DecodeElement(&s, &t); err != nil {
+					return nil, err
+				}
+				f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				if err != nil {
+					return nil, err
+				}
+				ret = f
+			case "array":
+				arr, err := decodeArray(dec)
+				if err != nil {
+					return nil, err
+				}
+				ret = arr
+			case "struct":
+				m, err := decodeStruct(dec)
+				if err != nil {
+					return nil, err
+				}
+				ret = m
+			default:
+				return nil, fmt.Errorf("rtorrent: unsupported xml-rpc type %s", t.Name.Local)
+			}
+		}
+	}
+}
+
+func decodeArray(dec *xml.Decoder) ([]interface{}, error) {
+	ret := make([]interface{}, 0)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "value" {
+				v, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, v)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "array" {
+				return ret, nil
+			}
+		}
+	}
+}
+
+func decodeStruct(dec *xml.Decoder) (map[string]interface{}, error) {
+	ret := make(map[string]interface{})
+	var name string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "name":
+				if err := dec.DecodeElement(&name, &t); err != nil {
+					return nil, err
+				}
+			case "value":
+				v, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				ret[name] = v
+			}
+		case xml.EndElement:
+			if t.Name.Local == "struct" {
+				return ret, nil
+			}
+		}
+	}
+}
+
+var errUnexpectedType = errors.New("rtorrent: unexpected response type")
@@ -0,0 +1,72 @@
+package torrent_client
+
+import (
+	"os"
+	"path/filepath"
+	"seanime/internal/torrent_clients/aria2"
+	"strings"
+)
+
+// forEachAria2Torrent calls fn with the GID of each torrent.
+// aria2 identifies downloads by GID, not by info hash.
+func (r *Repository) forEachAria2Torrent(hashes []string, fn func(gid string) error) error {
+	for _, hash := range hashes {
+		t, err := r.aria2.FindTorrent(hash)
+		if err != nil {
+			return err
+		}
+		if err := fn(t.Gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeAria2Torrents removes the torrents, and their files if removeData is true.
+// aria2 does not delete downloaded files, they are deleted when they are reachable from this machine.
+func (r *Repository) removeAria2Torrents(hashes []string, removeData bool) error {
+	for _, hash := range hashes {
+		t, err := r.aria2.FindTorrent(hash)
+		if err != nil {
+			return err
+		}
+		if err := r.aria2.Remove(t.Gid); err != nil {
+			return err
+		}
+		if !removeData {
+			continue
+		}
+		for _, p := range getAria2TorrentRoots(t) {
+			if _, err := os.Stat(p); err == nil {
+				_ = os.RemoveAll(p)
+				_ = os.Remove(p + ".aria2") // Control file
+			}
+		}
+	}
+	return nil
+}
+
+// getAria2TorrentRoots returns the top-level paths of the torrent's files in the download directory.
+func getAria2TorrentRoots(t *aria2.Download) []string {
+	if t.Dir == "" || !filepath.IsAbs(t.Dir) {
+		return nil
+	}
+	roots := make(map[string]struct{})
+	ret := make([]string, 0)
+	for _, p := range t.GetFilePaths() {
+		rel := filepath.FromSlash(p)
+		if rel == "" || filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		root := rel
+		for filepath.Dir(root) != "." {
+			root = filepath.Dir(root)
+		}
+		if _, found := roots[root]; found {
+			continue
+		}
+		roots[root] = struct{}{}
+		ret = append(ret, filepath.Join(t.Dir, root))
+	}
+	return ret
+}
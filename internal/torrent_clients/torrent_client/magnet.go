@@ -0,0 +1,36 @@
+package torrent_client
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// GetInfoHashFromMagnet returns the lowercase hex info hash of a magnet link, or an empty string.
+// Base32 hashes are converted to hex.
+func GetInfoHashFromMagnet(magnet string) string {
+	u, err := url.Parse(magnet)
+	if err != nil || u.Scheme != "magnet" {
+		return ""
+	}
+
+	for _, xt := range u.Query()["xt"] {
+		if !strings.HasPrefix(strings.ToLower(xt), "urn:btih:") {
+			continue
+		}
+		hash := xt[len("urn:btih:"):]
+		switch len(hash) {
+		case 40:
+			return strings.ToLower(hash)
+		case 32:
+			b, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash))
+			if err != nil {
+				return ""
+			}
+			return hex.EncodeToString(b)
+		}
+	}
+
+	return ""
+}
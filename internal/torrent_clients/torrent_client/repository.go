@@ -7,8 +7,11 @@ import (
 	"github.com/rs/zerolog"
 	"seanime/internal/api/metadata"
 	"seanime/internal/events"
+	"seanime/internal/torrent_clients/aria2"
+	"seanime/internal/torrent_clients/deluge"
 	"seanime/internal/torrent_clients/qbittorrent"
 	"seanime/internal/torrent_clients/qbittorrent/model"
+	"seanime/internal/torrent_clients/rtorrent"
 	"seanime/internal/torrent_clients/transmission"
 	"seanime/internal/torrents/torrent"
 	"strconv"
@@ -18,6 +21,9 @@ import (
 const (
 	QbittorrentClient  = "qbittorrent"
 	TransmissionClient = "transmission"
+	DelugeClient       = "deluge"
+	RTorrentClient     = "rtorrent"
+	Aria2Client        = "aria2"
 	NoneClient         = "none"
 )
 
@@ -26,6 +32,9 @@ type (
 		logger                      *zerolog.Logger
 		qBittorrentClient           *qbittorrent.Client
 		transmission                *transmission.Transmission
+		deluge                      *deluge.Deluge
+		rTorrent                    *rtorrent.RTorrent
+		aria2                       *aria2.Aria2
 		torrentRepository           *torrent.Repository
 		provider                    string
 		metadataProvider            metadata.Provider
@@ -37,6 +46,9 @@ type (
 		Logger            *zerolog.Logger
 		QbittorrentClient *qbittorrent.Client
 		Transmission      *transmission.Transmission
+		Deluge            *deluge.Deluge
+		RTorrent          *rtorrent.RTorrent
+		Aria2             *aria2.Aria2
 		TorrentRepository *torrent.Repository
 		Provider          string
 		MetadataProvider  metadata.Provider
@@ -57,6 +69,9 @@ func NewRepository(opts *NewRepositoryOptions) *Repository {
 		logger:             opts.Logger,
 		qBittorrentClient:  opts.QbittorrentClient,
 		transmission:       opts.Transmission,
+		deluge:             opts.Deluge,
+		rTorrent:           opts.RTorrent,
+		aria2:              opts.Aria2,
 		torrentRepository:  opts.TorrentRepository,
 		provider:           opts.Provider,
 		metadataProvider:   opts.MetadataProvider,
@@ -109,6 +124,12 @@ func (r *Repository) Start() bool {
 		return r.qBittorrentClient.CheckStart()
 	case TransmissionClient:
 		return r.transmission.CheckStart()
+	case DelugeClient:
+		return r.deluge.CheckStart()
+	case RTorrentClient:
+		return r.rTorrent.CheckStart()
+	case Aria2Client:
+		return r.aria2.CheckStart()
 	case NoneClient:
 		return true
 	default:
@@ -123,6 +144,14 @@ func (r *Repository) TorrentExists(hash string) bool {
 	case TransmissionClient:
 		torrents, err := r.transmission.Client.TorrentGetAllForHashes(context.Background(), []string{hash})
 		return err == nil && len(torrents) > 0
+	case DelugeClient:
+		torrents, err := r.deluge.GetTorrents([]string{hash})
+		return err == nil && len(torrents) > 0
+	case RTorrentClient:
+		return r.rTorrent.TorrentExists(hash)
+	case Aria2Client:
+		_, err := r.aria2.FindTorrent(hash)
+		return err == nil
 	default:
 		return false
 	}
@@ -145,6 +174,27 @@ func (r *Repository) GetList() ([]*Torrent, error) {
 			return nil, err
 		}
 		return r.FromTransmissionTorrents(torrents), nil
+	case DelugeClient:
+		torrents, err := r.deluge.GetTorrents(nil)
+		if err != nil {
+			r.logger.Err(err).Msg("torrent client: Error while getting torrent list (Deluge)")
+			return nil, err
+		}
+		return r.FromDelugeTorrents(torrents), nil
+	case RTorrentClient:
+		torrents, err := r.rTorrent.GetTorrents()
+		if err != nil {
+			r.logger.Err(err).Msg("torrent client: Error while getting torrent list (rTorrent)")
+			return nil, err
+		}
+		return r.FromRTorrentTorrents(torrents), nil
+	case Aria2Client:
+		torrents, err := r.aria2.GetTorrents()
+		if err != nil {
+			r.logger.Err(err).Msg("torrent client: Error while getting torrent list (aria2)")
+			return nil, err
+		}
+		return r.FromAria2Torrents(torrents), nil
 	default:
 		return nil, errors.New("torrent client: No torrent client provider found")
 	}
@@ -195,6 +245,22 @@ func (r *Repository) GetActiveCount(ret *ActiveCount) {
 			}
 		}
 		return
+	case DelugeClient, RTorrentClient, Aria2Client:
+		torrents, err := r.GetList()
+		if err != nil {
+			return
+		}
+		for _, t := range torrents {
+			switch t.Status {
+			case TorrentStatusDownloading:
+				ret.Downloading++
+			case TorrentStatusSeeding:
+				ret.Seeding++
+			case TorrentStatusPaused:
+				ret.Paused++
+			}
+		}
+		return
 	default:
 		return
 	}
@@ -241,6 +307,30 @@ func (r *Repository) AddMagnets(magnets []string, dest string) error {
 				break
 			}
 		}
+	case DelugeClient:
+		for _, magnet := range magnets {
+			_, err = r.deluge.AddMagnet(magnet, dest)
+			if err != nil {
+				r.logger.Err(err).Msg("torrent client: Error while adding magnets (Deluge)")
+				break
+			}
+		}
+	case RTorrentClient:
+		for _, magnet := range magnets {
+			err = r.rTorrent.AddMagnet(magnet, dest)
+			if err != nil {
+				r.logger.Err(err).Msg("torrent client: Error while adding magnets (rTorrent)")
+				break
+			}
+		}
+	case Aria2Client:
+		for _, magnet := range magnets {
+			_, err = r.aria2.AddUri([]string{magnet}, map[string]string{"dir": dest})
+			if err != nil {
+				r.logger.Err(err).Msg("torrent client: Error while adding magnets (aria2)")
+				break
+			}
+		}
 	case NoneClient:
 		return errors.New("torrent client: No torrent client selected")
 	}
@@ -256,12 +346,17 @@ func (r *Repository) AddMagnets(magnets []string, dest string) error {
 }
 
 func (r *Repository) RemoveTorrents(hashes []string) error {
-	r.logger.Trace().Msg("torrent client: Removing torrents")
+	return r.RemoveTorrentsWithData(hashes, true)
+}
+
+// RemoveTorrentsWithData removes the torrents, and their downloaded files if removeData is true.
+func (r *Repository) RemoveTorrentsWithData(hashes []string, removeData bool) error {
+	r.logger.Trace().Bool("removeData", removeData).Msg("torrent client: Removing torrents")
 
 	var err error
 	switch r.provider {
 	case QbittorrentClient:
-		err = r.qBittorrentClient.Torrent.DeleteTorrents(hashes, true)
+		err = r.qBittorrentClient.Torrent.DeleteTorrents(hashes, removeData)
 	case TransmissionClient:
 		torrents, err := r.transmission.Client.TorrentGetAllForHashes(context.Background(), hashes)
 		if err != nil {
@@ -274,12 +369,18 @@ func (r *Repository) RemoveTorrents(hashes []string) error {
 		}
 		err = r.transmission.Client.TorrentRemove(context.Background(), transmissionrpc.TorrentRemovePayload{
 			IDs:             ids,
-			DeleteLocalData: true,
+			DeleteLocalData: removeData,
 		})
 		if err != nil {
 			r.logger.Err(err).Msg("torrent client: Error while removing torrents (Transmission)")
 			return err
 		}
+	case DelugeClient:
+		err = r.deluge.RemoveTorrents(hashes, removeData)
+	case RTorrentClient:
+		err = r.rTorrent.RemoveTorrents(hashes, removeData)
+	case Aria2Client:
+		err = r.removeAria2Torrents(hashes, removeData)
 	}
 	if err != nil {
 		r.logger.Err(err).Msg("torrent client: Error while removing torrents")
@@ -299,6 +400,12 @@ func (r *Repository) PauseTorrents(hashes []string) error {
 		err = r.qBittorrentClient.Torrent.StopTorrents(hashes)
 	case TransmissionClient:
 		err = r.transmission.Client.TorrentStopHashes(context.Background(), hashes)
+	case DelugeClient:
+		err = r.deluge.PauseTorrents(hashes)
+	case RTorrentClient:
+		err = r.rTorrent.PauseTorrents(hashes)
+	case Aria2Client:
+		err = r.forEachAria2Torrent(hashes, r.aria2.Pause)
 	}
 
 	if err != nil {
@@ -320,6 +427,12 @@ func (r *Repository) ResumeTorrents(hashes []string) error {
 		err = r.qBittorrentClient.Torrent.ResumeTorrents(hashes)
 	case TransmissionClient:
 		err = r.transmission.Client.TorrentStartHashes(context.Background(), hashes)
+	case DelugeClient:
+		err = r.deluge.ResumeTorrents(hashes)
+	case RTorrentClient:
+		err = r.rTorrent.ResumeTorrents(hashes)
+	case Aria2Client:
+		err = r.forEachAria2Torrent(hashes, r.aria2.Unpause)
 	}
 
 	if err != nil {
@@ -357,6 +470,14 @@ func (r *Repository) DeselectFiles(hash string, indices []int) error {
 			FilesUnwanted: ind,
 			IDs:           []int64{id},
 		})
+	case DelugeClient:
+		err = r.deluge.DeselectFiles(hash, indices)
+	case RTorrentClient:
+		err = r.rTorrent.DeselectFiles(hash, indices)
+	case Aria2Client:
+		err = r.forEachAria2Torrent([]string{hash}, func(gid string) error {
+			return r.aria2.DeselectFiles(gid, indices)
+		})
 	}
 
 	if err != nil {
@@ -409,6 +530,31 @@ func (r *Repository) GetFiles(hash string) (filenames []string, err error) {
 						}
 						return
 					}
+				case DelugeClient:
+					delugeFiles, err := r.deluge.GetFiles(hash)
+					if err == nil && len(delugeFiles) > 0 {
+						r.logger.Debug().Str("hash", hash).Int("count", len(delugeFiles)).Msg("torrent client: Retrieved torrent files")
+						for _, f := range delugeFiles {
+							filenames = append(filenames, f.Path)
+						}
+						return
+					}
+				case RTorrentClient:
+					rTorrentFiles, err := r.rTorrent.GetFiles(hash)
+					if err == nil && len(rTorrentFiles) > 0 {
+						r.logger.Debug().Str("hash", hash).Int("count", len(rTorrentFiles)).Msg("torrent client: Retrieved torrent files")
+						filenames = append(filenames, rTorrentFiles...)
+						return
+					}
+				case Aria2Client:
+					// The torrent is not found until the metadata of the magnet link is downloaded
+					aria2Torrent, err := r.aria2.FindTorrent(hash)
+					if err == nil && len(aria2Torrent.Files) > 0 && aria2Torrent.Bittorrent != nil && aria2Torrent.Bittorrent.Info != nil {
+						aria2Files := aria2Torrent.GetFilePaths()
+						r.logger.Debug().Str("hash", hash).Int("count", len(aria2Files)).Msg("torrent client: Retrieved torrent files")
+						filenames = append(filenames, aria2Files...)
+						return
+					}
 				}
 			}
 		}
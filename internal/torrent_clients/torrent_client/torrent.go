@@ -3,8 +3,13 @@ package torrent_client
 import (
 	"github.com/dustin/go-humanize"
 	"github.com/hekmon/transmissionrpc/v3"
+	"seanime/internal/torrent_clients/aria2"
+	"seanime/internal/torrent_clients/deluge"
 	"seanime/internal/torrent_clients/qbittorrent/model"
+	"seanime/internal/torrent_clients/rtorrent"
 	"seanime/internal/util"
+	"strings"
+	"time"
 )
 
 const (
@@ -27,6 +32,9 @@ type (
 		Eta         string        `json:"eta"`
 		Status      TorrentStatus `json:"status"`
 		ContentPath string        `json:"contentPath"`
+		Ratio       float64       `json:"ratio"`
+		SeedingTime int           `json:"seedingTime"`    // Seconds, 0 if unknown
+		Tags        []string      `json:"tags,omitempty"` // qBittorrent only
 	}
 	TorrentStatus string
 )
@@ -91,6 +99,16 @@ func (r *Repository) FromTransmissionTorrent(t *transmissionrpc.Torrent) *Torren
 		torrent.ContentPath = *t.DownloadDir
 	}
 
+	torrent.Ratio = 0
+	if t.UploadRatio != nil && *t.UploadRatio > 0 { // Negative values are used for "not available"
+		torrent.Ratio = *t.UploadRatio
+	}
+
+	torrent.SeedingTime = 0
+	if t.TimeSeeding != nil {
+		torrent.SeedingTime = int(t.TimeSeeding.Seconds())
+	}
+
 	torrent.Status = TorrentStatusOther
 	if t.Status != nil && t.IsFinished != nil {
 		torrent.Status = fromTransmissionTorrentStatus(*t.Status, *t.IsFinished)
@@ -133,6 +151,9 @@ func (r *Repository) FromQbitTorrent(t *qbittorrent_model.Torrent) *Torrent {
 	torrent.Size = humanize.Bytes(uint64(t.Size))
 	torrent.Eta = util.FormatETA(t.Eta)
 	torrent.ContentPath = t.ContentPath
+	torrent.Ratio = t.Ratio
+	torrent.SeedingTime = t.SeedingTime
+	torrent.Tags = splitTags(t.Tags)
 	torrent.Status = fromQbitTorrentStatus(t.State)
 
 	return torrent
@@ -162,3 +183,171 @@ func fromQbitTorrentStatus(st qbittorrent_model.TorrentState) TorrentStatus {
 		return TorrentStatusOther
 	}
 }
+
+func (r *Repository) FromDelugeTorrents(t []*deluge.Torrent) []*Torrent {
+	ret := make([]*Torrent, 0, len(t))
+	for _, t := range t {
+		ret = append(ret, r.FromDelugeTorrent(t))
+	}
+	return ret
+}
+
+func (r *Repository) FromDelugeTorrent(t *deluge.Torrent) *Torrent {
+	torrent := &Torrent{}
+
+	torrent.Name = t.Name
+	torrent.Hash = t.Hash
+	torrent.Seeds = t.NumSeeds
+	torrent.UpSpeed = util.ToHumanReadableSpeed(t.UploadRate)
+	torrent.DownSpeed = util.ToHumanReadableSpeed(t.DownloadRate)
+	torrent.Progress = t.Progress / 100 // Deluge reports the progress as a percentage
+	torrent.Size = humanize.Bytes(uint64(t.TotalSize))
+	torrent.Eta = util.FormatETA(t.Eta)
+	torrent.ContentPath = t.SavePath
+	torrent.Ratio = t.Ratio
+	torrent.SeedingTime = t.SeedingTime
+	torrent.Status = fromDelugeTorrentStatus(t.State, t.IsFinished)
+
+	return torrent
+}
+
+// fromDelugeTorrentStatus returns a normalized status for the torrent.
+func fromDelugeTorrentStatus(st string, isFinished bool) TorrentStatus {
+	switch st {
+	case "Seeding":
+		return TorrentStatusSeeding
+	case "Paused":
+		if isFinished {
+			return TorrentStatusStopped
+		}
+		return TorrentStatusPaused
+	case "Downloading", "Checking", "Queued", "Allocating", "Moving":
+		return TorrentStatusDownloading
+	default:
+		return TorrentStatusOther
+	}
+}
+
+func (r *Repository) FromRTorrentTorrents(t []*rtorrent.Torrent) []*Torrent {
+	ret := make([]*Torrent, 0, len(t))
+	for _, t := range t {
+		ret = append(ret, r.FromRTorrentTorrent(t))
+	}
+	return ret
+}
+
+func (r *Repository) FromRTorrentTorrent(t *rtorrent.Torrent) *Torrent {
+	torrent := &Torrent{}
+
+	torrent.Name = t.Name
+	torrent.Hash = t.Hash
+	torrent.Seeds = t.Seeders
+	torrent.UpSpeed = util.ToHumanReadableSpeed(int(t.UpRate))
+	torrent.DownSpeed = util.ToHumanReadableSpeed(int(t.DownRate))
+	torrent.Progress = 0.0
+	if t.Size > 0 {
+		torrent.Progress = float64(t.CompletedBytes) / float64(t.Size)
+	}
+	torrent.Size = humanize.Bytes(uint64(t.Size))
+	torrent.Eta = "???"
+	if t.DownRate > 0 {
+		torrent.Eta = util.FormatETA(int((t.Size - t.CompletedBytes) / t.DownRate))
+	}
+	torrent.ContentPath = t.Directory
+	torrent.Ratio = t.Ratio
+	torrent.SeedingTime = 0
+	if t.Complete && t.FinishedAt > 0 {
+		// rTorrent doesn't track the seeding time, the time since completion is used instead
+		torrent.SeedingTime = int(time.Now().Unix() - t.FinishedAt)
+	}
+	torrent.Status = fromRTorrentTorrentStatus(t)
+
+	return torrent
+}
+
+// fromRTorrentTorrentStatus returns a normalized status for the torrent.
+// rTorrent has no state string, a torrent is paused when it's started but inactive.
+func fromRTorrentTorrentStatus(t *rtorrent.Torrent) TorrentStatus {
+	if !t.Started {
+		if t.Complete {
+			return TorrentStatusStopped
+		}
+		return TorrentStatusPaused
+	}
+	if !t.Active {
+		return TorrentStatusPaused
+	}
+	if t.Complete {
+		return TorrentStatusSeeding
+	}
+	return TorrentStatusDownloading
+}
+
+func (r *Repository) FromAria2Torrents(t []*aria2.Download) []*Torrent {
+	ret := make([]*Torrent, 0, len(t))
+	for _, t := range t {
+		ret = append(ret, r.FromAria2Torrent(t))
+	}
+	return ret
+}
+
+func (r *Repository) FromAria2Torrent(t *aria2.Download) *Torrent {
+	torrent := &Torrent{}
+
+	torrent.Name = t.GetName()
+	torrent.Hash = t.InfoHash
+	torrent.Seeds = t.GetNumSeeders()
+	torrent.UpSpeed = util.ToHumanReadableSpeed(int(t.GetUploadSpeed()))
+	torrent.DownSpeed = util.ToHumanReadableSpeed(int(t.GetDownloadSpeed()))
+	torrent.Progress = 0.0
+	if t.GetTotalLength() > 0 {
+		torrent.Progress = float64(t.GetCompletedLength()) / float64(t.GetTotalLength())
+	}
+	torrent.Size = humanize.Bytes(uint64(t.GetTotalLength()))
+	torrent.Eta = "???"
+	if t.GetDownloadSpeed() > 0 {
+		torrent.Eta = util.FormatETA(int((t.GetTotalLength() - t.GetCompletedLength()) / t.GetDownloadSpeed()))
+	}
+	torrent.ContentPath = t.Dir
+	torrent.Ratio = 0
+	if t.GetCompletedLength() > 0 {
+		torrent.Ratio = float64(t.GetUploadLength()) / float64(t.GetCompletedLength())
+	}
+	torrent.Status = fromAria2TorrentStatus(t)
+
+	return torrent
+}
+
+// fromAria2TorrentStatus returns a normalized status for the torrent.
+func fromAria2TorrentStatus(t *aria2.Download) TorrentStatus {
+	complete := t.GetTotalLength() > 0 && t.GetCompletedLength() == t.GetTotalLength()
+	switch t.Status {
+	case aria2.StatusActive:
+		if t.IsSeeder() || complete {
+			return TorrentStatusSeeding
+		}
+		return TorrentStatusDownloading
+	case aria2.StatusWaiting:
+		return TorrentStatusDownloading
+	case aria2.StatusPaused:
+		if complete {
+			return TorrentStatusStopped
+		}
+		return TorrentStatusPaused
+	case aria2.StatusComplete:
+		return TorrentStatusStopped
+	default:
+		return TorrentStatusOther
+	}
+}
+
+// splitTags returns the tags of a comma-separated list.
+func splitTags(tags string) []string {
+	ret := make([]string, 0)
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,57 @@
+package torrent_client
+
+import (
+	"github.com/stretchr/testify/assert"
+	"seanime/internal/torrent_clients/aria2"
+	"seanime/internal/torrent_clients/rtorrent"
+	"testing"
+)
+
+func TestFromDelugeTorrentStatus(t *testing.T) {
+	assert.Equal(t, TorrentStatusSeeding, fromDelugeTorrentStatus("Seeding", true))
+	assert.Equal(t, TorrentStatusPaused, fromDelugeTorrentStatus("Paused", false))
+	assert.Equal(t, TorrentStatusStopped, fromDelugeTorrentStatus("Paused", true))
+	assert.Equal(t, TorrentStatusDownloading, fromDelugeTorrentStatus("Queued", false))
+	assert.Equal(t, TorrentStatusOther, fromDelugeTorrentStatus("Error", false))
+}
+
+func TestFromRTorrentTorrentStatus(t *testing.T) {
+	tests := []struct {
+		torrent  *rtorrent.Torrent
+		expected TorrentStatus
+	}{
+		{&rtorrent.Torrent{Started: true, Active: true, Complete: false}, TorrentStatusDownloading},
+		{&rtorrent.Torrent{Started: true, Active: true, Complete: true}, TorrentStatusSeeding},
+		{&rtorrent.Torrent{Started: true, Active: false, Complete: false}, TorrentStatusPaused},
+		{&rtorrent.Torrent{Started: false, Active: false, Complete: false}, TorrentStatusPaused},
+		{&rtorrent.Torrent{Started: false, Active: false, Complete: true}, TorrentStatusStopped},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, fromRTorrentTorrentStatus(tt.torrent))
+	}
+}
+
+func TestFromAria2TorrentStatus(t *testing.T) {
+	tests := []struct {
+		torrent  *aria2.Download
+		expected TorrentStatus
+	}{
+		{&aria2.Download{Status: aria2.StatusActive, TotalLength: "100", CompletedLength: "50"}, TorrentStatusDownloading},
+		{&aria2.Download{Status: aria2.StatusActive, TotalLength: "100", CompletedLength: "100", Seeder: "true"}, TorrentStatusSeeding},
+		{&aria2.Download{Status: aria2.StatusWaiting}, TorrentStatusDownloading},
+		{&aria2.Download{Status: aria2.StatusPaused, TotalLength: "100", CompletedLength: "50"}, TorrentStatusPaused},
+		{&aria2.Download{Status: aria2.StatusPaused, TotalLength: "100", CompletedLength: "100"}, TorrentStatusStopped},
+		{&aria2.Download{Status: aria2.StatusError}, TorrentStatusOther},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, fromAria2TorrentStatus(tt.torrent))
+	}
+}
+
+func TestGetInfoHashFromMagnet(t *testing.T) {
+	assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", GetInfoHashFromMagnet("magnet:?xt=urn:btih:0123456789ABCDEF0123456789ABCDEF01234567&dn=Show"))
+	assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", GetInfoHashFromMagnet("magnet:?xt=urn:btih:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH"))
+	assert.Empty(t, GetInfoHashFromMagnet("https://example.com/file.torrent"))
+}
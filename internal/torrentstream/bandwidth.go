@@ -0,0 +1,185 @@
+package torrentstream
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"seanime/internal/database/models"
+	"seanime/internal/util"
+	"time"
+
+	"github.com/samber/mo"
+	"golang.org/x/time/rate"
+)
+
+// slowSeedingSpeedLimit is the upload speed limit in KB/s when slow seeding is enabled and no limit is set.
+const slowSeedingSpeedLimit = 1024
+
+type (
+	// speedLimits are the speed limits applied to the torrent client.
+	speedLimits struct {
+		downloadSpeedLimit int    // KB/s, 0 for no limit
+		uploadSpeedLimit   int    // KB/s, 0 for no limit
+		speedProfile       string // Name of the active speed profile, empty if none
+	}
+)
+
+// applySpeedLimits updates the client's rate limiters from the settings and the active speed profile.
+// The limiters are shared by all torrents, so the limits apply live to the running streams.
+// The client's mutex must be held.
+func (c *Client) applySpeedLimits() {
+	settings, ok := c.repository.settings.Get()
+	if !ok || c.downloadLimiter == nil || c.uploadLimiter == nil {
+		return
+	}
+
+	limits := getSpeedLimits(&settings.TorrentstreamSettings, time.Now())
+	if limits == c.speedLimits {
+		return
+	}
+
+	setSpeedLimit(c.downloadLimiter, limits.downloadSpeedLimit)
+	setSpeedLimit(c.uploadLimiter, limits.uploadSpeedLimit)
+	c.speedLimits = limits
+
+	c.repository.logger.Info().
+		Int("download", limits.downloadSpeedLimit).
+		Int("upload", limits.uploadSpeedLimit).
+		Str("profile", limits.speedProfile).
+		Msg("torrentstream: Speed limits updated")
+}
+
+// updateBandwidthSettings applies the settings to the running client if only the bandwidth settings changed.
+// Returns false if the module needs to be reinitialized.
+func (r *Repository) updateBandwidthSettings(settings *models.TorrentstreamSettings, host string, port int) bool {
+	current, ok := r.settings.Get()
+	if !ok || settings == nil || !settings.Enabled || r.client.torrentClient.IsAbsent() {
+		return false
+	}
+	if current.Host != host || current.Port != port {
+		return false
+	}
+
+	next := *settings
+	r.setDefaultSettings(&next)
+
+	prev := current.TorrentstreamSettings
+	prev.BaseModel, next.BaseModel = models.BaseModel{}, models.BaseModel{}
+	// Nothing changed, or a setting requires a new client
+	if reflect.DeepEqual(prev, next) || !reflect.DeepEqual(withoutBandwidthSettings(prev), withoutBandwidthSettings(next)) {
+		return false
+	}
+
+	current.TorrentstreamSettings = next
+	current.TorrentstreamSettings.BaseModel = settings.BaseModel
+	r.settings = mo.Some(current)
+
+	r.client.mu.Lock()
+	r.client.applySpeedLimits()
+	r.client.applyConnectionBudget()
+	r.client.mu.Unlock()
+
+	r.logger.Info().Msg("torrentstream: Bandwidth settings updated")
+	return true
+}
+
+// CheckSettingsUpdate returns an error if the settings require a new torrent client while streams are active.
+// Creating a new client drops the torrents of the streams, only the bandwidth settings can be changed live.
+func (r *Repository) CheckSettingsUpdate(settings *models.TorrentstreamSettings) error {
+	current, ok := r.settings.Get()
+	if !ok || settings == nil {
+		return nil
+	}
+
+	r.client.mu.Lock()
+	active := len(r.client.streams) > 0 || r.client.loadingCount > 0
+	r.client.mu.Unlock()
+	if !active {
+		return nil
+	}
+
+	if settings.Enabled {
+		next := *settings
+		r.setDefaultSettings(&next)
+		prev := current.TorrentstreamSettings
+		prev.BaseModel, next.BaseModel = models.BaseModel{}, models.BaseModel{}
+		if reflect.DeepEqual(withoutBandwidthSettings(prev), withoutBandwidthSettings(next)) {
+			return nil
+		}
+	}
+
+	return errors.New("torrentstream: Cannot change these settings while a stream is active")
+}
+
+// ValidateSpeedProfiles returns an error if a speed profile has an invalid time window.
+func ValidateSpeedProfiles(profiles models.TorrentstreamSpeedProfiles) error {
+	for _, p := range profiles {
+		if p == nil {
+			continue
+		}
+		if _, err := util.ParseTimeOfDay(p.StartTime); err != nil {
+			return fmt.Errorf("torrentstream: Invalid start time for speed profile %q", p.Name)
+		}
+		if _, err := util.ParseTimeOfDay(p.EndTime); err != nil {
+			return fmt.Errorf("torrentstream: Invalid end time for speed profile %q", p.Name)
+		}
+		for _, d := range p.Days {
+			if d < 0 || d > 6 {
+				return fmt.Errorf("torrentstream: Invalid day for speed profile %q", p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// getSpeedLimits returns the speed limits at the given time.
+// The first active speed profile overrides the limits of the settings.
+func getSpeedLimits(settings *models.TorrentstreamSettings, now time.Time) speedLimits {
+	limits := speedLimits{
+		downloadSpeedLimit: max(settings.DownloadSpeedLimit, 0),
+		uploadSpeedLimit:   max(settings.UploadSpeedLimit, 0),
+	}
+
+	for _, p := range settings.SpeedProfiles {
+		if p != nil && isSpeedProfileActive(p, now) {
+			limits = speedLimits{
+				downloadSpeedLimit: max(p.DownloadSpeedLimit, 0),
+				uploadSpeedLimit:   max(p.UploadSpeedLimit, 0),
+				speedProfile:       p.Name,
+			}
+			break
+		}
+	}
+
+	if limits.uploadSpeedLimit == 0 && settings.SlowSeeding {
+		limits.uploadSpeedLimit = slowSeedingSpeedLimit
+	}
+
+	return limits
+}
+
+// isSpeedProfileActive returns true if the time is within the profile's time window.
+func isSpeedProfileActive(p *models.TorrentstreamSpeedProfile, now time.Time) bool {
+	return util.IsInTimeWindow(p.StartTime, p.EndTime, p.Days, now)
+}
+
+// setSpeedLimit updates the limiter to a speed in KB/s, 0 for no limit.
+func setSpeedLimit(l *rate.Limiter, kbps int) {
+	if kbps <= 0 {
+		l.SetLimit(rate.Inf)
+		return
+	}
+	bps := kbps * 1024
+	// The burst must fit a whole chunk, it's updated first so the limiter never rejects one
+	l.SetBurst(max(bps, 1<<18))
+	l.SetLimit(rate.Limit(bps))
+}
+
+// withoutBandwidthSettings returns the settings without the ones that can be applied live.
+func withoutBandwidthSettings(s models.TorrentstreamSettings) models.TorrentstreamSettings {
+	s.MaxConnections = 0
+	s.DownloadSpeedLimit = 0
+	s.UploadSpeedLimit = 0
+	s.SpeedProfiles = nil
+	return s
+}
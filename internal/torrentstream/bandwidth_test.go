@@ -0,0 +1,157 @@
+package torrentstream
+
+import (
+	"seanime/internal/database/models"
+	"seanime/internal/util"
+	"testing"
+	"time"
+
+	"github.com/samber/mo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestGetSpeedLimits(t *testing.T) {
+	settings := &models.TorrentstreamSettings{
+		DownloadSpeedLimit: 0,
+		UploadSpeedLimit:   0,
+		SlowSeeding:        true,
+		SpeedProfiles: models.TorrentstreamSpeedProfiles{
+			{
+				Name:               "Work",
+				Days:               []int{1, 2, 3, 4, 5},
+				StartTime:          "09:00",
+				EndTime:            "17:00",
+				DownloadSpeedLimit: 500,
+				UploadSpeedLimit:   100,
+			},
+			{
+				Name:               "Night",
+				Days:               []int{5}, // Friday night
+				StartTime:          "23:00",
+				EndTime:            "02:00",
+				DownloadSpeedLimit: 2000,
+			},
+		},
+	}
+
+	// 2024-01-01 is a Monday
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected speedLimits
+	}{
+		{
+			name:     "Monday morning",
+			now:      time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local),
+			expected: speedLimits{downloadSpeedLimit: 500, uploadSpeedLimit: 100, speedProfile: "Work"},
+		},
+		{
+			name:     "Monday evening",
+			now:      time.Date(2024, 1, 1, 17, 0, 0, 0, time.Local),
+			expected: speedLimits{uploadSpeedLimit: slowSeedingSpeedLimit},
+		},
+		{
+			name:     "Saturday afternoon",
+			now:      time.Date(2024, 1, 6, 12, 0, 0, 0, time.Local),
+			expected: speedLimits{uploadSpeedLimit: slowSeedingSpeedLimit},
+		},
+		{
+			name:     "Friday night",
+			now:      time.Date(2024, 1, 5, 23, 30, 0, 0, time.Local),
+			expected: speedLimits{downloadSpeedLimit: 2000, uploadSpeedLimit: slowSeedingSpeedLimit, speedProfile: "Night"},
+		},
+		{
+			name:     "Friday night, after midnight",
+			now:      time.Date(2024, 1, 6, 1, 59, 0, 0, time.Local),
+			expected: speedLimits{downloadSpeedLimit: 2000, uploadSpeedLimit: slowSeedingSpeedLimit, speedProfile: "Night"},
+		},
+		{
+			name:     "Thursday night, after midnight",
+			now:      time.Date(2024, 1, 5, 1, 0, 0, 0, time.Local),
+			expected: speedLimits{uploadSpeedLimit: slowSeedingSpeedLimit},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, getSpeedLimits(settings, tt.now))
+		})
+	}
+}
+
+func TestValidateSpeedProfiles(t *testing.T) {
+	assert.NoError(t, ValidateSpeedProfiles(models.TorrentstreamSpeedProfiles{
+		{Name: "Work", StartTime: "09:00", EndTime: "17:30", Days: []int{0, 6}},
+	}))
+	assert.Error(t, ValidateSpeedProfiles(models.TorrentstreamSpeedProfiles{
+		{Name: "Work", StartTime: "9am", EndTime: "17:30"},
+	}))
+	assert.Error(t, ValidateSpeedProfiles(models.TorrentstreamSpeedProfiles{
+		{Name: "Work", StartTime: "09:00", EndTime: "17:30", Days: []int{7}},
+	}))
+}
+
+func TestApplySpeedLimits(t *testing.T) {
+	r := NewRepository(&NewRepositoryOptions{Logger: util.NewLogger()})
+	r.settings = mo.Some(Settings{
+		TorrentstreamSettings: models.TorrentstreamSettings{
+			DownloadSpeedLimit: 1024,
+		},
+	})
+	r.client.downloadLimiter = rate.NewLimiter(rate.Inf, 0)
+	r.client.uploadLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	r.client.mu.Lock()
+	defer r.client.mu.Unlock()
+
+	r.client.applySpeedLimits()
+	assert.Equal(t, rate.Limit(1024*1024), r.client.downloadLimiter.Limit())
+	assert.Equal(t, 1024*1024, r.client.downloadLimiter.Burst())
+	assert.Equal(t, rate.Inf, r.client.uploadLimiter.Limit())
+
+	// The burst fits a whole chunk
+	r.settings = mo.Some(Settings{
+		TorrentstreamSettings: models.TorrentstreamSettings{
+			DownloadSpeedLimit: 10,
+		},
+	})
+	r.client.applySpeedLimits()
+	require.Equal(t, rate.Limit(10*1024), r.client.downloadLimiter.Limit())
+	assert.Equal(t, 1<<18, r.client.downloadLimiter.Burst())
+
+	r.settings = mo.Some(Settings{})
+	r.client.applySpeedLimits()
+	assert.Equal(t, rate.Inf, r.client.downloadLimiter.Limit())
+}
+
+func TestCheckSettingsUpdate(t *testing.T) {
+	r := NewRepository(&NewRepositoryOptions{Logger: util.NewLogger()})
+	current := models.TorrentstreamSettings{
+		Enabled:     true,
+		DownloadDir: t.TempDir(),
+		CacheDir:    t.TempDir(),
+	}
+	r.setDefaultSettings(&current)
+	r.settings = mo.Some(Settings{TorrentstreamSettings: current})
+
+	changed := current
+	changed.TorrentClientPort = 43215
+	bandwidth := current
+	bandwidth.DownloadSpeedLimit = 1024
+
+	// No active stream
+	require.NoError(t, r.CheckSettingsUpdate(&changed))
+
+	r.client.mu.Lock()
+	r.client.setStream(&clientStream{clientId: "a"})
+	r.client.mu.Unlock()
+
+	assert.NoError(t, r.CheckSettingsUpdate(&bandwidth))
+	assert.Error(t, r.CheckSettingsUpdate(&changed))
+
+	disabled := current
+	disabled.Enabled = false
+	assert.Error(t, r.CheckSettingsUpdate(&disabled))
+}
@@ -0,0 +1,362 @@
+package torrentstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// The cache keeps the files of completed streams so that rewatching an episode does not use the swarm.
+// Files are stored in {cacheDir}/{mediaId}/{filename} and evicted from the least recently watched
+// once the total size exceeds the maximum cache size.
+
+type (
+	// CacheEntry is a cached episode.
+	CacheEntry struct {
+		*models.TorrentstreamCacheEntry
+		Filename string `json:"filename"`
+	}
+
+	// CacheSummary describes the content of the cache.
+	CacheSummary struct {
+		Entries   []*CacheEntry `json:"entries"`
+		TotalSize int64         `json:"totalSize"`
+		MaxSize   int64         `json:"maxSize"`
+	}
+)
+
+func (r *Repository) isCacheEnabled() bool {
+	settings, ok := r.settings.Get()
+	return ok && settings.CacheMaxSize > 0 && settings.CacheDir != ""
+}
+
+// GetCache returns the cached episodes from the most recently watched.
+func (r *Repository) GetCache() (*CacheSummary, error) {
+	entries, err := r.db.GetTorrentstreamCacheEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &CacheSummary{
+		Entries: make([]*CacheEntry, 0, len(entries)),
+	}
+	if settings, ok := r.settings.Get(); ok {
+		ret.MaxSize = int64(settings.CacheMaxSize) * 1024 * 1024
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		ret.Entries = append(ret.Entries, &CacheEntry{
+			TorrentstreamCacheEntry: entries[i],
+			Filename:                filepath.Base(entries[i].Path),
+		})
+		ret.TotalSize += entries[i].Size
+	}
+	return ret, nil
+}
+
+// RemoveCacheEntries deletes the cached episodes.
+func (r *Repository) RemoveCacheEntries(ids []uint) error {
+	for _, id := range ids {
+		entry, err := r.db.GetTorrentstreamCacheEntry(id)
+		if err != nil {
+			return err
+		}
+		if err := r.deleteCacheEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getCachedEpisode returns the cache entry of the episode if its file is still on disk.
+func (r *Repository) getCachedEpisode(mediaId int, episodeNumber int) (*models.TorrentstreamCacheEntry, bool) {
+	if !r.isCacheEnabled() {
+		return nil, false
+	}
+
+	entry, err := r.db.GetTorrentstreamCacheEntryByEpisode(mediaId, episodeNumber)
+	if err != nil {
+		return nil, false
+	}
+
+	if info, err := os.Stat(entry.Path); err != nil || info.Size() != entry.Size {
+		r.logger.Debug().Str("path", entry.Path).Msg("torrentstream: Cached file is missing, removing entry")
+		_ = r.deleteCacheEntry(entry)
+		return nil, false
+	}
+
+	_ = r.db.TouchTorrentstreamCacheEntry(entry.ID)
+	return entry, true
+}
+
+// cacheStreamFile copies the completed file of a stream to the cache, then evicts the least recently watched episodes.
+func (r *Repository) cacheStreamFile(mediaId int, episodeNumber int, t *torrent.Torrent, f *torrent.File) {
+	defer util.HandlePanicInModuleThen("torrentstream/cacheStreamFile", func() {})
+
+	if !r.isCacheEnabled() || mediaId == 0 {
+		return
+	}
+	settings := r.settings.MustGet()
+
+	if entry, err := r.db.GetTorrentstreamCacheEntryByEpisode(mediaId, episodeNumber); err == nil {
+		if entry.InfoHash == t.InfoHash().HexString() && entry.Size == f.Length() {
+			// Already cached
+			_ = r.db.TouchTorrentstreamCacheEntry(entry.ID)
+			return
+		}
+		// Replace the previous file of the episode
+		_ = r.deleteCacheEntry(entry)
+	}
+
+	if f.Length() > int64(settings.CacheMaxSize)*1024*1024 {
+		r.logger.Debug().Str("file", f.DisplayPath()).Msg("torrentstream: File is larger than the cache, not caching")
+		return
+	}
+
+	dest := filepath.Join(settings.CacheDir, strconv.Itoa(mediaId), filepath.Base(f.DisplayPath()))
+	if err := copyTorrentFile(f, dest); err != nil {
+		r.logger.Warn().Err(err).Str("file", f.DisplayPath()).Msg("torrentstream: Failed to cache file")
+		return
+	}
+
+	err := r.db.InsertTorrentstreamCacheEntry(&models.TorrentstreamCacheEntry{
+		MediaId:        mediaId,
+		EpisodeNumber:  episodeNumber,
+		InfoHash:       t.InfoHash().HexString(),
+		Path:           dest,
+		Size:           f.Length(),
+		LastAccessedAt: time.Now(),
+	})
+	if err != nil {
+		_ = os.Remove(dest)
+		r.logger.Error().Err(err).Msg("torrentstream: Failed to save cache entry")
+		return
+	}
+
+	r.logger.Info().Int("mediaId", mediaId).Int("episode", episodeNumber).Msgf("torrentstream: Cached %s", filepath.Base(dest))
+
+	r.evictCache()
+}
+
+// evictCache deletes the least recently watched episodes until the cache fits its maximum size.
+func (r *Repository) evictCache() {
+	settings, ok := r.settings.Get()
+	if !ok || settings.CacheMaxSize <= 0 {
+		return
+	}
+	maxSize := int64(settings.CacheMaxSize) * 1024 * 1024
+
+	entries, err := r.db.GetTorrentstreamCacheEntries()
+	if err != nil {
+		r.logger.Error().Err(err).Msg("torrentstream: Failed to get cache entries")
+		return
+	}
+
+	var totalSize int64
+	for _, entry := range entries {
+		totalSize += entry.Size
+	}
+
+	for _, entry := range entries {
+		if totalSize <= maxSize {
+			break
+		}
+		r.logger.Debug().Str("path", entry.Path).Msg("torrentstream: Evicting cached file")
+		if err := r.deleteCacheEntry(entry); err != nil {
+			r.logger.Warn().Err(err).Str("path", entry.Path).Msg("torrentstream: Failed to evict cached file")
+			continue
+		}
+		totalSize -= entry.Size
+	}
+}
+
+func (r *Repository) deleteCacheEntry(entry *models.TorrentstreamCacheEntry) error {
+	if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Remove the media directory if it's empty
+	_ = os.Remove(filepath.Dir(entry.Path))
+	return r.db.DeleteTorrentstreamCacheEntry(entry.ID)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type PromoteCacheEntryOptions struct {
+	ID          uint
+	LibraryPath string // Library path to move the file to, defaults to the main library path
+}
+
+// PromoteCacheEntry moves a cached episode to the library.
+// The file is added to the local files, matched with the media and episode it was streamed for.
+func (r *Repository) PromoteCacheEntry(opts *PromoteCacheEntryOptions) (ret *anime.LocalFile, err error) {
+	defer util.HandlePanicInModuleWithError("torrentstream/PromoteCacheEntry", &err)
+
+	entry, err := r.db.GetTorrentstreamCacheEntry(opts.ID)
+	if err != nil {
+		return nil, errors.New("cache entry not found")
+	}
+
+	settings, err := r.db.GetSettings()
+	if err != nil || settings == nil || settings.Library == nil {
+		return nil, errors.New("library settings not found")
+	}
+
+	libraryPath := opts.LibraryPath
+	if libraryPath == "" {
+		libraryPath = settings.Library.LibraryPath
+	}
+	if libraryPath == "" || (!isLibraryPath(settings.Library.GetLibraryPaths(), libraryPath) && !util.IsSubdirectoryOfAny(settings.Library.GetLibraryPaths(), libraryPath)) {
+		return nil, errors.New("invalid library path")
+	}
+
+	media, _, err := r.getMediaInfo(entry.MediaId)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(libraryPath, util.SanitizePathSegment(media.GetTitleSafe()))
+	dest := filepath.Join(dir, filepath.Base(entry.Path))
+	if _, err := os.Stat(dest); err == nil {
+		return nil, fmt.Errorf("%s already exists", dest)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := util.MoveFile(entry.Path, dest); err != nil {
+		return nil, err
+	}
+
+	// The media and episode are known, no need to match the file
+	lf := anime.NewLocalFile(dest, libraryPath)
+	lf.MediaId = entry.MediaId
+	lf.Locked = true
+	lf.Metadata = &anime.LocalFileMetadata{
+		Episode:      entry.EpisodeNumber,
+		AniDBEpisode: strconv.Itoa(entry.EpisodeNumber),
+		Type:         anime.LocalFileTypeMain,
+	}
+	if media.IsMovie() {
+		lf.Metadata.AniDBEpisode = "1"
+	}
+
+	_, err = db_bridge.UpdateLocalFiles(r.db, func(lfs []*anime.LocalFile) []*anime.LocalFile {
+		return append(lfs, lf)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The file was moved
+	_ = os.Remove(filepath.Dir(entry.Path))
+	if err := r.db.DeleteTorrentstreamCacheEntry(entry.ID); err != nil {
+		return nil, err
+	}
+
+	r.logger.Info().Int("mediaId", entry.MediaId).Int("episode", entry.EpisodeNumber).Msgf("torrentstream: Promoted cached file to %s", dest)
+
+	return lf, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// getCacheStreamingUrl returns the URL of the cached file, served by ServeCacheHTTP.
+func (r *Repository) getCacheStreamingUrl(entry *models.TorrentstreamCacheEntry) string {
+	settings, ok := r.settings.Get()
+	if !ok {
+		return ""
+	}
+
+	host := settings.Host
+	if host == "0.0.0.0" {
+		host = "127.0.0.1"
+	}
+	address := fmt.Sprintf("%s:%d", host, settings.Port)
+	if settings.StreamUrlAddress != "" {
+		address = settings.StreamUrlAddress
+	}
+	_url := fmt.Sprintf("http://%s/api/v1/torrentstream/cache/stream/%d/%s", address, entry.ID, url.PathEscape(filepath.Base(entry.Path)))
+	if strings.HasPrefix(_url, "http://http") {
+		_url = strings.Replace(_url, "http://http", "http", 1)
+	}
+	return _url
+}
+
+// HTTPCacheHandler serves the cached files.
+//
+//	e.g. /api/v1/torrentstream/cache/stream/{id}/{filename}
+func (r *Repository) HTTPCacheHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, rest, found := strings.Cut(req.URL.Path, "/cache/stream/")
+		if !found {
+			http.Error(w, "Invalid stream path", http.StatusBadRequest)
+			return
+		}
+		idStr, _, _ := strings.Cut(rest, "/")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid stream path", http.StatusBadRequest)
+			return
+		}
+
+		entry, err := r.db.GetTorrentstreamCacheEntry(uint(id))
+		if err != nil {
+			http.Error(w, "Cached file not found", http.StatusNotFound)
+			return
+		}
+
+		r.logger.Trace().Str("path", entry.Path).Msg("torrentstream: Serving cached file")
+		http.ServeFile(w, req, entry.Path)
+	})
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// copyTorrentFile writes the content of the torrent file to the destination.
+func copyTorrentFile(f *torrent.File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return err
+	}
+
+	reader := f.NewReader()
+	defer reader.Close()
+
+	tmp := dest + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(out, reader)
+	_ = out.Close()
+	if err == nil && n != f.Length() {
+		err = fmt.Errorf("copied %d bytes out of %d", n, f.Length())
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dest)
+}
+
+func isLibraryPath(libraryPaths []string, p string) bool {
+	for _, lp := range libraryPaths {
+		if lp != "" && util.NormalizePath(lp) == util.NormalizePath(p) {
+			return true
+		}
+	}
+	return false
+}
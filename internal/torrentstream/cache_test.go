@@ -0,0 +1,134 @@
+package torrentstream
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"seanime/internal/events"
+	"seanime/internal/util"
+	"testing"
+	"time"
+
+	"github.com/samber/mo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCacheRepository(t *testing.T, cacheMaxSize int) *Repository {
+	logger := util.NewLogger()
+	database, err := db.NewDatabase(t.TempDir(), "seanime-test", logger)
+	require.NoError(t, err)
+
+	r := NewRepository(&NewRepositoryOptions{Logger: logger, Database: database, WSEventManager: events.NewMockWSEventManager(logger)})
+	r.settings = mo.Some(Settings{
+		TorrentstreamSettings: models.TorrentstreamSettings{
+			CacheDir:     t.TempDir(),
+			CacheMaxSize: cacheMaxSize,
+		},
+	})
+	return r
+}
+
+func TestCacheStreamFile(t *testing.T) {
+	r := newTestCacheRepository(t, 1)
+	cl, dataDir := newTestTorrentClient(t, r)
+
+	batch := addTestBatch(t, cl, dataDir, "batch", "ep01.mkv", "ep02.mkv")
+	batch.VerifyData()
+	f := batch.Files()[1]
+	require.Equal(t, f.Length(), f.BytesCompleted())
+
+	r.cacheStreamFile(1, 2, batch, f)
+
+	entry, found := r.getCachedEpisode(1, 2)
+	require.True(t, found)
+	assert.Equal(t, batch.InfoHash().HexString(), entry.InfoHash)
+	assert.Equal(t, filepath.Join(r.settings.MustGet().CacheDir, "1", "ep02.mkv"), entry.Path)
+
+	data, err := os.ReadFile(entry.Path)
+	require.NoError(t, err)
+	expected, err := os.ReadFile(filepath.Join(dataDir, "batch", "ep02.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, expected, data)
+
+	// A missing file invalidates the entry
+	require.NoError(t, os.Remove(entry.Path))
+	_, found = r.getCachedEpisode(1, 2)
+	assert.False(t, found)
+
+	entries, err := r.db.GetTorrentstreamCacheEntries()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestEvictCache(t *testing.T) {
+	r := newTestCacheRepository(t, 1) // 1 MB
+	cacheDir := r.settings.MustGet().CacheDir
+
+	// Episode 1 is the least recently watched
+	now := time.Now()
+	for ep, lastAccessed := range map[int]time.Time{
+		1: now.Add(-3 * time.Hour),
+		2: now.Add(-1 * time.Hour),
+		3: now.Add(-2 * time.Hour),
+	} {
+		p := filepath.Join(cacheDir, "1", fmt.Sprintf("ep%02d.mkv", ep))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), os.ModePerm))
+		require.NoError(t, os.WriteFile(p, make([]byte, 400*1024), 0644))
+		require.NoError(t, r.db.InsertTorrentstreamCacheEntry(&models.TorrentstreamCacheEntry{
+			MediaId:        1,
+			EpisodeNumber:  ep,
+			Path:           p,
+			Size:           400 * 1024,
+			LastAccessedAt: lastAccessed,
+		}))
+	}
+
+	r.evictCache()
+
+	summary, err := r.GetCache()
+	require.NoError(t, err)
+	require.Len(t, summary.Entries, 2)
+	assert.Equal(t, 2, summary.Entries[0].EpisodeNumber) // Most recently watched first
+	assert.Equal(t, 3, summary.Entries[1].EpisodeNumber)
+	assert.Equal(t, int64(800*1024), summary.TotalSize)
+
+	_, err = os.Stat(filepath.Join(cacheDir, "1", "ep01.mkv"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Watching episode 3 again makes episode 2 the next to be evicted
+	_, found := r.getCachedEpisode(1, 3)
+	require.True(t, found)
+	summary, err = r.GetCache()
+	require.NoError(t, err)
+	assert.Equal(t, 3, summary.Entries[0].EpisodeNumber)
+}
+
+func TestStartCachedStream(t *testing.T) {
+	r := newTestCacheRepository(t, 1)
+
+	entry := &models.TorrentstreamCacheEntry{
+		MediaId:       1,
+		EpisodeNumber: 2,
+		InfoHash:      "80431b4f9a12f4e06616062d3d3973b9ef99b5e6",
+		Path:          filepath.Join(r.settings.MustGet().CacheDir, "1", "ep02.mkv"),
+		Size:          1024,
+	}
+	opts := &StartStreamOptions{ClientId: "a", MediaId: 1, EpisodeNumber: 2, PlaybackType: PlaybackTypeExternalPlayer}
+
+	r.startCachedStream(opts, nil, "2", entry)
+
+	// The cached stream is listed like the others
+	streams := r.GetStreams()
+	require.Len(t, streams, 1)
+	assert.Equal(t, "a", streams[0].ClientId)
+	assert.Equal(t, entry.InfoHash, streams[0].InfoHash)
+	assert.Equal(t, "ep02.mkv", streams[0].Filename)
+	assert.Equal(t, float64(100), streams[0].Status.ProgressPercentage)
+
+	// Stopping it doesn't drop any torrent
+	require.NoError(t, r.StopStream("a"))
+	assert.Empty(t, r.GetStreams())
+}
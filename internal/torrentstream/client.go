@@ -9,7 +9,10 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"seanime/internal/database/models"
 	"seanime/internal/mediaplayers/mediaplayer"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -22,23 +25,51 @@ import (
 	"golang.org/x/time/rate"
 )
 
+// dropThreshold is the completion percentage under which the torrent of a stopped stream is dropped.
+const dropThreshold = 70
+
+// defaultMaxConnections is the number of peer connections of a torrent when no budget is set.
+var defaultMaxConnections = torrent.NewDefaultClientConfig().EstablishedConnsPerTorrent
+
 type (
 	Client struct {
 		repository *Repository
 
-		torrentClient        mo.Option[*torrent.Client]
-		currentTorrent       mo.Option[*torrent.Torrent]
-		currentFile          mo.Option[*torrent.File]
-		currentTorrentStatus TorrentStatus
-		cancelFunc           context.CancelFunc
+		torrentClient mo.Option[*torrent.Client]
+		streams       map[string]*clientStream // Key: client ID
+		loadingCount  int                      // Number of streams being started
+		cancelFunc    context.CancelFunc
 
 		mu                          sync.Mutex
 		stopCh                      chan struct{}                    // Closed when the media player stops
 		mediaPlayerPlaybackStatusCh chan *mediaplayer.PlaybackStatus // Continuously receives playback status
+		mediaPlayerClientId         mo.Option[string]                // Client whose stream is played by the media player
 		timeSinceLoggedSeeding      time.Time
-		lastSpeedCheck              time.Time // Track the last time we checked speeds
-		lastBytesCompleted          int64     // Track the last bytes completed
-		lastBytesWrittenData        int64     // Track the last bytes written data
+		downloadLimiter             *rate.Limiter // Shared by all torrents
+		uploadLimiter               *rate.Limiter // Shared by all torrents
+		speedLimits                 speedLimits   // Limits currently applied to the rate limiters
+	}
+
+	// clientStream is a stream started by a client.
+	// Each client can only have one stream at a time.
+	clientStream struct {
+		clientId      string
+		mediaId       int
+		episodeNumber int
+		playbackType  PlaybackType
+		torrent       *torrent.Torrent
+		file          *torrent.File
+		status        TorrentStatus
+		// Stores the video duration returned by the media player
+		// When this is greater than 0, the video is considered to be playing
+		currentVideoDuration int
+		prefetching          bool                            // Whether the next episode has been requested
+		prefetched           *prefetchedEpisode              // Next episode, set once it has been resolved
+		cached               bool                            // Whether the file has been copied to the cache
+		cacheEntry           *models.TorrentstreamCacheEntry // Set when the episode is played from the cache, the torrent and file are nil
+		lastSpeedCheck       time.Time                       // Track the last time we checked speeds
+		lastBytesCompleted   int64                           // Track the last bytes completed
+		lastBytesWrittenData int64                           // Track the last bytes written data
 	}
 
 	TorrentStatus struct {
@@ -49,6 +80,22 @@ type (
 		UploadSpeed        string  `json:"uploadSpeed"`
 		Size               string  `json:"size"`
 		Seeders            int     `json:"seeders"`
+		DownloadSpeedLimit int     `json:"downloadSpeedLimit"` // KB/s, 0 for no limit
+		UploadSpeedLimit   int     `json:"uploadSpeedLimit"`   // KB/s, 0 for no limit
+		MaxConnections     int     `json:"maxConnections"`     // Peer connections shared by all streams, 0 for the default
+		SpeedProfile       string  `json:"speedProfile"`       // Name of the active speed profile, empty if none
+	}
+
+	// StreamInfo describes a running stream.
+	StreamInfo struct {
+		ClientId      string        `json:"clientId"`
+		MediaId       int           `json:"mediaId"`
+		EpisodeNumber int           `json:"episodeNumber"`
+		PlaybackType  PlaybackType  `json:"playbackType"`
+		TorrentName   string        `json:"torrentName"`
+		InfoHash      string        `json:"infoHash"`
+		Filename      string        `json:"filename"`
+		Status        TorrentStatus `json:"status"`
 	}
 
 	NewClientOptions struct {
@@ -60,18 +107,19 @@ func NewClient(repository *Repository) *Client {
 	ret := &Client{
 		repository:                  repository,
 		torrentClient:               mo.None[*torrent.Client](),
-		currentFile:                 mo.None[*torrent.File](),
-		currentTorrent:              mo.None[*torrent.Torrent](),
+		streams:                     make(map[string]*clientStream),
 		stopCh:                      make(chan struct{}),
 		mediaPlayerPlaybackStatusCh: make(chan *mediaplayer.PlaybackStatus, 1),
+		mediaPlayerClientId:         mo.None[string](),
 	}
 
 	return ret
 }
 
 // initializeClient will create and torrent client.
-// The client is designed to support only one torrent at a time, and seed it.
-// Upon initialization, the client will drop all torrents.
+// The client supports one stream per client ID, all streams share the connection and bandwidth budget.
+// Upon initialization, the client will drop all torrents and the active streams, and empty the download directory.
+// Settings that require a new client are refused while streams are active, see Repository.CheckSettingsUpdate.
 func (c *Client) initializeClient() error {
 	// Fail if no settings
 	if err := c.repository.FailIfNoSettings(); err != nil {
@@ -98,10 +146,22 @@ func (c *Client) initializeClient() error {
 
 	if settings.SlowSeeding {
 		cfg.DialRateLimiter = rate.NewLimiter(rate.Limit(1), 1)
-		cfg.UploadRateLimiter = rate.NewLimiter(rate.Limit(1<<20), 2<<20)
 		// cfg.DisableAggressiveUpload = true
 	}
 
+	// Global budget shared by all streams
+	if settings.MaxConnections > 0 {
+		cfg.EstablishedConnsPerTorrent = min(cfg.EstablishedConnsPerTorrent, settings.MaxConnections)
+		cfg.HalfOpenConnsPerTorrent = min(cfg.HalfOpenConnsPerTorrent, settings.MaxConnections)
+		cfg.TotalHalfOpenConns = min(cfg.TotalHalfOpenConns, settings.MaxConnections)
+	}
+	// The limiters are kept so the speed limits can be updated without restarting the client
+	// The limits are set by applySpeedLimits
+	downloadLimiter := rate.NewLimiter(rate.Inf, 0)
+	uploadLimiter := rate.NewLimiter(rate.Inf, 0)
+	cfg.DownloadRateLimiter = downloadLimiter
+	cfg.UploadRateLimiter = uploadLimiter
+
 	//cfg.DisableAggressiveUpload = true
 	//cfg.Debug = true
 
@@ -126,6 +186,12 @@ func (c *Client) initializeClient() error {
 	}
 	c.repository.logger.Info().Msgf("torrentstream: Initialized torrent client on port %d", settings.TorrentClientPort)
 	c.torrentClient = mo.Some(client)
+	c.streams = make(map[string]*clientStream)
+	c.mediaPlayerClientId = mo.None[string]()
+	c.downloadLimiter = downloadLimiter
+	c.uploadLimiter = uploadLimiter
+	c.speedLimits = speedLimits{}
+	c.applySpeedLimits()
 	c.dropTorrents()
 	c.mu.Unlock()
 
@@ -136,103 +202,50 @@ func (c *Client) initializeClient() error {
 			case <-ctx.Done():
 				c.repository.logger.Debug().Msg("torrentstream: Context cancelled, stopping torrent client")
 				return
-			//case <-c.stopCh:
-			//	c.mu.Lock()
-			//	c.stopCh = make(chan struct{})
-			//	c.repository.logger.Debug().Msg("torrentstream: Handling media player stopped event")
-			//	// This is to prevent the client from downloading the whole torrent when the user stops watching
-			//	// Also, the torrent might be a batch - so we don't want to download the whole thing
-			//	if c.currentTorrent.IsPresent() {
-			//		if c.currentTorrentStatus.ProgressPercentage < 70 {
-			//			c.repository.logger.Debug().Msg("torrentstream: Dropping torrent, completion is less than 70%")
-			//			c.dropTorrents()
-			//		}
-			//		c.repository.logger.Debug().Msg("torrentstream: Resetting current torrent and status")
-			//	}
-			//	c.currentTorrent = mo.None[*torrent.Torrent]()                  // Reset the current torrent
-			//	c.currentFile = mo.None[*torrent.File]()                        // Reset the current file
-			//	c.currentTorrentStatus = TorrentStatus{}                        // Reset the torrent status
-			//	c.repository.serverManager.stopServer()                         // Stop streaming server
-			//	c.repository.wsEventManager.SendEvent(eventTorrentStopped, nil) // Send torrent stopped event
-			//	c.repository.mediaPlayerRepository.Stop()                       // Stop the media player gracefully if it's running
-			//	c.mu.Unlock()
 
 			case status := <-c.mediaPlayerPlaybackStatusCh:
 				// DEVNOTE: When this is received, "default" case is executed right after
-				if status != nil && c.currentFile.IsPresent() && c.repository.playback.currentVideoDuration == 0 {
-					// If the stored video duration is 0 but the media player status shows a duration that is not 0
-					// we know that the video has been loaded and is playing
-					if c.repository.playback.currentVideoDuration == 0 && status.Duration > 0 {
-						// The media player has started playing the video
-						c.repository.logger.Debug().Msg("torrentstream: Media player started playing the video, sending event")
-						c.repository.wsEventManager.SendEvent(eventTorrentStartedPlaying, nil)
-						// Update the stored video duration
-						c.repository.playback.currentVideoDuration = status.Duration
-					}
+				c.mu.Lock()
+				s, found := c.getMediaPlayerStream()
+				// If the stored video duration is 0 but the media player status shows a duration that is not 0
+				// we know that the video has been loaded and is playing
+				if status != nil && found && s.currentVideoDuration == 0 && status.Duration > 0 {
+					// The media player has started playing the video
+					c.repository.logger.Debug().Str("clientId", s.clientId).Msg("torrentstream: Media player started playing the video, sending event")
+					c.repository.sendStreamEvent(s.clientId, eventTorrentStartedPlaying, nil)
+					// Update the stored video duration
+					s.currentVideoDuration = status.Duration
+				}
+				// Resolve the next episode in the background once the threshold is passed
+				if status != nil && found && !s.prefetching && status.CompletionPercentage >= prefetchThreshold {
+					s.prefetching = true
+					go c.repository.prefetchNextEpisode(s.clientId, s.mediaId, s.episodeNumber, s.torrent)
 				}
+				c.mu.Unlock()
 			default:
 				c.mu.Lock()
-				if c.torrentClient.IsPresent() && c.currentTorrent.IsPresent() && c.currentFile.IsPresent() {
-					t := c.currentTorrent.MustGet()
-					f := c.currentFile.MustGet()
-
-					// Get the current time
-					now := time.Now()
-					elapsed := now.Sub(c.lastSpeedCheck).Seconds()
-
-					// downloadProgress is the number of bytes downloaded
-					downloadProgress := t.BytesCompleted()
-
-					downloadSpeed := ""
-					if elapsed > 0 {
-						bytesPerSecond := float64(downloadProgress-c.lastBytesCompleted) / elapsed
-						if bytesPerSecond > 0 {
-							downloadSpeed = fmt.Sprintf("%s/s", humanize.Bytes(uint64(bytesPerSecond)))
+				if c.torrentClient.IsPresent() {
+					// Switch the speed profile when its time window starts or ends
+					c.applySpeedLimits()
+					for _, s := range c.streams {
+						if s.isFromCache() {
+							continue
 						}
-					}
-					size := humanize.Bytes(uint64(f.Length()))
-
-					bytesWrittenData := t.Stats().BytesWrittenData
-					uploadSpeed := ""
-					if elapsed > 0 {
-						bytesPerSecond := float64((&bytesWrittenData).Int64()-c.lastBytesWrittenData) / elapsed
-						if bytesPerSecond > 0 {
-							uploadSpeed = fmt.Sprintf("%s/s", humanize.Bytes(uint64(bytesPerSecond)))
+						c.updateStreamStatus(s)
+						// Keep the file once it's complete
+						if !s.cached && s.status.ProgressPercentage >= 100 {
+							s.cached = true
+							go c.repository.cacheStreamFile(s.mediaId, s.episodeNumber, s.torrent, s.file)
 						}
+						c.repository.sendStreamEvent(s.clientId, eventTorrentStatus, s.status)
+						// Always log the progress so the user knows what's happening
+						c.repository.logger.Trace().Str("clientId", s.clientId).Msgf("torrentstream: Progress: %.2f%%, Download speed: %s, Upload speed: %s, Size: %s",
+							s.status.ProgressPercentage,
+							s.status.DownloadSpeed,
+							s.status.UploadSpeed,
+							s.status.Size)
+						c.timeSinceLoggedSeeding = time.Now()
 					}
-
-					// Update the stored values for next calculation
-					c.lastBytesCompleted = downloadProgress
-					c.lastBytesWrittenData = (&bytesWrittenData).Int64()
-					c.lastSpeedCheck = now
-
-					if t.PeerConns() != nil {
-						c.currentTorrentStatus.Seeders = len(t.PeerConns())
-					}
-
-					//// If the torrent status went from 0% to > 0%, send an event, as the torrent has been loaded
-					//if c.currentTorrentStatus.ProgressPercentage == 0. && c.getTorrentPercentage(c.currentTorrent) > 0. {
-					//	c.repository.logger.Debug().Msg("torrentstream: Torrent loaded, sending event")
-					//	c.repository.wsEventManager.SendEvent(eventTorrentLoaded, nil)
-					//}
-
-					c.currentTorrentStatus = TorrentStatus{
-						Size:               size,
-						UploadProgress:     (&bytesWrittenData).Int64() - c.currentTorrentStatus.UploadProgress,
-						DownloadSpeed:      downloadSpeed,
-						UploadSpeed:        uploadSpeed,
-						DownloadProgress:   downloadProgress,
-						ProgressPercentage: c.getTorrentPercentage(c.currentTorrent, c.currentFile),
-						Seeders:            t.Stats().ConnectedSeeders,
-					}
-					c.repository.wsEventManager.SendEvent(eventTorrentStatus, c.currentTorrentStatus)
-					// Always log the progress so the user knows what's happening
-					c.repository.logger.Trace().Msgf("torrentstream: Progress: %.2f%%, Download speed: %s, Upload speed: %s, Size: %s",
-						c.currentTorrentStatus.ProgressPercentage,
-						c.currentTorrentStatus.DownloadSpeed,
-						c.currentTorrentStatus.UploadSpeed,
-						c.currentTorrentStatus.Size)
-					c.timeSinceLoggedSeeding = time.Now()
 				}
 				c.mu.Unlock()
 				if c.torrentClient.IsPresent() {
@@ -253,11 +266,65 @@ func (c *Client) initializeClient() error {
 	return nil
 }
 
-func (c *Client) GetStreamingUrl() string {
+// updateStreamStatus refreshes the status of the stream.
+// The client's mutex must be held.
+func (c *Client) updateStreamStatus(s *clientStream) {
+	t := s.torrent
+	f := s.file
+
+	// Get the current time
+	now := time.Now()
+	elapsed := now.Sub(s.lastSpeedCheck).Seconds()
+
+	// downloadProgress is the number of bytes downloaded
+	downloadProgress := t.BytesCompleted()
+
+	downloadSpeed := ""
+	if elapsed > 0 {
+		bytesPerSecond := float64(downloadProgress-s.lastBytesCompleted) / elapsed
+		if bytesPerSecond > 0 {
+			downloadSpeed = fmt.Sprintf("%s/s", humanize.Bytes(uint64(bytesPerSecond)))
+		}
+	}
+	size := humanize.Bytes(uint64(f.Length()))
+
+	bytesWrittenData := t.Stats().BytesWrittenData
+	uploadSpeed := ""
+	if elapsed > 0 {
+		bytesPerSecond := float64((&bytesWrittenData).Int64()-s.lastBytesWrittenData) / elapsed
+		if bytesPerSecond > 0 {
+			uploadSpeed = fmt.Sprintf("%s/s", humanize.Bytes(uint64(bytesPerSecond)))
+		}
+	}
+
+	// Update the stored values for next calculation
+	s.lastBytesCompleted = downloadProgress
+	s.lastBytesWrittenData = (&bytesWrittenData).Int64()
+	s.lastSpeedCheck = now
+
+	s.status = TorrentStatus{
+		Size:               size,
+		UploadProgress:     (&bytesWrittenData).Int64() - s.status.UploadProgress,
+		DownloadSpeed:      downloadSpeed,
+		UploadSpeed:        uploadSpeed,
+		DownloadProgress:   downloadProgress,
+		ProgressPercentage: c.getTorrentPercentage(mo.Some(t), mo.Some(f)),
+		Seeders:            t.Stats().ConnectedSeeders,
+		DownloadSpeedLimit: c.speedLimits.downloadSpeedLimit,
+		UploadSpeedLimit:   c.speedLimits.uploadSpeedLimit,
+		MaxConnections:     c.repository.settings.OrEmpty().MaxConnections,
+		SpeedProfile:       c.speedLimits.speedProfile,
+	}
+}
+
+func (c *Client) GetStreamingUrl(clientId string) string {
 	if c.torrentClient.IsAbsent() {
 		return ""
 	}
-	if c.currentFile.IsAbsent() {
+	c.mu.Lock()
+	s, found := c.streams[clientId]
+	c.mu.Unlock()
+	if !found {
 		return ""
 	}
 	settings, ok := c.repository.settings.Get()
@@ -265,6 +332,13 @@ func (c *Client) GetStreamingUrl() string {
 		return ""
 	}
 
+	if s.isFromCache() {
+		return c.repository.getCacheStreamingUrl(s.cacheEntry)
+	}
+
+	// e.g. {infohash}/{file path}
+	streamPath := s.torrent.InfoHash().HexString() + "/" + url.PathEscape(s.file.DisplayPath())
+
 	if !settings.UseSeparateServer {
 		host := settings.Host
 		if host == "0.0.0.0" {
@@ -274,23 +348,20 @@ func (c *Client) GetStreamingUrl() string {
 		if settings.StreamUrlAddress != "" {
 			address = settings.StreamUrlAddress
 		}
-		_url := fmt.Sprintf("http://%s/api/v1/torrentstream/stream/%s", address, url.PathEscape(c.currentFile.MustGet().DisplayPath()))
+		_url := fmt.Sprintf("http://%s/api/v1/torrentstream/stream/%s", address, streamPath)
 		if strings.HasPrefix(_url, "http://http") {
 			_url = strings.Replace(_url, "http://http", "http", 1)
 		}
 		return _url
 	}
 
-	//if settings.StreamingServerHost == "0.0.0.0" {
-	//	return fmt.Sprintf("http://127.0.0.1:%d/stream/%s", settings.StreamingServerPort, url.PathEscape(c.currentFile.MustGet().DisplayPath()))
-	//}
 	host := settings.StreamingServerHost
 	if host == "" {
 		host = "127.0.0.1"
 	}
-	_url := fmt.Sprintf("http://%s:%d/stream/%s", host, settings.StreamingServerPort, url.PathEscape(c.currentFile.MustGet().DisplayPath()))
+	_url := fmt.Sprintf("http://%s:%d/stream/%s", host, settings.StreamingServerPort, streamPath)
 	if settings.StreamUrlAddress != "" {
-		_url = fmt.Sprintf("http://%s/stream/%s", settings.StreamUrlAddress, url.PathEscape(c.currentFile.MustGet().DisplayPath()))
+		_url = fmt.Sprintf("http://%s/stream/%s", settings.StreamUrlAddress, streamPath)
 		if strings.HasPrefix(_url, "http://http") {
 			_url = strings.Replace(_url, "http://http", "http", 1)
 		}
@@ -303,11 +374,6 @@ func (c *Client) AddTorrent(id string) (*torrent.Torrent, error) {
 		return nil, errors.New("torrent client is not initialized")
 	}
 
-	// Drop all torrents
-	for _, t := range c.torrentClient.MustGet().Torrents() {
-		t.Drop()
-	}
-
 	if strings.HasPrefix(id, "magnet") {
 		return c.addTorrentMagnet(id)
 	}
@@ -319,6 +385,23 @@ func (c *Client) AddTorrent(id string) (*torrent.Torrent, error) {
 	return c.addTorrentFromFile(id)
 }
 
+// addTorrentPaused is like AddTorrent but the torrent's data is not downloaded until it is streamed.
+// Torrents that are already streamed are not paused.
+func (c *Client) addTorrentPaused(id string) (*torrent.Torrent, error) {
+	t, err := c.AddTorrent(id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Pieces are only requested once a file is prioritized, so no data has been downloaded yet
+	if !c.isStreamed(t.InfoHash().AsString()) {
+		t.DisallowDataDownload()
+	}
+	return t, nil
+}
+
 func (c *Client) addTorrentMagnet(magnet string) (*torrent.Torrent, error) {
 	if c.torrentClient.IsAbsent() {
 		return nil, errors.New("torrent client is not initialized")
@@ -407,9 +490,11 @@ func (c *Client) Shutdown() (errs []error) {
 	if c.torrentClient.IsAbsent() {
 		return
 	}
+	c.mu.Lock()
 	c.dropTorrents()
-	c.currentTorrent = mo.None[*torrent.Torrent]()
-	c.currentTorrentStatus = TorrentStatus{}
+	c.streams = make(map[string]*clientStream)
+	c.mediaPlayerClientId = mo.None[string]()
+	c.mu.Unlock()
 	c.repository.logger.Debug().Msg("torrentstream: Closing torrent client")
 	return c.torrentClient.MustGet().Close()
 }
@@ -436,6 +521,15 @@ func (c *Client) RemoveTorrent(infoHash string) error {
 
 	c.repository.logger.Trace().Msgf("torrentstream: Removing torrent: %s", infoHash)
 
+	// Do not remove a torrent that is being streamed by another client
+	c.mu.Lock()
+	streamed := c.isStreamed(infoHash)
+	c.mu.Unlock()
+	if streamed {
+		c.repository.logger.Debug().Msgf("torrentstream: Torrent is being streamed, not removing: %s", infoHash)
+		return nil
+	}
+
 	torrents := c.torrentClient.MustGet().Torrents()
 	for _, t := range torrents {
 		if t.InfoHash().AsString() == infoHash {
@@ -488,6 +582,205 @@ func (c *Client) getTorrentPercentage(t mo.Option[*torrent.Torrent], f mo.Option
 	return float64(f.MustGet().BytesCompleted()) / float64(f.MustGet().Length()) * 100
 }
 
-func (c *Client) readyToStream() bool {
-	return c.getTorrentPercentage(c.currentTorrent, c.currentFile) > 5.
+func (c *Client) readyToStream(clientId string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, found := c.streams[clientId]
+	if !found {
+		return false
+	}
+	return c.getTorrentPercentage(mo.Some(s.torrent), mo.Some(s.file)) > 5.
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// isFromCache returns true if the episode is played from the cache instead of the torrent.
+func (s *clientStream) isFromCache() bool {
+	return s.cacheEntry != nil
+}
+
+// setStream sets the stream of the client, replacing the previous one.
+// The client's mutex must be held.
+func (c *Client) setStream(s *clientStream) {
+	prev, found := c.streams[s.clientId]
+	c.streams[s.clientId] = s
+	if found {
+		c.releaseStream(prev, false)
+	}
+	if s.playbackType == PlaybackTypeDefault {
+		c.mediaPlayerClientId = mo.Some(s.clientId)
+	}
+	c.applyConnectionBudget()
+}
+
+// removeStream removes the stream of the client.
+// The torrent is dropped if it's forced or below the drop threshold, unless another stream uses it.
+// The client's mutex must be held.
+func (c *Client) removeStream(clientId string, forceDrop bool) (*clientStream, bool) {
+	s, found := c.streams[clientId]
+	if !found {
+		return nil, false
+	}
+	delete(c.streams, clientId)
+	if c.isMediaPlayerStream(clientId) {
+		c.mediaPlayerClientId = mo.None[string]()
+	}
+
+	c.releaseStream(s, forceDrop)
+	c.applyConnectionBudget()
+	return s, true
+}
+
+// releaseStream drops the torrents of a stream that was removed or replaced, unless another stream uses them.
+// The client's mutex must be held.
+func (c *Client) releaseStream(s *clientStream, forceDrop bool) {
+	// This is to prevent the client from downloading the whole torrent when the user stops watching
+	// Also, the torrent might be a batch - so we don't want to download the whole thing
+	if s.torrent != nil && (forceDrop || s.status.ProgressPercentage < dropThreshold) && !c.isStreamed(s.torrent.InfoHash().AsString()) {
+		c.repository.logger.Debug().Str("clientId", s.clientId).Msgf("torrentstream: Dropping torrent, completion is %.2f%%", s.status.ProgressPercentage)
+		c.dropTorrent(s.torrent)
+	}
+
+	// The prefetched torrent was never played
+	if s.prefetched != nil && s.prefetched.torrent != s.torrent && !c.isStreamed(s.prefetched.torrent.InfoHash().AsString()) {
+		c.repository.logger.Debug().Str("clientId", s.clientId).Msg("torrentstream: Dropping prefetched torrent")
+		c.dropTorrent(s.prefetched.torrent)
+	}
+}
+
+// isMediaPlayerStream returns true if the media player is playing the stream of the client.
+// The client's mutex must be held.
+func (c *Client) isMediaPlayerStream(clientId string) bool {
+	mpClientId, ok := c.mediaPlayerClientId.Get()
+	return ok && mpClientId == clientId
+}
+
+// hasStream returns true if the client is streaming the file.
+func (c *Client) hasStream(clientId string, f *torrent.File) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, found := c.streams[clientId]
+	return found && s.file == f
+}
+
+// getMediaPlayerStream returns the stream played by the media player.
+// The client's mutex must be held.
+func (c *Client) getMediaPlayerStream() (*clientStream, bool) {
+	clientId, ok := c.mediaPlayerClientId.Get()
+	if !ok {
+		return nil, false
+	}
+	s, found := c.streams[clientId]
+	return s, found
+}
+
+// isStreamed returns true if a stream uses the torrent, including prefetched torrents.
+// The client's mutex must be held.
+func (c *Client) isStreamed(infoHash string) bool {
+	for _, s := range c.streams {
+		if s.torrent != nil && s.torrent.InfoHash().AsString() == infoHash {
+			return true
+		}
+		if s.prefetched != nil && s.prefetched.torrent.InfoHash().AsString() == infoHash {
+			return true
+		}
+	}
+	return false
+}
+
+// getStreams returns information about the running streams.
+func (c *Client) getStreams() []*StreamInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ret := make([]*StreamInfo, 0, len(c.streams))
+	for _, s := range c.streams {
+		info := &StreamInfo{
+			ClientId:      s.clientId,
+			MediaId:       s.mediaId,
+			EpisodeNumber: s.episodeNumber,
+			PlaybackType:  s.playbackType,
+			Status:        s.status,
+		}
+		if s.isFromCache() {
+			info.TorrentName = filepath.Base(s.cacheEntry.Path)
+			info.InfoHash = s.cacheEntry.InfoHash
+			info.Filename = filepath.Base(s.cacheEntry.Path)
+		} else {
+			info.TorrentName = s.torrent.Name()
+			info.InfoHash = s.torrent.InfoHash().HexString()
+			info.Filename = s.file.DisplayPath()
+		}
+		ret = append(ret, info)
+	}
+	slices.SortFunc(ret, func(a, b *StreamInfo) int {
+		return strings.Compare(a.ClientId, b.ClientId)
+	})
+	return ret
+}
+
+// findStreamFile returns the file of the stream matching the info hash and path.
+func (c *Client) findStreamFile(infoHash string, displayPath string) (*torrent.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.streams {
+		if s.torrent != nil && s.torrent.InfoHash().HexString() == infoHash && s.file.DisplayPath() == displayPath {
+			return s.file, true
+		}
+	}
+	return nil, false
+}
+
+// dropIdleTorrents drops the torrents that are not used by a stream, e.g. the last seeded torrent or previewed torrents.
+// Nothing is dropped while another stream is being started since its torrents are not tracked yet.
+// The client's mutex must be held.
+func (c *Client) dropIdleTorrents() {
+	if c.torrentClient.IsAbsent() || c.loadingCount > 0 {
+		return
+	}
+
+	for _, t := range c.torrentClient.MustGet().Torrents() {
+		if !c.isStreamed(t.InfoHash().AsString()) {
+			t.Drop()
+		}
+	}
+}
+
+// applyConnectionBudget splits the maximum number of connections between the streamed torrents.
+// The client's mutex must be held.
+func (c *Client) applyConnectionBudget() {
+	settings, ok := c.repository.settings.Get()
+	if !ok {
+		return
+	}
+
+	torrents := make(map[string]*torrent.Torrent)
+	for _, s := range c.streams {
+		if s.torrent != nil {
+			torrents[s.torrent.InfoHash().AsString()] = s.torrent
+		}
+	}
+	if len(torrents) == 0 {
+		return
+	}
+
+	perTorrent := defaultMaxConnections
+	if settings.MaxConnections > 0 {
+		perTorrent = max(settings.MaxConnections/len(torrents), 1)
+	}
+	for _, t := range torrents {
+		t.SetMaxEstablishedConns(perTorrent)
+	}
+	c.repository.logger.Trace().Msgf("torrentstream: Connection budget set to %d per torrent", perTorrent)
+}
+
+// dropTorrent drops the torrent and deletes its files.
+func (c *Client) dropTorrent(t *torrent.Torrent) {
+	infoHash := t.InfoHash().HexString()
+	t.Drop()
+
+	if c.repository.settings.IsPresent() {
+		_ = os.RemoveAll(path.Join(c.repository.settings.MustGet().DownloadDir, infoHash))
+	}
 }
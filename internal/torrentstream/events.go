@@ -26,9 +26,19 @@ const (
 	TLSStateSendingStreamToMediaPlayer TorrentLoadingStatusState = "SENDING_STREAM_TO_MEDIA_PLAYER"
 )
 
-func (r *Repository) sendTorrentLoadingStatus(event TorrentLoadingStatusState, checking string) {
-	r.wsEventManager.SendEvent(eventTorrentLoadingStatus, &TorrentLoadingStatus{
+func (r *Repository) sendTorrentLoadingStatus(clientId string, event TorrentLoadingStatusState, checking string) {
+	r.sendStreamEvent(clientId, eventTorrentLoadingStatus, &TorrentLoadingStatus{
 		TorrentBeingChecked: checking,
 		State:               event,
 	})
 }
+
+// sendStreamEvent sends an event to the client of the stream.
+// The event is sent to all clients if the client is unknown.
+func (r *Repository) sendStreamEvent(clientId string, t string, payload interface{}) {
+	if clientId == "" {
+		r.wsEventManager.SendEvent(t, payload)
+		return
+	}
+	r.wsEventManager.SendEventTo(clientId, t, payload)
+}
@@ -25,9 +25,14 @@ type (
 		Torrent *torrent.Torrent
 		File    *torrent.File
 	}
+
+	findBestTorrentOptions struct {
+		ClientId string // Client receiving the loading statuses
+		Prefetch bool   // Resolve the torrent silently and add it paused
+	}
 )
 
-func (r *Repository) findBestTorrent(media *anilist.CompleteAnime, aniDbEpisode string, episodeNumber int) (ret *playbackTorrent, err error) {
+func (r *Repository) findBestTorrent(media *anilist.CompleteAnime, aniDbEpisode string, episodeNumber int, opts findBestTorrentOptions) (ret *playbackTorrent, err error) {
 	defer util.HandlePanicInModuleWithError("torrentstream/findBestTorrent", &err)
 
 	r.logger.Debug().Msgf("torrentstream: Finding best torrent for %s, Episode %d", media.GetTitleSafe(), episodeNumber)
@@ -51,7 +56,7 @@ func (r *Repository) findBestTorrent(media *anilist.CompleteAnime, aniDbEpisode
 		searchBatch = true
 	}
 
-	r.sendTorrentLoadingStatus(TLSStateSearchingTorrents, "")
+	r.sendFinderStatus(opts, TLSStateSearchingTorrents, "")
 
 	var data *itorrent.SearchData
 searchLoop:
@@ -122,7 +127,7 @@ searchLoop:
 		if tries >= 2 {
 			break
 		}
-		r.sendTorrentLoadingStatus(TLSStateAddingTorrent, searchT.Name)
+		r.sendFinderStatus(opts, TLSStateAddingTorrent, searchT.Name)
 		r.logger.Trace().Msgf("torrentstream: Getting torrent magnet")
 		magnet, err := providerExtension.GetProvider().GetTorrentMagnetLink(searchT)
 		if err != nil {
@@ -132,26 +137,25 @@ searchLoop:
 		}
 		r.logger.Debug().Msgf("torrentstream: Adding torrent %s from magnet", searchT.Link)
 
-		t, err := r.client.AddTorrent(magnet)
+		var t *torrent.Torrent
+		if opts.Prefetch {
+			t, err = r.client.addTorrentPaused(magnet)
+		} else {
+			t, err = r.client.AddTorrent(magnet)
+		}
 		if err != nil {
 			r.logger.Warn().Err(err).Msgf("torrentstream: Error adding torrent %s", searchT.Link)
 			tries++
 			continue
 		}
 
-		r.sendTorrentLoadingStatus(TLSStateCheckingTorrent, searchT.Name)
+		r.sendFinderStatus(opts, TLSStateCheckingTorrent, searchT.Name)
 
 		// If the torrent has only one file, return it
 		if len(t.Files()) == 1 {
 			tFile := t.Files()[0]
 			tFile.Download()
-			firstPieceIdx := tFile.Offset() * int64(t.NumPieces()) / t.Length()
-			endPieceIdx := (tFile.Offset() + tFile.Length()) * int64(t.NumPieces()) / t.Length()
-			numPiecesForFivePercent := (endPieceIdx - firstPieceIdx + 1) * 5 / 100
-			r.logger.Debug().Msgf("torrentstream: Setting priority for pieces %d to %d", firstPieceIdx, firstPieceIdx+numPiecesForFivePercent)
-			for idx := firstPieceIdx; idx <= firstPieceIdx+numPiecesForFivePercent; idx++ {
-				t.Piece(int(idx)).SetPriority(torrent.PiecePriorityNow)
-			}
+			prioritizeFileStart(t, tFile, torrent.PiecePriorityNow)
 			r.logger.Debug().Msgf("torrentstream: Found single file torrent: %s", tFile.DisplayPath())
 
 			return &playbackTorrent{
@@ -160,7 +164,7 @@ searchLoop:
 			}, nil
 		}
 
-		r.sendTorrentLoadingStatus(TLSStateSelectingFile, searchT.Name)
+		r.sendFinderStatus(opts, TLSStateSelectingFile, searchT.Name)
 
 		// DEVNOTE: The gap between adding the torrent and file analysis causes some pieces to be downloaded
 		// We currently can't Pause/Resume torrents so :shrug:
@@ -220,14 +224,7 @@ searchLoop:
 		}
 		tFile := t.Files()[analysisFile.GetIndex()]
 		r.logger.Debug().Msgf("torrentstream: Selecting file %s", tFile.DisplayPath())
-		// Calculate the number of pieces that represent 5% of the file
-		firstPieceIdx := tFile.Offset() * int64(t.NumPieces()) / t.Length()
-		endPieceIdx := (tFile.Offset() + tFile.Length()) * int64(t.NumPieces()) / t.Length()
-		numPiecesForFivePercent := (endPieceIdx - firstPieceIdx + 1) * 5 / 100
-		r.logger.Debug().Msgf("torrentstream: Setting priority for pieces %d to %d", firstPieceIdx, firstPieceIdx+numPiecesForFivePercent)
-		for idx := firstPieceIdx; idx <= firstPieceIdx+numPiecesForFivePercent; idx++ {
-			t.Piece(int(idx)).SetPriority(torrent.PiecePriorityNow)
-		}
+		prioritizeFileStart(t, tFile, torrent.PiecePriorityNow)
 		selectedTorrent = t
 		selectedFile = tFile
 		break
@@ -273,13 +270,7 @@ func (r *Repository) findBestTorrentFromManualSelection(t *hibiketorrent.AnimeTo
 	if len(selectedTorrent.Files()) == 1 {
 		tFile := selectedTorrent.Files()[0]
 		tFile.Download()
-		firstPieceIdx := tFile.Offset() * int64(selectedTorrent.NumPieces()) / selectedTorrent.Length()
-		endPieceIdx := (tFile.Offset() + tFile.Length()) * int64(selectedTorrent.NumPieces()) / selectedTorrent.Length()
-		numPiecesForFivePercent := (endPieceIdx - firstPieceIdx + 1) * 5 / 100
-		r.logger.Debug().Msgf("torrentstream: Setting priority for pieces %d to %d", firstPieceIdx, firstPieceIdx+numPiecesForFivePercent)
-		for idx := firstPieceIdx; idx <= firstPieceIdx+numPiecesForFivePercent; idx++ {
-			selectedTorrent.Piece(int(idx)).SetPriority(torrent.PiecePriorityNow)
-		}
+		prioritizeFileStart(selectedTorrent, tFile, torrent.PiecePriorityNow)
 		return &playbackTorrent{
 			Torrent: selectedTorrent,
 			File:    tFile,
@@ -354,14 +345,7 @@ func (r *Repository) findBestTorrentFromManualSelection(t *hibiketorrent.AnimeTo
 
 	tFile := selectedTorrent.Files()[fileIndex]
 	tFile.Download()
-	// Calculate the number of pieces that represent 5% of the file
-	firstPieceIdx := tFile.Offset() * int64(selectedTorrent.NumPieces()) / selectedTorrent.Length()
-	endPieceIdx := (tFile.Offset() + tFile.Length()) * int64(selectedTorrent.NumPieces()) / selectedTorrent.Length()
-	numPiecesForFivePercent := (endPieceIdx - firstPieceIdx + 1) * 5 / 100
-	r.logger.Debug().Msgf("torrentstream: Setting priority for pieces %d to %d", firstPieceIdx, firstPieceIdx+numPiecesForFivePercent)
-	for idx := firstPieceIdx; idx <= firstPieceIdx+numPiecesForFivePercent; idx++ {
-		selectedTorrent.Piece(int(idx)).SetPriority(torrent.PiecePriorityNow)
-	}
+	prioritizeFileStart(selectedTorrent, tFile, torrent.PiecePriorityNow)
 
 	ret := &playbackTorrent{
 		Torrent: selectedTorrent,
@@ -370,3 +354,11 @@ func (r *Repository) findBestTorrentFromManualSelection(t *hibiketorrent.AnimeTo
 
 	return ret, nil
 }
+
+// sendFinderStatus sends the loading status of findBestTorrent, unless the torrent is being prefetched.
+func (r *Repository) sendFinderStatus(opts findBestTorrentOptions, state TorrentLoadingStatusState, checking string) {
+	if opts.Prefetch {
+		return
+	}
+	r.sendTorrentLoadingStatus(opts.ClientId, state, checking)
+}
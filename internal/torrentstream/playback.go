@@ -7,9 +7,6 @@ import (
 type (
 	playback struct {
 		mediaPlayerCtxCancelFunc context.CancelFunc
-		// Stores the video duration returned by the media player
-		// When this is greater than 0, the video is considered to be playing
-		currentVideoDuration int
 	}
 )
 
@@ -35,29 +32,39 @@ func (r *Repository) listenToMediaPlayerEvents() {
 			case _ = <-r.mediaPlayerRepositorySubscriber.TrackingStoppedCh:
 			case _ = <-r.mediaPlayerRepositorySubscriber.PlaybackStatusCh:
 			case _ = <-r.mediaPlayerRepositorySubscriber.StreamingTrackingStartedCh:
-				// Reset the current video duration, as the video has stopped
+				// Reset the video duration of the media player's stream, as the video has stopped
 				// DEVNOTE: This is changed in client.go as well when the duration is updated over 0
-				r.playback.currentVideoDuration = 0
+				r.client.mu.Lock()
+				if s, found := r.client.getMediaPlayerStream(); found {
+					s.currentVideoDuration = 0
+				}
+				r.client.mu.Unlock()
 			case _ = <-r.mediaPlayerRepositorySubscriber.StreamingVideoCompletedCh:
 			case _ = <-r.mediaPlayerRepositorySubscriber.StreamingTrackingStoppedCh:
-				if r.client.currentTorrent.IsPresent() {
-					go func() {
+				r.client.mu.Lock()
+				s, found := r.client.getMediaPlayerStream()
+				r.client.mu.Unlock()
+				if found {
+					go func(clientId string) {
 						defer func() {
 							if r := recover(); r != nil {
 							}
 						}()
 						r.logger.Debug().Msg("torrentstream: Media player stopped event received")
-						// Stop the stream
-						_ = r.StopStream()
+						// Stop the stream played by the media player, other streams are not affected
+						r.stopClientStream(clientId)
 						// Stop the server
 						//r.serverManager.stopServer()
 						//// Signal to client.go that the media player has stopped
 						//close(r.client.stopCh)
-					}()
+					}(s.clientId)
 				}
 			case status := <-r.mediaPlayerRepositorySubscriber.StreamingPlaybackStatusCh:
+				r.client.mu.Lock()
+				_, found := r.client.getMediaPlayerStream()
+				r.client.mu.Unlock()
 				go func() {
-					if status != nil && r.client.currentTorrent.IsPresent() {
+					if status != nil && found {
 						r.client.mediaPlayerPlaybackStatusCh <- status
 					}
 				}()
@@ -0,0 +1,164 @@
+package torrentstream
+
+import (
+	"fmt"
+	"seanime/internal/api/anilist"
+	torrentanalyzer "seanime/internal/torrents/analyzer"
+	"seanime/internal/util"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"github.com/samber/lo"
+)
+
+// prefetchThreshold is the playback completion after which the next episode is resolved.
+const prefetchThreshold = 0.6
+
+type (
+	// prefetchedEpisode is the next episode of a stream, resolved while the current episode is playing.
+	prefetchedEpisode struct {
+		episodeNumber int
+		torrent       *torrent.Torrent // Same as the stream's torrent if the next episode is in the same batch
+		file          *torrent.File
+	}
+)
+
+// prefetchNextEpisode resolves the episode following the one being streamed by the client.
+//   - If the next episode is in the same torrent, the first pieces of its file are prioritized.
+//   - Otherwise, the best torrent is added paused, with its metadata ready.
+//
+// The result is used by StartStream when the client starts the next episode.
+func (r *Repository) prefetchNextEpisode(clientId string, mediaId int, episodeNumber int, current *torrent.Torrent) {
+	defer util.HandlePanicInModuleThen("torrentstream/prefetchNextEpisode", func() {})
+
+	nextEpisodeNumber := episodeNumber + 1
+
+	media, _, err := r.getMediaInfo(mediaId)
+	if err != nil {
+		r.logger.Warn().Err(err).Msg("torrentstream: Could not prefetch the next episode")
+		return
+	}
+
+	if media.IsMovie() {
+		return
+	}
+	if count := media.GetCurrentEpisodeCount(); count > 0 && nextEpisodeNumber > count {
+		r.logger.Debug().Msg("torrentstream: No next episode to prefetch")
+		return
+	}
+
+	r.logger.Debug().Str("clientId", clientId).Msgf("torrentstream: Prefetching episode %d", nextEpisodeNumber)
+
+	// Prevent other streams from dropping the torrents added while prefetching
+	r.client.mu.Lock()
+	r.client.loadingCount++
+	r.client.mu.Unlock()
+	defer func() {
+		r.client.mu.Lock()
+		r.client.loadingCount--
+		r.client.mu.Unlock()
+	}()
+
+	aniDbEpisode := strconv.Itoa(nextEpisodeNumber)
+
+	var next *playbackTorrent
+	// Look for the next episode in the current torrent first, e.g. a batch
+	if current != nil && len(current.Files()) > 1 {
+		if f, err := r.findEpisodeFile(current, media, aniDbEpisode); err == nil {
+			prioritizeFileStart(current, f, torrent.PiecePriorityHigh)
+			next = &playbackTorrent{Torrent: current, File: f}
+		}
+	}
+
+	if next == nil {
+		next, err = r.findBestTorrent(media, aniDbEpisode, nextEpisodeNumber, findBestTorrentOptions{Prefetch: true})
+		if err != nil {
+			r.logger.Warn().Err(err).Msgf("torrentstream: Could not prefetch episode %d", nextEpisodeNumber)
+			return
+		}
+	}
+
+	r.client.mu.Lock()
+	defer r.client.mu.Unlock()
+
+	// The client stopped or changed its stream while prefetching
+	s, found := r.client.streams[clientId]
+	if !found || s.mediaId != mediaId || s.episodeNumber != episodeNumber {
+		if next.Torrent != current && !r.client.isStreamed(next.Torrent.InfoHash().AsString()) {
+			r.client.dropTorrent(next.Torrent)
+		}
+		return
+	}
+
+	s.prefetched = &prefetchedEpisode{
+		episodeNumber: nextEpisodeNumber,
+		torrent:       next.Torrent,
+		file:          next.File,
+	}
+
+	r.logger.Info().Str("clientId", clientId).Msgf("torrentstream: Prefetched episode %d: %s", nextEpisodeNumber, next.File.DisplayPath())
+}
+
+// takePrefetchedEpisode returns the prefetched episode of the client if it matches the stream to start.
+// The torrent's data download is resumed and the file is prioritized.
+// The client's mutex must be held.
+func (r *Repository) takePrefetchedEpisode(opts *StartStreamOptions) (*playbackTorrent, bool) {
+	s, found := r.client.streams[opts.ClientId]
+	if !found || s.prefetched == nil || s.mediaId != opts.MediaId || s.prefetched.episodeNumber != opts.EpisodeNumber {
+		return nil, false
+	}
+	p := s.prefetched
+
+	// A manually selected torrent must be the prefetched one
+	if !opts.AutoSelect {
+		if opts.Torrent == nil || !strings.EqualFold(opts.Torrent.InfoHash, p.torrent.InfoHash().HexString()) {
+			return nil, false
+		}
+		if opts.FileIndex != nil && (*opts.FileIndex < 0 || *opts.FileIndex >= len(p.torrent.Files()) || p.torrent.Files()[*opts.FileIndex] != p.file) {
+			return nil, false
+		}
+	}
+
+	p.torrent.AllowDataDownload()
+	// Download the file and unselect the rest
+	for _, f := range p.torrent.Files() {
+		if f != p.file {
+			f.SetPriority(torrent.PiecePriorityNone)
+		}
+	}
+	p.file.Download()
+	prioritizeFileStart(p.torrent, p.file, torrent.PiecePriorityNow)
+
+	r.logger.Debug().Str("clientId", opts.ClientId).Msgf("torrentstream: Using prefetched episode %d", p.episodeNumber)
+
+	return &playbackTorrent{Torrent: p.torrent, File: p.file}, true
+}
+
+// findEpisodeFile returns the file of the episode in the torrent.
+func (r *Repository) findEpisodeFile(t *torrent.Torrent, media *anilist.CompleteAnime, aniDbEpisode string) (*torrent.File, error) {
+	filepaths := lo.Map(t.Files(), func(f *torrent.File, _ int) string {
+		return f.DisplayPath()
+	})
+
+	analyzer := torrentanalyzer.NewAnalyzer(&torrentanalyzer.NewAnalyzerOptions{
+		Logger:           r.logger,
+		Filepaths:        filepaths,
+		Media:            media,
+		Platform:         r.platform,
+		MetadataProvider: r.metadataProvider,
+		ForceMatch:       true,
+	})
+
+	analysis, err := analyzer.AnalyzeTorrentFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	analysisFile, found := analysis.GetFileByAniDBEpisode(aniDbEpisode)
+	if !found {
+		return nil, fmt.Errorf("episode %s not found in the torrent", aniDbEpisode)
+	}
+
+	return t.Files()[analysisFile.GetIndex()], nil
+}
@@ -0,0 +1,137 @@
+package torrentstream
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"seanime/internal/util"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/samber/mo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTorrentClient creates an offline torrent client.
+func newTestTorrentClient(t *testing.T, r *Repository) (*torrent.Client, string) {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.DefaultStorage = storage.NewFile(cfg.DataDir)
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.ListenPort = 0
+	cl, err := torrent.NewClient(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { cl.Close() })
+
+	r.client.torrentClient = mo.Some(cl)
+	return cl, cfg.DataDir
+}
+
+// addTestBatch adds a torrent with one file per name.
+// The files are written to the data directory, so the torrent is complete once its data is verified.
+func addTestBatch(t *testing.T, cl *torrent.Client, dataDir string, name string, filenames ...string) *torrent.Torrent {
+	dir := filepath.Join(dataDir, name)
+	require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	for i, f := range filenames {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), bytes.Repeat([]byte{byte(i + 1)}, 64*1024), 0644))
+	}
+
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(t, info.BuildFromFilePath(dir))
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+
+	tr, err := cl.AddTorrent(&metainfo.MetaInfo{InfoBytes: infoBytes})
+	require.NoError(t, err)
+	<-tr.GotInfo()
+	return tr
+}
+
+func TestTakePrefetchedEpisode(t *testing.T) {
+	r := NewRepository(&NewRepositoryOptions{Logger: util.NewLogger()})
+	cl, dataDir := newTestTorrentClient(t, r)
+
+	batch := addTestBatch(t, cl, dataDir, "batch", "ep01.mkv", "ep02.mkv")
+
+	r.client.mu.Lock()
+	r.client.setStream(&clientStream{
+		clientId:      "a",
+		mediaId:       1,
+		episodeNumber: 1,
+		playbackType:  PlaybackTypeExternalPlayer,
+		torrent:       batch,
+		file:          batch.Files()[0],
+		prefetched: &prefetchedEpisode{
+			episodeNumber: 2,
+			torrent:       batch,
+			file:          batch.Files()[1],
+		},
+	})
+
+	// Another episode
+	_, ok := r.takePrefetchedEpisode(&StartStreamOptions{ClientId: "a", MediaId: 1, EpisodeNumber: 3, AutoSelect: true})
+	assert.False(t, ok)
+
+	// Another client
+	_, ok = r.takePrefetchedEpisode(&StartStreamOptions{ClientId: "b", MediaId: 1, EpisodeNumber: 2, AutoSelect: true})
+	assert.False(t, ok)
+
+	// Manual selection of another file
+	fileIndex := 0
+	_, ok = r.takePrefetchedEpisode(&StartStreamOptions{
+		ClientId:      "a",
+		MediaId:       1,
+		EpisodeNumber: 2,
+		FileIndex:     &fileIndex,
+	})
+	assert.False(t, ok)
+
+	pt, ok := r.takePrefetchedEpisode(&StartStreamOptions{ClientId: "a", MediaId: 1, EpisodeNumber: 2, AutoSelect: true})
+	require.True(t, ok)
+	assert.Equal(t, batch, pt.Torrent)
+	assert.Equal(t, batch.Files()[1], pt.File)
+	r.client.mu.Unlock()
+}
+
+func TestReleaseStream_DropsPrefetchedTorrent(t *testing.T) {
+	r := NewRepository(&NewRepositoryOptions{Logger: util.NewLogger()})
+	cl, dataDir := newTestTorrentClient(t, r)
+
+	current := addTestBatch(t, cl, dataDir, "current", "ep01.mkv")
+	next := addTestBatch(t, cl, dataDir, "next", "ep02.mkv")
+	next.DisallowDataDownload()
+
+	r.client.mu.Lock()
+	r.client.setStream(&clientStream{
+		clientId:      "a",
+		mediaId:       1,
+		episodeNumber: 1,
+		playbackType:  PlaybackTypeExternalPlayer,
+		torrent:       current,
+		file:          current.Files()[0],
+		status:        TorrentStatus{ProgressPercentage: 100},
+		prefetched: &prefetchedEpisode{
+			episodeNumber: 2,
+			torrent:       next,
+			file:          next.Files()[0],
+		},
+	})
+
+	// The prefetched torrent is protected
+	r.client.dropIdleTorrents()
+	assert.Len(t, cl.Torrents(), 2)
+
+	// The completed torrent is kept for seeding, the prefetched torrent is dropped
+	_, found := r.client.removeStream("a", false)
+	r.client.mu.Unlock()
+	require.True(t, found)
+
+	torrents := cl.Torrents()
+	require.Len(t, torrents, 1)
+	assert.Equal(t, current.InfoHash(), torrents[0].InfoHash())
+}
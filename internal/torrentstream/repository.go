@@ -119,11 +119,16 @@ func (r *Repository) SetMediaPlayerRepository(mediaPlayerRepository *mediaplayer
 // InitModules sets the settings for the torrentstream module.
 // It should be called before any other method, to ensure the module is active.
 func (r *Repository) InitModules(settings *models.TorrentstreamSettings, host string, port int, isMainServer bool) (err error) {
+	defer util.HandlePanicInModuleWithError("torrentstream/InitModules", &err)
+
+	// Bandwidth settings are applied to the running client, so the streams are not interrupted
+	if r.updateBandwidthSettings(settings, host, port) {
+		return nil
+	}
+
 	r.client.Shutdown()
 	useSeparateServer := false
 
-	defer util.HandlePanicInModuleWithError("torrentstream/InitModules", &err)
-
 	if settings == nil {
 		r.logger.Error().Msg("torrentstream: Cannot initialize module, no settings provided")
 		r.settings = mo.None[Settings]()
@@ -139,26 +144,12 @@ func (r *Repository) InitModules(settings *models.TorrentstreamSettings, host st
 		return nil
 	}
 
-	// Set default download directory, which is a temporary directory
-	if s.DownloadDir == "" {
-		s.DownloadDir = r.getDefaultDownloadPath()
-		_ = os.MkdirAll(s.DownloadDir, os.ModePerm) // Create the directory if it doesn't exist
-	}
+	r.setDefaultSettings(&s)
 
 	// DEVNOTE: Commented code below causes error log after initializing the client
 	//// Empty the download directory
 	//_ = os.RemoveAll(s.DownloadDir)
 
-	if s.StreamingServerPort == 0 {
-		s.StreamingServerPort = 43214
-	}
-	if s.TorrentClientPort == 0 {
-		s.TorrentClientPort = 43213
-	}
-	if s.StreamingServerHost == "" {
-		s.StreamingServerHost = "127.0.0.1"
-	}
-
 	// Set the settings
 	r.settings = mo.Some(Settings{
 		TorrentstreamSettings: s,
@@ -182,6 +173,30 @@ func (r *Repository) InitModules(settings *models.TorrentstreamSettings, host st
 	return nil
 }
 
+// setDefaultSettings fills in the settings that are not set.
+func (r *Repository) setDefaultSettings(s *models.TorrentstreamSettings) {
+	// Set default download directory, which is a temporary directory
+	if s.DownloadDir == "" {
+		s.DownloadDir = r.getDefaultDownloadPath()
+		_ = os.MkdirAll(s.DownloadDir, os.ModePerm) // Create the directory if it doesn't exist
+	}
+
+	// Set default cache directory, outside the download directory since it's emptied on initialization
+	if s.CacheDir == "" {
+		s.CacheDir = r.getDefaultCacheDir()
+	}
+
+	if s.StreamingServerPort == 0 {
+		s.StreamingServerPort = 43214
+	}
+	if s.TorrentClientPort == 0 {
+		s.TorrentClientPort = 43213
+	}
+	if s.StreamingServerHost == "" {
+		s.StreamingServerHost = "127.0.0.1"
+	}
+}
+
 func (r *Repository) HTTPStreamHandler() http.Handler {
 	return r.serverManager
 }
@@ -236,3 +251,11 @@ func (r *Repository) getDefaultDownloadPath() string {
 	downloadDirPath := filepath.Join(tempDir, "seanime", "torrentstream")
 	return downloadDirPath
 }
+
+func (r *Repository) getDefaultCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "seanime", "torrentstream")
+}
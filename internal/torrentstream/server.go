@@ -2,6 +2,7 @@ package torrentstream
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/anacrolix/torrent"
@@ -70,13 +71,20 @@ func (s *serverManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.lastUsed = time.Now()
 	s.repository.logger.Trace().Msg("torrentstream: Stream endpoint hit [server]")
 
-	if s.repository.client.currentFile.IsAbsent() || s.repository.client.currentTorrent.IsAbsent() {
-		s.repository.logger.Error().Msg("torrentstream: No torrent to stream [server]")
+	// e.g. /api/v1/torrentstream/stream/{infohash}/{file path}
+	infoHash, displayPath, ok := parseStreamPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Invalid stream path", http.StatusBadRequest)
+		return
+	}
+
+	file, found := s.repository.client.findStreamFile(infoHash, displayPath)
+	if !found {
+		s.repository.logger.Error().Str("infoHash", infoHash).Msg("torrentstream: No torrent to stream [server]")
 		http.Error(w, "No torrent to stream", http.StatusNotFound)
 		return
 	}
 
-	file := s.repository.client.currentFile.MustGet()
 	tr := file.NewReader()
 	defer func(tr torrent.Reader) {
 		_ = tr.Close()
@@ -95,3 +103,16 @@ func (s *serverManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	)
 	s.repository.logger.Trace().Msg("torrentstream: File content served")
 }
+
+// parseStreamPath returns the info hash and the file path from the path of a stream URL.
+func parseStreamPath(p string) (infoHash string, displayPath string, ok bool) {
+	_, rest, found := strings.Cut(p, "/stream/")
+	if !found {
+		return "", "", false
+	}
+	infoHash, displayPath, found = strings.Cut(rest, "/")
+	if !found || infoHash == "" || displayPath == "" {
+		return "", "", false
+	}
+	return infoHash, displayPath, true
+}
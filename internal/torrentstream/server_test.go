@@ -0,0 +1,46 @@
+package torrentstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStreamPath(t *testing.T) {
+	tests := []struct {
+		path         string
+		expectedHash string
+		expectedPath string
+		expectedOk   bool
+	}{
+		{
+			path:         "/api/v1/torrentstream/stream/80431b4f9a12f4e06616062d3d3973b9ef99b5e6/[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/Bocchi the Rock! - 01.mkv",
+			expectedHash: "80431b4f9a12f4e06616062d3d3973b9ef99b5e6",
+			expectedPath: "[SubsPlease] Bocchi the Rock! (01-12) (1080p) [Batch]/Bocchi the Rock! - 01.mkv",
+			expectedOk:   true,
+		},
+		{
+			path:         "/stream/80431b4f9a12f4e06616062d3d3973b9ef99b5e6/Bocchi the Rock! - 01.mkv",
+			expectedHash: "80431b4f9a12f4e06616062d3d3973b9ef99b5e6",
+			expectedPath: "Bocchi the Rock! - 01.mkv",
+			expectedOk:   true,
+		},
+		{
+			path:       "/api/v1/torrentstream/stream/Bocchi the Rock! - 01.mkv",
+			expectedOk: false,
+		},
+		{
+			path:       "/api/v1/torrentstream/episodes/1",
+			expectedOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			hash, p, ok := parseStreamPath(tt.path)
+			assert.Equal(t, tt.expectedOk, ok)
+			assert.Equal(t, tt.expectedHash, hash)
+			assert.Equal(t, tt.expectedPath, p)
+		})
+	}
+}
@@ -3,14 +3,15 @@ package torrentstream
 import (
 	"fmt"
 	hibiketorrent "github.com/5rahim/hibike/pkg/extension/torrent"
-	"github.com/anacrolix/torrent"
-	"github.com/samber/mo"
+	"github.com/dustin/go-humanize"
 	"seanime/internal/api/anilist"
 	"seanime/internal/api/metadata"
+	"seanime/internal/database/models"
 	"seanime/internal/events"
 	"seanime/internal/library/playbackmanager"
 	"seanime/internal/util"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -33,7 +34,8 @@ type StartStreamOptions struct {
 	PlaybackType  PlaybackType
 }
 
-// StartStream is called by the client to start streaming a torrent
+// StartStream is called by the client to start streaming a torrent.
+// Each client can have one stream, starting a new one replaces the client's previous stream.
 func (r *Repository) StartStream(opts *StartStreamOptions) (err error) {
 	defer util.HandlePanicInModuleWithError("torrentstream/stream/StartStream", &err)
 	// DEVNOTE: Do not
@@ -44,7 +46,7 @@ func (r *Repository) StartStream(opts *StartStreamOptions) (err error) {
 		Any("playbackType", opts.PlaybackType).
 		Int("mediaId", opts.MediaId).Msgf("torrentstream: Starting stream for episode %s", opts.AniDBEpisode)
 
-	r.wsEventManager.SendEvent(eventTorrentLoading, nil)
+	r.sendStreamEvent(opts.ClientId, eventTorrentLoading, nil)
 
 	//
 	// Get the media info
@@ -57,40 +59,85 @@ func (r *Repository) StartStream(opts *StartStreamOptions) (err error) {
 	episodeNumber := opts.EpisodeNumber
 	aniDbEpisode := strconv.Itoa(episodeNumber)
 
+	//
+	// Play the episode from the cache if it was streamed before
+	//
+	if entry, found := r.getCachedEpisode(opts.MediaId, episodeNumber); found {
+		if opts.AutoSelect || (opts.Torrent != nil && strings.EqualFold(opts.Torrent.InfoHash, entry.InfoHash)) {
+			r.startCachedStream(opts, media, aniDbEpisode, entry)
+			return nil
+		}
+	}
+
+	//
+	// Use the prefetched episode, or replace the previous stream of the client and drop the torrents that are no longer used
+	// The previous stream is kept until the new one is set if the next episode was prefetched
+	//
+	r.client.mu.Lock()
+	prefetched, isPrefetched := r.takePrefetchedEpisode(opts)
+	if !isPrefetched {
+		r.client.removeStream(opts.ClientId, false)
+		r.client.dropIdleTorrents()
+	}
+	r.client.loadingCount++
+	r.client.mu.Unlock()
+	defer func() {
+		r.client.mu.Lock()
+		r.client.loadingCount--
+		r.client.mu.Unlock()
+	}()
+
 	//
 	// Find the best torrent / Select the torrent
 	//
 	var torrentToStream *playbackTorrent
-	switch opts.AutoSelect {
-	case true:
-		torrentToStream, err = r.findBestTorrent(media, aniDbEpisode, episodeNumber)
+	switch {
+	case isPrefetched:
+		torrentToStream = prefetched
+	case opts.AutoSelect:
+		torrentToStream, err = r.findBestTorrent(media, aniDbEpisode, episodeNumber, findBestTorrentOptions{ClientId: opts.ClientId})
 		if err != nil {
-			r.wsEventManager.SendEvent(eventTorrentLoadingFailed, nil)
+			r.sendStreamEvent(opts.ClientId, eventTorrentLoadingFailed, nil)
 			return err
 		}
-	case false:
+	default:
 		if opts.Torrent == nil {
 			return fmt.Errorf("torrentstream: No torrent provided")
 		}
 		torrentToStream, err = r.findBestTorrentFromManualSelection(opts.Torrent, media, aniDbEpisode, opts.FileIndex)
 		if err != nil {
-			r.wsEventManager.SendEvent(eventTorrentLoadingFailed, nil)
+			r.sendStreamEvent(opts.ClientId, eventTorrentLoadingFailed, nil)
 			return err
 		}
 	}
 
 	if torrentToStream == nil {
-		r.wsEventManager.SendEvent(eventTorrentLoadingFailed, nil)
+		r.sendStreamEvent(opts.ClientId, eventTorrentLoadingFailed, nil)
 		return fmt.Errorf("torrentstream: No torrent selected")
 	}
 
 	//
-	// Set current file & torrent
+	// Set the client's stream
 	//
-	r.client.currentFile = mo.Some(torrentToStream.File)
-	r.client.currentTorrent = mo.Some(torrentToStream.Torrent)
+	r.client.mu.Lock()
+	if opts.PlaybackType == PlaybackTypeDefault {
+		// The media player can only play one stream, stop the stream it was playing
+		if s, found := r.client.getMediaPlayerStream(); found && s.clientId != opts.ClientId {
+			r.client.removeStream(s.clientId, false)
+			r.sendStreamEvent(s.clientId, eventTorrentStopped, nil)
+		}
+	}
+	r.client.setStream(&clientStream{
+		clientId:      opts.ClientId,
+		mediaId:       opts.MediaId,
+		episodeNumber: opts.EpisodeNumber,
+		playbackType:  opts.PlaybackType,
+		torrent:       torrentToStream.Torrent,
+		file:          torrentToStream.File,
+	})
+	r.client.mu.Unlock()
 
-	r.sendTorrentLoadingStatus(TLSStateStartingServer, "")
+	r.sendTorrentLoadingStatus(opts.ClientId, TLSStateStartingServer, "")
 
 	settings, ok := r.settings.Get()
 	if ok && settings.UseSeparateServer {
@@ -100,134 +147,208 @@ func (r *Repository) StartStream(opts *StartStreamOptions) (err error) {
 		r.serverManager.startServer()
 	}
 
-	r.sendTorrentLoadingStatus(TLSStateSendingStreamToMediaPlayer, "")
+	r.sendTorrentLoadingStatus(opts.ClientId, TLSStateSendingStreamToMediaPlayer, "")
 
 	go func() {
 		// Add the torrent to the history if it is a batch & manually selected
-		if len(r.client.currentTorrent.MustGet().Files()) > 1 && opts.Torrent != nil {
+		if len(torrentToStream.Torrent.Files()) > 1 && opts.Torrent != nil {
 			r.AddBatchHistory(opts.MediaId, opts.Torrent) // ran in goroutine
 		}
 
 		for {
 			// This is to make sure the client is ready to stream before we start the stream
-			if r.client.readyToStream() {
+			if r.client.readyToStream(opts.ClientId) {
 				break
 			}
 			// If for some reason the torrent is dropped, we kill the goroutine
-			if r.client.torrentClient.IsAbsent() || r.client.currentTorrent.IsAbsent() {
+			if r.client.torrentClient.IsAbsent() || !r.client.hasStream(opts.ClientId, torrentToStream.File) {
 				return
 			}
-			r.logger.Debug().Msg("torrentstream: Waiting for playable threshold to be reached")
+			r.logger.Debug().Str("clientId", opts.ClientId).Msg("torrentstream: Waiting for playable threshold to be reached")
 			time.Sleep(3 * time.Second) // Wait for 3 secs before checking again
 		}
 
-		switch opts.PlaybackType {
-		case PlaybackTypeDefault:
-			//
-			// Start the stream
-			//
-			r.logger.Debug().Msg("torrentstream: Starting the media player")
-			err = r.playbackManager.StartStreamingUsingMediaPlayer("", &playbackmanager.StartPlayingOptions{
-				Payload:   r.client.GetStreamingUrl(),
-				UserAgent: opts.UserAgent,
-				ClientId:  opts.ClientId,
-			}, media.ToBaseAnime(), aniDbEpisode)
-			if err != nil {
-				// Failed to start the stream, we'll drop the torrents and stop the server
-				r.wsEventManager.SendEvent(eventTorrentLoadingFailed, nil)
-				_ = r.StopStream()
-				r.logger.Error().Err(err).Msg("torrentstream: Failed to start the stream")
-			}
-
-		case PlaybackTypeExternalPlayer:
-			// Send the external player link
-			r.wsEventManager.SendEventTo(opts.ClientId, events.ExternalPlayerOpenURL, struct {
-				Url           string `json:"url"`
-				MediaId       int    `json:"mediaId"`
-				EpisodeNumber int    `json:"episodeNumber"`
-			}{
-				Url:           r.client.GetStreamingUrl(),
-				MediaId:       opts.MediaId,
-				EpisodeNumber: opts.EpisodeNumber,
-			})
-
-			// Signal to the client that the torrent has started playing (remove loading status)
-			// We can't know for sure
-			r.wsEventManager.SendEvent(eventTorrentStartedPlaying, nil)
-		}
+		r.playStream(opts, media, aniDbEpisode, r.client.GetStreamingUrl(opts.ClientId))
 	}()
 
-	r.wsEventManager.SendEvent(eventTorrentLoaded, nil)
-	r.logger.Info().Msg("torrentstream: Stream started")
+	r.sendStreamEvent(opts.ClientId, eventTorrentLoaded, nil)
+	r.logger.Info().Str("clientId", opts.ClientId).Msg("torrentstream: Stream started")
 
 	return nil
 }
 
-func (r *Repository) StopStream() error {
+// startCachedStream plays a cached episode from disk, the previous stream of the client is stopped.
+func (r *Repository) startCachedStream(opts *StartStreamOptions, media *anilist.CompleteAnime, aniDbEpisode string, entry *models.TorrentstreamCacheEntry) {
+	r.logger.Info().Str("clientId", opts.ClientId).Str("path", entry.Path).Msg("torrentstream: Playing cached episode")
+
+	r.client.mu.Lock()
+	if opts.PlaybackType == PlaybackTypeDefault {
+		// The media player can only play one stream, stop the stream it was playing
+		if s, found := r.client.getMediaPlayerStream(); found && s.clientId != opts.ClientId {
+			r.client.removeStream(s.clientId, false)
+			r.sendStreamEvent(s.clientId, eventTorrentStopped, nil)
+		}
+	}
+	// The stream has no torrent, it's registered so that it can be listed and stopped like the others
+	r.client.setStream(&clientStream{
+		clientId:      opts.ClientId,
+		mediaId:       opts.MediaId,
+		episodeNumber: opts.EpisodeNumber,
+		playbackType:  opts.PlaybackType,
+		cacheEntry:    entry,
+		cached:        true,
+		status:        TorrentStatus{ProgressPercentage: 100, Size: humanize.Bytes(uint64(entry.Size))},
+	})
+	r.client.mu.Unlock()
+
+	r.sendTorrentLoadingStatus(opts.ClientId, TLSStateSendingStreamToMediaPlayer, "")
+	r.sendStreamEvent(opts.ClientId, eventTorrentLoaded, nil)
+
+	go r.playStream(opts, media, aniDbEpisode, r.getCacheStreamingUrl(entry))
+}
+
+// playStream sends the stream to the media player or to the client's external player.
+func (r *Repository) playStream(opts *StartStreamOptions, media *anilist.CompleteAnime, aniDbEpisode string, streamUrl string) {
+	switch opts.PlaybackType {
+	case PlaybackTypeDefault:
+		//
+		// Start the stream
+		//
+		r.logger.Debug().Msg("torrentstream: Starting the media player")
+		err := r.playbackManager.StartStreamingUsingMediaPlayer("", &playbackmanager.StartPlayingOptions{
+			Payload:   streamUrl,
+			UserAgent: opts.UserAgent,
+			ClientId:  opts.ClientId,
+		}, media.ToBaseAnime(), aniDbEpisode)
+		if err != nil {
+			// Failed to start the stream, we'll drop the torrent and stop the server
+			r.sendStreamEvent(opts.ClientId, eventTorrentLoadingFailed, nil)
+			r.stopClientStream(opts.ClientId)
+			r.logger.Error().Err(err).Msg("torrentstream: Failed to start the stream")
+		}
+
+	case PlaybackTypeExternalPlayer:
+		// Send the external player link
+		r.wsEventManager.SendEventTo(opts.ClientId, events.ExternalPlayerOpenURL, struct {
+			Url           string `json:"url"`
+			MediaId       int    `json:"mediaId"`
+			EpisodeNumber int    `json:"episodeNumber"`
+		}{
+			Url:           streamUrl,
+			MediaId:       opts.MediaId,
+			EpisodeNumber: opts.EpisodeNumber,
+		})
+
+		// Signal to the client that the torrent has started playing (remove loading status)
+		// We can't know for sure
+		r.sendStreamEvent(opts.ClientId, eventTorrentStartedPlaying, nil)
+	}
+}
+
+// GetStreams returns the running streams.
+func (r *Repository) GetStreams() []*StreamInfo {
+	return r.client.getStreams()
+}
+
+// StopStream stops the stream of the client and drops its torrent if it's below a threshold.
+// If the client ID is empty, all streams are stopped.
+func (r *Repository) StopStream(clientId string) error {
 	defer func() {
 		if r := recover(); r != nil {
 		}
 	}()
-	r.logger.Info().Msg("torrentstream: Stopping stream")
 
-	// Stop the client
-	// This will stop the stream and close the server
-	// This also sends the eventTorrentStopped event
+	if clientId != "" {
+		r.stopClientStream(clientId)
+		return nil
+	}
+
+	r.logger.Info().Msg("torrentstream: Stopping all streams")
+
 	r.client.mu.Lock()
-	//r.client.stopCh = make(chan struct{})
-	r.client.repository.logger.Debug().Msg("torrentstream: Handling media player stopped event")
-	// This is to prevent the client from downloading the whole torrent when the user stops watching
-	// Also, the torrent might be a batch - so we don't want to download the whole thing
-	if r.client.currentTorrent.IsPresent() {
-		if r.client.currentTorrentStatus.ProgressPercentage < 70 {
-			r.client.repository.logger.Debug().Msg("torrentstream: Dropping torrent, completion is less than 70%")
-			r.client.dropTorrents()
-		}
-		r.client.repository.logger.Debug().Msg("torrentstream: Resetting current torrent and status")
+	for id := range r.client.streams {
+		r.client.removeStream(id, false)
+		r.sendStreamEvent(id, eventTorrentStopped, nil)
 	}
-	r.client.currentTorrent = mo.None[*torrent.Torrent]() // Reset the current torrent
-	r.client.currentFile = mo.None[*torrent.File]()       // Reset the current file
-	r.client.currentTorrentStatus = TorrentStatus{}       // Reset the torrent status
-	settings, ok := r.client.repository.settings.Get()
+	r.client.mu.Unlock()
+
+	settings, ok := r.settings.Get()
 	if ok && settings.UseSeparateServer {
-		r.client.repository.serverManager.stopServer() // Stop the server
+		r.serverManager.stopServer() // Stop the server
 	}
-	r.client.repository.wsEventManager.SendEvent(eventTorrentStopped, nil) // Send torrent stopped event
-	r.client.repository.mediaPlayerRepository.Stop()                       // Stop the media player gracefully if it's running
-	r.client.mu.Unlock()
+	r.sendStreamEvent("", eventTorrentStopped, nil) // Send torrent stopped event
+	r.mediaPlayerRepository.Stop()                  // Stop the media player gracefully if it's running
 
-	r.logger.Info().Msg("torrentstream: Stream stopped")
+	r.logger.Info().Msg("torrentstream: Streams stopped")
 
 	return nil
 }
 
-//func (r *Repository) StopStream() error {
-//	defer func() {
-//		if r := recover(); r != nil {
-//		}
-//	}()
-//	r.logger.Info().Msg("torrentstream: Stopping stream")
-//
-//	// Stop the client
-//	// This will stop the stream and close the server
-//	// This also sends the eventTorrentStopped event
-//	close(r.client.stopCh)
-//
-//	r.logger.Info().Msg("torrentstream: Stream stopped")
-//
-//	return nil
-//}
-
-func (r *Repository) DropTorrent() error {
-	r.logger.Info().Msg("torrentstream: Dropping last torrent")
+// stopClientStream stops the stream of the client.
+// The media player is stopped if it was playing the stream.
+func (r *Repository) stopClientStream(clientId string) {
+	r.logger.Info().Str("clientId", clientId).Msg("torrentstream: Stopping stream")
+
+	r.client.mu.Lock()
+	isMediaPlayerStream := r.client.isMediaPlayerStream(clientId)
+	_, found := r.client.removeStream(clientId, false)
+	streamCount := len(r.client.streams)
+	r.client.mu.Unlock()
+
+	if !found {
+		return
+	}
+
+	settings, ok := r.settings.Get()
+	if ok && settings.UseSeparateServer && streamCount == 0 {
+		r.serverManager.stopServer() // Stop the server
+	}
+	r.sendStreamEvent(clientId, eventTorrentStopped, nil) // Send torrent stopped event
+	if isMediaPlayerStream {
+		r.mediaPlayerRepository.Stop() // Stop the media player gracefully if it's running
+	}
 
+	r.logger.Info().Str("clientId", clientId).Msg("torrentstream: Stream stopped")
+}
+
+// DropTorrent stops the stream of the client and drops its torrent completely.
+// If the client ID is empty, all streams are stopped and all torrents are dropped.
+func (r *Repository) DropTorrent(clientId string) error {
 	if r.client.torrentClient.IsAbsent() {
 		return nil
 	}
 
+	if clientId != "" {
+		r.logger.Info().Str("clientId", clientId).Msg("torrentstream: Dropping torrent")
+
+		r.client.mu.Lock()
+		isMediaPlayerStream := r.client.isMediaPlayerStream(clientId)
+		// Drop the torrent regardless of its completion, unless another stream uses it
+		_, found := r.client.removeStream(clientId, true)
+		r.client.mu.Unlock()
+
+		if found {
+			r.sendStreamEvent(clientId, eventTorrentStopped, nil)
+		}
+		if isMediaPlayerStream {
+			r.mediaPlayerRepository.Stop()
+		}
+
+		r.logger.Info().Str("clientId", clientId).Msg("torrentstream: Dropped torrent")
+		return nil
+	}
+
+	r.logger.Info().Msg("torrentstream: Dropping all torrents")
+
+	r.client.mu.Lock()
+	for id := range r.client.streams {
+		r.client.removeStream(id, true)
+		r.sendStreamEvent(id, eventTorrentStopped, nil)
+	}
 	for _, t := range r.client.torrentClient.MustGet().Torrents() {
 		t.Drop()
 	}
+	r.client.mu.Unlock()
 
 	// Also stop the server, since it's dropped
 	settings, ok := r.settings.Get()
@@ -236,7 +357,7 @@ func (r *Repository) DropTorrent() error {
 	}
 	r.mediaPlayerRepository.Stop()
 
-	r.logger.Info().Msg("torrentstream: Dropped last torrent")
+	r.logger.Info().Msg("torrentstream: Dropped all torrents")
 
 	return nil
 }
@@ -1 +1,15 @@
 package torrentstream
+
+import (
+	"github.com/anacrolix/torrent"
+)
+
+// prioritizeFileStart sets the priority of the pieces representing the first 5% of the file.
+func prioritizeFileStart(t *torrent.Torrent, f *torrent.File, prio torrent.PiecePriority) {
+	firstPieceIdx := f.Offset() * int64(t.NumPieces()) / t.Length()
+	endPieceIdx := (f.Offset() + f.Length()) * int64(t.NumPieces()) / t.Length()
+	numPiecesForFivePercent := (endPieceIdx - firstPieceIdx + 1) * 5 / 100
+	for idx := firstPieceIdx; idx <= firstPieceIdx+numPiecesForFivePercent && idx < int64(t.NumPieces()); idx++ {
+		t.Piece(int(idx)).SetPriority(prio)
+	}
+}
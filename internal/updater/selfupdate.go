@@ -5,7 +5,6 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
 	"github.com/samber/mo"
-	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -177,7 +176,7 @@ func (su *SelfUpdater) Run() error {
 	// LICENSE + /backup_restore_if_failed/LICENSE
 	for _, file := range files {
 		// We don't check for errors here because we don't want to stop the update process if LICENSE is not found for example
-		_ = copyFile(filepath.Join(exeDir, file), filepath.Join(backupDir, file))
+		_ = util.CopyFile(filepath.Join(exeDir, file), filepath.Join(backupDir, file))
 	}
 
 	su.logger.Info().Msg("selfupdate: Renaming assets")
@@ -295,29 +294,6 @@ func moveContents(newReleaseDir, exeDir string) error {
 	return copyDir(newReleaseDir, exeDir)
 }
 
-// copyFile copies a single file from src to dst
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer sourceFile.Close()
-
-	// Create destination directory if it does not exist
-	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
-		return err
-	}
-
-	destinationFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destinationFile.Close()
-
-	_, err = io.Copy(destinationFile, sourceFile)
-	return err
-}
-
 // copyDir recursively copies a directory tree, attempting to preserve permissions.
 func copyDir(src string, dst string) error {
 	src = filepath.Clean(src)
@@ -346,7 +322,7 @@ func copyDir(src string, dst string) error {
 				return err
 			}
 		} else {
-			if err := copyFile(srcPath, dstPath); err != nil {
+			if err := util.CopyFile(srcPath, dstPath); err != nil {
 				return err
 			}
 		}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"slices"
 	"time"
 )
 
@@ -9,3 +10,43 @@ func TimestampToDateStr(timestamp int64) string {
 	tm := time.Unix(timestamp, 0)
 	return fmt.Sprintf("%v", tm)
 }
+
+// ParseTimeOfDay returns the number of minutes since midnight of a "HH:MM" time.
+func ParseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// IsInTimeWindow returns true if the time is within the "HH:MM" window, on one of the days (0 is Sunday).
+// Every day is included if no day is given, and a window that starts when it ends is the whole day.
+// A window that ends before it starts spans midnight, it belongs to the day it starts on.
+func IsInTimeWindow(startTime string, endTime string, days []int, now time.Time) bool {
+	start, err := ParseTimeOfDay(startTime)
+	if err != nil {
+		return false
+	}
+	end, err := ParseTimeOfDay(endTime)
+	if err != nil {
+		return false
+	}
+
+	minutes := now.Hour()*60 + now.Minute()
+	today := int(now.Weekday())
+	yesterday := (today + 6) % 7
+
+	isDay := func(day int) bool {
+		return len(days) == 0 || slices.Contains(days, day)
+	}
+
+	switch {
+	case start == end: // Whole day
+		return isDay(today)
+	case start < end:
+		return isDay(today) && minutes >= start && minutes < end
+	default: // Spans midnight
+		return (isDay(today) && minutes >= start) || (isDay(yesterday) && minutes < end)
+	}
+}
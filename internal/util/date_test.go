@@ -0,0 +1,32 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsInTimeWindow(t *testing.T) {
+	// 2024-01-01 is a Monday
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local)
+	}
+
+	assert.True(t, IsInTimeWindow("09:00", "17:00", nil, at(1, 9, 0)))
+	assert.False(t, IsInTimeWindow("09:00", "17:00", nil, at(1, 17, 0)))
+	assert.True(t, IsInTimeWindow("00:00", "00:00", nil, at(1, 12, 0)))
+
+	// Spans midnight
+	assert.True(t, IsInTimeWindow("23:00", "07:00", nil, at(1, 23, 30)))
+	assert.True(t, IsInTimeWindow("23:00", "07:00", nil, at(2, 6, 59)))
+	assert.False(t, IsInTimeWindow("23:00", "07:00", nil, at(1, 12, 0)))
+
+	// The window belongs to the day it starts on
+	assert.True(t, IsInTimeWindow("23:00", "07:00", []int{1}, at(2, 6, 0)))
+	assert.False(t, IsInTimeWindow("23:00", "07:00", []int{1}, at(2, 23, 30)))
+	assert.False(t, IsInTimeWindow("09:00", "17:00", []int{0, 6}, at(1, 12, 0)))
+
+	assert.False(t, IsInTimeWindow("invalid", "07:00", nil, at(1, 6, 0)))
+	assert.False(t, IsInTimeWindow("", "", nil, at(1, 6, 0)))
+}
@@ -378,22 +378,27 @@ func (c *Cacher) RemoveAllBy(filter func(filename string) bool) error {
 	return err
 }
 
+// mediastreamVideoFilesDirs are the directories of the mediastream video file caches.
+// "videofiles" holds the extracted attachments, "segments" holds the transcoded segments kept across sessions.
+var mediastreamVideoFilesDirs = []string{"videofiles", "segments"}
+
 // ClearMediastreamVideoFiles clears all mediastream video file caches.
 func (c *Cacher) ClearMediastreamVideoFiles() error {
 	c.mu.Lock()
 
-	// Remove the contents of the directory
-	files, err := os.ReadDir(filepath.Join(c.dir, "videofiles"))
-	if err != nil {
-		c.mu.Unlock()
-		return nil
-	}
-	for _, file := range files {
-		_ = os.RemoveAll(filepath.Join(c.dir, "videofiles", file.Name()))
+	// Remove the contents of the directories
+	for _, dir := range mediastreamVideoFilesDirs {
+		files, err := os.ReadDir(filepath.Join(c.dir, dir))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			_ = os.RemoveAll(filepath.Join(c.dir, dir, file.Name()))
+		}
 	}
 	c.mu.Unlock()
 
-	err = c.RemoveAllBy(func(filename string) bool {
+	err := c.RemoveAllBy(func(filename string) bool {
 		return strings.HasPrefix(filename, "mediastream")
 	})
 
@@ -429,26 +434,28 @@ func (c *Cacher) GetMediastreamVideoFilesTotalSize() (int64, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	_, err := os.Stat(filepath.Join(c.dir, "videofiles"))
-	if err != nil {
-		if os.IsNotExist(err) {
-			return 0, nil
-		}
-		return 0, err
-	}
-
 	var totalSize int64
-	err = filepath.Walk(filepath.Join(c.dir, "videofiles"), func(_ string, info os.FileInfo, err error) error {
+	for _, dir := range mediastreamVideoFilesDirs {
+		_, err := os.Stat(filepath.Join(c.dir, dir))
 		if err != nil {
-			return err
+			if os.IsNotExist(err) {
+				continue
+			}
+			return 0, err
 		}
-		if !info.IsDir() {
-			totalSize += info.Size()
+
+		err = filepath.Walk(filepath.Join(c.dir, dir), func(_ string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				totalSize += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("filecache: failed to walk the cache directory: %w", err)
 		}
-		return nil
-	})
-	if err != nil {
-		return 0, fmt.Errorf("filecache: failed to walk the cache directory: %w", err)
 	}
 
 	return totalSize, nil
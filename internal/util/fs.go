@@ -1,6 +1,7 @@
 package util
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -38,6 +39,32 @@ func IsValidVideoExtension(ext string) bool {
 	return exists
 }
 
+// IsValidSubtitleExtension returns true if the extension is a subtitle format that can be shipped next to a video.
+func IsValidSubtitleExtension(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".ass", ".ssa", ".srt", ".vtt":
+		return true
+	}
+	return false
+}
+
+func IsValidFontExtension(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".ttf", ".otf", ".ttc", ".woff", ".woff2":
+		return true
+	}
+	return false
+}
+
+// IsFontDir returns true if the directory name is one used by releases to ship the fonts of their subtitles.
+func IsFontDir(name string) bool {
+	switch strings.ToLower(name) {
+	case "fonts", "font", "attachments":
+		return true
+	}
+	return false
+}
+
 func IsSubdirectory(parent, child string) bool {
 	rel, err := filepath.Rel(parent, child)
 	if err != nil {
@@ -71,3 +98,58 @@ func IsSameDir(dir1, dir2 string) bool {
 	}
 	return absDir1 == absDir2
 }
+
+// CopyFile copies a file, creating the destination directory if it doesn't exist.
+// The destination is removed if the copy fails.
+func CopyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// MoveFile moves a file, copying it if it's on another device.
+func MoveFile(src string, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := CopyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// SanitizePathSegment removes the characters that are not allowed in file names.
+func SanitizePathSegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '<', '>', ':', '"', '/', '\\', '|', '?', '*':
+			return -1
+		}
+		if r < 32 {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimRight(strings.TrimSpace(s), ". ")
+}
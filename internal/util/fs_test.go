@@ -2,6 +2,8 @@ package util
 
 import (
 	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -67,3 +69,31 @@ func TestSameDir(t *testing.T) {
 		})
 	}
 }
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mkv")
+	dst := filepath.Join(dir, "sub", "dst.mkv")
+	require.NoError(t, os.WriteFile(src, []byte("data"), 0644))
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(dst), 0755))
+	require.NoError(t, MoveFile(src, dst))
+
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "data", string(data))
+	_, err = os.Stat(src)
+	require.True(t, os.IsNotExist(err))
+
+	// The destination directory is created when copying
+	copied := filepath.Join(dir, "copy", "dst.mkv")
+	require.NoError(t, CopyFile(dst, copied))
+	_, err = os.Stat(copied)
+	require.NoError(t, err)
+}
+
+func TestSanitizePathSegment(t *testing.T) {
+	require.Equal(t, "Oshi no Ko Season 2", SanitizePathSegment("Oshi no Ko: Season 2"))
+	require.Equal(t, "Title", SanitizePathSegment(" Title... "))
+	require.Equal(t, "AB", SanitizePathSegment("A/B?"))
+}